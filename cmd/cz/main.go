@@ -0,0 +1,52 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Synth
+
+Play the CZ phase distortion preset voices.
+MIDI program changes select the voice.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"os/signal"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/cz"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+func main() {
+
+	s := core.NewSynth()
+
+	// create the cz patch
+	p := cz.NewPatch(s, 0, cz.Presets)
+
+	// set the root patch for the synth
+	s.SetPatch(p)
+
+	// start the jack client
+	err := s.StartJack("babi")
+	if err != nil {
+		log.Error.Printf("%s", err)
+		s.Close()
+		os.Exit(1)
+	}
+
+	// signal handling
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
+
+	s.Close()
+	os.Exit(0)
+}
+
+//-----------------------------------------------------------------------------
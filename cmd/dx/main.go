@@ -0,0 +1,75 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Synth
+
+Play a bank of DX7 voices (a .syx file).
+MIDI program changes select the voice.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/dx"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+func main() {
+
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <bank.syx>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	// load the voice bank
+	buf, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		log.Error.Printf("%s", err)
+		os.Exit(1)
+	}
+	voices, _, err := dx.DecodeSysex(buf)
+	if err != nil {
+		log.Error.Printf("%s: %s", os.Args[1], err)
+		os.Exit(1)
+	}
+	if len(voices) == 0 {
+		log.Error.Printf("%s: no voices", os.Args[1])
+		os.Exit(1)
+	}
+
+	s := core.NewSynth()
+
+	// create the dx patch
+	p := dx.NewPatch(s, 0, voices)
+
+	// set the root patch for the synth
+	s.SetPatch(p)
+
+	// start the jack client
+	err = s.StartJack("babi")
+	if err != nil {
+		log.Error.Printf("%s", err)
+		s.Close()
+		os.Exit(1)
+	}
+
+	// signal handling
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
+
+	s.Close()
+	os.Exit(0)
+}
+
+//-----------------------------------------------------------------------------
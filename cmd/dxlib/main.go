@@ -0,0 +1,240 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Voice Librarian
+
+List, extract, replace and merge DX7 voices.
+Convert voice banks between sysex (.syx) and JSON (.json) files.
+
+Voices are numbered 1..32. A file with a single voice is written as a single
+voice sysex message, otherwise voices are written as a 32 voice bank.
+
+*/
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/deadsy/babi/module/dx"
+)
+
+//-----------------------------------------------------------------------------
+
+const usage = `usage: dxlib <command> [args]
+
+commands:
+  list <file>                       list the voice names
+  show <file> [n]                   show the voices (or voice n) as text
+  extract <file> <n> <out>          write voice n to a file
+  replace <file> <n> <voice> <out>  replace voice n with the first voice of another file
+  merge <out> <file>...             merge the voices of files into a bank
+  convert <in> <out>                convert between .syx and .json files
+`
+
+//-----------------------------------------------------------------------------
+
+// isJSON returns true if the file is a JSON file.
+func isJSON(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
+
+// load returns the voices from a sysex or JSON file.
+func load(path string) ([]*dx.Voice, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isJSON(path) {
+		v, err := dx.DecodeJSON(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return v, nil
+	}
+	// a sysex file may have more than one message
+	var voices []*dx.Voice
+	for len(buf) != 0 {
+		v, n, err := dx.DecodeSysex(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		voices = append(voices, v...)
+		buf = buf[n:]
+	}
+	return voices, nil
+}
+
+// save writes voices to a sysex or JSON file.
+func save(path string, voices []*dx.Voice) error {
+	var buf []byte
+	var err error
+	if isJSON(path) {
+		buf, err = dx.EncodeJSON(voices)
+	} else if len(voices) == 1 {
+		buf = dx.EncodeVoice(voices[0])
+	} else {
+		buf, err = dx.EncodeBank(voices)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// voiceNumber returns the voice index for a voice number (1..n).
+func voiceNumber(s string, n int) (int, error) {
+	x, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad voice number: %s", s)
+	}
+	if x < 1 || x > n {
+		return 0, fmt.Errorf("voice number is out of range (1..%d): %d", n, x)
+	}
+	return x - 1, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func list(args []string) error {
+	if len(args) != 1 {
+		return errors.New("list: bad arguments")
+	}
+	voices, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	for i, v := range voices {
+		fmt.Printf("%2d %s\n", i+1, v.Name())
+	}
+	return nil
+}
+
+func show(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("show: bad arguments")
+	}
+	voices, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		i, err := voiceNumber(args[1], len(voices))
+		if err != nil {
+			return err
+		}
+		voices = voices[i : i+1]
+	}
+	for _, v := range voices {
+		fmt.Printf("%s\n\n", v)
+	}
+	return nil
+}
+
+func extract(args []string) error {
+	if len(args) != 3 {
+		return errors.New("extract: bad arguments")
+	}
+	voices, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	i, err := voiceNumber(args[1], len(voices))
+	if err != nil {
+		return err
+	}
+	return save(args[2], voices[i:i+1])
+}
+
+func replace(args []string) error {
+	if len(args) != 4 {
+		return errors.New("replace: bad arguments")
+	}
+	voices, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	i, err := voiceNumber(args[1], len(voices))
+	if err != nil {
+		return err
+	}
+	v, err := load(args[2])
+	if err != nil {
+		return err
+	}
+	if len(v) == 0 {
+		return fmt.Errorf("%s: no voices", args[2])
+	}
+	voices[i] = v[0]
+	return save(args[3], voices)
+}
+
+func merge(args []string) error {
+	if len(args) < 2 {
+		return errors.New("merge: bad arguments")
+	}
+	var voices []*dx.Voice
+	for _, path := range args[1:] {
+		v, err := load(path)
+		if err != nil {
+			return err
+		}
+		voices = append(voices, v...)
+	}
+	if len(voices) > dx.BankSize {
+		fmt.Fprintf(os.Stderr, "merge: %d voices, keeping the first %d\n", len(voices), dx.BankSize)
+		voices = voices[:dx.BankSize]
+	}
+	return save(args[0], voices)
+}
+
+func convert(args []string) error {
+	if len(args) != 2 {
+		return errors.New("convert: bad arguments")
+	}
+	voices, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	return save(args[1], voices)
+}
+
+//-----------------------------------------------------------------------------
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	cmds := map[string]func([]string) error{
+		"list":    list,
+		"show":    show,
+		"extract": extract,
+		"replace": replace,
+		"merge":   merge,
+		"convert": convert,
+	}
+
+	cmd, ok := cmds[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	err := cmd(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+//-----------------------------------------------------------------------------
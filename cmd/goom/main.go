@@ -5,28 +5,78 @@ Goom Synth
 
 Inspired by: https://www.quinapalus.com/goom.html
 
+Usage: goom [-learn bindings.json] [profile.json]
+
+With -learn, control numbers typed on stdin arm MIDI learn for a goom
+control. The learned bindings are saved to the bindings file on exit.
+
 */
 //-----------------------------------------------------------------------------
 
 package main
 
 import (
+	"bufio"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 
 	"github.com/deadsy/babi/core"
 	"github.com/deadsy/babi/module/goom"
+	"github.com/deadsy/babi/module/midi"
 	"github.com/deadsy/babi/utils/log"
 )
 
 //-----------------------------------------------------------------------------
 
+// learn reads control numbers from stdin and arms them for MIDI learn.
+func learn(s *core.Synth, p core.Module) {
+	fmt.Printf("MIDI learn: enter a control number, then move a knob\n")
+	for i, name := range goom.LearnControls {
+		fmt.Printf("%2d %s\n", i, name)
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		idx, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			fmt.Printf("bad control number\n")
+			continue
+		}
+		s.PushEvent(p, "learn", core.NewEventInt(idx))
+	}
+}
+
+//-----------------------------------------------------------------------------
+
 func main() {
 
+	bindingsFile := flag.String("learn", "", "MIDI learn bindings file (.json), enables MIDI learn from stdin")
+	flag.Parse()
+
+	// optional controller profile
+	var profile *midi.Profile
+	if flag.NArg() > 0 {
+		var err error
+		profile, err = midi.LoadProfile(flag.Arg(0))
+		if err != nil {
+			log.Error.Printf("%s", err)
+			os.Exit(1)
+		}
+	}
+
 	s := core.NewSynth()
 
+	// Pick the MIDI processing
+	var chain []core.Module
+	//chain = append(chain, midi.NewQuantizer(s, 0, nil))
+	//chain = append(chain, midi.NewChord(s, 0, nil))
+	//chain = append(chain, midi.NewArp(s, 0))
+
 	// create the goom patch
-	p := goom.NewPatch(s, 0)
+	p := goom.NewPatch(s, 0, profile, *bindingsFile, chain...)
 
 	// set the root patch for the synth
 	s.SetPatch(p)
@@ -39,6 +89,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// MIDI learn from the command line
+	if *bindingsFile != "" {
+		go learn(s, p)
+	}
+
 	// signal handling
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt)
@@ -12,19 +12,14 @@ package app
 
 import (
 	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
 	"github.com/deadsy/babi/module/osc"
 	"github.com/deadsy/babi/utils/log"
 )
 
 //-----------------------------------------------------------------------------
 
-const nControls = 8 // cc controls per mode
-
-const midiModModeNote = 45  // note for modulation mode (am/fm/pm)
-const midiLfoShapeNote = 46 // note for LFO wave shape
-const midiCCModeNote = 47   // note for CC mode
-
-// 1..8
+// internal CC numbers for the app controls
 const midiWaveDutyCC = 1           // wave oscillator duty cycle
 const midiWaveSlopeCC = 2          // wave oscillator duty slope
 const midiPanCC = 3                // pan left/right
@@ -33,14 +28,50 @@ const midiAmpAttackCC = 5          // amplitude attack
 const midiAmpDecayCC = 6           // amplitude decay
 const midiAmpSustainCC = 7         // amplitude sustain
 const midiAmpReleaseCC = 8         // amplitude release
+const midiLfoRateCC = 9            // lfo rate
+const midiLfoDepthCC = 10          // lfo depth
+const midiLfoShapeCC = 25          // lfo shape
+const midiModModeCC = 26           // modulation mode (am/fm/pm)
+
+// appControls maps profile control names to internal CC numbers.
+var appControls = map[string]uint8{
+	"wav_duty":    midiWaveDutyCC,
+	"wav_slope":   midiWaveSlopeCC,
+	"pan":         midiPanCC,
+	"vol":         midiPanVolCC,
+	"amp_attack":  midiAmpAttackCC,
+	"amp_decay":   midiAmpDecayCC,
+	"amp_sustain": midiAmpSustainCC,
+	"amp_release": midiAmpReleaseCC,
+	"lfo_rate":    midiLfoRateCC,
+	"lfo_depth":   midiLfoDepthCC,
+	"lfo_shape":   midiLfoShapeCC,
+	"mod_mode":    midiModModeCC,
+}
 
-// 9..16
-const midiLfoRateCC = 9   // lfo rate
-const midiLfoDepthCC = 10 // lfo depth
-
-// and keys turned into CCs
-const midiLfoShapeCC = 25 // lfo shape
-const midiModModeCC = 26  // modulation mode (am/fm/pm)
+// defaultProfile is the controller profile for an AKAI MPKmini.
+const defaultProfile = `{
+  "name": "AKAI MPKmini",
+  "knobs": [1, 2, 3, 4, 5, 6, 7, 8],
+  "pages": [
+    ["wav_duty", "wav_slope", "pan", "vol", "amp_attack", "amp_decay", "amp_sustain", "amp_release"],
+    ["lfo_rate", "lfo_depth"]
+  ],
+  "pads": [
+    {"note": 45, "action": "cycle", "control": "mod_mode", "values": 4},
+    {"note": 46, "action": "cycle", "control": "lfo_shape", "values": 6},
+    {"note": 47, "action": "next"}
+  ]
+}`
+
+// DefaultProfile returns the default controller profile for the LFO test patch.
+func DefaultProfile() *midi.Profile {
+	p, err := midi.ParseProfile([]byte(defaultProfile))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
 
 //-----------------------------------------------------------------------------
 
@@ -63,19 +94,26 @@ func (m *ctrlApp) Info() *core.ModuleInfo {
 //-----------------------------------------------------------------------------
 
 type ctrlApp struct {
-	info     core.ModuleInfo // module info
-	ch       uint8           // MIDI channel
-	lfoShape uint8           // lfo shape
-	modMode  uint8           // modulation mode
-	ccMode   uint8           // cc mode  (0,1)
+	info    core.ModuleInfo  // module info
+	ch      uint8            // MIDI channel
+	profile *midi.ProfileMap // controller profile mapping
 }
 
-// NewCtrl returns a goom voice MIDI controller.
-func NewCtrl(s *core.Synth, ch uint8) core.Module {
-	log.Info.Printf("")
+// NewCtrl returns a LFO test MIDI controller.
+// A nil profile selects the default profile.
+func NewCtrl(s *core.Synth, ch uint8, p *midi.Profile) core.Module {
+	if p == nil {
+		p = DefaultProfile()
+	}
+	log.Info.Printf("profile \"%s\"", p.Name)
+	pm, err := midi.NewProfileMap(p, appControls)
+	if err != nil {
+		panic(err)
+	}
 	m := &ctrlApp{
-		info: ctrlAppInfo,
-		ch:   ch,
+		info:    ctrlAppInfo,
+		ch:      ch,
+		profile: pm,
 	}
 	return s.Register(m)
 }
@@ -113,6 +151,7 @@ func ctrlAppReset(cm core.Module, e *core.Event) {
 		core.EventOutMidiCC(m, "midi", midiLfoDepthCC, 64)
 		core.EventOutMidiCC(m, "midi", midiModModeCC, 2)  // fm
 		core.EventOutMidiCC(m, "midi", midiLfoShapeCC, 0) // triangle
+		m.profile.Reset()
 	}
 }
 
@@ -120,42 +159,18 @@ func ctrlAppMidiIn(cm core.Module, e *core.Event) {
 	m := cm.(*ctrlApp)
 	me := e.GetEventMIDIChannel(m.ch)
 	if me != nil {
-		switch me.GetType() {
-		// Use the special key note on events to modulo increment the mode variables.
-		case core.EventMIDINoteOn:
-			switch me.GetNote() {
-			case midiModModeNote:
-				m.modMode = (m.modMode + 1) % 4
-				log.Info.Printf("modulation mode %s", modMode(m.modMode))
-				core.EventOutMidiCC(m, "midi", midiModModeCC, m.modMode)
-				return
-			case midiLfoShapeNote:
-				m.lfoShape = (m.lfoShape + 1) % 6
-				log.Info.Printf("lfo shape %s", osc.LfoWaveShape(m.lfoShape))
-				core.EventOutMidiCC(m, "midi", midiLfoShapeCC, m.lfoShape)
-				return
-			case midiCCModeNote:
-				m.ccMode = (m.ccMode + 1) % 2
-				log.Info.Printf("ccmode %d", m.ccMode)
-				return
-			}
-		// Ignore the note off events for our special keys.
-		case core.EventMIDINoteOff:
-			switch me.GetNote() {
-			case midiModModeNote,
-				midiLfoShapeNote,
-				midiCCModeNote:
-				// filter out
-				return
-			}
-		// Re-emit the CC events with higher CC numbers.
-		case core.EventMIDIControlChange:
-			ccNum := me.GetCcNum()
-			if ccNum >= 1 && ccNum <= 8 {
-				ccNum += m.ccMode * nControls
-				core.EventOutMidiCC(m, "midi", ccNum, me.GetCcInt())
-				return
+		// Map the controller knobs and pads onto the app controls.
+		out := func(cc, val uint8) {
+			switch cc {
+			case midiModModeCC:
+				log.Info.Printf("modulation mode %s", modMode(val))
+			case midiLfoShapeCC:
+				log.Info.Printf("lfo shape %s", osc.LfoWaveShape(val))
 			}
+			core.EventOutMidiCC(m, "midi", cc, val)
+		}
+		if m.profile.Event(me, out) {
+			return
 		}
 		// pass through
 		core.EventOut(m, "midi", e)
@@ -43,10 +43,11 @@ type patchApp struct {
 }
 
 // NewPatch returns an LFO test patch.
-func NewPatch(s *core.Synth, ch uint8) core.Module {
+// A nil profile selects the default controller profile.
+func NewPatch(s *core.Synth, ch uint8, p *midi.Profile) core.Module {
 
 	// process incoming midi
-	ctrl := NewCtrl(s, ch)
+	ctrl := NewCtrl(s, ch, p)
 
 	// polyphony
 	poly := midi.NewPoly(s, ch, NewVoice, 16)
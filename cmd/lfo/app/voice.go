@@ -120,7 +120,7 @@ func voiceAppNote(cm core.Module, e *core.Event) {
 	note := e.GetEventFloat().Val
 	m.note = note
 	// set the wave oscillator frequency
-	core.EventInFloat(m.wav, "frequency", core.MIDIToFrequency(note))
+	core.EventInFloat(m.wav, "frequency", m.info.Synth.NoteToFrequency(note))
 	// re-set the LFO depth since it is a function of the note
 	m.setDepth()
 }
@@ -204,17 +204,17 @@ func (m *voiceApp) Process(buf ...*core.Buf) bool {
 		m.lfo.Process(&mod)
 		switch m.mode {
 		case modModeAM:
-			m.wav.Process(out)
+			m.wav.Process(nil, out)
 			out.Mul(&mod)
 		case modModeFM:
-			m.wav.Process(&mod, out)
+			m.wav.Process(&mod, nil, out)
 		case modModePM:
-			m.wav.Process(&mod, out)
+			m.wav.Process(&mod, nil, out)
 		default:
 			panic(fmt.Sprintf("bad mode %d", m.mode))
 		}
 	} else {
-		m.wav.Process(out)
+		m.wav.Process(nil, out)
 	}
 
 	// generate envelope
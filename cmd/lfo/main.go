@@ -14,6 +14,7 @@ import (
 
 	"github.com/deadsy/babi/cmd/lfo/app"
 	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
 	"github.com/deadsy/babi/utils/log"
 )
 
@@ -21,10 +22,21 @@ import (
 
 func main() {
 
+	// optional controller profile
+	var profile *midi.Profile
+	if len(os.Args) > 1 {
+		var err error
+		profile, err = midi.LoadProfile(os.Args[1])
+		if err != nil {
+			log.Error.Printf("%s", err)
+			os.Exit(1)
+		}
+	}
+
 	s := core.NewSynth()
 
 	// create the application patch
-	p := app.NewPatch(s, 0)
+	p := app.NewPatch(s, 0, profile)
 
 	// set the root patch for the synth
 	s.SetPatch(p)
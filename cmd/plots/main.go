@@ -78,7 +78,7 @@ func goom() {
 
 	for i := 0; i < 10; i++ {
 		var y core.Buf
-		s.Process(&y)
+		s.Process(nil, &y)
 		p.Process(nil, &y)
 	}
 
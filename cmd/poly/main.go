@@ -9,10 +9,12 @@ Polyphonic Voice Player
 package main
 
 import (
+	"flag"
 	"os"
 	"os/signal"
 
 	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
 	"github.com/deadsy/babi/module/osc"
 	"github.com/deadsy/babi/module/patch"
 	"github.com/deadsy/babi/module/voice"
@@ -23,8 +25,36 @@ import (
 
 func main() {
 
+	sclFile := flag.String("scl", "", "scala scale file (.scl)")
+	kbmFile := flag.String("kbm", "", "scala keyboard mapping file (.kbm)")
+	ref := flag.Float64("ref", 0, "reference frequency (Hz), 0 for the default")
+	split := flag.Int("split", 0, "keyboard split note (karplus-strong below, one octave down), 0 for no split")
+	arp := flag.Int("arp", -1, "arpeggiator order (0=up, 1=down, 2=up-down, 3=random, 4=as-played), -1 for no arpeggiator")
+	flag.Parse()
+
 	s := core.NewSynth()
 
+	// set the tuning
+	var scale *core.Scale
+	var kbm *core.KeyboardMap
+	var err error
+	if *sclFile != "" {
+		scale, err = core.LoadScale(*sclFile)
+		if err != nil {
+			log.Error.Printf("%s", err)
+			os.Exit(1)
+		}
+	}
+	if *kbmFile != "" {
+		kbm, err = core.LoadKeyboardMap(*kbmFile)
+		if err != nil {
+			log.Error.Printf("%s", err)
+			os.Exit(1)
+		}
+	}
+	s.Tuning().SetScale(scale, kbm)
+	s.Tuning().SetReference(float32(*ref))
+
 	// Pick a voice
 	//v := func(s *core.Synth) core.Module { return voice.NewOsc(s, osc.NewSine(s)) }
 	//v := func(s *core.Synth) core.Module { return voice.NewOsc(s, osc.NewSquareBasic(s)) }
@@ -34,13 +64,27 @@ func main() {
 	//v := voice.NewKarplusStrong
 
 	// create the polyphonic patch
-	p := patch.NewPoly(s, 0, v)
+	var p core.Module
+	if *split > 0 && *split < 128 {
+		rule := []midi.RouteRule{
+			{Out: 0, Ch: midi.AnyChannel, NoteLo: uint8(*split), NoteHi: 127, VelLo: 0, VelHi: 127},
+			{Out: 1, Ch: midi.AnyChannel, NoteLo: 0, NoteHi: uint8(*split - 1), VelLo: 0, VelHi: 127, Transpose: -12},
+		}
+		p = patch.NewSplit(s, 0, rule, []func(s *core.Synth) core.Module{v, voice.NewKarplusStrong})
+	} else if *arp >= 0 {
+		a := midi.NewArp(s, 0)
+		core.EventInInt(a, "order", *arp)
+		core.EventInInt(a, "octaves", 2)
+		p = patch.NewPoly(s, 0, v, a)
+	} else {
+		p = patch.NewPoly(s, 0, v)
+	}
 
 	// set the root patch for the synth
 	s.SetPatch(p)
 
 	// start the jack client
-	err := s.StartJack("babi")
+	err = s.StartJack("babi")
 	if err != nil {
 		log.Error.Printf("%s", err)
 		s.Close()
@@ -49,6 +49,9 @@ const MinBeatsPerMin = 10.0
 // MaxBeatsPerMin for sequencer.
 const MaxBeatsPerMin = 300.0
 
+// DefaultBeatsPerMin is the initial synth tempo.
+const DefaultBeatsPerMin = 120.0
+
 //-----------------------------------------------------------------------------
 
 // Pi (3.14159...)
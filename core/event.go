@@ -43,6 +43,14 @@ func (e *Event) String() string {
 	if be != nil {
 		return be.String()
 	}
+	se := e.GetEventSysex()
+	if se != nil {
+		return se.String()
+	}
+	re := e.GetEventRealtime()
+	if re != nil {
+		return re.String()
+	}
 	return "unknown event"
 }
 
@@ -119,6 +127,11 @@ func NewEventMIDI(etype EventTypeMIDI, status, arg0, arg1 uint8) *Event {
 	return NewEvent(&EventMIDI{etype, status, arg0, arg1})
 }
 
+// NewEventMIDIChannel returns a new MIDI channel event.
+func NewEventMIDIChannel(etype EventTypeMIDI, ch, arg0, arg1 uint8) *Event {
+	return NewEventMIDI(etype, uint8(etype)|(ch&0xf), arg0, arg1)
+}
+
 // String returns a descriptive string for the MIDI event.
 func (e *EventMIDI) String() string {
 	descr := midiEventType2String[e.etype]
@@ -223,6 +236,83 @@ func EventOutMidiCC(m Module, name string, num, val uint8) {
 	EventOut(m, name, e)
 }
 
+//-----------------------------------------------------------------------------
+// MIDI System Exclusive Events
+
+// EventSysex is an event with a MIDI system exclusive message.
+// These are sent on MIDI ports.
+type EventSysex struct {
+	Data []byte // the complete message, 0xf0 ... 0xf7
+}
+
+// NewEventSysex returns a new MIDI system exclusive event.
+func NewEventSysex(data []byte) *Event {
+	return NewEvent(&EventSysex{data})
+}
+
+// String returns a descriptive string for the sysex event.
+func (e *EventSysex) String() string {
+	return fmt.Sprintf("sysex len %d", len(e.Data))
+}
+
+// GetEventSysex returns the MIDI system exclusive event (or nil).
+func (e *Event) GetEventSysex() *EventSysex {
+	if se, ok := e.info.(*EventSysex); ok {
+		return se
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// MIDI System Realtime Events
+
+// EventTypeRealtime is the MIDI system realtime event type.
+type EventTypeRealtime uint8
+
+// EventTypeRealtime enumeration.
+const (
+	EventRealtimeClock    EventTypeRealtime = midiStatusTimingClock
+	EventRealtimeStart    EventTypeRealtime = midiStatusStart
+	EventRealtimeContinue EventTypeRealtime = midiStatusContinue
+	EventRealtimeStop     EventTypeRealtime = midiStatusStop
+)
+
+var realtimeEventType2String = map[EventTypeRealtime]string{
+	EventRealtimeClock:    "clock",
+	EventRealtimeStart:    "start",
+	EventRealtimeContinue: "continue",
+	EventRealtimeStop:     "stop",
+}
+
+// EventRealtime is an event with a MIDI system realtime message.
+// These are sent on MIDI ports.
+type EventRealtime struct {
+	etype EventTypeRealtime
+}
+
+// NewEventRealtime returns a new MIDI system realtime event.
+func NewEventRealtime(etype EventTypeRealtime) *Event {
+	return NewEvent(&EventRealtime{etype})
+}
+
+// String returns a descriptive string for the realtime event.
+func (e *EventRealtime) String() string {
+	return realtimeEventType2String[e.etype]
+}
+
+// GetEventRealtime returns the MIDI system realtime event (or nil).
+func (e *Event) GetEventRealtime() *EventRealtime {
+	if re, ok := e.info.(*EventRealtime); ok {
+		return re
+	}
+	return nil
+}
+
+// GetType returns the MIDI system realtime event type.
+func (e *EventRealtime) GetType() EventTypeRealtime {
+	return e.etype
+}
+
 //-----------------------------------------------------------------------------
 // Float Events
 
@@ -10,6 +10,7 @@ package core
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/deadsy/babi/utils/log"
 )
@@ -78,6 +79,10 @@ func convertToMIDIEvent(data []byte) *Event {
 		// system common message
 		switch status {
 		case midiStatusSysexStart:
+			// the jack buffer is reused, so copy the message
+			buf := make([]byte, len(data))
+			copy(buf, data)
+			return NewEventSysex(buf)
 		case midiStatusQuarterFrame:
 		case midiStatusSongPointer:
 		case midiStatusSongSelect:
@@ -89,10 +94,11 @@ func convertToMIDIEvent(data []byte) *Event {
 	} else {
 		// system real time message
 		switch status {
-		case midiStatusTimingClock:
-		case midiStatusStart:
-		case midiStatusContinue:
-		case midiStatusStop:
+		case midiStatusTimingClock,
+			midiStatusStart,
+			midiStatusContinue,
+			midiStatusStop:
+			return NewEventRealtime(EventTypeRealtime(status))
 		case midiStatusActiveSensing:
 		case midiStatusReset:
 		default:
@@ -135,6 +141,26 @@ func (n MidiNote) String() string {
 	return fmt.Sprintf("%s%d", n.sharpString(), n.Octave())
 }
 
+// NoteName returns the name of the MIDI note without the octave, e.g. "C#".
+func (n MidiNote) NoteName() string {
+	return n.sharpString()
+}
+
+// PitchClass returns the pitch class (0..11, C = 0) of the MIDI note.
+func (n MidiNote) PitchClass() int {
+	return int(n) % notesInOctave
+}
+
+// ParsePitchClass returns the pitch class (0..11, C = 0) for a note name, e.g. "C#", "Eb".
+func ParsePitchClass(name string) (int, error) {
+	for i := 0; i < notesInOctave; i++ {
+		if strings.EqualFold(name, sharpNotes[i]) || strings.EqualFold(name, flatNotes[i]) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("bad note name \"%s\"", name)
+}
+
 //-----------------------------------------------------------------------------
 
 // MIDIPitchBend maps a pitch bend value onto a MIDI note offset.
@@ -145,6 +171,8 @@ func MIDIPitchBend(val uint16) float32 {
 
 // MIDIToFrequency converts a MIDI note to a frequency value (Hz).
 // The note value is a float for pitch bending, tuning, etc.
+// This is fixed at 12-TET with A4 = 440 Hz. Voices should use
+// Synth.NoteToFrequency to follow the synth tuning.
 func MIDIToFrequency(note float32) float32 {
 	return 440.0 * Pow2((note-69.0)*(1.0/12.0))
 }
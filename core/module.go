@@ -151,6 +151,12 @@ type Module interface {
 	Child() []Module          // return the child modules
 }
 
+// NumAudioIn returns the number of audio input ports of a module.
+// The audio input buffers are the first Process() arguments.
+func NumAudioIn(m Module) int {
+	return m.Info().In.numPortsByType(PortTypeAudio)
+}
+
 // ModuleString returns a string for a tree of modules.
 func ModuleString(m Module) string {
 	mi := m.Info()
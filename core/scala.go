@@ -0,0 +1,242 @@
+//-----------------------------------------------------------------------------
+/*
+
+Scala Scale (.scl) and Keyboard Mapping (.kbm) Files
+
+See:
+http://www.huygens-fokker.org/scala/scl_format.html
+http://www.huygens-fokker.org/scala/help.htm#mappings
+
+*/
+//-----------------------------------------------------------------------------
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// scalaLines returns the non-comment lines of a scala file.
+func scalaLines(buf []byte) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		l := strings.TrimRight(s.Text(), "\r")
+		if strings.HasPrefix(l, "!") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, s.Err()
+}
+
+// scalaField returns the first whitespace delimited field of a line.
+func scalaField(l string) string {
+	f := strings.Fields(l)
+	if len(f) == 0 {
+		return ""
+	}
+	return f[0]
+}
+
+//-----------------------------------------------------------------------------
+
+// Scale is a Scala scale.
+type Scale struct {
+	Description string    // scale description
+	Cents       []float64 // cents for scale degrees 1..n (degree 0 is 0 cents, degree n is the period)
+}
+
+// parsePitch parses a scala pitch value (cents or ratio) and returns cents.
+func parsePitch(s string) (float64, error) {
+	if strings.Contains(s, ".") {
+		// cents
+		return strconv.ParseFloat(s, 64)
+	}
+	// ratio
+	n, d := s, "1"
+	if i := strings.Index(s, "/"); i >= 0 {
+		n, d = s[:i], s[i+1:]
+	}
+	num, err := strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	den, err := strconv.ParseUint(d, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if num == 0 || den == 0 {
+		return 0, fmt.Errorf("bad ratio %s", s)
+	}
+	return 1200 * math.Log2(float64(num)/float64(den)), nil
+}
+
+// ParseScale returns a scale from the contents of a .scl file.
+func ParseScale(buf []byte) (*Scale, error) {
+	lines, err := scalaLines(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, errors.New("scl: file is too short")
+	}
+	s := &Scale{
+		Description: strings.TrimSpace(lines[0]),
+	}
+	n, err := strconv.Atoi(scalaField(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("scl: bad note count: %s", err)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("scl: bad note count %d", n)
+	}
+	lines = lines[2:]
+	if len(lines) < n {
+		return nil, fmt.Errorf("scl: expected %d notes, got %d", n, len(lines))
+	}
+	s.Cents = make([]float64, n)
+	for i := range s.Cents {
+		cents, err := parsePitch(scalaField(lines[i]))
+		if err != nil {
+			return nil, fmt.Errorf("scl: note %d: %s", i+1, err)
+		}
+		s.Cents[i] = cents
+	}
+	if s.Cents[n-1] <= 0 {
+		return nil, errors.New("scl: period must be > 0 cents")
+	}
+	return s, nil
+}
+
+// LoadScale returns a scale from a .scl file.
+func LoadScale(path string) (*Scale, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseScale(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// KeyboardMap is a Scala keyboard mapping.
+type KeyboardMap struct {
+	First   int     // first MIDI note to retune
+	Last    int     // last MIDI note to retune
+	Middle  int     // MIDI note where scale degree 0 is mapped
+	RefNote int     // reference MIDI note
+	RefFreq float64 // frequency of the reference note (Hz)
+	Octave  int     // scale degree of the formal octave
+	Map     []int   // scale degree for each key in the map, -1 is unmapped (empty is linear)
+}
+
+// defaultKeyboardMap returns a linear mapping with A4 = 440 Hz.
+func defaultKeyboardMap(s *Scale) *KeyboardMap {
+	octave := notesInOctave
+	if s != nil {
+		octave = len(s.Cents)
+	}
+	return &KeyboardMap{
+		First:   0,
+		Last:    numMidiNotes - 1,
+		Middle:  60,
+		RefNote: 69,
+		RefFreq: DefaultReference,
+		Octave:  octave,
+	}
+}
+
+// ParseKeyboardMap returns a keyboard mapping from the contents of a .kbm file.
+func ParseKeyboardMap(buf []byte) (*KeyboardMap, error) {
+	lines, err := scalaLines(buf)
+	if err != nil {
+		return nil, err
+	}
+	// remove blank lines
+	var fields []string
+	for _, l := range lines {
+		if f := scalaField(l); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) < 7 {
+		return nil, errors.New("kbm: file is too short")
+	}
+	hdr := make([]int, 7)
+	for i := range hdr {
+		if i == 5 {
+			continue
+		}
+		hdr[i], err = strconv.Atoi(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("kbm: line %d: %s", i+1, err)
+		}
+	}
+	refFreq, err := strconv.ParseFloat(fields[5], 64)
+	if err != nil {
+		return nil, fmt.Errorf("kbm: bad reference frequency: %s", err)
+	}
+	k := &KeyboardMap{
+		First:   hdr[1],
+		Last:    hdr[2],
+		Middle:  hdr[3],
+		RefNote: hdr[4],
+		RefFreq: refFreq,
+		Octave:  hdr[6],
+	}
+	size := hdr[0]
+	if size < 0 {
+		return nil, fmt.Errorf("kbm: bad map size %d", size)
+	}
+	if k.RefFreq <= 0 {
+		return nil, fmt.Errorf("kbm: bad reference frequency %f", k.RefFreq)
+	}
+	if !InEnum(k.RefNote, numMidiNotes) || !InEnum(k.Middle, numMidiNotes) {
+		return nil, errors.New("kbm: bad middle or reference note")
+	}
+	if size != 0 {
+		k.Map = make([]int, size)
+		fields = fields[7:]
+		for i := range k.Map {
+			k.Map[i] = -1
+			if i >= len(fields) || fields[i] == "x" {
+				// unmapped key
+				continue
+			}
+			k.Map[i], err = strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("kbm: map entry %d: %s", i, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyboardMap returns a keyboard mapping from a .kbm file.
+func LoadKeyboardMap(path string) (*KeyboardMap, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := ParseKeyboardMap(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return k, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -35,23 +35,34 @@ func (s *Synth) pushEvent(m Module, name string, e *Event) {
 	}
 }
 
+// PushEvent queues an event for the named input port of a module.
+// It can be called from outside the audio thread (e.g. a user interface).
+// The event is handled before the next buffer is processed.
+func (s *Synth) PushEvent(m Module, name string, e *Event) {
+	s.pushEvent(m, name, e)
+}
+
 //-----------------------------------------------------------------------------
 
 // Synth is the top-level synthesizer object.
 type Synth struct {
-	root  Module               // root module
-	jack  *Jack                // jack client object
-	audio []*Buf               // audio buffers (in + out)
-	nIn   int                  // number of audio input buffers
-	nOut  int                  // number of audio output buffers
-	event *cbuf.CircularBuffer // event buffer
+	root   Module               // root module
+	jack   *Jack                // jack client object
+	audio  []*Buf               // audio buffers (in + out)
+	nIn    int                  // number of audio input buffers
+	nOut   int                  // number of audio output buffers
+	event  *cbuf.CircularBuffer // event buffer
+	tuning *Tuning              // note to frequency tuning
+	tempo  float32              // tempo (beats per minute)
 }
 
 // NewSynth creates a synthesizer object.
 func NewSynth() *Synth {
 	log.Info.Printf("")
 	return &Synth{
-		event: cbuf.NewCircularBuffer(numEvents),
+		event:  cbuf.NewCircularBuffer(numEvents),
+		tuning: NewTuning(),
+		tempo:  DefaultBeatsPerMin,
 	}
 }
 
@@ -99,6 +110,14 @@ func (s *Synth) Loop() {
 		e := x.(*QueueEvent)
 		if e.dst == nil {
 			e.dst = s.root
+			// MIDI tuning messages update the synth tuning
+			se := e.event.GetEventSysex()
+			if se != nil && IsMTS(se.Data) {
+				err := s.tuning.MTS(se.Data)
+				if err != nil {
+					log.Info.Printf("%s", err)
+				}
+			}
 		}
 		EventIn(e.dst, e.port, e.event)
 	}
@@ -112,6 +131,28 @@ func (s *Synth) Loop() {
 	}
 }
 
+// Tuning returns the synth tuning.
+func (s *Synth) Tuning() *Tuning {
+	return s.tuning
+}
+
+// Tempo returns the synth tempo (beats per minute).
+func (s *Synth) Tempo() float32 {
+	return s.tempo
+}
+
+// SetTempo sets the synth tempo (beats per minute).
+// The sequencers set the tempo and the tempo synced modules follow it.
+func (s *Synth) SetTempo(bpm float32) {
+	s.tempo = Clamp(bpm, MinBeatsPerMin, MaxBeatsPerMin)
+}
+
+// NoteToFrequency converts a MIDI note to a frequency (Hz) using the synth tuning.
+// The note value is a float for pitch bending.
+func (s *Synth) NoteToFrequency(note float32) float32 {
+	return s.tuning.Frequency(note)
+}
+
 // Close handles synth cleanup.
 func (s *Synth) Close() {
 	log.Info.Printf("")
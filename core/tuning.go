@@ -0,0 +1,276 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tuning
+
+A tuning maps MIDI notes to frequencies.
+
+The default tuning is 12-TET with A4 = 440 Hz. Other tunings can be set
+from Scala scale (.scl) and keyboard mapping (.kbm) files, or updated live
+with MIDI Tuning Standard (MTS) sysex messages.
+
+See:
+http://www.huygens-fokker.org/scala/scl_format.html
+http://www.huygens-fokker.org/scala/help.htm#mappings
+https://www.midi.org/specifications/item/the-midi-1-0-specification (MIDI Tuning)
+
+*/
+//-----------------------------------------------------------------------------
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// DefaultReference is the default reference frequency for A4 (Hz).
+const DefaultReference = 440.0
+
+const numMidiNotes = 128
+
+// Tuning maps MIDI notes to frequencies.
+type Tuning struct {
+	scale   *Scale                // scale (nil for 12-TET)
+	kbm     *KeyboardMap          // keyboard mapping (nil for linear)
+	ref     float64               // reference frequency (0 uses the keyboard map frequency)
+	pitch   [numMidiNotes]float64 // log2(frequency) for each note
+	mapped  [numMidiNotes]bool    // is the note mapped to a scale degree?
+	version uint                  // incremented when the tuning changes
+}
+
+// NewTuning returns a 12-TET tuning with A4 = 440 Hz.
+func NewTuning() *Tuning {
+	t := &Tuning{}
+	t.update()
+	return t
+}
+
+// Version returns a value that changes whenever the tuning changes.
+func (t *Tuning) Version() uint {
+	return t.version
+}
+
+// SetScale sets the scale and keyboard mapping for the tuning.
+// A nil scale is 12-TET. A nil keyboard map is a linear mapping.
+func (t *Tuning) SetScale(scale *Scale, kbm *KeyboardMap) {
+	t.scale = scale
+	t.kbm = kbm
+	t.update()
+}
+
+// SetReference sets the reference frequency (Hz) for the reference note.
+// The reference note is A4 (69) unless set by a keyboard map.
+// A value of 0 uses the frequency in the keyboard map (or 440 Hz).
+func (t *Tuning) SetReference(freq float32) {
+	t.ref = float64(ClampLo(freq, 0))
+	t.update()
+}
+
+// Reference returns the reference frequency (Hz) for the reference note.
+func (t *Tuning) Reference() float32 {
+	return float32(t.refFreq())
+}
+
+// refFreq returns the reference frequency.
+func (t *Tuning) refFreq() float64 {
+	if t.ref != 0 {
+		return t.ref
+	}
+	if t.kbm != nil {
+		return t.kbm.RefFreq
+	}
+	return DefaultReference
+}
+
+// update recalculates the note frequencies.
+// This discards any MTS changes.
+func (t *Tuning) update() {
+	kbm := t.kbm
+	if kbm == nil {
+		kbm = defaultKeyboardMap(t.scale)
+	}
+	refCents, ok := t.cents(kbm, kbm.RefNote)
+	if !ok {
+		// unmapped reference note, use a linear mapping
+		refCents = t.degreeCents(kbm.RefNote - kbm.Middle)
+	}
+	refPitch := math.Log2(t.refFreq())
+	for i := range t.pitch {
+		cents, ok := t.cents(kbm, i)
+		if !ok {
+			// unmapped notes are tuned as 12-TET
+			cents = refCents + 100*float64(i-kbm.RefNote)
+		}
+		t.pitch[i] = refPitch + (cents-refCents)/1200
+		t.mapped[i] = ok
+	}
+	t.version++
+}
+
+// degreeCents returns the cents value for a (possibly negative) scale degree.
+func (t *Tuning) degreeCents(degree int) float64 {
+	if t.scale == nil {
+		return 100 * float64(degree)
+	}
+	n := len(t.scale.Cents)
+	octave := floorDiv(degree, n)
+	idx := degree - (octave * n)
+	cents := float64(octave) * t.scale.Cents[n-1]
+	if idx != 0 {
+		cents += t.scale.Cents[idx-1]
+	}
+	return cents
+}
+
+// cents returns the cents value for a MIDI note using a keyboard map.
+// Returns false if the note is not mapped to a scale degree.
+func (t *Tuning) cents(kbm *KeyboardMap, note int) (float64, bool) {
+	if note < kbm.First || note > kbm.Last {
+		return 0, false
+	}
+	i := note - kbm.Middle
+	n := len(kbm.Map)
+	if n == 0 {
+		// linear mapping
+		return t.degreeCents(i), true
+	}
+	octave := floorDiv(i, n)
+	degree := kbm.Map[i-(octave*n)]
+	if degree < 0 {
+		return 0, false
+	}
+	// Each repeat of the map is shifted by the formal octave.
+	// The scale degree wraps at the scale size, not the formal octave.
+	return float64(octave)*t.degreeCents(kbm.Octave) + t.degreeCents(degree), true
+}
+
+// floorDiv returns floor(a/b) for b > 0.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && (a < 0) {
+		q--
+	}
+	return q
+}
+
+//-----------------------------------------------------------------------------
+
+// Mapped returns true if the MIDI note is mapped to a scale degree.
+func (t *Tuning) Mapped(note uint8) bool {
+	return t.mapped[note&0x7f]
+}
+
+// Frequency converts a MIDI note to a frequency value (Hz).
+// The note value is a float for pitch bending. Fractional notes are
+// interpolated (in pitch) between the adjacent notes.
+func (t *Tuning) Frequency(note float32) float32 {
+	n := math.Floor(float64(note))
+	i := ClampInt(int(n), 0, numMidiNotes-2)
+	frac := float64(note) - float64(i)
+	p := t.pitch[i] + frac*(t.pitch[i+1]-t.pitch[i])
+	return float32(math.Exp2(p))
+}
+
+//-----------------------------------------------------------------------------
+// MIDI Tuning Standard
+
+const midiIDNonRealtime = 0x7e
+const midiIDRealtime = 0x7f
+const mtsSubID1 = 0x08
+
+// mtsPitch converts a 3 byte MTS frequency to log2(frequency).
+// Returns false for the "no change" value (0x7f 0x7f 0x7f).
+func mtsPitch(buf []byte) (float64, bool) {
+	if buf[0] == 0x7f && buf[1] == 0x7f && buf[2] == 0x7f {
+		return 0, false
+	}
+	note := float64(buf[0]) + float64(int(buf[1])<<7|int(buf[2]))/(1<<14)
+	return math.Log2(DefaultReference) + (note-69)/12, true
+}
+
+// IsMTS returns true if the sysex buffer is a MIDI Tuning Standard message.
+func IsMTS(buf []byte) bool {
+	if len(buf) < 5 || buf[0] != midiStatusSysexStart {
+		return false
+	}
+	return (buf[1] == midiIDNonRealtime || buf[1] == midiIDRealtime) && buf[3] == mtsSubID1
+}
+
+// mtsRetune sets the frequencies for a list of [key xx yy zz] entries.
+func (t *Tuning) mtsRetune(buf []byte, n int) error {
+	if len(buf) < n*4 {
+		return errors.New("mts: short note change")
+	}
+	for i := 0; i < n; i++ {
+		x := buf[i*4:]
+		if p, ok := mtsPitch(x[1:4]); ok {
+			key := x[0] & 0x7f
+			t.pitch[key] = p
+			t.mapped[key] = true
+		}
+	}
+	return nil
+}
+
+// mtsDump sets the frequencies for all notes from a bulk tuning dump.
+func (t *Tuning) mtsDump(buf []byte) error {
+	// 16 byte name, 128 x 3 byte frequencies
+	if len(buf) < 16+(numMidiNotes*3) {
+		return errors.New("mts: short bulk dump")
+	}
+	buf = buf[16:]
+	for i := 0; i < numMidiNotes; i++ {
+		if p, ok := mtsPitch(buf[i*3:]); ok {
+			t.pitch[i] = p
+			t.mapped[i] = true
+		}
+	}
+	return nil
+}
+
+// MTS updates the tuning with a MIDI Tuning Standard sysex message.
+// Supported messages are the bulk tuning dumps (0x01, 0x04) and the single
+// note tuning changes (0x02, 0x07). The tuning program and bank are ignored.
+func (t *Tuning) MTS(buf []byte) error {
+	if !IsMTS(buf) {
+		return errors.New("mts: not a tuning message")
+	}
+	subID2 := buf[4]
+	data := buf[5:]
+	var err error
+	switch subID2 {
+	case 0x01: // bulk tuning dump: tt name[16] data[384] csum
+		if len(data) < 1 {
+			return errors.New("mts: short bulk dump")
+		}
+		err = t.mtsDump(data[1:])
+	case 0x04: // key based tuning dump: bb tt name[16] data[384] csum
+		if len(data) < 2 {
+			return errors.New("mts: short bulk dump")
+		}
+		err = t.mtsDump(data[2:])
+	case 0x02: // single note tuning change: tt ll [kk xx yy zz]...
+		if len(data) < 2 {
+			return errors.New("mts: short note change")
+		}
+		err = t.mtsRetune(data[2:], int(data[1]))
+	case 0x07: // single note tuning change with bank: bb tt ll [kk xx yy zz]...
+		if len(data) < 3 {
+			return errors.New("mts: short note change")
+		}
+		err = t.mtsRetune(data[3:], int(data[2]))
+	default:
+		return fmt.Errorf("mts: unsupported message 0x%02x", subID2)
+	}
+	if err != nil {
+		return err
+	}
+	t.version++
+	return nil
+}
+
+//-----------------------------------------------------------------------------
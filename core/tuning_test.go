@@ -0,0 +1,218 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tuning Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package core
+
+import (
+	"math"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+const testScale = `! meanquar.scl
+!
+1/4-comma meantone scale. Pietro Aaron's temperament (1523)
+ 12
+!
+ 76.04900
+ 193.15686
+ 310.26471
+ 5/4
+ 503.42157
+ 579.47057
+ 696.57843
+ 25/16
+ 889.73529
+ 1006.84314
+ 1082.89214
+ 2/1
+`
+
+// 7 note white key mapping, A4 = 432 Hz.
+const testKbm = `! white.kbm
+12
+0
+127
+60
+69
+432.0
+7
+! mapping
+0
+x
+1
+x
+2
+3
+x
+4
+x
+5
+x
+6
+`
+
+func freqEqual(a, b float32) bool {
+	return math.Abs(float64(a-b))/float64(b) < 1e-5
+}
+
+func Test_TuningDefault(t *testing.T) {
+	tu := NewTuning()
+	tests := []struct {
+		note float32
+		freq float32
+	}{
+		{69, 440},
+		{57, 220},
+		{81, 880},
+		{60, 261.6256},
+		{69.5, 452.8930},
+		{0, 8.175799},
+		{127, 12543.85},
+	}
+	for _, v := range tests {
+		f := tu.Frequency(v.note)
+		if !freqEqual(f, v.freq) {
+			t.Errorf("note %f: expected %f, got %f", v.note, v.freq, f)
+		}
+	}
+	// reference pitch
+	tu.SetReference(432)
+	if !freqEqual(tu.Frequency(69), 432) || !freqEqual(tu.Frequency(81), 864) {
+		t.Errorf("bad reference pitch")
+	}
+}
+
+func Test_Scala(t *testing.T) {
+	scale, err := ParseScale([]byte(testScale))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scale.Cents) != 12 || scale.Cents[11] != 1200 {
+		t.Fatalf("bad scale %v", scale)
+	}
+	if math.Abs(scale.Cents[3]-386.3137) > 1e-3 {
+		t.Errorf("bad ratio conversion %f", scale.Cents[3])
+	}
+
+	// linear mapping, A4 = 440 Hz
+	tu := NewTuning()
+	tu.SetScale(scale, nil)
+	// degree 9 = 889.73529 cents above C4
+	c4 := 440 / math.Pow(2, 889.73529/1200)
+	if !freqEqual(tu.Frequency(60), float32(c4)) {
+		t.Errorf("C4: expected %f, got %f", c4, tu.Frequency(60))
+	}
+	if !freqEqual(tu.Frequency(64), float32(c4*5/4)) {
+		t.Errorf("E4: expected %f, got %f", c4*5/4, tu.Frequency(64))
+	}
+	if !freqEqual(tu.Frequency(48), float32(c4/2)) {
+		t.Errorf("C3: expected %f, got %f", c4/2, tu.Frequency(48))
+	}
+
+	// keyboard mapping
+	kbm, err := ParseKeyboardMap([]byte(testKbm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale7, err := ParseScale([]byte("7 note\n7\n200.0\n400.0\n500.0\n700.0\n900.0\n1100.0\n2/1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.SetScale(scale7, kbm)
+	if !freqEqual(tu.Frequency(69), 432) {
+		t.Errorf("A4: expected 432, got %f", tu.Frequency(69))
+	}
+	if !freqEqual(tu.Frequency(81), 864) {
+		t.Errorf("A5: expected 864, got %f", tu.Frequency(81))
+	}
+	if tu.Mapped(61) || !tu.Mapped(62) {
+		t.Errorf("bad mapped keys")
+	}
+	// D4 is scale degree 1 (200 cents above C4), A4 is 900 cents above C4
+	d4 := 432 * math.Pow(2, -700.0/1200)
+	if !freqEqual(tu.Frequency(62), float32(d4)) {
+		t.Errorf("D4: expected %f, got %f", d4, tu.Frequency(62))
+	}
+
+	// 2 key mapping with a formal octave (degree 2) that is not the scale size
+	kbm, err = ParseKeyboardMap([]byte("2\n0\n127\n60\n60\n100.0\n2\n0\n1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale4, err := ParseScale([]byte("4 note\n4\n150.0\n400.0\n500.0\n2/1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tu.SetScale(scale4, kbm)
+	// each repeat of the map is 400 cents higher
+	tests := []struct {
+		note  float32
+		cents float64
+	}{
+		{58, -400}, {59, -250}, {60, 0}, {61, 150}, {62, 400}, {63, 550}, {64, 800}, {65, 950},
+	}
+	for _, v := range tests {
+		f := 100 * math.Pow(2, v.cents/1200)
+		if !freqEqual(tu.Frequency(v.note), float32(f)) {
+			t.Errorf("note %f: expected %f, got %f", v.note, f, tu.Frequency(v.note))
+		}
+	}
+}
+
+func Test_MTS(t *testing.T) {
+	tu := NewTuning()
+	v := tu.Version()
+	// realtime single note tuning change: note 60 -> 61.5
+	msg := []byte{0xf0, 0x7f, 0x7f, 0x08, 0x02, 0x00, 0x02,
+		60, 61, 0x40, 0x00,
+		62, 0x7f, 0x7f, 0x7f, // no change
+		0xf7}
+	err := tu.MTS(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tu.Version() == v {
+		t.Errorf("version not changed")
+	}
+	if !freqEqual(tu.Frequency(60), tet(61.5)) {
+		t.Errorf("expected %f, got %f", tet(61.5), tu.Frequency(60))
+	}
+	if !freqEqual(tu.Frequency(62), tet(62)) {
+		t.Errorf("no change note was changed")
+	}
+	// bulk dump: everything up a semitone
+	msg = []byte{0xf0, 0x7e, 0x00, 0x08, 0x01, 0x00}
+	msg = append(msg, []byte("0123456789abcdef")...)
+	for i := 0; i < 128; i++ {
+		msg = append(msg, byte(ClampInt(i+1, 0, 127)), 0, 0)
+	}
+	msg = append(msg, 0, 0xf7)
+	err = tu.MTS(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !freqEqual(tu.Frequency(69), tet(70)) {
+		t.Errorf("expected %f, got %f", tet(70), tu.Frequency(69))
+	}
+	// errors
+	if tu.MTS(msg[:20]) == nil {
+		t.Errorf("expected error for short message")
+	}
+	if IsMTS([]byte{0xf0, 0x43, 0x00, 0x09, 0x20}) {
+		t.Errorf("yamaha sysex is not mts")
+	}
+}
+
+// tet returns the 12-TET frequency (A4 = 440 Hz) for a MIDI note.
+func tet(note float64) float32 {
+	return float32(440 * math.Pow(2, (note-69)/12))
+}
+
+//-----------------------------------------------------------------------------
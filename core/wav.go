@@ -0,0 +1,261 @@
+//-----------------------------------------------------------------------------
+/*
+
+WAV Files
+
+See:
+http://soundfile.sapp.org/doc/WaveFormat/
+http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/WAVE/WAVE.html
+
+PCM (8/16/24/32 bit) and IEEE float (32/64 bit) samples are supported.
+Chunks other than "fmt " and "data" are kept (unparsed) for the user.
+
+*/
+//-----------------------------------------------------------------------------
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// Wave is the audio data from a WAV file.
+type Wave struct {
+	Rate  int               // sample rate (Hz)
+	Data  [][]float32       // samples (-1..1) for each channel
+	Chunk map[string][]byte // other chunks
+}
+
+// Len returns the number of samples per channel.
+func (w *Wave) Len() int {
+	if len(w.Data) == 0 {
+		return 0
+	}
+	return len(w.Data[0])
+}
+
+// Mono returns the average of the channels.
+func (w *Wave) Mono() []float32 {
+	if len(w.Data) == 1 {
+		return w.Data[0]
+	}
+	x := make([]float32, w.Len())
+	k := 1 / float32(len(w.Data))
+	for _, ch := range w.Data {
+		for i := range x {
+			x[i] += ch[i] * k
+		}
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+type wavFormat struct {
+	format   uint16 // audio format
+	channels uint16 // number of channels
+	rate     uint32 // sample rate
+	bits     uint16 // bits per sample
+}
+
+// parseFormat parses the "fmt " chunk.
+func parseFormat(buf []byte) (*wavFormat, error) {
+	if len(buf) < 16 {
+		return nil, errors.New("wav: fmt chunk is too short")
+	}
+	f := &wavFormat{
+		format:   binary.LittleEndian.Uint16(buf[0:]),
+		channels: binary.LittleEndian.Uint16(buf[2:]),
+		rate:     binary.LittleEndian.Uint32(buf[4:]),
+		bits:     binary.LittleEndian.Uint16(buf[14:]),
+	}
+	if f.format == wavFormatExtensible {
+		if len(buf) < 26 {
+			return nil, errors.New("wav: fmt chunk is too short")
+		}
+		// the format is the start of the sub-format GUID
+		f.format = binary.LittleEndian.Uint16(buf[24:])
+	}
+	if f.channels == 0 {
+		return nil, errors.New("wav: no channels")
+	}
+	switch {
+	case f.format == wavFormatPCM && (f.bits == 8 || f.bits == 16 || f.bits == 24 || f.bits == 32):
+	case f.format == wavFormatFloat && (f.bits == 32 || f.bits == 64):
+	default:
+		return nil, fmt.Errorf("wav: unsupported format %d (%d bits)", f.format, f.bits)
+	}
+	return f, nil
+}
+
+// sample returns the sample value (-1..1) for the sample bytes.
+func (f *wavFormat) sample(b []byte) float32 {
+	if f.format == wavFormatFloat {
+		if f.bits == 32 {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}
+		return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+	switch f.bits {
+	case 8:
+		// 8 bit samples are unsigned
+		return float32(int(b[0])-128) * (1.0 / (1 << 7))
+	case 16:
+		return float32(int16(binary.LittleEndian.Uint16(b))) * (1.0 / (1 << 15))
+	case 24:
+		x := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+		return float32(SignExtend(x, 24)) * (1.0 / (1 << 23))
+	}
+	return float32(int32(binary.LittleEndian.Uint32(b))) * (1.0 / (1 << 31))
+}
+
+// RIFFChunks calls f for each chunk in a buffer of RIFF chunks.
+// It stops at the first error returned by f.
+func RIFFChunks(buf []byte, f func(id string, chunk []byte) error) error {
+	for len(buf) >= 8 {
+		id := string(buf[0:4])
+		size := binary.LittleEndian.Uint32(buf[4:])
+		buf = buf[8:]
+		// a truncated chunk uses what we have (compare as uint64, the size may not fit in an int)
+		n := len(buf)
+		if uint64(size) < uint64(n) {
+			n = int(size)
+		}
+		if err := f(id, buf[:n]); err != nil {
+			return err
+		}
+		// chunks are padded to an even length
+		buf = buf[Min(n+n&1, len(buf)):]
+	}
+	return nil
+}
+
+// ParseWave returns the audio data from the contents of a WAV file.
+func ParseWave(buf []byte) (*Wave, error) {
+	if len(buf) < 12 || string(buf[0:4]) != "RIFF" || string(buf[8:12]) != "WAVE" {
+		return nil, errors.New("wav: not a RIFF/WAVE file")
+	}
+	w := &Wave{
+		Chunk: make(map[string][]byte),
+	}
+	var f *wavFormat
+	var data []byte
+	err := RIFFChunks(buf[12:], func(id string, chunk []byte) error {
+		switch id {
+		case "fmt ":
+			var err error
+			f, err = parseFormat(chunk)
+			return err
+		case "data":
+			data = chunk
+		default:
+			w.Chunk[id] = chunk
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, errors.New("wav: no fmt chunk")
+	}
+	if data == nil {
+		return nil, errors.New("wav: no data chunk")
+	}
+	w.Rate = int(f.rate)
+	// de-interleave the samples
+	size := int(f.bits) / 8
+	nch := int(f.channels)
+	n := len(data) / (size * nch)
+	w.Data = make([][]float32, nch)
+	for ch := range w.Data {
+		w.Data[ch] = make([]float32, n)
+	}
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < nch; ch++ {
+			k := (i*nch + ch) * size
+			w.Data[ch][i] = f.sample(data[k : k+size])
+		}
+	}
+	return w, nil
+}
+
+// LoadWave returns the audio data from a WAV file.
+func LoadWave(path string) (*Wave, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := ParseWave(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return w, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeWave returns the WAV file (32 bit float samples) for the audio data.
+func EncodeWave(w *Wave) []byte {
+	nch := len(w.Data)
+	n := w.Len()
+	var body bytes.Buffer
+	put := func(x interface{}) {
+		binary.Write(&body, binary.LittleEndian, x)
+	}
+	chunk := func(id string, size int) {
+		body.WriteString(id)
+		put(uint32(size))
+	}
+	// format chunk
+	chunk("fmt ", 16)
+	put(uint16(wavFormatFloat))
+	put(uint16(nch))
+	put(uint32(w.Rate))
+	put(uint32(w.Rate * nch * 4))
+	put(uint16(nch * 4))
+	put(uint16(32))
+	// other chunks
+	ids := make([]string, 0, len(w.Chunk))
+	for id := range w.Chunk {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		chunk(id, len(w.Chunk[id]))
+		body.Write(w.Chunk[id])
+		if len(w.Chunk[id])&1 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	// data chunk
+	chunk("data", 4*nch*n)
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < nch; ch++ {
+			put(w.Data[ch][i])
+		}
+	}
+	// riff header
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+body.Len()))
+	buf.WriteString("WAVE")
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+//-----------------------------------------------------------------------------
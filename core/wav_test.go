@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+/*
+
+WAV File Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+// pcmWave returns a PCM WAV file.
+func pcmWave(rate, channels, bits int, data []byte) []byte {
+	var buf bytes.Buffer
+	put := func(x interface{}) {
+		binary.Write(&buf, binary.LittleEndian, x)
+	}
+	buf.WriteString("RIFF")
+	put(uint32(4 + 8 + 16 + 8 + 4 + 8 + len(data)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	put(uint32(16))
+	put(uint16(wavFormatPCM))
+	put(uint16(channels))
+	put(uint32(rate))
+	put(uint32(rate * channels * bits / 8))
+	put(uint16(channels * bits / 8))
+	put(uint16(bits))
+	// odd length chunk with padding
+	buf.WriteString("junk")
+	put(uint32(3))
+	buf.Write([]byte{1, 2, 3, 0})
+	buf.WriteString("data")
+	put(uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func Test_WavePCM(t *testing.T) {
+	tests := []struct {
+		bits int
+		data []byte
+		ch0  []float32
+		ch1  []float32
+	}{
+		{8, []byte{0x80, 0x00, 0xc0, 0xff}, []float32{0, 0.5}, []float32{-1, 127.0 / 128.0}},
+		{16, []byte{0x00, 0x80, 0xff, 0x7f, 0x00, 0x40, 0x00, 0x00}, []float32{-1, 0.5}, []float32{32767.0 / 32768.0, 0}},
+		{24, []byte{0x00, 0x00, 0x80, 0x00, 0x00, 0x40, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00}, []float32{-1, -0.5}, []float32{0.5, 0}},
+	}
+	for _, v := range tests {
+		w, err := ParseWave(pcmWave(44100, 2, v.bits, v.data))
+		if err != nil {
+			t.Fatalf("%d bits: %s", v.bits, err)
+		}
+		if w.Rate != 44100 || len(w.Data) != 2 || w.Len() != 2 {
+			t.Fatalf("%d bits: bad format %d Hz, %d channels, %d samples", v.bits, w.Rate, len(w.Data), w.Len())
+		}
+		for i := range v.ch0 {
+			if w.Data[0][i] != v.ch0[i] || w.Data[1][i] != v.ch1[i] {
+				t.Errorf("%d bits: sample %d is %f/%f, expected %f/%f", v.bits, i, w.Data[0][i], w.Data[1][i], v.ch0[i], v.ch1[i])
+			}
+		}
+		if !bytes.Equal(w.Chunk["junk"], []byte{1, 2, 3}) {
+			t.Errorf("%d bits: bad junk chunk %v", v.bits, w.Chunk["junk"])
+		}
+		mono := w.Mono()
+		for i := range mono {
+			if mono[i] != 0.5*(v.ch0[i]+v.ch1[i]) {
+				t.Errorf("%d bits: mono sample %d is %f", v.bits, i, mono[i])
+			}
+		}
+	}
+}
+
+func Test_WaveEncode(t *testing.T) {
+	w0 := &Wave{
+		Rate:  48000,
+		Data:  [][]float32{{0, 0.25, -0.5, 1}},
+		Chunk: map[string][]byte{"clm ": []byte("<!>2048")},
+	}
+	w1, err := ParseWave(EncodeWave(w0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w1.Rate != w0.Rate || len(w1.Data) != 1 || w1.Len() != w0.Len() {
+		t.Fatalf("bad format %d Hz, %d channels, %d samples", w1.Rate, len(w1.Data), w1.Len())
+	}
+	for i := range w0.Data[0] {
+		if w1.Data[0][i] != w0.Data[0][i] {
+			t.Errorf("sample %d is %f, expected %f", i, w1.Data[0][i], w0.Data[0][i])
+		}
+	}
+	if string(w1.Chunk["clm "]) != "<!>2048" {
+		t.Errorf("bad clm chunk %q", w1.Chunk["clm "])
+	}
+}
+
+func Test_WaveTruncated(t *testing.T) {
+	// a data chunk size larger than the file (and larger than a 32-bit int)
+	buf := pcmWave(44100, 1, 16, []byte{0, 0x40, 0, 0xc0})
+	binary.LittleEndian.PutUint32(buf[len(buf)-8:], 0xffffffff)
+	w, err := ParseWave(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Data[0]) != 2 || w.Data[0][0] != 0.5 || w.Data[0][1] != -0.5 {
+		t.Errorf("bad data %v", w.Data[0])
+	}
+}
+
+func Test_RIFFChunks(t *testing.T) {
+	// an odd length chunk is padded
+	buf := []byte("abcd\x03\x00\x00\x00xyz\x00efgh\x01\x00\x00\x00w")
+	var ids []string
+	err := RIFFChunks(buf, func(id string, chunk []byte) error {
+		ids = append(ids, id+string(chunk))
+		return nil
+	})
+	if err != nil || len(ids) != 2 || ids[0] != "abcdxyz" || ids[1] != "efghw" {
+		t.Errorf("bad chunks %q", ids)
+	}
+	// an error stops the walk
+	n := 0
+	err = RIFFChunks(buf, func(id string, chunk []byte) error {
+		n++
+		return errors.New("stop")
+	})
+	if err == nil || n != 1 {
+		t.Errorf("expected the walk to stop after an error")
+	}
+}
+
+func Test_WaveErrors(t *testing.T) {
+	bad := [][]byte{
+		nil,
+		[]byte("RIFF\x04\x00\x00\x00WAVX"),
+		[]byte("RIFF\x04\x00\x00\x00WAVE"),
+		pcmWave(44100, 1, 12, []byte{0, 0}),
+		pcmWave(44100, 0, 16, []byte{0, 0}),
+	}
+	for i, buf := range bad {
+		if _, err := ParseWave(buf); err == nil {
+			t.Errorf("test %d: expected an error", i)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,86 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Voice Configuration
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"github.com/deadsy/babi/module/osc"
+)
+
+//-----------------------------------------------------------------------------
+// envelope generator configuration
+
+// EnvConfig is an 8 step CZ envelope.
+// Each step moves to the step level at the step rate.
+type EnvConfig struct {
+	Rate    [8]int // step rates 0..99
+	Level   [8]int // step levels 0..99
+	Sustain int    // sustain step (-1 is none)
+	End     int    // end step
+}
+
+//-----------------------------------------------------------------------------
+// voice configuration
+
+// VoiceConfig is a CZ voice configuration.
+type VoiceConfig struct {
+	Name     string
+	Wave     osc.CzWave // oscillator waveform
+	Depth    float32    // DCO envelope pitch depth (semitones)
+	Velocity float32    // velocity sensitivity of the DCW and DCA (0..1)
+	DCO      EnvConfig  // pitch envelope
+	DCW      EnvConfig  // wave envelope
+	DCA      EnvConfig  // amplitude envelope
+}
+
+//-----------------------------------------------------------------------------
+
+// Presets are some CZ style voices.
+var Presets = []*VoiceConfig{
+	{
+		Name:     "Brass",
+		Wave:     osc.CzSaw,
+		Depth:    12,
+		Velocity: 0.5,
+		DCO:      EnvConfig{[8]int{99, 60}, [8]int{10, 0}, -1, 1},
+		DCW:      EnvConfig{[8]int{75, 60, 40}, [8]int{90, 60, 0}, 1, 2},
+		DCA:      EnvConfig{[8]int{80, 60, 55}, [8]int{99, 85, 0}, 1, 2},
+	},
+	{
+		Name:     "Bass",
+		Wave:     osc.CzSquare,
+		Velocity: 0.7,
+		DCW:      EnvConfig{[8]int{99, 65, 70}, [8]int{85, 20, 0}, 1, 2},
+		DCA:      EnvConfig{[8]int{99, 55, 75}, [8]int{99, 70, 0}, 1, 2},
+	},
+	{
+		Name:     "Resonant Sweep",
+		Wave:     osc.CzResonance2,
+		Velocity: 0.3,
+		DCW:      EnvConfig{[8]int{50, 45, 55}, [8]int{99, 10, 0}, 1, 2},
+		DCA:      EnvConfig{[8]int{90, 50, 60}, [8]int{99, 80, 0}, 1, 2},
+	},
+	{
+		Name:     "Electric Piano",
+		Wave:     osc.CzDoubleSine,
+		Velocity: 0.8,
+		DCW:      EnvConfig{[8]int{99, 70, 60}, [8]int{60, 10, 0}, -1, 2},
+		DCA:      EnvConfig{[8]int{99, 50, 60, 70}, [8]int{99, 60, 20, 0}, 2, 3},
+	},
+	{
+		Name:     "Pluck",
+		Wave:     osc.CzSawPulse,
+		Depth:    12,
+		Velocity: 0.6,
+		DCO:      EnvConfig{[8]int{99, 85}, [8]int{20, 0}, -1, 1},
+		DCW:      EnvConfig{[8]int{99, 75}, [8]int{99, 0}, -1, 1},
+		DCA:      EnvConfig{[8]int{99, 55, 70}, [8]int{99, 0, 0}, -1, 2},
+	},
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Envelope Generator
+
+An 8 step envelope. Each step is a linear ramp to the step level at the step
+rate. The envelope holds at the sustain step while the key is down. A key off
+jumps to the step after the sustain step. The envelope finishes after the end
+step.
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// rateTime returns the time (secs) for a full scale ramp at a rate (0..99).
+// Rate 99 is 1 millisecond, rate 0 is 10 seconds.
+func rateTime(rate int) float32 {
+	r := core.ClampInt(rate, 0, 99)
+	return float32(0.001 * math.Pow(10, 4*float64(99-r)/99))
+}
+
+type czEnv struct {
+	cfg    *EnvConfig // envelope configuration
+	step   int        // current step
+	level  float32    // current level (0..1)
+	target float32    // target level (0..1)
+	delta  float32    // level change per sample
+	down   bool       // key state
+	hold   bool       // holding at the sustain step
+	done   bool       // the end step has finished
+}
+
+// newEnv returns an idle envelope.
+func newEnv(cfg *EnvConfig) czEnv {
+	return czEnv{
+		cfg:  cfg,
+		done: true,
+	}
+}
+
+// start starts an envelope step.
+func (e *czEnv) start(step int) {
+	e.hold = false
+	if step > e.cfg.End || step >= len(e.cfg.Level) {
+		e.done = true
+		return
+	}
+	e.done = false
+	e.step = step
+	e.target = float32(core.ClampInt(e.cfg.Level[step], 0, 99)) / 99
+	e.delta = 1 / (rateTime(e.cfg.Rate[step]) * core.AudioSampleFrequency)
+}
+
+// keyOn starts the envelope from the current level.
+func (e *czEnv) keyOn() {
+	e.down = true
+	e.start(0)
+}
+
+// keyOff releases the envelope.
+func (e *czEnv) keyOff() {
+	e.down = false
+	if e.done {
+		if e.level > 0 {
+			// release a finished envelope at the end step rate
+			e.start(e.cfg.End)
+			e.target = 0
+		}
+		return
+	}
+	if e.cfg.Sustain >= 0 && e.step <= e.cfg.Sustain {
+		e.start(e.cfg.Sustain + 1)
+	}
+}
+
+// active returns true if the envelope is running or holding a level.
+func (e *czEnv) active() bool {
+	return !e.done || e.level > 0
+}
+
+// sample returns the next envelope level.
+func (e *czEnv) sample() float32 {
+	if e.done || e.hold {
+		return e.level
+	}
+	if e.level < e.target {
+		e.level += e.delta
+		if e.level < e.target {
+			return e.level
+		}
+	} else if e.level > e.target {
+		e.level -= e.delta
+		if e.level > e.target {
+			return e.level
+		}
+	}
+	// the step is done
+	e.level = e.target
+	if e.step == e.cfg.Sustain && e.down {
+		e.hold = true
+	} else {
+		e.start(e.step + 1)
+	}
+	return e.level
+}
+
+//-----------------------------------------------------------------------------
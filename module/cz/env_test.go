@@ -0,0 +1,97 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Envelope Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// run returns the envelope levels for n samples.
+func run(e *czEnv, n int) []float32 {
+	x := make([]float32, n)
+	for i := range x {
+		x[i] = e.sample()
+	}
+	return x
+}
+
+func Test_RateTime(t *testing.T) {
+	if math.Abs(float64(rateTime(99)-0.001)) > 1e-6 || math.Abs(float64(rateTime(0)-10)) > 1e-3 {
+		t.Errorf("bad rate times %f %f", rateTime(99), rateTime(0))
+	}
+	for r := 1; r < 100; r++ {
+		if rateTime(r) >= rateTime(r-1) {
+			t.Fatalf("rate %d is not faster than rate %d", r, r-1)
+		}
+	}
+}
+
+func Test_Env(t *testing.T) {
+	cfg := &EnvConfig{
+		Rate:    [8]int{99, 50, 50, 99},
+		Level:   [8]int{99, 50, 20, 0},
+		Sustain: 1,
+		End:     3,
+	}
+	e := newEnv(cfg)
+	if e.active() {
+		t.Fatalf("new envelope is active")
+	}
+	e.keyOn()
+	// attack in 1ms, then decay to 50 and hold
+	x := run(&e, core.AudioSampleFrequency)
+	if x[47] < 0.99 || math.Abs(float64(x[len(x)-1])-50.0/99) > 1e-6 || !e.hold {
+		t.Errorf("bad attack/sustain %f %f", x[47], x[len(x)-1])
+	}
+	// the release goes to 20 then 0
+	e.keyOff()
+	run(&e, core.AudioSampleFrequency)
+	if e.active() || e.level != 0 {
+		t.Errorf("envelope is active after the release")
+	}
+
+	// key off before the sustain step
+	e.keyOn()
+	run(&e, 10)
+	e.keyOff()
+	if e.step != 2 {
+		t.Errorf("key off at step %d, expected 2", e.step)
+	}
+
+	// no sustain, a key off during the steps is ignored
+	cfg.Sustain = -1
+	e = newEnv(cfg)
+	e.keyOn()
+	run(&e, 100)
+	e.keyOff()
+	if e.step != 1 {
+		t.Errorf("key off at step %d, expected 1", e.step)
+	}
+
+	// a finished envelope at a non-zero level is released
+	cfg.End = 1
+	e = newEnv(cfg)
+	e.keyOn()
+	run(&e, core.AudioSampleFrequency)
+	if !e.done || !e.active() {
+		t.Errorf("finished envelope is not holding")
+	}
+	e.keyOff()
+	run(&e, core.AudioSampleFrequency)
+	if e.active() {
+		t.Errorf("finished envelope is active after the release")
+	}
+}
+
+//-----------------------------------------------------------------------------
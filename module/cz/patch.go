@@ -0,0 +1,122 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Patch
+
+A polyphonic CZ voice patch for a bank of voices.
+A MIDI program change selects the voice used for new notes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
+	"github.com/deadsy/babi/module/mix"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var patchCzInfo = core.ModuleInfo{
+	Name: "patchCz",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, patchCzMidiIn},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *patchCz) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type patchCz struct {
+	info  core.ModuleInfo // module info
+	ch    uint8           // MIDI channel
+	voice []*VoiceConfig  // voice bank
+	cfg   *VoiceConfig    // current voice
+	poly  core.Module     // polyphony
+	pan   core.Module     // pan left/right
+}
+
+// NewPatch returns a CZ patch for a bank of voices.
+func NewPatch(s *core.Synth, ch uint8, voice []*VoiceConfig) core.Module {
+	log.Info.Printf("")
+
+	const midiCtrl = 7
+
+	m := &patchCz{
+		info:  patchCzInfo,
+		ch:    ch,
+		voice: voice,
+	}
+	m.setProgram(0)
+
+	// polyphony: new voices use the current voice configuration
+	m.poly = midi.NewPoly(s, ch, func(s *core.Synth) core.Module { return NewVoice(s, m.cfg) }, 16)
+	// pan the output to left/right channels
+	m.pan = mix.NewPan(s, ch, midiCtrl)
+
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *patchCz) Child() []core.Module {
+	return []core.Module{m.poly, m.pan}
+}
+
+// Stop performs any cleanup of a module.
+func (m *patchCz) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// setProgram selects the voice for new notes.
+func (m *patchCz) setProgram(n int) {
+	if !core.InEnum(n, len(m.voice)) {
+		log.Info.Printf("no voice for program %d", n)
+		return
+	}
+	m.cfg = m.voice[n]
+	log.Info.Printf("program %d: %s", n, m.cfg.Name)
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func patchCzMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*patchCz)
+	me := e.GetEventMIDIChannel(m.ch)
+	if me != nil {
+		if me.GetType() == core.EventMIDIProgramChange {
+			m.setProgram(int(me.GetProgram()))
+			return
+		}
+		core.EventIn(m.poly, "midi", e)
+		core.EventIn(m.pan, "midi", e)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *patchCz) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	// polyphony
+	var out core.Buf
+	m.poly.Process(&out)
+	// pan left/right
+	m.pan.Process(&out, out0, out1)
+	return true
+}
+
+//-----------------------------------------------------------------------------
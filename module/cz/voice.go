@@ -0,0 +1,133 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Voice
+
+A phase distortion oscillator with DCO (pitch), DCW (wave) and DCA (amplitude)
+8 step envelopes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/osc"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var voiceCzInfo = core.ModuleInfo{
+	Name: "voiceCz",
+	In: []core.PortInfo{
+		{"note", "note value", core.PortTypeFloat, voiceCzNote},
+		{"gate", "voice gate, attack(>0) or release(=0)", core.PortTypeFloat, voiceCzGate},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *voiceCz) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type voiceCz struct {
+	info core.ModuleInfo // module info
+	cfg  *VoiceConfig    // voice configuration
+	osc  core.Module     // phase distortion oscillator
+	dco  czEnv           // pitch envelope
+	dcw  czEnv           // wave envelope
+	dca  czEnv           // amplitude envelope
+	note float32         // current note
+	freq float32         // current oscillator frequency
+	vel  float32         // velocity scaling
+}
+
+// NewVoice returns a CZ voice.
+func NewVoice(s *core.Synth, cfg *VoiceConfig) core.Module {
+	log.Info.Printf("")
+	pd := osc.NewCZ(s)
+	core.EventInInt(pd, "wave", int(cfg.Wave))
+	m := &voiceCz{
+		info: voiceCzInfo,
+		cfg:  cfg,
+		osc:  pd,
+		dco:  newEnv(&cfg.DCO),
+		dcw:  newEnv(&cfg.DCW),
+		dca:  newEnv(&cfg.DCA),
+		vel:  1,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *voiceCz) Child() []core.Module {
+	return []core.Module{m.osc}
+}
+
+// Stop performs any cleanup of a module.
+func (m *voiceCz) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func voiceCzNote(cm core.Module, e *core.Event) {
+	m := cm.(*voiceCz)
+	m.note = e.GetEventFloat().Val
+}
+
+func voiceCzGate(cm core.Module, e *core.Event) {
+	m := cm.(*voiceCz)
+	gate := e.GetEventFloat().Val
+	log.Info.Printf("gate %f", gate)
+	if gate > 0 {
+		m.vel = 1 - m.cfg.Velocity*(1-core.Clamp(gate, 0, 1))
+		m.dco.keyOn()
+		m.dcw.keyOn()
+		m.dca.keyOn()
+	} else {
+		m.dco.keyOff()
+		m.dcw.keyOff()
+		m.dca.keyOff()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *voiceCz) Process(buf ...*core.Buf) bool {
+	if !m.dca.active() {
+		return false
+	}
+	out := buf[0]
+	// the pitch envelope is applied per buffer
+	var pitch float32
+	for range out {
+		pitch = m.dco.sample()
+	}
+	f := m.info.Synth.NoteToFrequency(m.note + pitch*m.cfg.Depth)
+	if f != m.freq {
+		osc.SetCZFrequency(m.osc, f)
+		m.freq = f
+	}
+	// wave envelope
+	var dcw core.Buf
+	for i := range dcw {
+		dcw[i] = m.vel * m.dcw.sample()
+	}
+	m.osc.Process(&dcw, out)
+	// amplitude envelope
+	for i := range out {
+		out[i] *= m.vel * m.dca.sample()
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
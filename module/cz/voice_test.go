@@ -0,0 +1,59 @@
+//-----------------------------------------------------------------------------
+/*
+
+CZ Voice Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package cz
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Voice(t *testing.T) {
+	for _, cfg := range Presets {
+		s := core.NewSynth()
+		m := NewVoice(s, cfg)
+		var out core.Buf
+		if m.Process(&out) {
+			t.Errorf("%s: idle voice is active", cfg.Name)
+		}
+		core.EventInFloat(m, "note", 60)
+		core.EventInFloat(m, "gate", 1)
+		var peak float32
+		for i := 0; i < 100; i++ {
+			if !m.Process(&out) {
+				// a percussive voice
+				break
+			}
+			for _, v := range out {
+				if v > peak {
+					peak = v
+				}
+				if v < -1.01 || v > 1.01 {
+					t.Fatalf("%s: output %f is out of range", cfg.Name, v)
+				}
+			}
+		}
+		if peak == 0 {
+			t.Errorf("%s: no output", cfg.Name)
+		}
+		// release
+		core.EventInFloat(m, "gate", 0)
+		n := 0
+		for m.Process(&out) {
+			n++
+			if n > 20*core.AudioSampleFrequency/core.AudioBufferSize {
+				t.Fatalf("%s: voice is active after the release", cfg.Name)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,79 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Algorithms
+
+An algorithm defines how the 6 operators modulate each other.
+Operators that don't modulate another operator are carriers.
+
+In all algorithms an operator is only modulated by higher numbered
+operators, so the operators can be computed in the order 6..1.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+//-----------------------------------------------------------------------------
+
+type algorithm struct {
+	mod     [6][]int // modulating operators for each operator (0..5 = op1..op6)
+	fbSrc   int      // feedback is taken from the output of this operator
+	fbDst   int      // feedback is the modulation input to this operator
+	carrier [6]bool  // is the operator a carrier?
+}
+
+// alg returns an algorithm from a list of modulators (op numbers are 1..6).
+func alg(fbSrc, fbDst int, mod [6][]int) *algorithm {
+	a := &algorithm{
+		fbSrc: fbSrc - 1,
+		fbDst: fbDst - 1,
+	}
+	for i := range a.carrier {
+		a.carrier[i] = true
+	}
+	for i := range mod {
+		for _, j := range mod[i] {
+			a.mod[i] = append(a.mod[i], j-1)
+			a.carrier[j-1] = false
+		}
+	}
+	return a
+}
+
+var algorithms = [32]*algorithm{
+	alg(6, 6, [6][]int{{2}, nil, {4}, {5}, {6}, nil}),       // 1
+	alg(2, 2, [6][]int{{2}, nil, {4}, {5}, {6}, nil}),       // 2
+	alg(6, 6, [6][]int{{2}, {3}, nil, {5}, {6}, nil}),       // 3
+	alg(4, 6, [6][]int{{2}, {3}, nil, {5}, {6}, nil}),       // 4
+	alg(6, 6, [6][]int{{2}, nil, {4}, nil, {6}, nil}),       // 5
+	alg(5, 6, [6][]int{{2}, nil, {4}, nil, {6}, nil}),       // 6
+	alg(6, 6, [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}),    // 7
+	alg(4, 4, [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}),    // 8
+	alg(2, 2, [6][]int{{2}, nil, {4, 5}, nil, {6}, nil}),    // 9
+	alg(3, 3, [6][]int{{2}, {3}, nil, {5, 6}, nil, nil}),    // 10
+	alg(6, 6, [6][]int{{2}, {3}, nil, {5, 6}, nil, nil}),    // 11
+	alg(2, 2, [6][]int{{2}, nil, {4, 5, 6}, nil, nil, nil}), // 12
+	alg(6, 6, [6][]int{{2}, nil, {4, 5, 6}, nil, nil, nil}), // 13
+	alg(6, 6, [6][]int{{2}, nil, {4}, {5, 6}, nil, nil}),    // 14
+	alg(2, 2, [6][]int{{2}, nil, {4}, {5, 6}, nil, nil}),    // 15
+	alg(6, 6, [6][]int{{2, 3, 5}, nil, {4}, nil, {6}, nil}), // 16
+	alg(2, 2, [6][]int{{2, 3, 5}, nil, {4}, nil, {6}, nil}), // 17
+	alg(3, 3, [6][]int{{2, 3, 4}, nil, nil, {5}, {6}, nil}), // 18
+	alg(6, 6, [6][]int{{2}, {3}, nil, {6}, {6}, nil}),       // 19
+	alg(3, 3, [6][]int{{3}, {3}, nil, {5, 6}, nil, nil}),    // 20
+	alg(3, 3, [6][]int{{3}, {3}, nil, {6}, {6}, nil}),       // 21
+	alg(6, 6, [6][]int{{2}, nil, {6}, {6}, {6}, nil}),       // 22
+	alg(6, 6, [6][]int{nil, {3}, nil, {6}, {6}, nil}),       // 23
+	alg(6, 6, [6][]int{nil, nil, {6}, {6}, {6}, nil}),       // 24
+	alg(6, 6, [6][]int{nil, nil, nil, {6}, {6}, nil}),       // 25
+	alg(6, 6, [6][]int{nil, {3}, nil, {5, 6}, nil, nil}),    // 26
+	alg(3, 3, [6][]int{nil, {3}, nil, {5, 6}, nil, nil}),    // 27
+	alg(5, 5, [6][]int{{2}, nil, {4}, {5}, nil, nil}),       // 28
+	alg(6, 6, [6][]int{nil, nil, {4}, nil, {6}, nil}),       // 29
+	alg(5, 5, [6][]int{nil, nil, {4}, {5}, nil, nil}),       // 30
+	alg(6, 6, [6][]int{nil, nil, nil, nil, {6}, nil}),       // 31
+	alg(6, 6, [6][]int{nil, nil, nil, nil, nil, nil}),       // 32
+}
+
+//-----------------------------------------------------------------------------
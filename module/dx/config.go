@@ -113,12 +113,13 @@ type opConfig struct {
 	freqFine            int // 0..99
 	detune              int // -7..7
 	env                 envConfig
-	breakPoint          core.MidiNote
+	breakPoint          int // 0..99, A-1..C8 (C3 = 39)
 	keyRateScale        int // 0..7
 	leftCurve           curveType
 	leftDepth           int // 0..99
 	rightCurve          curveType
-	rightDepth          int // 0..99
+	rightDepth          int  // 0..99
+	off                 bool // operator is switched off (parameter change only)
 }
 
 var opRowHeader = []string{
@@ -140,8 +141,16 @@ var opRowHeader = []string{
 	"amSens",
 }
 
+// breakPointString returns the note name of the keyboard level scaling break point.
+func (o *opConfig) breakPointString() string {
+	if o.breakPoint < 3 {
+		return []string{"A-1", "A#-1", "B-1"}[core.Max(o.breakPoint, 0)]
+	}
+	return core.MidiNote(o.breakPoint - 3).String()
+}
+
 // row returns a set of row values for this operator.
-// needs to match the column order in (v *voiceConfig) String().
+// needs to match the column order in (v *Voice) String().
 func (o *opConfig) rowStrings() []string {
 	row := make([]string, 0, 16)
 	row = append(row, fmt.Sprintf("op%d", o.idx+1))
@@ -151,11 +160,7 @@ func (o *opConfig) rowStrings() []string {
 	row = append(row, fmt.Sprintf("%d", o.detune))
 	row = append(row, o.env.rateString())
 	row = append(row, o.env.levelString())
-	if o.breakPoint == core.MidiNote(0) {
-		row = append(row, "off")
-	} else {
-		row = append(row, fmt.Sprintf("%s", o.breakPoint))
-	}
+	row = append(row, o.breakPointString())
 	row = append(row, fmt.Sprintf("%s", o.leftCurve))
 	row = append(row, fmt.Sprintf("%d", o.leftDepth))
 	row = append(row, fmt.Sprintf("%s", o.rightCurve))
@@ -170,17 +175,21 @@ func (o *opConfig) rowStrings() []string {
 //-----------------------------------------------------------------------------
 // voice configuration
 
-type voiceConfig struct {
+// Voice is a DX7 voice configuration.
+// Voices are decoded from sysex (DecodeSysex) or JSON (DecodeJSON) data,
+// and played with NewVoice or NewPatch.
+type Voice struct {
 	name      string
 	algorithm int
 	env       envConfig
 	transpose core.MidiNote
 	feedback  int
+	oscSync   bool // reset the operator phases on note on
 	lfo       lfoConfig
 	op        [6]*opConfig
 }
 
-func (v *voiceConfig) String() string {
+func (v *Voice) String() string {
 	var s []string
 	s = append(s, v.name)
 	s = append(s, fmt.Sprintf("transpose %s", v.transpose))
@@ -188,6 +197,7 @@ func (v *voiceConfig) String() string {
 	s = append(s, fmt.Sprintf("level %s", v.env.levelString()))
 	s = append(s, fmt.Sprintf("algorithm %d", v.algorithm+1))
 	s = append(s, fmt.Sprintf("feedback %d", v.feedback))
+	s = append(s, fmt.Sprintf("osc sync %s", core.BoolToString(v.oscSync, []string{"off", "on"})))
 	s = append(s, fmt.Sprintf("%s", &v.lfo))
 	// operators in table form
 	rows := make([][]string, len(v.op)+1)
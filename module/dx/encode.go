@@ -0,0 +1,201 @@
+//-----------------------------------------------------------------------------
+/*
+
+Encode DX7 System Exclusive Buffers
+
+Voice configurations are encoded as single voice (155 byte) or
+32 voice bank (4096 byte packed) sysex messages.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+//-----------------------------------------------------------------------------
+
+// BankSize is the number of voices in a DX7 voice bank.
+const BankSize = 32
+
+//-----------------------------------------------------------------------------
+
+// packed returns the packed (bank format) operator data.
+func (o *opConfig) packed() opData {
+	var d opData
+	for i := 0; i < 4; i++ {
+		d.rate[i] = byte(o.env.rate[i])
+		d.level[i] = byte(o.env.level[i])
+	}
+	d.breakPoint = byte(o.breakPoint)
+	d.leftDepth = byte(o.leftDepth)
+	d.rightDepth = byte(o.rightDepth)
+	d.x0 = byte(o.rightCurve&3)<<2 | byte(o.leftCurve&3)
+	d.x1 = byte((o.detune+7)&15)<<3 | byte(o.keyRateScale&7)
+	d.x2 = byte(o.velocitySensitivity&7)<<2 | byte(o.amSensitivity&3)
+	d.outputLevel = byte(o.outputLevel)
+	d.x3 = byte(o.freqCoarse&31)<<1 | byte(o.oscMode&1)
+	d.freqFine = byte(o.freqFine)
+	return d
+}
+
+// unpacked returns the unpacked (single voice format) operator data.
+func (o *opConfig) unpacked() op155Data {
+	var d op155Data
+	for i := 0; i < 4; i++ {
+		d.rate[i] = byte(o.env.rate[i])
+		d.level[i] = byte(o.env.level[i])
+	}
+	d.breakPoint = byte(o.breakPoint)
+	d.leftDepth = byte(o.leftDepth)
+	d.rightDepth = byte(o.rightDepth)
+	d.leftCurve = byte(o.leftCurve & 3)
+	d.rightCurve = byte(o.rightCurve & 3)
+	d.rateScale = byte(o.keyRateScale & 7)
+	d.ampModSensitivity = byte(o.amSensitivity & 3)
+	d.velocitySensitivity = byte(o.velocitySensitivity & 7)
+	d.outputLevel = byte(o.outputLevel)
+	d.oscMode = byte(o.oscMode & 1)
+	d.freqCoarse = byte(o.freqCoarse & 31)
+	d.freqFine = byte(o.freqFine)
+	d.detune = byte((o.detune + 7) & 15)
+	return d
+}
+
+// nameBytes returns the voice name as 10 bytes (space padded).
+func (v *Voice) nameBytes() [10]byte {
+	var name [10]byte
+	for i := range name {
+		name[i] = ' '
+	}
+	copy(name[:], v.name)
+	return name
+}
+
+// packed returns the packed (bank format) voice data.
+func (v *Voice) packed() voice128Data {
+	var d voice128Data
+	for i := range d.op {
+		d.op[i] = v.op[5-i].packed()
+	}
+	for i := 0; i < 4; i++ {
+		d.pRate[i] = byte(v.env.rate[i])
+		d.pLevel[i] = byte(v.env.level[i])
+	}
+	d.algorithm = byte(v.algorithm & 31)
+	d.keySyncFeedback = byte(v.feedback & 7)
+	if v.oscSync {
+		d.keySyncFeedback |= 8
+	}
+	d.lfoSpeed = byte(v.lfo.speed)
+	d.lfoDelay = byte(v.lfo.delay)
+	d.lfoPhaseModDepth = byte(v.lfo.pmDepth)
+	d.lfoAmpModDepth = byte(v.lfo.amDepth)
+	d.x2 = byte(v.lfo.pms&7)<<4 | byte(v.lfo.wave&7)<<1
+	if v.lfo.sync {
+		d.x2 |= 1
+	}
+	d.transpose = byte(v.transpose - 12)
+	d.name = v.nameBytes()
+	return d
+}
+
+// unpacked returns the unpacked (single voice format) voice data.
+func (v *Voice) unpacked() voice155Data {
+	var d voice155Data
+	for i := range d.op {
+		d.op[i] = v.op[5-i].unpacked()
+	}
+	for i := 0; i < 4; i++ {
+		d.pRate[i] = byte(v.env.rate[i])
+		d.pLevel[i] = byte(v.env.level[i])
+	}
+	d.algorithm = byte(v.algorithm & 31)
+	d.feedback = byte(v.feedback & 7)
+	if v.oscSync {
+		d.oscSync = 1
+	}
+	d.lfoSpeed = byte(v.lfo.speed)
+	d.lfoDelay = byte(v.lfo.delay)
+	d.lfoPhaseModDepth = byte(v.lfo.pmDepth)
+	d.lfoAmpModDepth = byte(v.lfo.amDepth)
+	if v.lfo.sync {
+		d.lfoSync = 1
+	}
+	d.lfoWave = byte(v.lfo.wave)
+	d.lfoPms = byte(v.lfo.pms & 7)
+	d.transpose = byte(v.transpose - 12)
+	d.name = v.nameBytes()
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+// encodeSysex returns a voice data sysex message.
+func encodeSysex(formatNum byte, data []byte) []byte {
+	n := len(data)
+	buf := make([]byte, 0, n+8)
+	buf = append(buf, midiStatusSysexStart, midiIDYamaha, 0)
+	buf = append(buf, formatNum, byte(n>>7)&0x7f, byte(n)&0x7f)
+	buf = append(buf, data...)
+	buf = append(buf, checksum(data), midiStatusSysexEnd)
+	return buf
+}
+
+// EncodeVoice returns a single voice sysex message.
+func EncodeVoice(v *Voice) []byte {
+	d := v.unpacked()
+	data := (*[unsafe.Sizeof(voice155Data{})]byte)(unsafe.Pointer(&d))
+	return encodeSysex(0, data[:])
+}
+
+// EncodeBank returns a 32 voice bank sysex message.
+// Banks with less than 32 voices are filled with the initial voice.
+func EncodeBank(v []*Voice) ([]byte, error) {
+	if len(v) > BankSize {
+		return nil, fmt.Errorf("too many voices for a bank: %d", len(v))
+	}
+	var d voices32
+	for i := range d {
+		if i < len(v) {
+			d[i] = v[i].packed()
+		} else {
+			d[i] = InitVoice().packed()
+		}
+	}
+	data := (*[unsafe.Sizeof(voices32{})]byte)(unsafe.Pointer(&d))
+	return encodeSysex(9, data[:]), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// InitVoice returns the DX7 initial voice.
+func InitVoice() *Voice {
+	v := &Voice{
+		name:      "INIT VOICE",
+		env:       envConfig{rate: [4]int{99, 99, 99, 99}, level: [4]int{50, 50, 50, 50}},
+		transpose: 36, // C3
+		oscSync:   true,
+		lfo:       lfoConfig{speed: 35, pms: 3, sync: true},
+	}
+	for i := range v.op {
+		v.op[i] = &opConfig{
+			idx:        i,
+			env:        envConfig{rate: [4]int{99, 99, 99, 99}, level: [4]int{99, 99, 99, 0}},
+			breakPoint: 39, // C3
+			freqCoarse: 1,
+		}
+	}
+	v.op[0].outputLevel = 99
+	return v
+}
+
+// Name returns the voice name.
+func (v *Voice) Name() string {
+	return v.name
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,110 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Sysex Encoder Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Encode(t *testing.T) {
+	tests := []struct {
+		path string
+	}{
+		{"./test/rom1a.syx"},
+		{"./test/021.syx"},
+		{"./test/060.syx"},
+	}
+
+	for _, v := range tests {
+		buf, err := ioutil.ReadFile(v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, err := DecodeSysex(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// sysex round trip
+		var x []byte
+		if len(cfg) == 1 {
+			x = EncodeVoice(cfg[0])
+		} else {
+			x, err = EncodeBank(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(x, buf) {
+			t.Errorf("%s: encoded sysex does not match", v.path)
+		}
+
+		// json round trip
+		j, err := EncodeJSON(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jcfg, err := DecodeJSON(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range cfg {
+			if jcfg[i].String() != cfg[i].String() {
+				t.Errorf("%s: json voice %d does not match", v.path, i)
+			}
+		}
+	}
+}
+
+func Test_EncodeBank(t *testing.T) {
+	// a short bank is filled with the initial voice
+	buf, err := EncodeBank([]*Voice{InitVoice()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, n, err := DecodeSysex(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4104 || len(cfg) != BankSize {
+		t.Fatalf("bad bank: %d bytes, %d voices", n, len(cfg))
+	}
+	if cfg[31].name != "INIT VOICE" {
+		t.Errorf("bad voice name %q", cfg[31].name)
+	}
+	// a single voice converts to the same voice in a bank
+	single, _, err := DecodeSysex(EncodeVoice(InitVoice()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single[0].String() != cfg[0].String() {
+		t.Errorf("single voice and bank voice do not match")
+	}
+
+	if _, err := EncodeBank(make([]*Voice, BankSize+1)); err == nil {
+		t.Errorf("expected an error for a large bank")
+	}
+
+	// out of range json values
+	if _, err := DecodeJSON([]byte(`[{"name":"BAD","algorithm":33}]`)); err == nil {
+		t.Errorf("expected an error for a bad algorithm")
+	}
+	if _, err := DecodeJSON([]byte(`[{"name":"CAF\u00c9","algorithm":1}]`)); err == nil {
+		t.Errorf("expected an error for a non-ASCII name")
+	}
+	if _, err := DecodeJSON([]byte(`[{"name":"CAFE","algorithm":1}]`)); err != nil {
+		t.Error(err)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -79,6 +79,7 @@ type envDx struct {
 	qr             int
 	shift          int
 	decayIncrement float32 // decay increment
+	rateScaling    int     // keyboard rate scaling (added to the qrate)
 }
 
 // NewEnv returns an DX7 envelope module.
@@ -88,6 +89,7 @@ func NewEnv(s *core.Synth, levels, rates *[4]int) core.Module {
 		info:   envDxInfo,
 		levels: levels,
 		rates:  rates,
+		state:  4,
 	}
 	return s.Register(m)
 }
@@ -109,19 +111,35 @@ func envDxGate(cm core.Module, e *core.Event) {
 	gate := e.GetEventFloat().Val
 	log.Info.Printf("gate %f", gate)
 	if gate != 0 {
-		// note on
-		m.down = true
-		m.idx = 0
-		m.advance(0)
+		m.keyOn()
 	} else {
-		// note off
-		m.down = false
-		m.advance(3)
+		m.keyOff()
 	}
 }
 
 //-----------------------------------------------------------------------------
 
+// keyOn starts the attack phase of the envelope.
+func (m *envDx) keyOn() {
+	m.down = true
+	m.idx = 0
+	m.advance(0)
+}
+
+// keyOff starts the release phase of the envelope.
+func (m *envDx) keyOff() {
+	m.down = false
+	m.advance(3)
+}
+
+// active returns true if the envelope is still changing, or if it has
+// finished at a non-zero L4 (the DX7 holds that level until the next key on).
+func (m *envDx) active() bool {
+	return m.state < 4 || m.level > 0
+}
+
+//-----------------------------------------------------------------------------
+
 const envAccurate = true
 
 var envmask = [4][8]int{
@@ -173,15 +191,14 @@ func (m *envDx) advance(newstate int) {
 		newlevel := m.levels[m.state]
 		m.targetlevel = float32(core.Max(0, (outputLevel[newlevel]<<5)-224))
 		m.rising = (m.targetlevel - m.level) > 0
-		rateScaling := 0
-		m.qr = core.Min(63, rateScaling+((m.rates[m.state]*41)>>6))
+		m.qr = core.Min(63, m.rateScaling+((m.rates[m.state]*41)>>6))
 		m.shift = (m.qr >> 2) - 11
 		m.decayIncrement = core.Pow2(float32(m.shift))
 	}
 }
 
-// sample generates an envelope sample.
-func (m *envDx) sample() float32 {
+// nextLevel generates an envelope level sample (DX7 level units, 0..4095).
+func (m *envDx) nextLevel() float32 {
 	if m.state < 3 || (m.state < 4 && !m.down) {
 		lev := m.level
 		if m.rising {
@@ -208,13 +225,18 @@ func (m *envDx) sample() float32 {
 		m.level = lev
 	}
 	m.idx++
+	return m.level
+}
+
+// sample generates an envelope sample.
+func (m *envDx) sample() float32 {
 	// Convert DX7 level -> dB -> amplitude
-	return outputLUT[int(math.Floor(float64(m.level)))]
+	return outputLUT[int(math.Floor(float64(m.nextLevel())))]
 }
 
 // Process runs the module DSP.
 func (m *envDx) Process(buf ...*core.Buf) bool {
-	if m.state >= 4 {
+	if !m.active() {
 		return false
 	}
 	out := buf[0]
@@ -0,0 +1,36 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Envelope Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/module/env"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_EnvLevels(t *testing.T) {
+	// dB of a DX7 envelope level, as used by envDx
+	db := func(l int) float64 {
+		return float64((outputLevel[l]<<5)-224-3824) * 0.0235
+	}
+	rates := [4]int{99, 99, 99, 99}
+	// outputLevel is linear above level 20
+	for l := 20; l <= 99; l++ {
+		shape := env.DXShape(&[4]int{l, l, l, 0}, &rates)
+		x := 20 * math.Log10(float64(shape.Points[0].Level))
+		if math.Abs(x-(db(l)-db(99))) > 0.25 {
+			t.Errorf("level %d is %f dB, expected %f dB", l, x, db(l)-db(99))
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,221 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Voice JSON
+
+Voice banks in a readable JSON form, so patches can be edited and version
+controlled. Values are the DX7 front panel values (e.g. algorithm 1..32,
+detune -7..7), operators are listed in op1..op6 order.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+type envJSON struct {
+	Rate  [4]int `json:"rate"`
+	Level [4]int `json:"level"`
+}
+
+type lfoJSON struct {
+	Wave    int  `json:"wave"` // 0..5: tri, sw-, sw+, sqr, sin, s&h
+	Speed   int  `json:"speed"`
+	Delay   int  `json:"delay"`
+	PMDepth int  `json:"pmDepth"`
+	AMDepth int  `json:"amDepth"`
+	PMS     int  `json:"pms"`
+	Sync    bool `json:"sync"`
+}
+
+type opJSON struct {
+	OscMode             int     `json:"oscMode"` // 0 = ratio, 1 = fixed
+	FreqCoarse          int     `json:"freqCoarse"`
+	FreqFine            int     `json:"freqFine"`
+	Detune              int     `json:"detune"`
+	Env                 envJSON `json:"env"`
+	BreakPoint          int     `json:"breakPoint"`
+	LeftCurve           int     `json:"leftCurve"` // 0..3: -lin, -exp, +exp, +lin
+	LeftDepth           int     `json:"leftDepth"`
+	RightCurve          int     `json:"rightCurve"`
+	RightDepth          int     `json:"rightDepth"`
+	KeyRateScale        int     `json:"keyRateScale"`
+	OutputLevel         int     `json:"outputLevel"`
+	VelocitySensitivity int     `json:"velocitySensitivity"`
+	AMSensitivity       int     `json:"amSensitivity"`
+}
+
+type voiceJSON struct {
+	Name      string    `json:"name"`
+	Algorithm int       `json:"algorithm"`
+	Feedback  int       `json:"feedback"`
+	OscSync   bool      `json:"oscSync"`
+	Transpose int       `json:"transpose"` // 0..48, C3 = 24
+	PitchEnv  envJSON   `json:"pitchEnv"`
+	LFO       lfoJSON   `json:"lfo"`
+	Op        [6]opJSON `json:"op"`
+}
+
+//-----------------------------------------------------------------------------
+
+func (e *envConfig) toJSON() envJSON {
+	return envJSON{Rate: e.rate, Level: e.level}
+}
+
+func (v *Voice) toJSON() *voiceJSON {
+	j := &voiceJSON{
+		Name:      v.name,
+		Algorithm: v.algorithm + 1,
+		Feedback:  v.feedback,
+		OscSync:   v.oscSync,
+		Transpose: int(v.transpose) - 12,
+		PitchEnv:  v.env.toJSON(),
+		LFO: lfoJSON{
+			Wave:    int(v.lfo.wave),
+			Speed:   v.lfo.speed,
+			Delay:   v.lfo.delay,
+			PMDepth: v.lfo.pmDepth,
+			AMDepth: v.lfo.amDepth,
+			PMS:     v.lfo.pms,
+			Sync:    v.lfo.sync,
+		},
+	}
+	for i, o := range v.op {
+		j.Op[i] = opJSON{
+			OscMode:             int(o.oscMode),
+			FreqCoarse:          o.freqCoarse,
+			FreqFine:            o.freqFine,
+			Detune:              o.detune,
+			Env:                 o.env.toJSON(),
+			BreakPoint:          o.breakPoint,
+			LeftCurve:           int(o.leftCurve),
+			LeftDepth:           o.leftDepth,
+			RightCurve:          int(o.rightCurve),
+			RightDepth:          o.rightDepth,
+			KeyRateScale:        o.keyRateScale,
+			OutputLevel:         o.outputLevel,
+			VelocitySensitivity: o.velocitySensitivity,
+			AMSensitivity:       o.amSensitivity,
+		}
+	}
+	return j
+}
+
+//-----------------------------------------------------------------------------
+
+// rangeCheck accumulates the first out of range value.
+type rangeCheck struct {
+	err error
+}
+
+func (r *rangeCheck) check(name string, x, lo, hi int) int {
+	if r.err == nil && (x < lo || x > hi) {
+		r.err = fmt.Errorf("%s is out of range (%d..%d): %d", name, lo, hi, x)
+	}
+	return x
+}
+
+func (r *rangeCheck) env(name string, e *envJSON) envConfig {
+	var cfg envConfig
+	for i := 0; i < 4; i++ {
+		cfg.rate[i] = r.check(fmt.Sprintf("%s rate %d", name, i+1), e.Rate[i], 0, 99)
+		cfg.level[i] = r.check(fmt.Sprintf("%s level %d", name, i+1), e.Level[i], 0, 99)
+	}
+	return cfg
+}
+
+func (j *voiceJSON) toConfig() (*Voice, error) {
+	var r rangeCheck
+	if len(j.Name) > 10 {
+		return nil, fmt.Errorf("voice name is too long: %q", j.Name)
+	}
+	// the name bytes are sysex data bytes
+	for i := 0; i < len(j.Name); i++ {
+		if j.Name[i] >= 0x80 {
+			return nil, fmt.Errorf("voice name is not 7-bit ASCII: %q", j.Name)
+		}
+	}
+	v := &Voice{
+		name:      j.Name,
+		algorithm: r.check("algorithm", j.Algorithm, 1, 32) - 1,
+		feedback:  r.check("feedback", j.Feedback, 0, 7),
+		oscSync:   j.OscSync,
+		transpose: core.MidiNote(r.check("transpose", j.Transpose, 0, 48) + 12),
+		env:       r.env("pitch env", &j.PitchEnv),
+		lfo: lfoConfig{
+			wave:    lfoWaveType(r.check("lfo wave", j.LFO.Wave, 0, 5)),
+			speed:   r.check("lfo speed", j.LFO.Speed, 0, 99),
+			delay:   r.check("lfo delay", j.LFO.Delay, 0, 99),
+			pmDepth: r.check("lfo pmDepth", j.LFO.PMDepth, 0, 99),
+			amDepth: r.check("lfo amDepth", j.LFO.AMDepth, 0, 99),
+			pms:     r.check("lfo pms", j.LFO.PMS, 0, 7),
+			sync:    j.LFO.Sync,
+		},
+	}
+	// pad the name to 10 characters
+	padded := v.nameBytes()
+	v.name = string(padded[:])
+	for i := range j.Op {
+		o := &j.Op[i]
+		name := fmt.Sprintf("op%d", i+1)
+		v.op[i] = &opConfig{
+			idx:                 i,
+			oscMode:             oscModeType(r.check(name+" oscMode", o.OscMode, 0, 1)),
+			freqCoarse:          r.check(name+" freqCoarse", o.FreqCoarse, 0, 31),
+			freqFine:            r.check(name+" freqFine", o.FreqFine, 0, 99),
+			detune:              r.check(name+" detune", o.Detune, -7, 7),
+			env:                 r.env(name, &o.Env),
+			breakPoint:          r.check(name+" breakPoint", o.BreakPoint, 0, 99),
+			leftCurve:           curveType(r.check(name+" leftCurve", o.LeftCurve, 0, 3)),
+			leftDepth:           r.check(name+" leftDepth", o.LeftDepth, 0, 99),
+			rightCurve:          curveType(r.check(name+" rightCurve", o.RightCurve, 0, 3)),
+			rightDepth:          r.check(name+" rightDepth", o.RightDepth, 0, 99),
+			keyRateScale:        r.check(name+" keyRateScale", o.KeyRateScale, 0, 7),
+			outputLevel:         r.check(name+" outputLevel", o.OutputLevel, 0, 99),
+			velocitySensitivity: r.check(name+" velocitySensitivity", o.VelocitySensitivity, 0, 7),
+			amSensitivity:       r.check(name+" amSensitivity", o.AMSensitivity, 0, 3),
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%s: %s", j.Name, r.err)
+	}
+	return v, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// EncodeJSON returns the JSON form of a list of voices.
+func EncodeJSON(v []*Voice) ([]byte, error) {
+	j := make([]*voiceJSON, len(v))
+	for i := range v {
+		j[i] = v[i].toJSON()
+	}
+	return json.MarshalIndent(j, "", "  ")
+}
+
+// DecodeJSON returns a list of voices from the JSON form.
+func DecodeJSON(buf []byte) ([]*Voice, error) {
+	var j []*voiceJSON
+	err := json.Unmarshal(buf, &j)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]*Voice, len(j))
+	for i := range j {
+		v[i], err = j[i].toConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Parameter Changes
+
+Voice parameters are numbered by their offset in the 155 byte single voice
+data, with parameter 155 switching the operators on/off.
+
+Function parameters are the global (not per voice) DX7 settings.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+// voice parameters
+
+// voiceParamOpEnable is the operator on/off parameter number.
+// The value has a bit per operator, op1 = bit 5 ... op6 = bit 0.
+const voiceParamOpEnable = 155
+
+// voiceParamMax returns the maximum value of a voice parameter.
+func voiceParamMax(param int) int {
+	n := len(op155Max) * 6
+	if param < n {
+		return int(op155Max[param%len(op155Max)])
+	}
+	return int(voice155Max[param-n])
+}
+
+// setParam sets a voice parameter.
+func (v *Voice) setParam(param, value int) error {
+	if param == voiceParamOpEnable {
+		for i, o := range v.op {
+			o.off = value&(1<<uint(5-i)) == 0
+		}
+		return nil
+	}
+	if !core.InEnum(param, voiceParamOpEnable) {
+		return fmt.Errorf("bad voice parameter number: %d", param)
+	}
+	var r rangeCheck
+	r.check(fmt.Sprintf("voice parameter %d", param), value, 0, voiceParamMax(param))
+	if r.err != nil {
+		return r.err
+	}
+	// set the parameter in the single voice data and convert it back
+	d := v.unpacked()
+	buf := (*[unsafe.Sizeof(voice155Data{})]byte)(unsafe.Pointer(&d))
+	buf[param] = byte(value)
+	x := d.convert()
+	// The voice and operator configurations are referenced by running voices,
+	// so update them in place.
+	op := v.op
+	for i := range op {
+		off := op[i].off
+		*op[i] = *x.op[i]
+		op[i].off = off
+	}
+	x.op = op
+	*v = *x
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// function parameters
+
+const fnParamBase = 64 // first function parameter number
+const fnParamMax = 14  // number of function parameters
+
+var fnParamName = [fnParamMax]string{
+	"mono",
+	"pitch bend range",
+	"pitch bend step",
+	"portamento mode",
+	"portamento glissando",
+	"portamento time",
+	"mod wheel range",
+	"mod wheel assign",
+	"foot control range",
+	"foot control assign",
+	"breath control range",
+	"breath control assign",
+	"aftertouch range",
+	"aftertouch assign",
+}
+
+var fnParamMaxValue = [fnParamMax]int{1, 12, 12, 1, 1, 99, 99, 7, 99, 7, 99, 7, 99, 7}
+
+// fnConfig is the DX7 function configuration.
+type fnConfig struct {
+	param [fnParamMax]int // function parameters 64..77
+}
+
+// setParam sets a function parameter.
+func (f *fnConfig) setParam(param, value int) error {
+	i := param - fnParamBase
+	if !core.InEnum(i, fnParamMax) {
+		return fmt.Errorf("bad function parameter number: %d", param)
+	}
+	f.param[i] = core.ClampInt(value, 0, fnParamMaxValue[i])
+	return nil
+}
+
+func (f *fnConfig) String() string {
+	rows := make([][]string, fnParamMax)
+	for i := range f.param {
+		rows[i] = []string{fnParamName[i], fmt.Sprintf("%d", f.param[i])}
+	}
+	return core.TableString(rows, nil, 1)
+}
+
+//-----------------------------------------------------------------------------
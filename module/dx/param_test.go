@@ -0,0 +1,143 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Parameter Change Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// paramSysex returns a parameter change sysex message.
+func paramSysex(device, group, param, value int) []byte {
+	return []byte{
+		midiStatusSysexStart, midiIDYamaha, byte(0x10 | device),
+		byte(group<<2 | param>>7), byte(param & 0x7f), byte(value),
+		midiStatusSysexEnd,
+	}
+}
+
+func Test_ParamChange(t *testing.T) {
+	msg, n, err := decodeSysex(paramSysex(3, paramGroupVoice, 134, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 || msg.device != 3 || msg.voice != nil {
+		t.Fatalf("bad parameter change message")
+	}
+	if *msg.param != (paramChange{paramGroupVoice, 134, 5}) {
+		t.Errorf("bad parameter change %v", *msg.param)
+	}
+	// parameter numbers > 127
+	msg, _, err = decodeSysex(paramSysex(0, paramGroupVoice, voiceParamOpEnable, 0x3e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.param.param != voiceParamOpEnable {
+		t.Errorf("bad parameter number %d", msg.param.param)
+	}
+	// bad parameters
+	if _, _, err := decodeSysex(paramSysex(0, paramGroupVoice, 200, 0)); err == nil {
+		t.Errorf("expected an error for a bad voice parameter")
+	}
+	if _, _, err := decodeSysex(paramSysex(0, paramGroupFunction, 10, 0)); err == nil {
+		t.Errorf("expected an error for a bad function parameter")
+	}
+	if _, _, err := decodeSysex(paramSysex(0, 1, 0, 0)); err == nil {
+		t.Errorf("expected an error for a bad parameter group")
+	}
+}
+
+func Test_SetParam(t *testing.T) {
+	v := InitVoice()
+	op1 := v.op[0]
+	tests := []struct {
+		param, value int
+		check        func() bool
+	}{
+		{134, 21, func() bool { return v.algorithm == 21 }},
+		{135, 6, func() bool { return v.feedback == 6 }},
+		{144, 36, func() bool { return v.transpose == 48 }},
+		{145, 'X', func() bool { return v.name == "XNIT VOICE" }},
+		{5*21 + 16, 50, func() bool { return op1.outputLevel == 50 }}, // op1 output level
+		{0*21 + 20, 10, func() bool { return v.op[5].detune == 3 }},   // op6 detune
+		{voiceParamOpEnable, 0x1f, func() bool { return op1.off && !v.op[1].off }},
+	}
+	for i, x := range tests {
+		if err := v.setParam(x.param, x.value); err != nil {
+			t.Fatal(err)
+		}
+		if !x.check() {
+			t.Errorf("test %d: parameter %d was not set", i, x.param)
+		}
+	}
+	// the operator configuration is updated in place
+	if v.op[0] != op1 {
+		t.Errorf("operator configuration was replaced")
+	}
+	// out of range values are rejected
+	for _, x := range [][2]int{{5*21 + 16, 127}, {5*21 + 4, 100}, {0*21 + 20, 15}, {134, 32}, {142, 6}, {144, 49}} {
+		if err := v.setParam(x[0], x[1]); err == nil {
+			t.Errorf("parameter %d: expected an error for value %d", x[0], x[1])
+		}
+	}
+	if op1.outputLevel != 50 || op1.env.level[0] != 99 || v.algorithm != 21 || v.transpose != 48 {
+		t.Errorf("out of range values changed the voice")
+	}
+
+	var fn fnConfig
+	if err := fn.setParam(65, 12); err != nil || fn.param[1] != 12 {
+		t.Errorf("pitch bend range was not set")
+	}
+}
+
+func Test_PatchParamChange(t *testing.T) {
+	s := core.NewSynth()
+	p := NewPatch(s, 0, []*Voice{InitVoice()})
+	m := p.(*patchDx)
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100))
+	v := m.poly.Child()[0].(*voiceDx)
+
+	// change the algorithm of the running voice
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(0, paramGroupVoice, 134, 31)))
+	if m.cfg.algorithm != 31 || v.alg != algorithms[31] {
+		t.Errorf("algorithm was not changed")
+	}
+	// change the op1 coarse frequency of the running voice
+	xstep := v.op[0].xstep
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(0, paramGroupVoice, 5*21+18, 2)))
+	if d := int(v.op[0].xstep) - 2*int(xstep); d < -2 || d > 2 {
+		t.Errorf("frequency was not changed")
+	}
+	// other devices are ignored
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(1, paramGroupVoice, 134, 0)))
+	if m.cfg.algorithm != 31 {
+		t.Errorf("parameter change for another device changed the voice")
+	}
+	// function parameters
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(0, paramGroupFunction, 65, 7)))
+	if m.fn.param[1] != 7 {
+		t.Errorf("function parameter was not set")
+	}
+	// out of range values are ignored
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(0, paramGroupVoice, 5*21+16, 127)))
+	core.EventIn(p, "midi", core.NewEventSysex(paramSysex(0, paramGroupVoice, 5*21+4, 127)))
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 62, 100))
+	var out0, out1 core.Buf
+	p.Process(&out0, &out1)
+	// a single voice replaces the current voice
+	core.EventIn(p, "midi", core.NewEventSysex(EncodeVoice(InitVoice())))
+	if m.cfg.algorithm != 0 || m.voice[0] != m.cfg {
+		t.Errorf("single voice did not replace the current voice")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,182 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Patch
+
+A polyphonic DX7 voice patch for a bank of voices.
+A MIDI program change selects the voice used for new notes.
+
+DX7 sysex messages for the patch channel are handled:
+
+* A single voice replaces the current voice.
+* A 32 voice bank replaces the bank.
+* A voice parameter change edits the current voice (and any running voices).
+* A function parameter change sets the function configuration.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
+	"github.com/deadsy/babi/module/mix"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var patchDxInfo = core.ModuleInfo{
+	Name: "patchDx",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, patchDxMidiIn},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the general module information.
+func (m *patchDx) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type patchDx struct {
+	info    core.ModuleInfo // module info
+	ch      uint8           // MIDI channel
+	voice   []*Voice        // voice bank
+	program int             // current program
+	cfg     *Voice          // current voice
+	fn      fnConfig        // function configuration
+	poly    core.Module     // polyphony
+	pan     core.Module     // pan left/right
+}
+
+// NewPatch returns a DX7 patch for a bank of voices.
+func NewPatch(s *core.Synth, ch uint8, voice []*Voice) core.Module {
+	log.Info.Printf("")
+
+	const midiCtrl = 7
+
+	m := &patchDx{
+		info:  patchDxInfo,
+		ch:    ch,
+		voice: voice,
+	}
+	m.setProgram(0)
+
+	// polyphony: new voices use the current voice configuration
+	m.poly = midi.NewPoly(s, ch, func(s *core.Synth) core.Module { return NewVoice(s, m.cfg) }, 16)
+	// pan the output to left/right channels
+	m.pan = mix.NewPan(s, ch, midiCtrl)
+
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *patchDx) Child() []core.Module {
+	return []core.Module{m.poly, m.pan}
+}
+
+// Stop performs any cleanup of a module.
+func (m *patchDx) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// setProgram selects the voice for new notes.
+func (m *patchDx) setProgram(n int) {
+	if !core.InEnum(n, len(m.voice)) {
+		log.Info.Printf("no voice for program %d", n)
+		return
+	}
+	m.program = n
+	m.cfg = m.voice[n]
+	log.Info.Printf("program %d: %s", n, m.cfg.name)
+}
+
+// update applies changes in the current voice to the running voices.
+func (m *patchDx) update() {
+	for _, c := range m.poly.Child() {
+		if v, ok := c.(*voiceDx); ok && v.cfg == m.cfg {
+			v.update()
+		}
+	}
+}
+
+// sysex handles DX7 sysex messages.
+func (m *patchDx) sysex(buf []byte) {
+	msg, _, err := decodeSysex(buf)
+	if err != nil {
+		log.Info.Printf("%s", err)
+		return
+	}
+	if msg.device != int(m.ch) {
+		return
+	}
+	switch {
+	case len(msg.voice) == 1:
+		// replace the current voice
+		m.voice[m.program] = msg.voice[0]
+		m.setProgram(m.program)
+	case len(msg.voice) != 0:
+		// replace the bank
+		m.voice = msg.voice
+		m.setProgram(core.Min(m.program, len(m.voice)-1))
+	case msg.param != nil:
+		pc := msg.param
+		switch pc.group {
+		case paramGroupVoice:
+			err = m.cfg.setParam(pc.param, pc.value)
+			m.update()
+		case paramGroupFunction:
+			err = m.fn.setParam(pc.param, pc.value)
+		}
+		if err != nil {
+			log.Info.Printf("%s", err)
+			return
+		}
+		log.Info.Printf("parameter change group %d param %d value %d", pc.group, pc.param, pc.value)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func patchDxMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*patchDx)
+	se := e.GetEventSysex()
+	if se != nil {
+		m.sysex(se.Data)
+		return
+	}
+	me := e.GetEventMIDIChannel(m.ch)
+	if me != nil {
+		if me.GetType() == core.EventMIDIProgramChange {
+			m.setProgram(int(me.GetProgram()))
+			return
+		}
+		core.EventIn(m.poly, "midi", e)
+		core.EventIn(m.pan, "midi", e)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *patchDx) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	// polyphony
+	var out core.Buf
+	m.poly.Process(&out)
+	// pan left/right
+	m.pan.Process(&out, out0, out1)
+	return true
+}
+
+//-----------------------------------------------------------------------------
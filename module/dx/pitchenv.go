@@ -0,0 +1,105 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Pitch Envelope Generator
+
+https://github.com/asb2m10/dexed/blob/master/Source/msfa/pitchenv.cc
+
+The envelope level is a log frequency offset (1 << 24 is one octave).
+The envelope is updated once per audio buffer.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// pitchEnvUnit is the level increment per audio buffer for a rate value of 1.
+// A rate value of 1 changes the pitch by 1/21.3 octaves per second.
+var pitchEnvUnit = int(math.Floor(core.AudioBufferSize*(1<<24)/(21.3*core.AudioSampleFrequency) + 0.5))
+
+// pitchEnvRate maps a pitch envelope rate (0..99) to a rate value.
+var pitchEnvRate = [100]int{
+	1, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13,
+	13, 14, 14, 15, 16, 16, 17, 18, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28,
+	30, 31, 33, 34, 36, 37, 38, 39, 41, 42, 44, 46, 47, 49, 51, 53, 54, 56, 58,
+	60, 62, 64, 66, 68, 70, 72, 74, 76, 79, 82, 85, 88, 91, 94, 98, 102, 106,
+	110, 115, 120, 125, 130, 135, 141, 147, 153, 159, 165, 171, 178, 185, 193,
+	202, 211, 232, 243, 254, 255,
+}
+
+// pitchEnvLevel maps a pitch envelope level (0..99) to a pitch offset (128 = 4 octaves).
+var pitchEnvLevel = [100]int{
+	-128, -116, -104, -95, -85, -76, -68, -61, -56, -52, -49, -46, -43, -41,
+	-39, -37, -35, -33, -32, -31, -30, -29, -28, -27, -26, -25, -24, -23, -22,
+	-21, -20, -19, -18, -17, -16, -15, -14, -13, -12, -11, -10, -9, -8, -7, -6,
+	-5, -4, -3, -2, -1, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+	35, 38, 40, 43, 46, 49, 53, 58, 65, 73, 82, 92, 103, 115, 127,
+}
+
+//-----------------------------------------------------------------------------
+
+type pitchEnv struct {
+	cfg         *envConfig // rates and levels
+	level       int        // current level
+	targetlevel int        // target level
+	inc         int        // level increment per audio buffer
+	state       int        // current state
+	rising      bool       // rising or falling?
+	down        bool       // key state
+}
+
+// keyOn starts the pitch envelope from the release level.
+func (e *pitchEnv) keyOn() {
+	e.level = pitchEnvLevel[e.cfg.level[3]] << 19
+	e.down = true
+	e.advance(0)
+}
+
+// keyOff starts the release phase of the pitch envelope.
+func (e *pitchEnv) keyOff() {
+	if e.down {
+		e.down = false
+		e.advance(3)
+	}
+}
+
+// advance moves to the next envelope state.
+func (e *pitchEnv) advance(newstate int) {
+	e.state = newstate
+	if e.state < 4 {
+		e.targetlevel = pitchEnvLevel[e.cfg.level[e.state]] << 19
+		e.rising = e.targetlevel > e.level
+		e.inc = pitchEnvRate[e.cfg.rate[e.state]] * pitchEnvUnit
+	}
+}
+
+// sample generates a pitch envelope sample (once per audio buffer).
+func (e *pitchEnv) sample() int {
+	if e.state < 3 || (e.state < 4 && !e.down) {
+		if e.rising {
+			e.level += e.inc
+			if e.level >= e.targetlevel {
+				e.level = e.targetlevel
+				e.advance(e.state + 1)
+			}
+		} else {
+			e.level -= e.inc
+			if e.level <= e.targetlevel {
+				e.level = e.targetlevel
+				e.advance(e.state + 1)
+			}
+		}
+	}
+	return e.level
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,60 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Pitch Envelope Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import "testing"
+
+//-----------------------------------------------------------------------------
+
+func Test_PitchEnv(t *testing.T) {
+	cfg := &envConfig{
+		rate:  [4]int{99, 50, 99, 99},
+		level: [4]int{50, 99, 60, 0},
+	}
+	e := &pitchEnv{cfg: cfg}
+	e.keyOn()
+
+	// starts at level 4 (-4 octaves)
+	if e.level != -128<<19 {
+		t.Errorf("bad initial level %d", e.level)
+	}
+
+	// level 1: rate 99 from -128 to 0
+	n := 0
+	for e.state == 0 {
+		e.sample()
+		n++
+	}
+	expect := (128<<19 + pitchEnvRate[99]*pitchEnvUnit - 1) / (pitchEnvRate[99] * pitchEnvUnit)
+	if n != expect {
+		t.Errorf("level 1: expected %d buffers, got %d", expect, n)
+	}
+	if e.level != 0 {
+		t.Errorf("level 1: bad level %d", e.level)
+	}
+
+	// run to the sustain level
+	for i := 0; i < 1000; i++ {
+		e.sample()
+	}
+	if e.state != 3 || e.level != pitchEnvLevel[60]<<19 {
+		t.Errorf("sustain: bad state %d level %d", e.state, e.level)
+	}
+
+	// release to level 4
+	e.keyOff()
+	for i := 0; i < 1000; i++ {
+		e.sample()
+	}
+	if e.state != 4 || e.level != pitchEnvLevel[0]<<19 {
+		t.Errorf("release: bad state %d level %d", e.state, e.level)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -26,6 +26,25 @@ const midiIDYamaha = 0x43
 
 //-----------------------------------------------------------------------------
 
+// Corrupt or non-DX7 data can have out of range values.
+// These are clamped so they don't index past the end of the lookup tables.
+
+// limit returns a data byte clamped to 0..max.
+func limit(x byte, max int) int {
+	return core.ClampInt(int(x), 0, max)
+}
+
+// clampBytes clamps each data byte to its maximum value.
+func clampBytes(buf, max []byte) {
+	for i := range max {
+		if buf[i] > max[i] {
+			buf[i] = max[i]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
 type opData struct {
 	rate        [4]byte // 0: 0..99
 	level       [4]byte // 4: 0..99
@@ -45,27 +64,22 @@ func (o *opData) convert(idx int) *opConfig {
 		idx: idx,
 	}
 
-	if o.breakPoint < 3 {
-		cfg.breakPoint = core.MidiNote(0)
-	} else {
-		cfg.breakPoint = core.MidiNote(o.breakPoint - 3)
-	}
-
 	for i := 0; i < 4; i++ {
-		cfg.env.rate[i] = int(o.rate[i])
-		cfg.env.level[i] = int(o.level[i])
+		cfg.env.rate[i] = limit(o.rate[i], 99)
+		cfg.env.level[i] = limit(o.level[i], 99)
 	}
 
+	cfg.breakPoint = limit(o.breakPoint, 99)
 	cfg.oscMode = oscModeType(o.x3 & 1)
 	cfg.freqCoarse = int((o.x3 >> 1) & 31)
-	cfg.freqFine = int(o.freqFine)
+	cfg.freqFine = limit(o.freqFine, 99)
 	cfg.keyRateScale = int(o.x1 & 7)
-	cfg.detune = int((o.x1>>3)&15) - 7
-	cfg.outputLevel = int(o.outputLevel)
+	cfg.detune = limit((o.x1>>3)&15, 14) - 7
+	cfg.outputLevel = limit(o.outputLevel, 99)
 	cfg.velocitySensitivity = int((o.x2 >> 2) & 7)
 	cfg.amSensitivity = int(o.x2 & 3)
-	cfg.leftDepth = int(o.leftDepth)
-	cfg.rightDepth = int(o.rightDepth)
+	cfg.leftDepth = limit(o.leftDepth, 99)
+	cfg.rightDepth = limit(o.rightDepth, 99)
 	cfg.leftCurve = curveType(o.x0 & 3)
 	cfg.rightCurve = curveType((o.x0 >> 2) & 3)
 
@@ -79,7 +93,7 @@ type voice128Data struct {
 	pRate            [4]byte   // 102:
 	pLevel           [4]byte   // 106:
 	algorithm        byte      // 110: 0..31
-	keySyncFeedback  byte      // 111: 0..7
+	keySyncFeedback  byte      // 111: 0000 kfff, osc key sync 0..1, feedback 0..7
 	lfoSpeed         byte      // 112:
 	lfoDelay         byte      // 113:
 	lfoPhaseModDepth byte      // 114: 0..99
@@ -89,8 +103,8 @@ type voice128Data struct {
 	name             [10]byte  // 118:
 }
 
-func (v *voice128Data) convert() *voiceConfig {
-	cfg := &voiceConfig{}
+func (v *voice128Data) convert() *Voice {
+	cfg := &Voice{}
 
 	for i := range v.op {
 		idx := 5 - i
@@ -98,20 +112,21 @@ func (v *voice128Data) convert() *voiceConfig {
 	}
 
 	for i := 0; i < 4; i++ {
-		cfg.env.rate[i] = int(v.pRate[i])
-		cfg.env.level[i] = int(v.pLevel[i])
+		cfg.env.rate[i] = limit(v.pRate[i], 99)
+		cfg.env.level[i] = limit(v.pLevel[i], 99)
 	}
 
-	cfg.algorithm = int(v.algorithm)
+	cfg.algorithm = int(v.algorithm & 31)
 	cfg.feedback = int(v.keySyncFeedback & 7)
-	cfg.lfo.wave = lfoWaveType((v.x2 >> 1) & 7)
-	cfg.lfo.speed = int(v.lfoSpeed)
-	cfg.lfo.delay = int(v.lfoDelay)
-	cfg.lfo.pmDepth = int(v.lfoPhaseModDepth)
-	cfg.lfo.amDepth = int(v.lfoAmpModDepth)
+	cfg.oscSync = v.keySyncFeedback&8 != 0
+	cfg.lfo.wave = lfoWaveType(limit((v.x2>>1)&7, LfoSampleAndHold))
+	cfg.lfo.speed = limit(v.lfoSpeed, 99)
+	cfg.lfo.delay = limit(v.lfoDelay, 99)
+	cfg.lfo.pmDepth = limit(v.lfoPhaseModDepth, 99)
+	cfg.lfo.amDepth = limit(v.lfoAmpModDepth, 99)
 	cfg.lfo.pms = int((v.x2 >> 4) & 7)
 	cfg.lfo.sync = v.x2&1 != 0
-	cfg.transpose = core.MidiNote(v.transpose + 12)
+	cfg.transpose = core.MidiNote(limit(v.transpose, 48) + 12)
 	cfg.name = string(v.name[:])
 
 	return cfg
@@ -119,8 +134,125 @@ func (v *voice128Data) convert() *voiceConfig {
 
 //-----------------------------------------------------------------------------
 
+type op155Data struct {
+	rate                [4]byte // 0: 0..99
+	level               [4]byte // 4: 0..99
+	breakPoint          byte    // 8: C3 = $27
+	leftDepth           byte    // 9: 0..99
+	rightDepth          byte    // 10: 0..99
+	leftCurve           byte    // 11: 0..3
+	rightCurve          byte    // 12: 0..3
+	rateScale           byte    // 13: 0..7
+	ampModSensitivity   byte    // 14: 0..3
+	velocitySensitivity byte    // 15: 0..7
+	outputLevel         byte    // 16: 0..99
+	oscMode             byte    // 17: 0..1
+	freqCoarse          byte    // 18: 0..31
+	freqFine            byte    // 19: 0..99
+	detune              byte    // 20: 0..14
+}
+
+// op155Max is the maximum value of each operator data byte.
+var op155Max = [unsafe.Sizeof(op155Data{})]byte{
+	99, 99, 99, 99, // rate
+	99, 99, 99, 99, // level
+	99, 99, 99, // break point, left depth, right depth
+	3, 3, 7, 3, 7, // left curve, right curve, rate scale, ams, velocity sensitivity
+	99, 1, 31, 99, 14, // output level, osc mode, frequency coarse, frequency fine, detune
+}
+
+func (o *op155Data) convert(idx int) *opConfig {
+	cfg := &opConfig{
+		idx: idx,
+	}
+
+	// clamp a copy of the data
+	d := *o
+	o = &d
+	clampBytes((*[unsafe.Sizeof(op155Data{})]byte)(unsafe.Pointer(o))[:], op155Max[:])
+
+	for i := 0; i < 4; i++ {
+		cfg.env.rate[i] = int(o.rate[i])
+		cfg.env.level[i] = int(o.level[i])
+	}
+
+	cfg.breakPoint = int(o.breakPoint)
+	cfg.oscMode = oscModeType(o.oscMode & 1)
+	cfg.freqCoarse = int(o.freqCoarse & 31)
+	cfg.freqFine = int(o.freqFine)
+	cfg.keyRateScale = int(o.rateScale & 7)
+	cfg.detune = int(o.detune&15) - 7
+	cfg.outputLevel = int(o.outputLevel)
+	cfg.velocitySensitivity = int(o.velocitySensitivity & 7)
+	cfg.amSensitivity = int(o.ampModSensitivity & 3)
+	cfg.leftDepth = int(o.leftDepth)
+	cfg.rightDepth = int(o.rightDepth)
+	cfg.leftCurve = curveType(o.leftCurve & 3)
+	cfg.rightCurve = curveType(o.rightCurve & 3)
+
+	return cfg
+}
+
 type voice155Data struct {
-	data [155]byte
+	op               [6]op155Data // 0: 6..1
+	pRate            [4]byte      // 126:
+	pLevel           [4]byte      // 130:
+	algorithm        byte         // 134: 0..31
+	feedback         byte         // 135: 0..7
+	oscSync          byte         // 136: 0..1
+	lfoSpeed         byte         // 137: 0..99
+	lfoDelay         byte         // 138: 0..99
+	lfoPhaseModDepth byte         // 139: 0..99
+	lfoAmpModDepth   byte         // 140: 0..99
+	lfoSync          byte         // 141: 0..1
+	lfoWave          byte         // 142: 0..5
+	lfoPms           byte         // 143: 0..7
+	transpose        byte         // 144: 0..48
+	name             [10]byte     // 145:
+}
+
+// voice155Max is the maximum value of each voice data byte (after the operators).
+var voice155Max = [...]byte{
+	99, 99, 99, 99, // pitch envelope rate
+	99, 99, 99, 99, // pitch envelope level
+	31, 7, 1, // algorithm, feedback, osc sync
+	99, 99, 99, 99, // lfo speed, delay, pm depth, am depth
+	1, 5, 7, // lfo sync, wave, pms
+	48, 127, 127, 127, 127, 127, 127, 127, 127, 127, 127, // transpose, name
+}
+
+func (v *voice155Data) convert() *Voice {
+	cfg := &Voice{}
+
+	// clamp a copy of the data
+	d := *v
+	v = &d
+	clampBytes((*[unsafe.Sizeof(voice155Data{})]byte)(unsafe.Pointer(&v.pRate))[:len(voice155Max)], voice155Max[:])
+
+	for i := range v.op {
+		idx := 5 - i
+		cfg.op[idx] = v.op[i].convert(idx)
+	}
+
+	for i := 0; i < 4; i++ {
+		cfg.env.rate[i] = int(v.pRate[i])
+		cfg.env.level[i] = int(v.pLevel[i])
+	}
+
+	cfg.algorithm = int(v.algorithm & 31)
+	cfg.feedback = int(v.feedback & 7)
+	cfg.oscSync = v.oscSync&1 != 0
+	cfg.lfo.wave = lfoWaveType(core.Min(int(v.lfoWave), LfoSampleAndHold))
+	cfg.lfo.speed = int(v.lfoSpeed)
+	cfg.lfo.delay = int(v.lfoDelay)
+	cfg.lfo.pmDepth = int(v.lfoPhaseModDepth)
+	cfg.lfo.amDepth = int(v.lfoAmpModDepth)
+	cfg.lfo.pms = int(v.lfoPms & 7)
+	cfg.lfo.sync = v.lfoSync&1 != 0
+	cfg.transpose = core.MidiNote(v.transpose + 12)
+	cfg.name = string(v.name[:])
+
+	return cfg
 }
 
 //-----------------------------------------------------------------------------
@@ -149,128 +281,198 @@ func checksum(buf []byte) byte {
 	return -csum & 0x7f
 }
 
-func decode32Voice(buf []byte) (int, error) {
+func decode32Voice(buf []byte) ([]*Voice, int, error) {
 	// should have 32 x 128 byte voice records
 	n := int(unsafe.Sizeof(voices32{})) + 1
 	if len(buf) < n {
-		return 0, fmt.Errorf("bad voice data size: is %d, should be %d", len(buf), n)
+		return nil, 0, fmt.Errorf("bad voice data size: is %d, should be %d", len(buf), n)
 	}
 	// checksum
 	csum := checksum(buf[:n-1])
 	if csum != buf[n-1] {
-		return 0, fmt.Errorf("bad checksum: is 0x%02x, should be 0x%02x", csum, buf[n-1])
+		return nil, 0, fmt.Errorf("bad checksum: is 0x%02x, should be 0x%02x", csum, buf[n-1])
 	}
 
 	voices := (*voices32)(unsafe.Pointer(&buf[0]))
 
+	cfg := make([]*Voice, len(voices))
 	for i := range voices {
-		cfg := voices[i].convert()
-		fmt.Printf("%s\n", cfg.String())
+		cfg[i] = voices[i].convert()
 	}
 
-	return n, nil
+	return cfg, n, nil
 }
 
-func decode1Voice(buf []byte) (int, error) {
+func decode1Voice(buf []byte) ([]*Voice, int, error) {
 	// should have a single voice record
 	n := int(unsafe.Sizeof(voice155Data{})) + 1
 	if len(buf) < n {
-		return 0, fmt.Errorf("bad voice data size: is %d, should be %d", len(buf), n)
+		return nil, 0, fmt.Errorf("bad voice data size: is %d, should be %d", len(buf), n)
 	}
 	csum := checksum(buf[:n-1])
 	if csum != buf[n-1] {
-		return 0, fmt.Errorf("bad checksum: is 0x%02x, ahould be 0x%02x", csum, buf[n-1])
+		return nil, 0, fmt.Errorf("bad checksum: is 0x%02x, should be 0x%02x", csum, buf[n-1])
 	}
 
-	return n, nil
+	voice := (*voice155Data)(unsafe.Pointer(&buf[0]))
+
+	return []*Voice{voice.convert()}, n, nil
 }
 
-func decodeVoice(buf []byte) (int, error) {
+func decodeVoice(buf []byte) ([]*Voice, int, error) {
 	ofs := 0
 	n := int(unsafe.Sizeof(voicesHdr{}))
 	if len(buf) < n {
-		return 0, errors.New("voice sysex header is too short")
+		return nil, 0, errors.New("voice sysex header is too short")
 	}
 	hdr := (*voicesHdr)(unsafe.Pointer(&buf[0]))
 	ofs += n
 
 	count := (int(hdr.countMSB) << 7) + int(hdr.countLSB)
 
+	var cfg []*Voice
 	switch hdr.formatNum {
 	case 9:
 		if count != 4096 {
-			return 0, fmt.Errorf("bad voice data count: is %d, should be 4096", count)
+			return nil, 0, fmt.Errorf("bad voice data count: is %d, should be 4096", count)
 		}
-		n, err := decode32Voice(buf[ofs:])
+		voices, n, err := decode32Voice(buf[ofs:])
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
+		cfg = voices
 		ofs += n
 	case 0:
 		if count != 155 {
-			return 0, fmt.Errorf("bad voice data count: is %d, should be 155", count)
+			return nil, 0, fmt.Errorf("bad voice data count: is %d, should be 155", count)
 		}
-		n, err := decode1Voice(buf[ofs:])
+		voices, n, err := decode1Voice(buf[ofs:])
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
+		cfg = voices
 		ofs += n
 	default:
-		return 0, fmt.Errorf("unknown format number: 0x%02x", hdr.formatNum)
+		return nil, 0, fmt.Errorf("unknown format number: 0x%02x", hdr.formatNum)
 	}
 
-	return ofs, nil
+	return cfg, ofs, nil
+}
+
+// Parameter change groups.
+const (
+	paramGroupVoice    = 0 // voice parameters (155 byte single voice offsets)
+	paramGroupFunction = 2 // function parameters
+)
+
+// paramChange is a DX7 parameter change.
+type paramChange struct {
+	group int // parameter group
+	param int // parameter number
+	value int // parameter value
 }
 
-func decodeParameterChange(buf []byte) (int, error) {
-	panic("todo")
-	return len(buf), nil
+type paramChangeData struct {
+	groupParam byte // 0gggggpp, group 0..31, parameter number bits 8..7
+	param      byte // parameter number bits 6..0
+	value      byte // parameter value
 }
 
-// DecodeSysex parses a buffer of DX system exclusive MIDI data.
-func DecodeSysex(buf []byte) (int, error) {
+func decodeParameterChange(buf []byte) (*paramChange, int, error) {
+	n := int(unsafe.Sizeof(paramChangeData{}))
+	if len(buf) < n {
+		return nil, 0, errors.New("parameter change is too short")
+	}
+	d := (*paramChangeData)(unsafe.Pointer(&buf[0]))
+	pc := &paramChange{
+		group: int(d.groupParam>>2) & 31,
+		param: int(d.groupParam&3)<<7 | int(d.param&0x7f),
+		value: int(d.value & 0x7f),
+	}
+	switch pc.group {
+	case paramGroupVoice:
+		if pc.param > voiceParamOpEnable {
+			return nil, 0, fmt.Errorf("bad voice parameter number: %d", pc.param)
+		}
+	case paramGroupFunction:
+		if !core.InEnum(pc.param-fnParamBase, fnParamMax) {
+			return nil, 0, fmt.Errorf("bad function parameter number: %d", pc.param)
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown parameter group: %d", pc.group)
+	}
+	return pc, n, nil
+}
+
+// sysexMsg is a decoded DX7 sysex message.
+type sysexMsg struct {
+	device int          // device number (MIDI channel)
+	voice  []*Voice     // voice data
+	param  *paramChange // parameter change
+}
+
+// decodeSysex parses a buffer of DX system exclusive MIDI data.
+// It returns the decoded message and the length of the sysex message.
+func decodeSysex(buf []byte) (*sysexMsg, int, error) {
 	ofs := 0
 	n := int(unsafe.Sizeof(sysexHdr{}))
 	if len(buf) < n {
-		return 0, errors.New("sysex is too short")
+		return nil, 0, errors.New("sysex is too short")
 	}
 	hdr := (*sysexHdr)(unsafe.Pointer(&buf[ofs]))
 	ofs += n
 
 	if hdr.start != midiStatusSysexStart {
-		return 0, errors.New("bad sysex start byte")
+		return nil, 0, errors.New("bad sysex start byte")
 	}
 
 	if hdr.manufID != midiIDYamaha {
-		return 0, fmt.Errorf("bad manufacturer id: 0x%02x", hdr.manufID)
+		return nil, 0, fmt.Errorf("bad manufacturer id: 0x%02x", hdr.manufID)
 	}
 
-	switch hdr.subStatus {
+	// the low nibble of the sub status is the device number
+	msg := &sysexMsg{
+		device: int(hdr.subStatus & 0x0f),
+	}
+
+	switch hdr.subStatus & 0x70 {
 	case 0:
-		n, err := decodeVoice(buf[ofs:])
+		voices, n, err := decodeVoice(buf[ofs:])
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
+		msg.voice = voices
 		ofs += n
 	case 0x10:
-		n, err := decodeParameterChange(buf[ofs:])
+		pc, n, err := decodeParameterChange(buf[ofs:])
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
+		msg.param = pc
 		ofs += n
 	default:
-		return 0, fmt.Errorf("unknown sub status: 0x%02x", hdr.subStatus)
+		return nil, 0, fmt.Errorf("unknown sub status: 0x%02x", hdr.subStatus)
 	}
 
 	if len(buf[ofs:]) < 1 {
-		return 0, errors.New("no sysex end byte")
+		return nil, 0, errors.New("no sysex end byte")
 	}
 	if buf[ofs] != midiStatusSysexEnd {
-		return 0, errors.New("bad sysex end byte")
+		return nil, 0, errors.New("bad sysex end byte")
 	}
 	ofs++
 
-	return ofs, nil
+	return msg, ofs, nil
+}
+
+// DecodeSysex parses a buffer of DX system exclusive MIDI data.
+// It returns the decoded voices and the length of the sysex message.
+func DecodeSysex(buf []byte) ([]*Voice, int, error) {
+	msg, n, err := decodeSysex(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return msg.voice, n, nil
 }
 
 //-----------------------------------------------------------------------------
@@ -5,9 +5,10 @@
 package dx
 
 import (
-	"fmt"
 	"io/ioutil"
 	"testing"
+
+	"github.com/deadsy/babi/core"
 )
 
 //-----------------------------------------------------------------------------
@@ -15,11 +16,14 @@ import (
 func Test_Parse(t *testing.T) {
 
 	tests := []struct {
-		path string
+		path      string
+		voices    int
+		name      string // first voice name
+		algorithm int    // first voice algorithm
 	}{
-		{"./test/rom1a.syx"},
-		{"./test/021.syx"},
-		{"./test/060.syx"},
+		{"./test/rom1a.syx", 32, "BRASS   1 ", 21},
+		{"./test/021.syx", 1, "", -1},
+		{"./test/060.syx", 1, "", -1},
 	}
 
 	for _, v := range tests {
@@ -30,16 +34,62 @@ func Test_Parse(t *testing.T) {
 			t.FailNow()
 		}
 
-		n, err := DecodeSysex(buf)
+		cfg, n, err := DecodeSysex(buf)
 
 		if err != nil {
 			t.Error(err)
 		}
 
-		fmt.Printf("%d bytes\n", n)
+		if n != len(buf) {
+			t.Errorf("%s: decoded %d bytes, expected %d", v.path, n, len(buf))
+		}
+		if len(cfg) != v.voices {
+			t.Errorf("%s: expected %d voices, got %d", v.path, v.voices, len(cfg))
+			continue
+		}
+		if v.name != "" && cfg[0].name != v.name {
+			t.Errorf("%s: expected voice name %q, got %q", v.path, v.name, cfg[0].name)
+		}
+		if v.algorithm >= 0 && cfg[0].algorithm != v.algorithm {
+			t.Errorf("%s: expected algorithm %d, got %d", v.path, v.algorithm+1, cfg[0].algorithm+1)
+		}
+	}
+
+}
 
+// corruptSysex returns a voice sysex message with all data bytes set to 0x7f.
+func corruptSysex(formatNum byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = 0x7f
 	}
+	buf := []byte{midiStatusSysexStart, midiIDYamaha, 0, formatNum, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+	buf = append(buf, data...)
+	return append(buf, checksum(data), midiStatusSysexEnd)
+}
 
+func Test_ParseCorrupt(t *testing.T) {
+	for _, buf := range [][]byte{corruptSysex(9, 4096), corruptSysex(0, 155)} {
+		cfg, _, err := DecodeSysex(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := cfg[0]
+		o := v.op[0]
+		if o.env.rate[0] != 99 || o.env.level[0] != 99 || o.outputLevel != 99 || o.breakPoint != 99 || o.detune != 7 {
+			t.Errorf("operator values are not clamped")
+		}
+		if v.env.level[0] != 99 || v.lfo.speed != 99 || v.lfo.wave != LfoSampleAndHold || v.transpose != 60 {
+			t.Errorf("voice values are not clamped")
+		}
+		// play the voice
+		s := core.NewSynth()
+		m := NewVoice(s, v)
+		core.EventInFloat(m, "note", 60)
+		core.EventInFloat(m, "gate", 1)
+		var out core.Buf
+		m.Process(&out)
+	}
 }
 
 //-----------------------------------------------------------------------------
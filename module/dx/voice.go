@@ -0,0 +1,317 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Voice
+
+A 6 operator FM voice rendered from a DX7 voice configuration.
+
+https://github.com/asb2m10/dexed/tree/master/Source/msfa
+
+Operator levels are handled in the DX7 log domain (256 units per doubling
+of the amplitude), so the envelope, output level, keyboard level scaling and
+velocity sensitivity are summed before the conversion to a linear gain.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var voiceDxInfo = core.ModuleInfo{
+	Name: "voiceDx",
+	In: []core.PortInfo{
+		{"note", "note value", core.PortTypeFloat, voiceDxNote},
+		{"gate", "voice gate, attack(>0) or release(=0)", core.PortTypeFloat, voiceDxGate},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *voiceDx) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// velocityData maps MIDI velocity/2 to a DX7 velocity value.
+var velocityData = [64]int{
+	0, 70, 86, 97, 106, 114, 121, 126, 132, 138, 142, 148, 152, 156, 160, 163,
+	166, 170, 173, 174, 178, 181, 184, 186, 189, 190, 194, 196, 198, 200, 202,
+	205, 206, 209, 211, 214, 216, 218, 220, 222, 224, 225, 227, 229, 230, 232,
+	233, 235, 237, 238, 240, 241, 242, 243, 244, 246, 246, 248, 249, 250, 251,
+	252, 253, 254,
+}
+
+// scaleVelocity returns the level offset for a MIDI velocity and a sensitivity (0..7).
+func scaleVelocity(velocity, sensitivity int) int {
+	x := velocityData[core.ClampInt(velocity, 0, 127)>>1] - 239
+	return ((sensitivity*x + 7) >> 3) << 4
+}
+
+// scaleRate returns the envelope rate offset for a MIDI note and a keyboard rate scaling (0..7).
+func scaleRate(note, sensitivity int) int {
+	x := core.ClampInt(note/3-7, 0, 31)
+	return (sensitivity * x) >> 3
+}
+
+// expScaleData is the exponential keyboard level scaling curve.
+var expScaleData = [33]int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 14, 16, 19, 23, 27, 33, 39, 47, 56, 66,
+	80, 94, 110, 126, 142, 158, 174, 190, 206, 222, 238, 250,
+}
+
+// scaleCurve returns the level scaling for a key group (3 notes per group).
+func scaleCurve(group, depth int, curve curveType) int {
+	var scale int
+	if curve == curveNegLin || curve == curvePosLin {
+		scale = (group * depth * 329) >> 12
+	} else {
+		scale = (expScaleData[core.Min(group, len(expScaleData)-1)] * depth * 329) >> 15
+	}
+	if curve == curveNegLin || curve == curveNegExp {
+		scale = -scale
+	}
+	return scale
+}
+
+// scaleLevel returns the keyboard level scaling (output level units) for a MIDI note.
+func (o *opConfig) scaleLevel(note int) int {
+	offset := note - o.breakPoint - 17
+	if offset >= 0 {
+		return scaleCurve((offset+1)/3, o.rightDepth, o.rightCurve)
+	}
+	return scaleCurve(-(offset-1)/3, o.leftDepth, o.leftCurve)
+}
+
+// levelOffset is subtracted from the summed operator level.
+// The maximum envelope and output levels give a gain of ~2.2,
+// which is a modulation index of ~14 radians.
+const levelOffset = 7616
+
+// voiceGain scales the sum of the carrier outputs.
+const voiceGain = 0.125
+
+//-----------------------------------------------------------------------------
+
+type opDx struct {
+	cfg   *opConfig
+	env   envDx   // operator envelope
+	freq  float32 // frequency (without the pitch envelope)
+	x     uint32  // phase
+	xstep uint32  // phase step
+	level int     // output level + level scaling + velocity (DX7 level units)
+	out   float32 // current output
+}
+
+// sample generates an operator sample.
+// The modulation input is in cycles.
+func (op *opDx) sample(mod float32) float32 {
+	gain := core.Pow2(float32(int(op.env.nextLevel())+op.level-levelOffset) * (1.0 / 256.0))
+	phase := op.x + uint32(int64(mod*core.FullCycle))
+	op.x += op.xstep
+	if op.cfg.off {
+		op.out = 0
+		return 0
+	}
+	// sin(x) = cos(x - pi/2)
+	op.out = gain * core.CosLookup(phase-(1<<30))
+	return op.out
+}
+
+//-----------------------------------------------------------------------------
+
+type voiceDx struct {
+	info core.ModuleInfo // module info
+	cfg  *Voice          // voice configuration
+	alg  *algorithm      // operator algorithm
+	op   [6]opDx         // operators
+	penv pitchEnv        // pitch envelope
+	note float32         // current note
+	key  int             // current MIDI note (with transpose)
+	vel  int             // current velocity
+	fb   [2]float32      // feedback history
+}
+
+// NewVoice returns a DX7 voice.
+func NewVoice(s *core.Synth, cfg *Voice) core.Module {
+	log.Info.Printf("")
+	m := &voiceDx{
+		info: voiceDxInfo,
+		cfg:  cfg,
+		alg:  algorithms[cfg.algorithm&31],
+		penv: pitchEnv{cfg: &cfg.env},
+	}
+	for i := range m.op {
+		op := &m.op[i]
+		op.cfg = cfg.op[i]
+		op.env.levels = &op.cfg.env.level
+		op.env.rates = &op.cfg.env.rate
+		op.env.state = 4
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *voiceDx) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *voiceDx) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// setNote sets the operator frequencies for a note value.
+func (m *voiceDx) setNote(note float32) {
+	m.note = note
+	m.key = int(math.Floor(float64(note)+0.5)) + int(m.cfg.transpose) - 36
+	f := m.info.Synth.NoteToFrequency(note + float32(int(m.cfg.transpose)-36))
+	for i := range m.op {
+		op := &m.op[i]
+		c := op.cfg
+		logfreq := oscFreq(m.key, int(c.oscMode), c.freqCoarse, c.freqFine, c.detune+7)
+		if c.oscMode == oscModeRatio {
+			op.freq = f * core.Pow2(float32(logfreq-midiNoteToLogFreq(m.key))*(1.0/(1<<24)))
+		} else {
+			op.freq = core.Pow2(float32(logfreq) * (1.0 / (1 << 24)))
+		}
+		op.env.rateScaling = scaleRate(m.key, c.keyRateScale)
+	}
+	m.setPitch(m.penv.level)
+}
+
+// setPitch sets the operator phase steps for a pitch envelope level.
+// The pitch envelope only changes the ratio mode operators.
+func (m *voiceDx) setPitch(pitch int) {
+	k := core.Pow2(float32(pitch) * (1.0 / (1 << 24)))
+	for i := range m.op {
+		op := &m.op[i]
+		freq := op.freq
+		if op.cfg.oscMode == oscModeRatio {
+			freq *= k
+		}
+		op.xstep = uint32(freq * core.FrequencyScale)
+	}
+}
+
+// setLevels sets the operator levels for the current note and velocity.
+func (m *voiceDx) setLevels() {
+	for i := range m.op {
+		op := &m.op[i]
+		c := op.cfg
+		level := core.Min(127, outputLevel[c.outputLevel]+c.scaleLevel(m.key))
+		op.level = core.Max(0, (level<<5)+scaleVelocity(m.vel, c.velocitySensitivity))
+	}
+}
+
+// update applies changes in the voice configuration to a running voice.
+func (m *voiceDx) update() {
+	m.alg = algorithms[m.cfg.algorithm&31]
+	m.setNote(m.note)
+	m.setLevels()
+}
+
+// noteOn starts the voice with a velocity (0..127).
+func (m *voiceDx) noteOn(vel int) {
+	m.vel = vel
+	m.setLevels()
+	for i := range m.op {
+		op := &m.op[i]
+		if m.cfg.oscSync {
+			op.x = 0
+		}
+		op.env.keyOn()
+	}
+	m.penv.keyOn()
+	if m.cfg.oscSync {
+		m.fb = [2]float32{}
+	}
+}
+
+// noteOff releases the voice.
+func (m *voiceDx) noteOff() {
+	for i := range m.op {
+		m.op[i].env.keyOff()
+	}
+	m.penv.keyOff()
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func voiceDxNote(cm core.Module, e *core.Event) {
+	m := cm.(*voiceDx)
+	m.setNote(e.GetEventFloat().Val)
+}
+
+func voiceDxGate(cm core.Module, e *core.Event) {
+	m := cm.(*voiceDx)
+	gate := e.GetEventFloat().Val
+	log.Info.Printf("gate %f", gate)
+	if gate != 0 {
+		m.noteOn(int(gate*127 + 0.5))
+	} else {
+		m.noteOff()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// active returns true if any carrier envelope is active.
+func (m *voiceDx) active() bool {
+	for i := range m.op {
+		if m.alg.carrier[i] && m.op[i].env.active() {
+			return true
+		}
+	}
+	return false
+}
+
+// sample generates a voice sample.
+func (m *voiceDx) sample() float32 {
+	a := m.alg
+	var out float32
+	for i := len(m.op) - 1; i >= 0; i-- {
+		var mod float32
+		for _, j := range a.mod[i] {
+			mod += m.op[j].out
+		}
+		if i == a.fbDst && m.cfg.feedback != 0 {
+			mod += (m.fb[0] + m.fb[1]) * 0.5 * core.Pow2(float32(m.cfg.feedback-8))
+		}
+		y := m.op[i].sample(mod)
+		if i == a.fbSrc {
+			m.fb[0], m.fb[1] = m.fb[1], y
+		}
+		if a.carrier[i] {
+			out += y
+		}
+	}
+	return out * voiceGain
+}
+
+// Process runs the module DSP.
+func (m *voiceDx) Process(buf ...*core.Buf) bool {
+	if !m.active() {
+		return false
+	}
+	m.setPitch(m.penv.sample())
+	out := buf[0]
+	for i := range out {
+		out[i] = m.sample()
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
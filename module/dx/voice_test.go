@@ -0,0 +1,277 @@
+//-----------------------------------------------------------------------------
+/*
+
+DX7 Voice Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package dx
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
+)
+
+//-----------------------------------------------------------------------------
+
+// romVoices returns the voice configurations from a sysex file.
+func romVoices(t *testing.T, path string) []*Voice {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := DecodeSysex(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func Test_Algorithms(t *testing.T) {
+	for i, a := range algorithms {
+		if !a.carrier[0] {
+			t.Errorf("algorithm %d: op1 is not a carrier", i+1)
+		}
+		for j := range a.mod {
+			for _, k := range a.mod[j] {
+				if k <= j {
+					t.Errorf("algorithm %d: op%d is modulated by op%d", i+1, j+1, k+1)
+				}
+			}
+		}
+	}
+}
+
+func Test_Voice(t *testing.T) {
+	for _, cfg := range romVoices(t, "./test/rom1a.syx") {
+		cfg := cfg
+		s := core.NewSynth()
+		p := midi.NewPoly(s, 0, func(s *core.Synth) core.Module { return NewVoice(s, cfg) }, 4)
+
+		core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100))
+		var peak float64
+		var buf core.Buf
+		// some voices have slow attacks, so render 2 seconds
+		for i := 0; i < 2*core.AudioSampleFrequency/core.AudioBufferSize; i++ {
+			buf = core.Buf{}
+			p.Process(&buf)
+			for _, x := range buf {
+				if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+					t.Fatalf("%s: bad sample value", cfg.name)
+				}
+				peak = math.Max(peak, math.Abs(float64(x)))
+			}
+		}
+		if peak < 1e-4 {
+			t.Errorf("%s: no output (peak %f)", cfg.name, peak)
+		}
+		if peak > 2 {
+			t.Errorf("%s: output is too loud (peak %f)", cfg.name, peak)
+		}
+	}
+}
+
+func Test_VoiceRelease(t *testing.T) {
+	cfg := romVoices(t, "./test/rom1a.syx")[10] // E.PIANO 1
+	s := core.NewSynth()
+	v := NewVoice(s, cfg)
+	core.EventInFloat(v, "note", 60)
+	core.EventInFloat(v, "gate", 1)
+	var buf core.Buf
+	if !v.Process(&buf) {
+		t.Fatalf("voice is not active after note on")
+	}
+	core.EventInFloat(v, "gate", 0)
+	// the release should finish within 10 seconds
+	for i := 0; i < 10*core.AudioSampleFrequency/core.AudioBufferSize; i++ {
+		if !v.Process(&buf) {
+			return
+		}
+	}
+	t.Errorf("voice is still active after release")
+}
+
+func Test_VoiceHold(t *testing.T) {
+	cfg := InitVoice()
+	op := cfg.op[0]
+	op.env.level = [4]int{99, 99, 99, 50}
+	op.env.rate = [4]int{99, 99, 99, 99}
+	s := core.NewSynth()
+	v := NewVoice(s, cfg)
+	core.EventInFloat(v, "note", 60)
+	core.EventInFloat(v, "gate", 1)
+	var buf core.Buf
+	v.Process(&buf)
+	core.EventInFloat(v, "gate", 0)
+	// the release ends at L4, and the voice keeps sounding at that level
+	for i := 0; i < core.AudioSampleFrequency/core.AudioBufferSize; i++ {
+		buf = core.Buf{}
+		if !v.Process(&buf) {
+			t.Fatalf("voice with a non-zero L4 is not active after release")
+		}
+	}
+	var peak float32
+	for _, x := range buf {
+		if core.Abs(x) > peak {
+			peak = core.Abs(x)
+		}
+	}
+	if peak == 0 {
+		t.Errorf("voice with a non-zero L4 is silent after release")
+	}
+}
+
+func Test_Patch(t *testing.T) {
+	voices := romVoices(t, "./test/rom1a.syx")
+	s := core.NewSynth()
+	p := NewPatch(s, 0, voices)
+	m := p.(*patchDx)
+	if m.cfg != voices[0] {
+		t.Errorf("expected voice 0 after reset")
+	}
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 0, 10, 0))
+	if m.cfg != voices[10] {
+		t.Errorf("expected voice 10 after program change")
+	}
+	// other channels are ignored
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 1, 3, 0))
+	if m.cfg != voices[10] {
+		t.Errorf("program change on another channel changed the voice")
+	}
+	// out of range programs are ignored
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 0, 100, 0))
+	if m.cfg != voices[10] {
+		t.Errorf("out of range program changed the voice")
+	}
+	// new notes use the new voice
+	core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100))
+	v := m.poly.Child()[0].(*voiceDx)
+	if v.cfg != voices[10] {
+		t.Errorf("new note is not using the selected voice")
+	}
+}
+
+func Test_LevelScaling(t *testing.T) {
+	o := &opConfig{
+		breakPoint: 39, // C3
+		leftCurve:  curvePosExp,
+		leftDepth:  50,
+		rightCurve: curveNegLin,
+		rightDepth: 99,
+	}
+	tests := []struct {
+		note, level int
+	}{
+		{60, -7},
+		{96, -103},
+		{127, -190},
+		{56, 0},
+		{36, 3},
+		{0, 28},
+	}
+	for _, v := range tests {
+		if x := o.scaleLevel(v.note); x != v.level {
+			t.Errorf("note %d: expected %d, got %d", v.note, v.level, x)
+		}
+	}
+
+	// the exponential curve saturates
+	if x := scaleCurve(100, 99, curveNegExp); x != -((250 * 99 * 329) >> 15) {
+		t.Errorf("bad exponential curve value %d", x)
+	}
+}
+
+func Test_RateScaling(t *testing.T) {
+	tests := []struct {
+		note, sens, rate int
+	}{
+		{60, 7, 11},
+		{127, 7, 27},
+		{20, 7, 0},
+		{60, 0, 0},
+	}
+	for _, v := range tests {
+		if x := scaleRate(v.note, v.sens); x != v.rate {
+			t.Errorf("note %d sens %d: expected %d, got %d", v.note, v.sens, v.rate, x)
+		}
+	}
+
+	// rate scaling speeds up the envelope
+	attack := func(rateScaling int) int {
+		e := &envDx{levels: &[4]int{99, 99, 99, 0}, rates: &[4]int{50, 99, 99, 99}, rateScaling: rateScaling}
+		e.keyOn()
+		n := 0
+		for e.state == 0 {
+			e.nextLevel()
+			n++
+		}
+		return n
+	}
+	if attack(27) >= attack(0) {
+		t.Errorf("rate scaling does not shorten the attack")
+	}
+}
+
+func Test_VoiceLevels(t *testing.T) {
+	cfg := InitVoice()
+	op := cfg.op[0]
+	op.outputLevel = 90
+	op.velocitySensitivity = 7
+	op.breakPoint = 39
+	op.rightCurve = curveNegLin
+	op.rightDepth = 99
+	op.env.level = [4]int{99, 80, 70, 0}
+	op.env.rate = [4]int{99, 99, 99, 99}
+
+	s := core.NewSynth()
+	m := NewVoice(s, cfg).(*voiceDx)
+	core.EventInFloat(m, "note", 96)
+	core.EventInFloat(m, "gate", 1)
+
+	// output level + level scaling + velocity
+	expect := ((outputLevel[90] + op.scaleLevel(96)) << 5) + scaleVelocity(127, 7)
+	if m.op[0].level != expect {
+		t.Errorf("expected level %d, got %d", expect, m.op[0].level)
+	}
+
+	// the envelope settles on the sustain level
+	var buf core.Buf
+	for i := 0; i < 100; i++ {
+		m.Process(&buf)
+	}
+	if e := &m.op[0].env; e.state != 3 || int(e.level) != (outputLevel[70]<<5)-224 {
+		t.Errorf("bad sustain state %d level %f", e.state, e.level)
+	}
+}
+
+func Test_VoicePitchEnv(t *testing.T) {
+	cfg := InitVoice()
+	cfg.env.rate = [4]int{99, 99, 99, 99}
+	cfg.env.level = [4]int{82, 82, 82, 50} // +1 octave
+	cfg.op[1].oscMode = oscModeFixed
+
+	s := core.NewSynth()
+	m := NewVoice(s, cfg).(*voiceDx)
+	core.EventInFloat(m, "note", 69)
+	core.EventInFloat(m, "gate", 1)
+	base := [2]uint32{m.op[0].xstep, m.op[1].xstep}
+	var buf core.Buf
+	for i := 0; i < 100; i++ {
+		m.Process(&buf)
+	}
+	// ratio mode operators follow the pitch envelope
+	if r := float64(m.op[0].xstep) / float64(base[0]); math.Abs(r-2) > 0.01 {
+		t.Errorf("ratio operator: expected a frequency ratio of 2, got %f", r)
+	}
+	// fixed mode operators don't
+	if m.op[1].xstep != base[1] {
+		t.Errorf("fixed operator: frequency changed")
+	}
+}
+
+//-----------------------------------------------------------------------------
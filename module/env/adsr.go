@@ -199,6 +199,9 @@ func (m *adsrEnv) Process(buf ...*core.Buf) bool {
 				m.val = 0
 				m.state = stateIdle
 			}
+		case stateIdle:
+			// idle for the rest of the buffer
+			m.val = 0
 		default:
 			panic(fmt.Sprintf("bad adsr state %d", m.state))
 		}
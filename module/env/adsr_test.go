@@ -0,0 +1,44 @@
+//-----------------------------------------------------------------------------
+/*
+
+ADSR Envelope Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package env
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_ADSRIdle(t *testing.T) {
+	s := core.NewSynth()
+	m := NewADSR(s)
+	// no sustain: the decay ends (and the envelope goes idle) within the first buffer
+	core.EventInFloat(m, "attack", 0)
+	core.EventInFloat(m, "decay", 0.0001)
+	core.EventInFloat(m, "sustain", 0)
+	core.EventInFloat(m, "release", 0)
+	core.EventInFloat(m, "gate", 1)
+
+	var out core.Buf
+	if !m.Process(&out) {
+		t.Fatal("expected an active envelope")
+	}
+	if out[0] == 0 {
+		t.Errorf("expected a non-zero attack")
+	}
+	if out[len(out)-1] != 0 {
+		t.Errorf("expected a zero level after the decay, got %f", out[len(out)-1])
+	}
+	if m.Process(&out) {
+		t.Errorf("expected an idle envelope")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,380 @@
+//-----------------------------------------------------------------------------
+/*
+
+Multi-Stage Envelope Generator
+
+The envelope is a list of breakpoints. Each segment moves from the current
+level to the level of the next breakpoint in the breakpoint time, using the
+breakpoint curve. While the gate is held the envelope can hold at a sustain
+point or loop between two breakpoints. A gate release jumps to the segment
+after the sustain/loop points. The last breakpoint level is zero, so the
+envelope is silent (and inactive) once it has finished.
+
+*/
+//-----------------------------------------------------------------------------
+
+package env
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var msegEnvInfo = core.ModuleInfo{
+	Name: "msegEnv",
+	In: []core.PortInfo{
+		{"gate", "envelope gate, attack(>0, velocity) or release(=0)", core.PortTypeFloat, msegEnvGate},
+		{"retrigger", "retrigger mode (int)", core.PortTypeInt, msegEnvRetrigger},
+		{"velocity", "velocity sensitivity 0..1", core.PortTypeFloat, msegEnvVelocity},
+		{"note", "note value (float)", core.PortTypeFloat, msegEnvNote},
+		{"key_track", "key tracking of segment times 0..1", core.PortTypeFloat, msegEnvKeyTrack},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+		{"eoc", "end of cycle", core.PortTypeBool, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *msegEnv) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// Curve is the shape of an envelope segment.
+type Curve int
+
+// Segment curves.
+const (
+	CurveLinear Curve = iota // straight line
+	CurveExp                 // exponential rise/fall, fast then slow
+	CurveS                   // S-shaped, slow then fast then slow
+)
+
+func (c Curve) String() string {
+	return [...]string{"linear", "exp", "s"}[c]
+}
+
+// Breakpoint is the end point of an envelope segment.
+type Breakpoint struct {
+	Time  float32 // segment time (secs)
+	Level float32 // breakpoint level 0..1
+	Curve Curve   // segment curve
+}
+
+// Shape defines a multi-stage envelope.
+// The envelope starts at zero and moves through the breakpoints in order.
+// The last breakpoint level must be zero.
+type Shape struct {
+	Points    []Breakpoint // breakpoints
+	Sustain   int          // hold at this breakpoint while the gate is on (-1 for none)
+	LoopStart int          // loop back to the segment after this breakpoint (-1 for none)
+	LoopEnd   int          // loop when this breakpoint is reached (-1 for none)
+}
+
+// releasePoint returns the breakpoint released by a gate off (-1 for none).
+func (s *Shape) releasePoint() int {
+	if s.LoopEnd > s.Sustain {
+		return s.LoopEnd
+	}
+	return s.Sustain
+}
+
+//-----------------------------------------------------------------------------
+
+// Retrigger is the behaviour of the envelope for a gate on.
+type Retrigger int
+
+// Retrigger modes.
+const (
+	RetriggerReset   Retrigger = iota // reset to zero and restart
+	RetriggerLegato                   // continue a running envelope
+	RetriggerRestart                  // restart from the current level
+	retriggerMax
+)
+
+func (r Retrigger) String() string {
+	return [...]string{"reset", "legato", "restart"}[r]
+}
+
+//-----------------------------------------------------------------------------
+
+// We use the same exponential as the ADSR envelope, scaled to reach the target level.
+var expK = -math.Log(adsrEpsilon)
+var expScale = float32(1 / (1 - adsrEpsilon))
+
+// curve returns the curve value (0..1) at segment position x (0..1).
+func curve(c Curve, x float32) float32 {
+	switch c {
+	case CurveExp:
+		return expScale * (1 - float32(math.Exp(-expK*float64(x))))
+	case CurveS:
+		return x * x * (3 - 2*x)
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+type msegEnv struct {
+	info      core.ModuleInfo // module info
+	shape     *Shape          // envelope shape
+	retrigger Retrigger       // retrigger mode
+	vsens     float32         // velocity sensitivity
+	note      float32         // note value
+	keyTrack  float32         // key tracking amount
+	gate      bool            // gate state
+	running   bool            // the envelope is running
+	hold      bool            // holding at the sustain point
+	eoc       bool            // end of cycle in this buffer
+	seg       int             // current segment (breakpoint index)
+	x         float32         // segment position 0..1
+	xstep     float32         // segment position step per sample
+	start     float32         // segment start level
+	level     float32         // current level
+	scale     float32         // velocity scaling
+}
+
+// NewMSEG returns a multi-stage envelope module.
+func NewMSEG(s *core.Synth, shape *Shape) core.Module {
+	log.Info.Printf("")
+	n := len(shape.Points)
+	if n == 0 {
+		panic("envelope has no breakpoints")
+	}
+	if shape.Points[n-1].Level != 0 {
+		panic("envelope does not end at zero level")
+	}
+	if shape.Sustain < -1 || shape.Sustain >= n {
+		panic(fmt.Sprintf("bad sustain point %d", shape.Sustain))
+	}
+	if shape.LoopEnd >= 0 && (shape.LoopEnd >= n || shape.LoopStart < 0 || shape.LoopStart >= shape.LoopEnd) {
+		panic(fmt.Sprintf("bad loop points %d..%d", shape.LoopStart, shape.LoopEnd))
+	}
+	m := &msegEnv{
+		info:  msegEnvInfo,
+		shape: shape,
+		note:  60,
+		scale: 1,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *msegEnv) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *msegEnv) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func msegEnvGate(cm core.Module, e *core.Event) {
+	m := cm.(*msegEnv)
+	gate := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("gate %f", gate)
+	if gate != 0 {
+		m.scale = 1 - m.vsens*(1-gate)
+		m.keyOn()
+	} else {
+		m.keyOff()
+	}
+}
+
+func msegEnvRetrigger(cm core.Module, e *core.Event) {
+	m := cm.(*msegEnv)
+	r := Retrigger(core.ClampInt(e.GetEventInt().Val, 0, int(retriggerMax)-1))
+	log.Info.Printf("set retrigger mode %s", r)
+	m.retrigger = r
+}
+
+func msegEnvVelocity(cm core.Module, e *core.Event) {
+	m := cm.(*msegEnv)
+	vsens := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set velocity sensitivity %f", vsens)
+	m.vsens = vsens
+}
+
+func msegEnvNote(cm core.Module, e *core.Event) {
+	m := cm.(*msegEnv)
+	note := core.Clamp(e.GetEventFloat().Val, 0, 127)
+	log.Info.Printf("set note %f", note)
+	m.note = note
+}
+
+func msegEnvKeyTrack(cm core.Module, e *core.Event) {
+	m := cm.(*msegEnv)
+	kt := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set key tracking %f", kt)
+	m.keyTrack = kt
+}
+
+//-----------------------------------------------------------------------------
+
+// keyOn starts the envelope.
+func (m *msegEnv) keyOn() {
+	legato := m.retrigger == RetriggerLegato && m.gate && m.running
+	m.gate = true
+	if legato {
+		return
+	}
+	if m.retrigger == RetriggerReset {
+		m.level = 0
+	}
+	m.running = true
+	m.enter(0)
+}
+
+// keyOff releases the envelope.
+func (m *msegEnv) keyOff() {
+	m.gate = false
+	if !m.running {
+		return
+	}
+	rp := m.shape.releasePoint()
+	if rp < 0 {
+		// no sustain or loop, a one shot envelope
+		return
+	}
+	if m.seg <= rp && rp+1 < len(m.shape.Points) {
+		m.enter(rp + 1)
+	} else if m.hold {
+		// held at the last breakpoint
+		m.finish()
+	}
+}
+
+// enter starts an envelope segment from the current level.
+func (m *msegEnv) enter(seg int) {
+	m.seg = seg
+	m.hold = false
+	m.x = 0
+	m.start = m.level
+	// key tracking: shorter times for higher notes
+	t := m.shape.Points[seg].Time * core.Pow2(-m.keyTrack*(m.note-60)*(1.0/12.0))
+	if t <= 0 {
+		m.xstep = 1
+	} else {
+		m.xstep = 1 / (t * core.AudioSampleFrequency)
+	}
+}
+
+// finish ends the envelope.
+func (m *msegEnv) finish() {
+	m.running = false
+	m.hold = false
+	m.eoc = true
+}
+
+// next is called when the envelope reaches the end of a segment.
+func (m *msegEnv) next() {
+	s := m.shape
+	switch {
+	case m.gate && m.seg == s.LoopEnd:
+		m.eoc = true
+		m.enter(s.LoopStart + 1)
+	case m.gate && m.seg == s.Sustain:
+		m.hold = true
+	case m.seg == len(s.Points)-1:
+		m.finish()
+	default:
+		m.enter(m.seg + 1)
+	}
+}
+
+// sample generates an envelope sample.
+func (m *msegEnv) sample() float32 {
+	if m.running && !m.hold {
+		p := &m.shape.Points[m.seg]
+		m.x += m.xstep
+		if m.x >= 1 {
+			m.level = p.Level
+			m.next()
+		} else {
+			m.level = m.start + (p.Level-m.start)*curve(p.Curve, m.x)
+		}
+	}
+	return m.scale * m.level
+}
+
+// Process runs the module DSP.
+func (m *msegEnv) Process(buf ...*core.Buf) bool {
+	if !m.running {
+		// zero output
+		return false
+	}
+	out := buf[0]
+	for i := range out {
+		out[i] = m.sample()
+	}
+	if m.eoc {
+		m.eoc = false
+		core.EventPush(m, "eoc", core.NewEventBool(true))
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+// Presets
+
+// ADSRShape returns an envelope shape with the same stages as the ADSR envelope.
+func ADSRShape(attack, decay, sustain, release float32) *Shape {
+	return &Shape{
+		Points: []Breakpoint{
+			{attack, 1, CurveExp},
+			{decay, sustain, CurveExp},
+			{release, 0, CurveExp},
+		},
+		Sustain:   1,
+		LoopStart: -1,
+		LoopEnd:   -1,
+	}
+}
+
+// dxLevel returns the amplitude of a DX7 envelope level (0..99).
+// Each level step is about 0.75 dB (1/8 of a doubling).
+func dxLevel(l int) float32 {
+	if l <= 0 {
+		return 0
+	}
+	return core.Pow2(float32(l-99) * 0.125)
+}
+
+// dxTime returns the time (secs) for a DX7 envelope rate (0..99) to move dl levels.
+func dxTime(rate, dl int) float32 {
+	// the per sample level increment doubles every 4 qrates
+	qr := float32(rate*41) / 64
+	return core.Abs(float32(dl*32)) / (core.Pow2(qr/4-11) * core.AudioSampleFrequency)
+}
+
+// DXShape returns an envelope shape approximating a DX7 envelope.
+// The levels and rates use the DX7 0..99 range. A non-zero level 4 is
+// followed by a fall to zero at rate 4.
+func DXShape(levels, rates *[4]int) *Shape {
+	s := &Shape{
+		Points:    make([]Breakpoint, 4),
+		Sustain:   2,
+		LoopStart: -1,
+		LoopEnd:   -1,
+	}
+	prev := 0
+	for i := range s.Points {
+		s.Points[i] = Breakpoint{dxTime(rates[i], levels[i]-prev), dxLevel(levels[i]), CurveExp}
+		prev = levels[i]
+	}
+	if prev != 0 {
+		s.Points = append(s.Points, Breakpoint{dxTime(rates[3], prev), 0, CurveExp})
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,235 @@
+//-----------------------------------------------------------------------------
+/*
+
+Multi-Stage Envelope Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package env
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// ms is the number of samples in a millisecond.
+const ms = core.AudioSampleFrequency / 1000
+
+// run returns the envelope output for n buffers.
+func run(m core.Module, n int) []float32 {
+	x := make([]float32, 0, n*core.AudioBufferSize)
+	for i := 0; i < n; i++ {
+		var out core.Buf
+		m.Process(&out)
+		x = append(x, out[:]...)
+	}
+	return x
+}
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-3
+}
+
+func Test_Curves(t *testing.T) {
+	for c := CurveLinear; c <= CurveS; c++ {
+		if curve(c, 0) != 0 || !near(curve(c, 1), 1) {
+			t.Errorf("%s: bad end points %f %f", c, curve(c, 0), curve(c, 1))
+		}
+		for x := float32(0.01); x < 1; x += 0.01 {
+			if curve(c, x) <= curve(c, x-0.01) {
+				t.Fatalf("%s: curve is not increasing at %f", c, x)
+			}
+		}
+	}
+	if curve(CurveExp, 0.5) < 0.9 || !near(curve(CurveS, 0.5), 0.5) || curve(CurveS, 0.1) > 0.1 {
+		t.Errorf("bad curve shapes")
+	}
+}
+
+func Test_Sustain(t *testing.T) {
+	shape := &Shape{
+		Points: []Breakpoint{
+			{0.01, 1, CurveLinear},
+			{0.01, 0.5, CurveLinear},
+			{0.01, 0, CurveLinear},
+		},
+		Sustain:   1,
+		LoopStart: -1,
+		LoopEnd:   -1,
+	}
+	s := core.NewSynth()
+	m := NewMSEG(s, shape)
+	var out core.Buf
+	if m.Process(&out) {
+		t.Errorf("idle envelope is active")
+	}
+	core.EventInFloat(m, "gate", 1)
+	x := run(m, 100)
+	// 10ms attack, 10ms decay, then sustain
+	if !near(x[5*ms-1], 0.5) || !near(x[10*ms-1], 1) || !near(x[15*ms-1], 0.75) || x[len(x)-1] != 0.5 {
+		t.Errorf("bad attack/decay/sustain %f %f %f %f", x[5*ms-1], x[10*ms-1], x[15*ms-1], x[len(x)-1])
+	}
+	// release
+	core.EventInFloat(m, "gate", 0)
+	x = run(m, 100)
+	if !near(x[5*ms-1], 0.25) || x[len(x)-1] != 0 || m.Process(&out) {
+		t.Errorf("bad release %f %f", x[5*ms-1], x[len(x)-1])
+	}
+	// velocity
+	core.EventInFloat(m, "velocity", 1)
+	core.EventInFloat(m, "gate", 0.5)
+	x = run(m, 100)
+	if !near(x[len(x)-1], 0.25) {
+		t.Errorf("bad velocity scaling %f", x[len(x)-1])
+	}
+	// key tracking, an octave up halves the times
+	core.EventInFloat(m, "key_track", 1)
+	core.EventInFloat(m, "note", 72)
+	core.EventInFloat(m, "gate", 0)
+	x = run(m, 10)
+	if !near(x[5*ms-1], 0) {
+		t.Errorf("bad key tracking %f", x[5*ms-1])
+	}
+}
+
+func Test_Loop(t *testing.T) {
+	shape := &Shape{
+		Points: []Breakpoint{
+			{0.01, 1, CurveLinear},
+			{0.01, 0.5, CurveS},
+			{0.01, 1, CurveExp},
+			{0.01, 0, CurveLinear},
+		},
+		Sustain:   -1,
+		LoopStart: 0,
+		LoopEnd:   2,
+	}
+	s := core.NewSynth()
+	m := NewMSEG(s, shape)
+	core.EventInFloat(m, "gate", 1)
+	x := run(m, 100)
+	// loops between 1 and 0.5 with a 20ms period
+	for i := 10 * ms; i < len(x)-20*ms; i++ {
+		if !near(x[i], x[i+20*ms]) || x[i] < 0.5 || x[i] > 1 {
+			t.Fatalf("sample %d is not looping", i)
+		}
+	}
+	// a release plays the last segment
+	core.EventInFloat(m, "gate", 0)
+	x = run(m, 20)
+	if x[len(x)-1] != 0 {
+		t.Errorf("envelope is not released")
+	}
+}
+
+func Test_Finish(t *testing.T) {
+	s := core.NewSynth()
+	// the envelope must end at zero
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic for a non-zero last level")
+			}
+		}()
+		NewMSEG(s, &Shape{
+			Points:    []Breakpoint{{0.01, 1, CurveLinear}},
+			Sustain:   0,
+			LoopStart: -1,
+			LoopEnd:   -1,
+		})
+	}()
+	// sustain at the last breakpoint
+	m := NewMSEG(s, &Shape{
+		Points: []Breakpoint{
+			{0.01, 1, CurveLinear},
+			{0.01, 0, CurveLinear},
+		},
+		Sustain:   1,
+		LoopStart: -1,
+		LoopEnd:   -1,
+	})
+	core.EventInFloat(m, "gate", 1)
+	run(m, 100)
+	var out core.Buf
+	if !m.Process(&out) {
+		t.Errorf("held envelope is inactive")
+	}
+	core.EventInFloat(m, "gate", 0)
+	m.Process(&out)
+	if m.Process(&out) {
+		t.Errorf("released envelope is active")
+	}
+	// a DX7 envelope with a non-zero level 4
+	shape := DXShape(&[4]int{99, 80, 70, 50}, &[4]int{99, 80, 80, 80})
+	if len(shape.Points) != 5 || shape.Points[4].Level != 0 {
+		t.Fatalf("bad release to zero")
+	}
+	m = NewMSEG(s, shape)
+	core.EventInFloat(m, "gate", 1)
+	run(m, 100)
+	core.EventInFloat(m, "gate", 0)
+	n := 0
+	for m.Process(&out) {
+		n++
+		if n > 60*core.AudioSampleFrequency/core.AudioBufferSize {
+			t.Fatalf("envelope did not finish")
+		}
+	}
+}
+
+func Test_Retrigger(t *testing.T) {
+	shape := ADSRShape(0.01, 0.1, 0.5, 0.1)
+	for r := RetriggerReset; r < retriggerMax; r++ {
+		s := core.NewSynth()
+		m := NewMSEG(s, shape)
+		core.EventInInt(m, "retrigger", int(r))
+		core.EventInFloat(m, "gate", 1)
+		run(m, 100)
+		core.EventInFloat(m, "gate", 1)
+		var out core.Buf
+		m.Process(&out)
+		switch r {
+		case RetriggerReset:
+			if out[0] > 0.1 {
+				t.Errorf("%s: retrigger did not reset %f", r, out[0])
+			}
+		case RetriggerLegato:
+			if !near(out[0], 0.5) {
+				t.Errorf("%s: retrigger did not continue %f", r, out[0])
+			}
+		case RetriggerRestart:
+			if out[0] < 0.5 || out[len(out)-1] <= out[0] {
+				t.Errorf("%s: retrigger did not restart %f %f", r, out[0], out[len(out)-1])
+			}
+		}
+	}
+}
+
+func Test_DXShape(t *testing.T) {
+	shape := DXShape(&[4]int{99, 80, 70, 0}, &[4]int{99, 50, 50, 60})
+	if !near(shape.Points[0].Level, 1) || shape.Points[3].Level != 0 {
+		t.Errorf("bad levels")
+	}
+	if shape.Points[0].Time > 0.01 || shape.Points[1].Time <= shape.Points[2].Time {
+		t.Errorf("bad times")
+	}
+	// a one shot envelope
+	s := core.NewSynth()
+	m := NewMSEG(s, &Shape{Points: shape.Points, Sustain: -1, LoopStart: -1, LoopEnd: -1})
+	core.EventInFloat(m, "gate", 1)
+	var out core.Buf
+	n := 0
+	for m.Process(&out) {
+		n++
+		if n > 60*core.AudioSampleFrequency/core.AudioBufferSize {
+			t.Fatalf("envelope did not finish")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
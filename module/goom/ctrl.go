@@ -6,14 +6,18 @@ Goom Voice Control Module
 This is a MIDI event processor.
 
 A goom voice has 22 controls and 2 modal switches.
-My MIDI controller (AKAI MPKmini) has 8 CC controls.
-We use a drum pad note as a modal switch to multiplex CC controls into 3 groups.
+The controls are mapped onto the physical knobs and pads of a MIDI controller
+using a controller profile (see midi.Profile). Each goom control has a name
+and an internal CC number used between this module and the goom voices.
+
+The default profile is for an AKAI MPKmini. It has 8 CC controls.
+We use a drum pad note as a page switch to multiplex CC controls into 3 groups.
 
 Group 0 (wave):
 duty slope pan vol
 attack decay sustain release
 
-Group 1 (modulation):
+Group 1 (modulation, not implemented by the voice yet):
 duty slope X level
 attack decay coarse fine
 
@@ -28,18 +32,13 @@ package goom
 
 import (
 	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
 	"github.com/deadsy/babi/utils/log"
 )
 
 //-----------------------------------------------------------------------------
 
-const midiOscillatorModeNote = 45 // note for oscillator mode
-const midiFrequencyModeNote = 46  // note for frequency mode
-const midiCCModeNote = 47         // note for cc mode
-
-const nControls = 8 // cc controls per mode
-
-// 3 x 8 CC values
+// internal CC numbers for the goom controls
 const midiWaveDutyCC = 1           // wave oscillator duty cycle
 const midiWaveSlopeCC = 2          // wave oscillator duty slope
 const midiPanCC = 3                // pan left/right
@@ -64,10 +63,63 @@ const midiFltAttackCC = 21         // filter attack
 const midiFltDecayCC = 22          // filter decay
 const midiFltSustainCC = 23        // filter sustain
 const midiFltReleaseCC = 24        // filter release
+const midiOscillatorModeCC = 25    // oscillator mode cc
+const midiFrequencyModeCC = 26     // frequency mode cc
+
+// goomControls maps profile control names to internal CC numbers.
+var goomControls = map[string]uint8{
+	"wav_duty":        midiWaveDutyCC,
+	"wav_slope":       midiWaveSlopeCC,
+	"pan":             midiPanCC,
+	"vol":             midiPanVolCC,
+	"amp_attack":      midiAmpAttackCC,
+	"amp_decay":       midiAmpDecayCC,
+	"amp_sustain":     midiAmpSustainCC,
+	"amp_release":     midiAmpReleaseCC,
+	"flt_sensitivity": midiFltSensitivityCC,
+	"flt_cutoff":      midiFltCutoffCC,
+	"flt_resonance":   midiFltResonanceCC,
+	"flt_attack":      midiFltAttackCC,
+	"flt_decay":       midiFltDecayCC,
+	"flt_sustain":     midiFltSustainCC,
+	"flt_release":     midiFltReleaseCC,
+	"omode":           midiOscillatorModeCC,
+	"fmode":           midiFrequencyModeCC,
+}
 
-// and keys turned into CCs
-const midiOscillatorModeCC = 25 // oscillator mode cc
-const midiFrequencyModeCC = 26  // frequency mode cc
+// LearnControls are the goom controls that can be bound with MIDI learn.
+// Each is a float (0..1) input port of the ctrl module.
+var LearnControls = []string{
+	"wav_duty", "wav_slope", "pan", "vol",
+	"amp_attack", "amp_decay", "amp_sustain", "amp_release",
+	"flt_sensitivity", "flt_cutoff", "flt_resonance",
+	"flt_attack", "flt_decay", "flt_sustain", "flt_release",
+}
+
+// defaultProfile is the controller profile for an AKAI MPKmini.
+const defaultProfile = `{
+  "name": "AKAI MPKmini",
+  "knobs": [1, 2, 3, 4, 5, 6, 7, 8],
+  "pages": [
+    ["wav_duty", "wav_slope", "pan", "vol", "amp_attack", "amp_decay", "amp_sustain", "amp_release"],
+    ["", "", "", "", "", "", "", ""],
+    ["flt_sensitivity", "flt_cutoff", "", "flt_resonance", "flt_attack", "flt_decay", "flt_sustain", "flt_release"]
+  ],
+  "pads": [
+    {"note": 45, "action": "cycle", "control": "omode", "values": 3},
+    {"note": 46, "action": "cycle", "control": "fmode", "values": 3},
+    {"note": 47, "action": "next"}
+  ]
+}`
+
+// DefaultProfile returns the default controller profile for the goom patch.
+func DefaultProfile() *midi.Profile {
+	p, err := midi.ParseProfile([]byte(defaultProfile))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
 
 //-----------------------------------------------------------------------------
 
@@ -87,22 +139,36 @@ func (m *ctrlGoom) Info() *core.ModuleInfo {
 	return &m.info
 }
 
+func init() {
+	// add the float ports for the learnable controls
+	for _, name := range LearnControls {
+		ctrlGoomInfo.In = append(ctrlGoomInfo.In, core.PortInfo{name, "control value (0..1)", core.PortTypeFloat, ctrlGoomControl(goomControls[name])})
+	}
+}
+
 //-----------------------------------------------------------------------------
 
 type ctrlGoom struct {
-	info   core.ModuleInfo // module info
-	ch     uint8           // MIDI channel
-	oMode  uint8           // oscillator mode (0,1,2)
-	fMode  uint8           // frequency mode (0,1,2)
-	ccMode uint8           // cc mode  (0,1,2)
+	info    core.ModuleInfo  // module info
+	ch      uint8            // MIDI channel
+	profile *midi.ProfileMap // controller profile mapping
 }
 
 // NewCtrl returns a goom voice MIDI controller.
-func NewCtrl(s *core.Synth, ch uint8) core.Module {
-	log.Info.Printf("")
+// A nil profile selects the default profile.
+func NewCtrl(s *core.Synth, ch uint8, p *midi.Profile) core.Module {
+	if p == nil {
+		p = DefaultProfile()
+	}
+	log.Info.Printf("profile \"%s\"", p.Name)
+	pm, err := midi.NewProfileMap(p, goomControls)
+	if err != nil {
+		panic(err)
+	}
 	m := &ctrlGoom{
-		info: ctrlGoomInfo,
-		ch:   ch,
+		info:    ctrlGoomInfo,
+		ch:      ch,
+		profile: pm,
 	}
 	return s.Register(m)
 }
@@ -119,6 +185,15 @@ func (m *ctrlGoom) Stop() {
 //-----------------------------------------------------------------------------
 // Port Events
 
+// ctrlGoomControl returns a port function that sends a control value as a CC.
+func ctrlGoomControl(cc uint8) core.PortFuncType {
+	return func(cm core.Module, e *core.Event) {
+		m := cm.(*ctrlGoom)
+		val := core.Clamp(e.GetEventFloat().Val, 0, 1)
+		core.EventOutMidiCC(m, "midi", cc, uint8(val*127+0.5))
+	}
+}
+
 func ctrlGoomReset(cm core.Module, e *core.Event) {
 	m := cm.(*ctrlGoom)
 	be := e.GetEventBool()
@@ -147,6 +222,7 @@ func ctrlGoomReset(cm core.Module, e *core.Event) {
 		// oscillator/frequency modes
 		core.EventOutMidiCC(m, "midi", midiOscillatorModeCC, 0)
 		core.EventOutMidiCC(m, "midi", midiFrequencyModeCC, 0)
+		m.profile.Reset()
 	}
 }
 
@@ -154,45 +230,18 @@ func ctrlGoomMidiIn(cm core.Module, e *core.Event) {
 	m := cm.(*ctrlGoom)
 	me := e.GetEventMIDIChannel(m.ch)
 	if me != nil {
-		switch me.GetType() {
-		// Use the special key note on events to modulo increment the mode variables.
-		case core.EventMIDINoteOn:
-			switch me.GetNote() {
-			case midiOscillatorModeNote:
-				m.oMode = (m.oMode + 1) % 3
-				log.Info.Printf("omode %d", m.oMode)
-				core.EventOutMidiCC(m, "midi", midiOscillatorModeCC, m.oMode)
-				return
-			case midiFrequencyModeNote:
-				m.fMode = (m.fMode + 1) % 3
-				log.Info.Printf("fmode %d", m.fMode)
-				core.EventOutMidiCC(m, "midi", midiFrequencyModeCC, m.fMode)
-				return
-			case midiCCModeNote:
-				m.ccMode = (m.ccMode + 1) % 3
-				log.Info.Printf("ccmode %d", m.ccMode)
-				return
-			}
-		// Ignore the note off events for our special keys.
-		case core.EventMIDINoteOff:
-			switch me.GetNote() {
-			case midiOscillatorModeNote,
-				midiFrequencyModeNote,
-				midiCCModeNote:
-				// filter out
-				return
-			}
-		// Re-emit the CC events with higher CC numbers.
-		case core.EventMIDIControlChange:
-			ccNum := me.GetCcNum()
-			if ccNum >= 1 && ccNum <= 8 {
-				ccNum += m.ccMode * nControls
-				core.EventOutMidiCC(m, "midi", ccNum, me.GetCcInt())
-				return
-			}
+		// Map the controller knobs and pads onto the goom controls.
+		out := func(cc, val uint8) { core.EventOutMidiCC(m, "midi", cc, val) }
+		if m.profile.Event(me, out) {
+			return
 		}
 		// pass through
 		core.EventOut(m, "midi", e)
+		return
+	}
+	// pass through MIDI clock for the MIDI processing chain
+	if e.GetEventRealtime() != nil {
+		core.EventOut(m, "midi", e)
 	}
 }
 
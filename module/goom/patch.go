@@ -3,6 +3,14 @@
 
 Goom synth root level patch.
 
+An optional chain of MIDI modules (e.g. a scale quantizer, chord generator
+or arpeggiator) can process the MIDI events before the polyphony. Each chain
+module has a "midi" input and output.
+
+The MIDI input goes through a MIDI learn module before the controller
+profile. The "learn" port arms a control (an index into LearnControls), and
+the next CC moved is bound to it.
+
 */
 //-----------------------------------------------------------------------------
 
@@ -21,6 +29,7 @@ var patchGoomInfo = core.ModuleInfo{
 	Name: "patchGoom",
 	In: []core.PortInfo{
 		{"midi", "midi input", core.PortTypeMIDI, patchGoomMidiIn},
+		{"learn", "arm a control for MIDI learn (index), disarm (<0)", core.PortTypeInt, patchGoomLearn},
 	},
 	Out: []core.PortInfo{
 		{"out0", "left channel output", core.PortTypeAudio, nil},
@@ -36,24 +45,41 @@ func (m *patchGoom) Info() *core.ModuleInfo {
 //-----------------------------------------------------------------------------
 
 type patchGoom struct {
-	info core.ModuleInfo // module info
-	ctrl core.Module     // MIDI filter/processor
-	poly core.Module     // polyphony
-	pan  core.Module     // pan left/right
+	info  core.ModuleInfo // module info
+	learn core.Module     // MIDI learn
+	ctrl  core.Module     // MIDI filter/processor
+	poly  core.Module     // polyphony
+	pan   core.Module     // pan left/right
+	chain []core.Module   // MIDI processing modules
 }
 
 // NewPatch returns an goom root module.
-func NewPatch(s *core.Synth, ch uint8) core.Module {
+// A nil profile selects the default controller profile.
+// MIDI learn bindings are loaded from (and saved to) the bindings file, "" for none.
+func NewPatch(s *core.Synth, ch uint8, p *midi.Profile, bindings string, chain ...core.Module) core.Module {
 
 	// process incoming midi
-	ctrl := NewCtrl(s, ch)
+	ctrl := NewCtrl(s, ch, p)
+
+	// MIDI learn for the goom controls
+	target := make([]midi.LearnTarget, len(LearnControls))
+	for i, name := range LearnControls {
+		target[i] = midi.LearnTarget{name, ctrl, name, 0, 1, midi.TaperLin}
+	}
+	learn := midi.NewLearn(s, bindings, target)
+	core.Connect(learn, "midi", ctrl, "midi")
 
 	// function to create a goom voices
 	//voice := func(s *core.Synth) core.Module { return NewVoice(s) }
 
 	// polyphony
 	poly := midi.NewPoly(s, ch, NewVoice, 16)
-	core.Connect(ctrl, "midi", poly, "midi")
+	src := ctrl
+	for _, c := range chain {
+		core.Connect(src, "midi", c, "midi")
+		src = c
+	}
+	core.Connect(src, "midi", poly, "midi")
 
 	// pan the output to left/right channels
 	pan := mix.NewPan(s, ch, midiPanCC)
@@ -65,10 +91,12 @@ func NewPatch(s *core.Synth, ch uint8) core.Module {
 
 	log.Info.Printf("")
 	m := &patchGoom{
-		info: patchGoomInfo,
-		ctrl: ctrl,
-		poly: poly,
-		pan:  pan,
+		info:  patchGoomInfo,
+		learn: learn,
+		ctrl:  ctrl,
+		poly:  poly,
+		pan:   pan,
+		chain: chain,
 	}
 
 	// set the initial cc values
@@ -79,7 +107,7 @@ func NewPatch(s *core.Synth, ch uint8) core.Module {
 
 // Child returns the child modules of this module.
 func (m *patchGoom) Child() []core.Module {
-	return []core.Module{m.ctrl, m.poly, m.pan}
+	return append([]core.Module{m.learn, m.ctrl, m.poly, m.pan}, m.chain...)
 }
 
 // Stop performs any cleanup of a module.
@@ -91,7 +119,12 @@ func (m *patchGoom) Stop() {
 
 func patchGoomMidiIn(cm core.Module, e *core.Event) {
 	m := cm.(*patchGoom)
-	core.EventIn(m.ctrl, "midi", e)
+	core.EventIn(m.learn, "midi", e)
+}
+
+func patchGoomLearn(cm core.Module, e *core.Event) {
+	m := cm.(*patchGoom)
+	core.EventIn(m.learn, "arm", e)
 }
 
 //-----------------------------------------------------------------------------
@@ -100,6 +133,10 @@ func patchGoomMidiIn(cm core.Module, e *core.Event) {
 func (m *patchGoom) Process(buf ...*core.Buf) bool {
 	out0 := buf[0]
 	out1 := buf[1]
+	// MIDI processing
+	for _, c := range m.chain {
+		c.Process()
+	}
 	// polyphony
 	var out core.Buf
 	m.poly.Process(&out)
@@ -144,7 +144,7 @@ func voiceGoomNote(cm core.Module, e *core.Event) {
 	m := cm.(*voiceGoom)
 	note := e.GetEventFloat().Val
 	// set the wave oscillator frequency
-	core.EventInFloat(m.wavOsc, "frequency", core.MIDIToFrequency(note))
+	core.EventInFloat(m.wavOsc, "frequency", m.info.Synth.NoteToFrequency(note))
 
 	/*
 		  // set the modulation oscillator frequency
@@ -155,7 +155,7 @@ func voiceGoomNote(cm core.Module, e *core.Event) {
 				note = 100
 			}
 			note += m.modTuning * 2 // +/- 2 semitones
-			core.EventInFloat(m.modOsc, "frequency", core.MIDIToFrequency(note))
+			core.EventInFloat(m.modOsc, "frequency", m.info.Synth.NoteToFrequency(note))
 	*/
 }
 
@@ -311,7 +311,7 @@ func (m *voiceGoom) Process(buf ...*core.Buf) bool {
 
 	// generate wave
 	var wave core.Buf
-	m.wavOsc.Process(&wave)
+	m.wavOsc.Process(nil, &wave)
 
 	// apply the low pass filter
 	m.lpf.Process(&wave, out)
@@ -0,0 +1,398 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Arpeggiator Module
+
+Notes held on the MIDI channel are played one at a time as an arpeggio.
+Other MIDI events are passed through.
+
+The step rate is a number of steps per beat. The beat comes from the synth
+tempo (set by the sequencer bpm) or from the 24 ppqn MIDI clock when clock
+sync is enabled. MIDI start resets the arpeggio and MIDI
+stop pauses it.
+
+With latch enabled, released notes keep playing until a new set of notes
+is pressed.
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var arpMidiInfo = core.ModuleInfo{
+	Name: "arpMidi",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, arpMidiIn},
+		{"rate", "steps per beat (1..24)", core.PortTypeInt, arpPortRate},
+		{"order", "note order", core.PortTypeInt, arpPortOrder},
+		{"octaves", "octave range (1..4)", core.PortTypeInt, arpPortOctaves},
+		{"gate", "gate length (0..1)", core.PortTypeFloat, arpPortGate},
+		{"latch", "latch notes", core.PortTypeBool, arpPortLatch},
+		{"clock", "sync to midi clock", core.PortTypeBool, arpPortClock},
+	},
+	Out: []core.PortInfo{
+		{"midi", "midi output", core.PortTypeMIDI, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *arpMidi) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// Arpeggiator note orders.
+const (
+	ArpUp       = iota // lowest to highest
+	ArpDown            // highest to lowest
+	ArpUpDown          // lowest to highest and back
+	ArpRandom          // random
+	ArpAsPlayed        // the order the notes were played
+	arpMaxOrder
+)
+
+var arpOrderString = []string{"up", "down", "up-down", "random", "as-played"}
+
+const clocksPerBeat = 24
+const arpMaxOctaves = 4
+
+type arpNote struct {
+	note uint8 // midi note
+	vel  uint8 // note on velocity
+}
+
+type arpMidi struct {
+	info        core.ModuleInfo // module info
+	ch          uint8           // MIDI channel
+	rand        *core.Rand32    // random state
+	notes       []arpNote       // arpeggio notes (in played order)
+	down        [128]bool       // is the note key down?
+	nDown       int             // number of keys down
+	pattern     []arpNote       // notes in arpeggio order
+	idx         int             // pattern index
+	rate        int             // steps per beat
+	order       int             // note order
+	octaves     int             // octave range
+	gate        float32         // gate length as a fraction of a step
+	latch       bool            // latch notes
+	clock       bool            // sync to MIDI clock
+	running     bool            // MIDI clock is running
+	clocks      int             // MIDI clock count
+	clockTime   float32         // seconds since the last MIDI clock
+	clockPeriod float32         // seconds per MIDI clock
+	stepError   float32         // current step error (internal timing)
+	playing     bool            // is a note playing?
+	current     uint8           // current note
+	gateTime    float32         // seconds until the note off
+}
+
+// NewArp returns a MIDI arpeggiator module.
+func NewArp(s *core.Synth, ch uint8) core.Module {
+	log.Info.Printf("")
+	m := &arpMidi{
+		info:        arpMidiInfo,
+		ch:          ch,
+		rand:        core.NewRand32(0),
+		rate:        4,
+		octaves:     1,
+		gate:        0.5,
+		running:     true,
+		clockPeriod: core.SecsPerMin / (core.DefaultBeatsPerMin * clocksPerBeat),
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *arpMidi) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *arpMidi) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// secsPerStep returns the current step duration in seconds.
+func (m *arpMidi) secsPerStep() float32 {
+	if m.clock {
+		return m.clockPeriod * float32(m.clocksPerStep())
+	}
+	return core.SecsPerMin / (m.info.Synth.Tempo() * float32(m.rate))
+}
+
+// clocksPerStep returns the number of MIDI clocks per step.
+func (m *arpMidi) clocksPerStep() int {
+	n := (clocksPerBeat + m.rate/2) / m.rate
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// update builds the arpeggio pattern from the notes.
+func (m *arpMidi) update() {
+	// base notes
+	base := append([]arpNote(nil), m.notes...)
+	if m.order != ArpAsPlayed {
+		// sort by note
+		for i := 1; i < len(base); i++ {
+			for j := i; j > 0 && base[j].note < base[j-1].note; j-- {
+				base[j], base[j-1] = base[j-1], base[j]
+			}
+		}
+	}
+	// octaves
+	m.pattern = m.pattern[:0]
+	for i := 0; i < m.octaves; i++ {
+		for _, n := range base {
+			note := int(n.note) + 12*i
+			if note < 128 {
+				m.pattern = append(m.pattern, arpNote{uint8(note), n.vel})
+			}
+		}
+	}
+	// order
+	n := len(m.pattern)
+	switch m.order {
+	case ArpDown:
+		for i := 0; i < n/2; i++ {
+			m.pattern[i], m.pattern[n-1-i] = m.pattern[n-1-i], m.pattern[i]
+		}
+	case ArpUpDown:
+		// don't repeat the top and bottom notes
+		for i := n - 2; i > 0; i-- {
+			m.pattern = append(m.pattern, m.pattern[i])
+		}
+	}
+}
+
+// noteOff stops the current note.
+func (m *arpMidi) noteOff() {
+	if m.playing {
+		core.EventOut(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, m.ch, m.current, 0))
+		m.playing = false
+	}
+}
+
+// step plays the next note of the arpeggio.
+func (m *arpMidi) step() {
+	m.noteOff()
+	n := len(m.pattern)
+	if n == 0 {
+		return
+	}
+	var x arpNote
+	if m.order == ArpRandom {
+		x = m.pattern[m.rand.Uint32()%uint32(n)]
+	} else {
+		if m.idx >= n {
+			m.idx = 0
+		}
+		x = m.pattern[m.idx]
+		m.idx++
+	}
+	core.EventOut(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, m.ch, x.note, x.vel))
+	m.playing = true
+	m.current = x.note
+	m.gateTime = m.gate * m.secsPerStep()
+}
+
+// restart starts the arpeggio from the beginning on the next step.
+func (m *arpMidi) restart() {
+	m.idx = 0
+	m.stepError = m.secsPerStep() - core.SecsPerAudioBuffer
+}
+
+// addNote adds a note to the arpeggio.
+func (m *arpMidi) addNote(note, vel uint8) {
+	if m.nDown == 0 {
+		// a new set of notes (replaces any latched notes)
+		m.notes = m.notes[:0]
+		m.restart()
+	}
+	if !m.down[note] {
+		m.down[note] = true
+		m.nDown++
+	}
+	for i := range m.notes {
+		if m.notes[i].note == note {
+			m.notes[i].vel = vel
+			m.update()
+			return
+		}
+	}
+	m.notes = append(m.notes, arpNote{note, vel})
+	m.update()
+}
+
+// removeNote removes a released note from the arpeggio.
+func (m *arpMidi) removeNote(note uint8) {
+	if !m.down[note] {
+		return
+	}
+	m.down[note] = false
+	m.nDown--
+	if !m.latch {
+		m.dropReleased()
+	}
+}
+
+// dropReleased removes notes that are not held down.
+func (m *arpMidi) dropReleased() {
+	notes := m.notes[:0]
+	for _, n := range m.notes {
+		if m.down[n.note] {
+			notes = append(notes, n)
+		}
+	}
+	m.notes = notes
+	m.update()
+	if len(m.notes) == 0 {
+		m.noteOff()
+	}
+}
+
+// midiClock handles a MIDI clock.
+func (m *arpMidi) midiClock() {
+	if m.clockTime > 0 {
+		m.clockPeriod = m.clockTime
+	}
+	m.clockTime = 0
+	if !m.clock || !m.running {
+		return
+	}
+	if m.clocks%m.clocksPerStep() == 0 {
+		m.step()
+	}
+	m.clocks++
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func arpMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	re := e.GetEventRealtime()
+	if re != nil {
+		switch re.GetType() {
+		case core.EventRealtimeClock:
+			m.midiClock()
+		case core.EventRealtimeStart:
+			m.running = true
+			m.clocks = 0
+			m.idx = 0
+		case core.EventRealtimeContinue:
+			m.running = true
+		case core.EventRealtimeStop:
+			m.running = false
+			if m.clock {
+				m.noteOff()
+			}
+		}
+	}
+	me := e.GetEventMIDIChannel(m.ch)
+	if me != nil {
+		switch me.GetType() {
+		case core.EventMIDINoteOn:
+			if me.GetVelocityInt() != 0 {
+				m.addNote(me.GetNote(), me.GetVelocityInt())
+			} else {
+				// note on with vel=0 is a note off
+				m.removeNote(me.GetNote())
+			}
+			return
+		case core.EventMIDINoteOff:
+			m.removeNote(me.GetNote())
+			return
+		}
+	}
+	// pass through everything else
+	core.EventOut(m, "midi", e)
+}
+
+func arpPortRate(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	m.rate = core.ClampInt(e.GetEventInt().Val, 1, clocksPerBeat)
+	log.Info.Printf("set rate %d", m.rate)
+}
+
+func arpPortOrder(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	order := e.GetEventInt().Val
+	if !core.InEnum(order, arpMaxOrder) {
+		log.Info.Printf("bad order value %d", order)
+		return
+	}
+	log.Info.Printf("set order %s", arpOrderString[order])
+	m.order = order
+	m.update()
+}
+
+func arpPortOctaves(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	m.octaves = core.ClampInt(e.GetEventInt().Val, 1, arpMaxOctaves)
+	log.Info.Printf("set octaves %d", m.octaves)
+	m.update()
+}
+
+func arpPortGate(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	m.gate = core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set gate %f", m.gate)
+}
+
+func arpPortLatch(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	m.latch = e.GetEventBool().Val
+	log.Info.Printf("set latch %t", m.latch)
+	if !m.latch {
+		m.dropReleased()
+	}
+}
+
+func arpPortClock(cm core.Module, e *core.Event) {
+	m := cm.(*arpMidi)
+	m.clock = e.GetEventBool().Val
+	log.Info.Printf("set clock sync %t", m.clock)
+	m.clocks = 0
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *arpMidi) Process(buf ...*core.Buf) bool {
+	// This routine is being used as a periodic call for timed event generation.
+	t := float32(core.SecsPerAudioBuffer)
+	// note off at the end of the gate
+	if m.playing {
+		m.gateTime -= t
+		if m.gateTime <= 0 {
+			m.noteOff()
+		}
+	}
+	if m.clock {
+		m.clockTime += t
+		return false
+	}
+	// internal timing
+	if len(m.pattern) == 0 {
+		return false
+	}
+	m.stepError += t
+	if m.stepError >= m.secsPerStep() {
+		m.stepError -= m.secsPerStep()
+		m.step()
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,181 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Arpeggiator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/seq"
+)
+
+//-----------------------------------------------------------------------------
+
+// arpRun runs the arpeggiator until it has played a number of notes.
+// Returns the notes and the number of audio buffers used.
+func arpRun(m core.Module, sink *midiSink, steps int) ([]uint8, int) {
+	// 120 bpm, 4 steps per beat
+	limit := int(float32(steps)*0.125/core.SecsPerAudioBuffer) + 2
+	var notes []uint8
+	var n int
+	for n = 0; n < limit && len(notes) < steps; n++ {
+		m.Process()
+		for _, me := range sink.me {
+			if me != nil && me.GetType() == core.EventMIDINoteOn {
+				notes = append(notes, me.GetNote())
+			}
+		}
+		sink.me = nil
+	}
+	return notes, n
+}
+
+// midiNotes returns the note on values sent to the sink.
+func midiNotes(sink *midiSink) []uint8 {
+	var notes []uint8
+	for _, me := range sink.me {
+		if me != nil && me.GetType() == core.EventMIDINoteOn {
+			notes = append(notes, me.GetNote())
+		}
+	}
+	sink.me = nil
+	return notes
+}
+
+func notesEqual(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_Arp(t *testing.T) {
+	s := core.NewSynth()
+	m := NewArp(s, 0)
+	sink := newMidiSink(s)
+	core.Connect(m, "midi", sink, "midi")
+
+	noteOn := func(n uint8) { core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, n, 100)) }
+	noteOff := func(n uint8) { core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, n, 0)) }
+
+	// up, 2 octaves
+	core.EventInInt(m, "octaves", 2)
+	noteOn(67)
+	noteOn(60)
+	noteOn(64)
+	x, n := arpRun(m, sink, 7)
+	expect := []uint8{60, 64, 67, 72, 76, 79, 60}
+	if !notesEqual(x, expect) {
+		t.Errorf("up: expected %v, got %v", expect, x)
+	}
+	// the first note is immediate, then 1/8 second per step
+	steps := float32(n-1) * core.SecsPerAudioBuffer / 0.125
+	if steps < 6 || steps > 6.05 {
+		t.Errorf("up: bad step timing, %d buffers", n)
+	}
+
+	// up-down
+	core.EventInInt(m, "order", ArpUpDown)
+	core.EventInInt(m, "octaves", 1)
+	x, _ = arpRun(m, sink, 5)
+	expect = []uint8{64, 67, 64, 60, 64}
+	if !notesEqual(x, expect) {
+		t.Errorf("up-down: expected %v, got %v", expect, x)
+	}
+
+	// as played
+	core.EventInInt(m, "order", ArpAsPlayed)
+	noteOff(67)
+	noteOff(60)
+	noteOff(64)
+	sink.me = nil
+	noteOn(64)
+	noteOn(60)
+	x, _ = arpRun(m, sink, 3)
+	expect = []uint8{64, 60, 64}
+	if !notesEqual(x, expect) {
+		t.Errorf("as-played: expected %v, got %v", expect, x)
+	}
+
+	// released notes stop the arpeggio
+	noteOff(64)
+	noteOff(60)
+	sink.me = nil
+	x, _ = arpRun(m, sink, 2)
+	if len(x) != 0 {
+		t.Errorf("released: expected no notes, got %v", x)
+	}
+
+	// latch
+	core.EventInBool(m, "latch", true)
+	noteOn(50)
+	noteOff(50)
+	x, _ = arpRun(m, sink, 2)
+	expect = []uint8{50, 50}
+	if !notesEqual(x, expect) {
+		t.Errorf("latch: expected %v, got %v", expect, x)
+	}
+	// a new note replaces the latched notes
+	noteOn(52)
+	noteOff(52)
+	x, _ = arpRun(m, sink, 1)
+	expect = []uint8{52}
+	if !notesEqual(x, expect) {
+		t.Errorf("latch: expected %v, got %v", expect, x)
+	}
+
+	// midi clock sync, 6 clocks per step
+	core.EventInBool(m, "clock", true)
+	core.EventIn(m, "midi", core.NewEventRealtime(core.EventRealtimeStart))
+	noteOn(40)
+	noteOn(41)
+	sink.me = nil
+	for i := 0; i < 13; i++ {
+		core.EventIn(m, "midi", core.NewEventRealtime(core.EventRealtimeClock))
+	}
+	expect = []uint8{40, 41, 40}
+	if x := midiNotes(sink); !notesEqual(x, expect) {
+		t.Errorf("clock: expected %v, got %v", expect, x)
+	}
+
+	// other events are passed through
+	core.EventInMidiCC(m, "midi", 7, 100)
+	if len(sink.me) != 1 || sink.me[0].GetType() != core.EventMIDIControlChange {
+		t.Errorf("cc was not passed through")
+	}
+}
+
+func Test_ArpTempo(t *testing.T) {
+	s := core.NewSynth()
+	m := NewArp(s, 0)
+	sink := newMidiSink(s)
+	core.Connect(m, "midi", sink, "midi")
+	// the sequencer bpm sets the synth tempo
+	sq := seq.NewSequencer(s, nil)
+	core.EventInFloat(sq, "bpm", 60)
+
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100))
+	var notes, n int
+	for n = 0; n < 1000 && notes < 3; n++ {
+		m.Process()
+		notes += len(midiNotes(sink))
+	}
+	// the first note is immediate, then 1/4 second per step
+	steps := float32(n-1) * core.SecsPerAudioBuffer / 0.25
+	if steps < 2 || steps > 2.05 {
+		t.Errorf("bad step timing, %d buffers", n)
+	}
+}
+
+//-----------------------------------------------------------------------------
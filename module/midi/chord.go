@@ -0,0 +1,279 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Chord Generator Module
+
+Expand single notes on the MIDI channel into chords.
+Other MIDI events are passed through.
+
+Without a key the chord intervals are fixed semitones. With a key the input
+note is quantized to the key and the chord is stacked from notes in the key,
+so the chord quality follows the scale degree (diatonic chords).
+
+Voicings:
+
+* 0: close
+* 1: drop 2 (the second highest note is dropped an octave)
+* 2: open (every second note is raised an octave)
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"sort"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var chordMidiInfo = core.ModuleInfo{
+	Name: "chordMidi",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, chordMidiIn},
+		{"chord", "chord (index into Chords)", core.PortTypeInt, chordPortChord},
+		{"inversion", "chord inversion", core.PortTypeInt, chordPortInversion},
+		{"voicing", "chord voicing (0..2)", core.PortTypeInt, chordPortVoicing},
+		{"root", "key root note (0..11, C = 0)", core.PortTypeInt, chordPortRoot},
+		{"mode", "key mode (index into Modes, -1 for no key)", core.PortTypeInt, chordPortMode},
+	},
+	Out: []core.PortInfo{
+		{"midi", "midi output", core.PortTypeMIDI, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *chordMidi) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// Chord is a chord type.
+type Chord struct {
+	Name      string // chord name
+	Semitones []int  // chord intervals (no key)
+	Steps     []int  // chord intervals as steps within a key
+}
+
+// Chords is the list of known chord types.
+// With a key, chords with the same steps are the same diatonic chord.
+var Chords = []Chord{
+	{"major", []int{0, 4, 7}, []int{0, 2, 4}},
+	{"minor", []int{0, 3, 7}, []int{0, 2, 4}},
+	{"diminished", []int{0, 3, 6}, []int{0, 2, 4}},
+	{"augmented", []int{0, 4, 8}, []int{0, 2, 4}},
+	{"dominant 7", []int{0, 4, 7, 10}, []int{0, 2, 4, 6}},
+	{"major 7", []int{0, 4, 7, 11}, []int{0, 2, 4, 6}},
+	{"minor 7", []int{0, 3, 7, 10}, []int{0, 2, 4, 6}},
+	{"sus2", []int{0, 2, 7}, []int{0, 1, 4}},
+	{"sus4", []int{0, 5, 7}, []int{0, 3, 4}},
+	{"add9", []int{0, 4, 7, 14}, []int{0, 2, 4, 8}},
+	{"6", []int{0, 4, 7, 9}, []int{0, 2, 4, 5}},
+	{"power", []int{0, 7}, []int{0, 4}},
+}
+
+// Chord voicings.
+const (
+	VoicingClose = iota // close
+	VoicingDrop2        // drop 2
+	VoicingOpen         // open
+	voicingMax
+)
+
+//-----------------------------------------------------------------------------
+
+type chordMidi struct {
+	info      core.ModuleInfo // module info
+	ch        uint8           // MIDI channel
+	key       *Key            // key for diatonic chords (nil for none)
+	chord     int             // chord type
+	inversion int             // chord inversion
+	voicing   int             // chord voicing
+	root      int             // key root pitch class
+	mode      int             // key mode
+	held      [128][]uint8    // chord notes for each input note
+	refs      noteRefs        // output note counts
+}
+
+// NewChord returns a MIDI chord generator module.
+// A nil key gives chromatic chords.
+func NewChord(s *core.Synth, ch uint8, key *Key) core.Module {
+	log.Info.Printf("")
+	m := &chordMidi{
+		info: chordMidiInfo,
+		ch:   ch,
+		key:  key,
+		mode: -1,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *chordMidi) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *chordMidi) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// notes returns the chord notes for a root note.
+func (m *chordMidi) notes(note uint8) []uint8 {
+	c := &Chords[m.chord]
+	var x []int
+	if m.key == nil {
+		for _, n := range c.Semitones {
+			x = append(x, int(note)+n)
+		}
+	} else {
+		degree := m.key.Degree(m.key.Quantize(note))
+		for _, n := range c.Steps {
+			if k, ok := m.key.Note(degree + n); ok {
+				x = append(x, int(k))
+			}
+		}
+	}
+	if len(x) == 0 {
+		return nil
+	}
+	// inversion: raise the lowest notes an octave
+	for i := 0; i < m.inversion%len(x); i++ {
+		sort.Ints(x)
+		x[0] += 12
+	}
+	sort.Ints(x)
+	// voicing
+	n := len(x)
+	switch m.voicing {
+	case VoicingDrop2:
+		if n >= 3 {
+			x[n-2] -= 12
+		}
+	case VoicingOpen:
+		for i := 1; i < n; i += 2 {
+			x[i] += 12
+		}
+	}
+	sort.Ints(x)
+	// remove out of range and repeated notes
+	var notes []uint8
+	for i, k := range x {
+		if core.InEnum(k, 128) && (i == 0 || k != x[i-1]) {
+			notes = append(notes, uint8(k))
+		}
+	}
+	return notes
+}
+
+// noteOff releases the chord for an input note.
+func (m *chordMidi) noteOff(note, vel uint8) {
+	for _, k := range m.held[note] {
+		m.refs.off(m, m.ch, k, vel)
+	}
+	m.held[note] = nil
+}
+
+// setKey sets the key from the root and mode.
+func (m *chordMidi) setKey() {
+	if m.mode < 0 {
+		log.Info.Printf("no key")
+		m.key = nil
+		return
+	}
+	key, err := NewKey(m.root, m.mode)
+	if err != nil {
+		log.Info.Printf("%s", err)
+		return
+	}
+	log.Info.Printf("key %s", key)
+	m.key = key
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func chordMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	me := e.GetEventMIDIChannel(m.ch)
+	if me != nil {
+		note := me.GetNote()
+		switch me.GetType() {
+		case core.EventMIDINoteOn:
+			m.noteOff(note, 0)
+			if me.GetVelocityInt() != 0 {
+				m.held[note] = m.notes(note)
+				for _, k := range m.held[note] {
+					m.refs.on(m, m.ch, k, me.GetVelocityInt())
+				}
+			}
+			return
+		case core.EventMIDINoteOff:
+			m.noteOff(note, me.GetVelocityInt())
+			return
+		}
+	}
+	// pass through everything else
+	core.EventOut(m, "midi", e)
+}
+
+func chordPortChord(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	chord := e.GetEventInt().Val
+	if !core.InEnum(chord, len(Chords)) {
+		log.Info.Printf("bad chord value %d", chord)
+		return
+	}
+	log.Info.Printf("set chord %s", Chords[chord].Name)
+	m.chord = chord
+}
+
+func chordPortInversion(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	m.inversion = core.ClampInt(e.GetEventInt().Val, 0, 8)
+	log.Info.Printf("set inversion %d", m.inversion)
+}
+
+func chordPortVoicing(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	voicing := e.GetEventInt().Val
+	if !core.InEnum(voicing, voicingMax) {
+		log.Info.Printf("bad voicing value %d", voicing)
+		return
+	}
+	log.Info.Printf("set voicing %d", voicing)
+	m.voicing = voicing
+}
+
+func chordPortRoot(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	m.root = core.ClampInt(e.GetEventInt().Val, 0, 11)
+	if m.mode >= 0 {
+		m.setKey()
+	}
+}
+
+func chordPortMode(cm core.Module, e *core.Event) {
+	m := cm.(*chordMidi)
+	mode := e.GetEventInt().Val
+	if mode < -1 || mode >= len(Modes) {
+		log.Info.Printf("bad mode value %d", mode)
+		return
+	}
+	m.mode = mode
+	m.setKey()
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *chordMidi) Process(buf ...*core.Buf) bool {
+	return false
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,343 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Learn Module
+
+Bind MIDI CC controls to the float ports of other modules at run time.
+
+Arm a target (by index) and then move a knob. The first CC message
+received after arming creates a binding from that CC to the target port.
+Each binding has an output range and a taper.
+
+Learned bindings are saved to a file when the module is stopped (file
+I/O is kept off the event thread) and reloaded from the file when the
+module is created.
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var learnMidiInfo = core.ModuleInfo{
+	Name: "learnMidi",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, learnMidiIn},
+		{"arm", "arm a target for learning (index), disarm (<0)", core.PortTypeInt, learnMidiArm},
+		{"clear", "clear all bindings", core.PortTypeBool, learnMidiClear},
+	},
+	Out: []core.PortInfo{
+		{"midi", "midi output (unbound events)", core.PortTypeMIDI, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *learnMidi) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+// tapers
+
+// Taper is the curve used to map a CC value onto a port value.
+type Taper int
+
+// Taper enumeration.
+const (
+	TaperLin Taper = iota // linear
+	TaperExp              // exponential (upwards curve)
+	TaperLog              // logarithmic (downwards curve)
+)
+
+var taperToString = map[Taper]string{
+	TaperLin: "lin",
+	TaperExp: "exp",
+	TaperLog: "log",
+}
+
+func (t Taper) String() string {
+	return taperToString[t]
+}
+
+// MarshalText returns the text form of the taper.
+func (t Taper) MarshalText() ([]byte, error) {
+	s, ok := taperToString[t]
+	if !ok {
+		return nil, fmt.Errorf("bad taper %d", t)
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText sets the taper from its text form.
+func (t *Taper) UnmarshalText(text []byte) error {
+	for k, v := range taperToString {
+		if v == string(text) {
+			*t = k
+			return nil
+		}
+	}
+	return fmt.Errorf("bad taper \"%s\"", text)
+}
+
+// taperK is the curvature used for the exponential tapers.
+const taperK = 4
+
+// Map maps x = 0..1 to y = a..b using the taper.
+func (t Taper) Map(x, a, b float32) float32 {
+	switch t {
+	case TaperExp:
+		return core.MapExp(x, a, b, taperK)
+	case TaperLog:
+		return core.MapExp(x, a, b, -taperK)
+	}
+	return core.MapLin(x, a, b)
+}
+
+//-----------------------------------------------------------------------------
+
+// LearnTarget is a float port that can be bound to a MIDI CC.
+type LearnTarget struct {
+	Name   string      // unique target name (used in the bindings file)
+	Module core.Module // destination module
+	Port   string      // destination float port name
+	Min    float32     // default minimum port value
+	Max    float32     // default maximum port value
+	Taper  Taper       // default taper
+}
+
+// learnBinding binds a MIDI channel/CC to a target.
+type learnBinding struct {
+	Target string       `json:"target"` // target name
+	Ch     uint8        `json:"ch"`     // MIDI channel
+	Cc     uint8        `json:"cc"`     // MIDI CC number
+	Min    float32      `json:"min"`    // minimum port value
+	Max    float32      `json:"max"`    // maximum port value
+	Taper  Taper        `json:"taper"`  // CC to port value taper
+	target *LearnTarget // target port
+}
+
+func (b *learnBinding) String() string {
+	return fmt.Sprintf("ch %d cc %d -> %s (%f..%f %s)", b.Ch, b.Cc, b.Target, b.Min, b.Max, b.Taper)
+}
+
+type learnMidi struct {
+	info     core.ModuleInfo // module info
+	path     string          // bindings file path
+	target   []LearnTarget   // learnable targets
+	binding  []*learnBinding // current bindings
+	armed    int             // armed target index (-1 == disarmed)
+	lastCc   [16][128]uint8  // last CC values (to ignore repeats while armed)
+	hasLast  [16][128]bool   // is the last CC value valid?
+	learning bool            // are we waiting for a CC?
+	dirty    bool            // the bindings need to be saved
+}
+
+// NewLearn returns a MIDI learn module.
+// Bindings are loaded from (and saved to) the file at path.
+// An empty path disables persistence.
+func NewLearn(s *core.Synth, path string, target []LearnTarget) core.Module {
+	log.Info.Printf("")
+	m := &learnMidi{
+		info:   learnMidiInfo,
+		path:   path,
+		target: target,
+		armed:  -1,
+	}
+	// check the target names
+	names := make(map[string]bool)
+	for i := range m.target {
+		name := m.target[i].Name
+		if names[name] {
+			panic(fmt.Sprintf("target name \"%s\" is not unique", name))
+		}
+		names[name] = true
+	}
+	// load the bindings
+	err := m.load()
+	if err != nil {
+		log.Info.Printf("can't load bindings from \"%s\": %s", m.path, err)
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *learnMidi) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *learnMidi) Stop() {
+	if !m.dirty {
+		return
+	}
+	err := m.save()
+	if err != nil {
+		log.Info.Printf("can't save bindings to \"%s\": %s", m.path, err)
+	}
+	m.dirty = false
+}
+
+//-----------------------------------------------------------------------------
+// binding persistence
+
+// targetLookup returns the target with a given name (or nil).
+func (m *learnMidi) targetLookup(name string) *LearnTarget {
+	for i := range m.target {
+		if m.target[i].Name == name {
+			return &m.target[i]
+		}
+	}
+	return nil
+}
+
+// load reads the bindings file.
+func (m *learnMidi) load() error {
+	if m.path == "" {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// no bindings yet
+			return nil
+		}
+		return err
+	}
+	var binding []*learnBinding
+	err = json.Unmarshal(buf, &binding)
+	if err != nil {
+		return err
+	}
+	m.binding = nil
+	for _, b := range binding {
+		b.target = m.targetLookup(b.Target)
+		if b.target == nil {
+			log.Info.Printf("no target named \"%s\", binding ignored", b.Target)
+			continue
+		}
+		log.Info.Printf("%s", b)
+		m.binding = append(m.binding, b)
+	}
+	return nil
+}
+
+// save writes the bindings file.
+func (m *learnMidi) save() error {
+	if m.path == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(m.binding, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.path, append(buf, '\n'), 0644)
+}
+
+//-----------------------------------------------------------------------------
+
+// bindingLookup returns the binding for a MIDI channel/CC (or nil).
+func (m *learnMidi) bindingLookup(ch, cc uint8) *learnBinding {
+	for _, b := range m.binding {
+		if b.Ch == ch && b.Cc == cc {
+			return b
+		}
+	}
+	return nil
+}
+
+// bind creates a new binding between a MIDI channel/CC and a target.
+// Existing bindings for the target or the channel/CC are replaced.
+func (m *learnMidi) bind(ch, cc uint8, t *LearnTarget) {
+	var binding []*learnBinding
+	for _, b := range m.binding {
+		if b.target != t && !(b.Ch == ch && b.Cc == cc) {
+			binding = append(binding, b)
+		}
+	}
+	b := &learnBinding{
+		Target: t.Name,
+		Ch:     ch,
+		Cc:     cc,
+		Min:    t.Min,
+		Max:    t.Max,
+		Taper:  t.Taper,
+		target: t,
+	}
+	log.Info.Printf("learned %s", b)
+	m.binding = append(binding, b)
+	m.dirty = true
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func learnMidiArm(cm core.Module, e *core.Event) {
+	m := cm.(*learnMidi)
+	idx := e.GetEventInt().Val
+	if !core.InEnum(idx, len(m.target)) {
+		log.Info.Printf("disarmed")
+		m.armed = -1
+		m.learning = false
+		return
+	}
+	log.Info.Printf("armed %s:%s", m.target[idx].Name, m.target[idx].Port)
+	m.armed = idx
+	m.learning = true
+}
+
+func learnMidiClear(cm core.Module, e *core.Event) {
+	m := cm.(*learnMidi)
+	if e.GetEventBool().Val {
+		log.Info.Printf("clear bindings")
+		m.binding = nil
+		m.dirty = true
+	}
+}
+
+func learnMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*learnMidi)
+	me := e.GetEventMIDI()
+	if me != nil && me.GetType() == core.EventMIDIControlChange {
+		ch := me.GetChannel()
+		cc := me.GetCcNum() & 0x7f
+		val := me.GetCcInt() & 0x7f
+		// A knob that is being moved sends a stream of changing values.
+		// A button or a stale message repeats the same value, so ignore
+		// repeats when learning.
+		changed := !m.hasLast[ch][cc] || m.lastCc[ch][cc] != val
+		m.lastCc[ch][cc] = val
+		m.hasLast[ch][cc] = true
+		if m.learning && changed {
+			m.bind(ch, cc, &m.target[m.armed])
+			m.armed = -1
+			m.learning = false
+		}
+		b := m.bindingLookup(ch, cc)
+		if b != nil {
+			core.EventInFloat(b.target.Module, b.target.Port, b.Taper.Map(me.GetCcFloat(), b.Min, b.Max))
+			return
+		}
+	}
+	// pass through
+	core.EventOut(m, "midi", e)
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *learnMidi) Process(buf ...*core.Buf) bool {
+	return false
+}
+
+//-----------------------------------------------------------------------------
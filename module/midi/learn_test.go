@@ -0,0 +1,95 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Learn Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// sinkModule records the float values sent to its port.
+type sinkModule struct {
+	info core.ModuleInfo
+	val  []float32
+}
+
+func (m *sinkModule) Info() *core.ModuleInfo        { return &m.info }
+func (m *sinkModule) Child() []core.Module          { return nil }
+func (m *sinkModule) Stop()                         {}
+func (m *sinkModule) Process(buf ...*core.Buf) bool { return false }
+
+func sinkIn(cm core.Module, e *core.Event) {
+	m := cm.(*sinkModule)
+	m.val = append(m.val, e.GetEventFloat().Val)
+}
+
+func newSink(s *core.Synth) *sinkModule {
+	m := &sinkModule{
+		info: core.ModuleInfo{
+			Name: "sink",
+			In:   []core.PortInfo{{"val", "value", core.PortTypeFloat, sinkIn}},
+		},
+	}
+	s.Register(m)
+	return m
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Learn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "learn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bindings.json")
+
+	s := core.NewSynth()
+	sink := newSink(s)
+	target := []LearnTarget{
+		{"cutoff", sink, "val", 100, 200, TaperLin},
+	}
+
+	// learn a binding
+	m := NewLearn(s, path, target)
+	core.EventInInt(m, "arm", 0)
+	core.EventInMidiCC(m, "midi", 21, 0)
+	core.EventInMidiCC(m, "midi", 21, 127)
+	if len(sink.val) != 2 || sink.val[0] != 100 || sink.val[1] != 200 {
+		t.Errorf("bad learned values %v", sink.val)
+	}
+
+	// unbound CCs are not sent to the target
+	core.EventInMidiCC(m, "midi", 22, 64)
+	if len(sink.val) != 2 {
+		t.Errorf("unbound cc was sent to target")
+	}
+
+	// the bindings are saved when the module is stopped
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("bindings were saved before stop")
+	}
+	m.Stop()
+
+	// reload the bindings
+	sink.val = nil
+	m = NewLearn(s, path, target)
+	core.EventInMidiCC(m, "midi", 21, 127)
+	if len(sink.val) != 1 || sink.val[0] != 200 {
+		t.Errorf("bad reloaded values %v", sink.val)
+	}
+}
+
+//-----------------------------------------------------------------------------
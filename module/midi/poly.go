@@ -49,6 +49,7 @@ type polyMidi struct {
 	idx     int                             // round-robin index for voice slice
 	bend    float32                         // pitch bending value (for all voices)
 	ccCache [128]uint8                      // cache of cc values
+	tuning  uint                            // tuning version for the active voices
 }
 
 // NewPoly returns a MIDI polyphonic voice control module.
@@ -64,6 +65,7 @@ func NewPoly(s *core.Synth, ch uint8, sm func(s *core.Synth) core.Module, maxvoi
 	for num := range m.ccCache {
 		m.ccCache[num] = 0xff
 	}
+	m.tuning = s.Tuning().Version()
 	return s.Register(m)
 }
 
@@ -123,6 +125,16 @@ func (m *polyMidi) voiceAlloc(note uint8) *voiceInfo {
 	return v
 }
 
+// retune sends the current note value to all active voices.
+func (m *polyMidi) retune() {
+	for i := range m.voice {
+		v := &m.voice[i]
+		if v.module != nil {
+			core.EventInFloat(v.module, "note", float32(v.note)+m.bend)
+		}
+	}
+}
+
 func polyMidiIn(cm core.Module, e *core.Event) {
 	m := cm.(*polyMidi)
 	me := e.GetEventMIDIChannel(m.ch)
@@ -136,6 +148,10 @@ func polyMidiIn(cm core.Module, e *core.Event) {
 				core.EventInFloat(v.module, "gate", vel)
 			} else {
 				if vel != 0 {
+					if !m.info.Synth.Tuning().Mapped(me.GetNote()) {
+						// this note is not mapped by the tuning
+						return
+					}
 					v := m.voiceAlloc(me.GetNote())
 					if v != nil {
 						core.EventInFloat(v.module, "gate", vel)
@@ -155,12 +171,7 @@ func polyMidiIn(cm core.Module, e *core.Event) {
 			// get the pitch bend value
 			m.bend = core.MIDIPitchBend(me.GetPitchWheel())
 			// update all active voices
-			for i := range m.voice {
-				v := &m.voice[i]
-				if v.module != nil {
-					core.EventInFloat(v.module, "note", float32(v.note)+m.bend)
-				}
-			}
+			m.retune()
 		case core.EventMIDIControlChange:
 			// cache the cc value
 			m.ccCache[me.GetCcNum()&0x7f] = me.GetCcInt()
@@ -182,16 +193,22 @@ func polyMidiIn(cm core.Module, e *core.Event) {
 
 // Process runs the module DSP.
 func (m *polyMidi) Process(buf ...*core.Buf) bool {
+	// has the tuning changed?
+	version := m.info.Synth.Tuning().Version()
+	if version != m.tuning {
+		m.tuning = version
+		m.retune()
+	}
 	out := buf[0]
 	var vout core.Buf
 	// run each voice
 	for i := range m.voice {
 		vm := m.voice[i].module
 		if vm != nil {
-			// get the voice output
-			vm.Process(&vout)
-			// accumulate in the output buffer
-			out.Add(&vout)
+			// get the voice output and accumulate it in the output buffer
+			if vm.Process(&vout) {
+				out.Add(&vout)
+			}
 		}
 	}
 	return true
@@ -0,0 +1,79 @@
+//-----------------------------------------------------------------------------
+/*
+
+Polyphonic Module Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// gateVoice outputs 1 while the gate is on.
+// An inactive voice doesn't write to the output buffer.
+type gateVoice struct {
+	info core.ModuleInfo
+	gate bool
+}
+
+func (m *gateVoice) Info() *core.ModuleInfo { return &m.info }
+func (m *gateVoice) Child() []core.Module   { return nil }
+func (m *gateVoice) Stop()                  {}
+
+func (m *gateVoice) Process(buf ...*core.Buf) bool {
+	if !m.gate {
+		return false
+	}
+	for i := range buf[0] {
+		buf[0][i] = 1
+	}
+	return true
+}
+
+func gateVoiceGate(cm core.Module, e *core.Event) {
+	m := cm.(*gateVoice)
+	m.gate = e.GetEventFloat().Val != 0
+}
+
+func gateVoiceNote(cm core.Module, e *core.Event) {
+}
+
+func newGateVoice(s *core.Synth) core.Module {
+	m := &gateVoice{
+		info: core.ModuleInfo{
+			Name: "gateVoice",
+			In: []core.PortInfo{
+				{"note", "note", core.PortTypeFloat, gateVoiceNote},
+				{"gate", "gate", core.PortTypeFloat, gateVoiceGate},
+			},
+		},
+	}
+	return s.Register(m)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolyInactive(t *testing.T) {
+	s := core.NewSynth()
+	m := NewPoly(s, 0, newGateVoice, 4)
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100))
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 62, 100))
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, 62, 0))
+	// the finished voice doesn't add the output of the active voice again
+	var out core.Buf
+	m.Process(&out)
+	for i := range out {
+		if out[i] != 1 {
+			t.Fatalf("sample %d is %f, expected 1", i, out[i])
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
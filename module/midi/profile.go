@@ -0,0 +1,288 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Controller Profiles
+
+A profile describes the physical layout of a MIDI controller and what each
+physical control does within a patch.
+
+* knobs: CC numbers of the paged knobs/sliders.
+* pages: for each page, the control name for each paged knob ("" is unused).
+* fixed: knobs/sliders that always map to the same control.
+* pads: notes or CCs that switch pages or cycle a control through values.
+
+Pad actions:
+
+* "next": go to the next page
+* "prev": go to the previous page
+* "page": go to page "value"
+* "cycle": increment "control" modulo "values"
+
+Control names are mapped to CC numbers by the patch. The profile mapper
+converts events from the physical controls into CC events for the patch.
+
+Profiles are stored as JSON, e.g.
+
+	{
+	  "name": "example",
+	  "knobs": [1, 2],
+	  "pages": [["duty", "slope"], ["attack", "decay"]],
+	  "fixed": [{"cc": 7, "control": "vol"}],
+	  "pads": [
+	    {"note": 45, "action": "cycle", "control": "mode", "values": 3},
+	    {"note": 47, "action": "next"}
+	  ]
+	}
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+// ProfileFixed is a knob/slider that always maps to the same control.
+type ProfileFixed struct {
+	CC      uint8  `json:"cc"`      // MIDI CC number
+	Control string `json:"control"` // control name
+}
+
+// ProfilePad is a pad/button that switches pages or cycles a control.
+type ProfilePad struct {
+	Note    *uint8 `json:"note,omitempty"`    // MIDI note number (for note pads)
+	CC      *uint8 `json:"cc,omitempty"`      // MIDI CC number (for CC pads)
+	Action  string `json:"action"`            // pad action
+	Control string `json:"control,omitempty"` // control name (cycle)
+	Values  int    `json:"values,omitempty"`  // number of values (cycle)
+	Value   int    `json:"value,omitempty"`   // page number (page)
+}
+
+// Profile describes a MIDI controller layout.
+type Profile struct {
+	Name  string         `json:"name"`  // profile name
+	Knobs []uint8        `json:"knobs"` // CC numbers for paged knobs
+	Pages [][]string     `json:"pages"` // control names for each page
+	Fixed []ProfileFixed `json:"fixed"` // fixed knobs
+	Pads  []ProfilePad   `json:"pads"`  // pads
+}
+
+// ParseProfile returns a controller profile from a JSON buffer.
+func ParseProfile(buf []byte) (*Profile, error) {
+	p := &Profile{}
+	err := json.Unmarshal(buf, p)
+	if err != nil {
+		return nil, err
+	}
+	err = p.check()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadProfile returns a controller profile from a JSON file.
+func LoadProfile(path string) (*Profile, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParseProfile(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return p, nil
+}
+
+// check checks the profile for internal consistency.
+func (p *Profile) check() error {
+	cc := make(map[uint8]bool)
+	note := make(map[uint8]bool)
+	addCC := func(n uint8) error {
+		if n > 127 {
+			return fmt.Errorf("bad cc number %d", n)
+		}
+		if cc[n] {
+			return fmt.Errorf("cc %d is used more than once", n)
+		}
+		cc[n] = true
+		return nil
+	}
+	for _, n := range p.Knobs {
+		if err := addCC(n); err != nil {
+			return err
+		}
+	}
+	for i, page := range p.Pages {
+		if len(page) > len(p.Knobs) {
+			return fmt.Errorf("page %d has more controls than knobs", i)
+		}
+	}
+	for _, f := range p.Fixed {
+		if err := addCC(f.CC); err != nil {
+			return err
+		}
+	}
+	for i, pad := range p.Pads {
+		switch {
+		case pad.Note != nil && pad.CC == nil:
+			if *pad.Note > 127 || note[*pad.Note] {
+				return fmt.Errorf("pad %d: bad or repeated note %d", i, *pad.Note)
+			}
+			note[*pad.Note] = true
+		case pad.CC != nil && pad.Note == nil:
+			if err := addCC(*pad.CC); err != nil {
+				return fmt.Errorf("pad %d: %s", i, err)
+			}
+		default:
+			return fmt.Errorf("pad %d: needs one of note or cc", i)
+		}
+		switch pad.Action {
+		case "next", "prev":
+		case "page":
+			if !core.InEnum(pad.Value, len(p.Pages)) {
+				return fmt.Errorf("pad %d: bad page %d", i, pad.Value)
+			}
+		case "cycle":
+			if pad.Control == "" || pad.Values <= 0 || pad.Values > 128 {
+				return fmt.Errorf("pad %d: cycle needs a control and 1..128 values", i)
+			}
+		default:
+			return fmt.Errorf("pad %d: unknown action \"%s\"", i, pad.Action)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ProfileMap maps the physical controls of a profile onto patch controls.
+type ProfileMap struct {
+	profile  *Profile         // controller profile
+	controls map[string]uint8 // control name to CC number
+	page     int              // current page
+	cycle    map[string]uint8 // current values for cycled controls
+}
+
+// NewProfileMap returns a mapper from a profile to the named controls of a patch.
+func NewProfileMap(p *Profile, controls map[string]uint8) (*ProfileMap, error) {
+	// check that all the control names are known
+	names := make([]string, 0)
+	for _, page := range p.Pages {
+		names = append(names, page...)
+	}
+	for _, f := range p.Fixed {
+		names = append(names, f.Control)
+	}
+	for _, pad := range p.Pads {
+		names = append(names, pad.Control)
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, ok := controls[name]; !ok {
+			return nil, fmt.Errorf("profile \"%s\": unknown control \"%s\"", p.Name, name)
+		}
+	}
+	return &ProfileMap{
+		profile:  p,
+		controls: controls,
+		cycle:    make(map[string]uint8),
+	}, nil
+}
+
+// Reset sets the page and all cycled controls back to 0.
+func (pm *ProfileMap) Reset() {
+	pm.page = 0
+	pm.cycle = make(map[string]uint8)
+}
+
+// setPage sets the current page.
+func (pm *ProfileMap) setPage(page int) {
+	n := len(pm.profile.Pages)
+	if n == 0 {
+		return
+	}
+	pm.page = ((page % n) + n) % n
+	log.Info.Printf("page %d", pm.page)
+}
+
+// pad runs the action for a pad.
+func (pm *ProfileMap) pad(pad *ProfilePad, out func(cc, val uint8)) {
+	switch pad.Action {
+	case "next":
+		pm.setPage(pm.page + 1)
+	case "prev":
+		pm.setPage(pm.page - 1)
+	case "page":
+		pm.setPage(pad.Value)
+	case "cycle":
+		val := uint8((int(pm.cycle[pad.Control]) + 1) % pad.Values)
+		pm.cycle[pad.Control] = val
+		log.Info.Printf("%s %d", pad.Control, val)
+		out(pm.controls[pad.Control], val)
+	}
+}
+
+// Event maps a MIDI event from the controller.
+// Mapped controls are output as CC events using the out function.
+// Returns true if the event was used by the profile.
+func (pm *ProfileMap) Event(me *core.EventMIDI, out func(cc, val uint8)) bool {
+	p := pm.profile
+	switch me.GetType() {
+	case core.EventMIDINoteOn, core.EventMIDINoteOff:
+		for i := range p.Pads {
+			pad := &p.Pads[i]
+			if pad.Note != nil && *pad.Note == me.GetNote() {
+				// note on with vel=0 is a note off
+				if me.GetType() == core.EventMIDINoteOn && me.GetVelocityInt() != 0 {
+					pm.pad(pad, out)
+				}
+				return true
+			}
+		}
+	case core.EventMIDIControlChange:
+		ccNum := me.GetCcNum()
+		// paged knobs
+		for i, n := range p.Knobs {
+			if n == ccNum {
+				if pm.page < len(p.Pages) && i < len(p.Pages[pm.page]) {
+					name := p.Pages[pm.page][i]
+					if name != "" {
+						out(pm.controls[name], me.GetCcInt())
+					}
+				}
+				return true
+			}
+		}
+		// fixed knobs
+		for _, f := range p.Fixed {
+			if f.CC == ccNum {
+				out(pm.controls[f.Control], me.GetCcInt())
+				return true
+			}
+		}
+		// CC pads (momentary, act on the press)
+		for i := range p.Pads {
+			pad := &p.Pads[i]
+			if pad.CC != nil && *pad.CC == ccNum {
+				if me.GetCcInt() != 0 {
+					pm.pad(pad, out)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Controller Profile Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+const testProfile = `{
+  "name": "test",
+  "knobs": [1, 2],
+  "pages": [["a", "b"], ["c"]],
+  "fixed": [{"cc": 7, "control": "vol"}],
+  "pads": [
+    {"note": 45, "action": "cycle", "control": "mode", "values": 3},
+    {"cc": 20, "action": "next"}
+  ]
+}`
+
+var testControls = map[string]uint8{
+	"a":    10,
+	"b":    11,
+	"c":    12,
+	"vol":  13,
+	"mode": 14,
+}
+
+func Test_Profile(t *testing.T) {
+	p, err := ParseProfile([]byte(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := NewProfileMap(p, testControls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type ccval struct{ cc, val uint8 }
+	var result []ccval
+	out := func(cc, val uint8) { result = append(result, ccval{cc, val}) }
+	cc := func(num, val uint8) *core.EventMIDI {
+		return core.NewEventMIDI(core.EventMIDIControlChange, 0xb0, num, val).GetEventMIDI()
+	}
+	note := func(n uint8) *core.EventMIDI {
+		return core.NewEventMIDI(core.EventMIDINoteOn, 0x90, n, 100).GetEventMIDI()
+	}
+
+	tests := []struct {
+		me     *core.EventMIDI
+		used   bool
+		result []ccval
+	}{
+		{cc(1, 5), true, []ccval{{10, 5}}},
+		{cc(2, 6), true, []ccval{{11, 6}}},
+		{cc(7, 7), true, []ccval{{13, 7}}},
+		{cc(3, 8), false, nil},
+		{note(45), true, []ccval{{14, 1}}},
+		{note(45), true, []ccval{{14, 2}}},
+		{note(45), true, []ccval{{14, 0}}},
+		{note(44), false, nil},
+		{cc(20, 127), true, nil}, // next page
+		{cc(20, 0), true, nil},   // pad release
+		{cc(1, 9), true, []ccval{{12, 9}}},
+		{cc(2, 9), true, nil}, // unused on page 1
+		{cc(20, 127), true, nil},
+		{cc(1, 10), true, []ccval{{10, 10}}},
+	}
+
+	for i, v := range tests {
+		result = nil
+		used := pm.Event(v.me, out)
+		if used != v.used || len(result) != len(v.result) {
+			t.Errorf("test %d: expected %v %v, got %v %v", i, v.used, v.result, used, result)
+			continue
+		}
+		for j := range result {
+			if result[j] != v.result[j] {
+				t.Errorf("test %d: expected %v, got %v", i, v.result, result)
+			}
+		}
+	}
+
+	// bad profiles
+	bad := []string{
+		`{"knobs": [1, 1]}`,
+		`{"knobs": [1], "pages": [["a", "b"]]}`,
+		`{"pads": [{"note": 1, "action": "jump"}]}`,
+		`{"pads": [{"note": 1, "cc": 2, "action": "next"}]}`,
+		`{"pads": [{"note": 1, "action": "page", "value": 1}]}`,
+	}
+	for _, v := range bad {
+		_, err := ParseProfile([]byte(v))
+		if err == nil {
+			t.Errorf("expected error for %s", v)
+		}
+	}
+
+	// unknown control name
+	p, _ = ParseProfile([]byte(`{"knobs": [1], "pages": [["x"]]}`))
+	_, err = NewProfileMap(p, testControls)
+	if err == nil {
+		t.Errorf("expected error for unknown control")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,151 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Scale Quantizer Module
+
+Snap notes on the MIDI channel to the nearest note in a key.
+Other MIDI events are passed through.
+
+The key is set with the root and mode ports, or with a Scala scale
+passed to the constructor.
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var quantMidiInfo = core.ModuleInfo{
+	Name: "quantMidi",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, quantMidiIn},
+		{"root", "root note (0..11, C = 0)", core.PortTypeInt, quantPortRoot},
+		{"mode", "mode (index into Modes)", core.PortTypeInt, quantPortMode},
+	},
+	Out: []core.PortInfo{
+		{"midi", "midi output", core.PortTypeMIDI, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *quantMidi) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type quantMidi struct {
+	info  core.ModuleInfo // module info
+	ch    uint8           // MIDI channel
+	key   *Key            // key for quantizing
+	root  int             // root pitch class
+	mode  int             // mode
+	qnote [128]int        // quantized note for each input note (-1 is off)
+	refs  noteRefs        // output note counts
+}
+
+// NewQuantizer returns a MIDI scale quantizer module.
+// A nil key is C major.
+func NewQuantizer(s *core.Synth, ch uint8, key *Key) core.Module {
+	log.Info.Printf("")
+	if key == nil {
+		key, _ = NewKey(0, 0)
+	}
+	m := &quantMidi{
+		info: quantMidiInfo,
+		ch:   ch,
+		key:  key,
+	}
+	for i := range m.qnote {
+		m.qnote[i] = -1
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *quantMidi) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *quantMidi) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// setKey sets the key from the root and mode.
+func (m *quantMidi) setKey() {
+	key, err := NewKey(m.root, m.mode)
+	if err != nil {
+		log.Info.Printf("%s", err)
+		return
+	}
+	log.Info.Printf("key %s", key)
+	m.key = key
+}
+
+// noteOff releases the quantized note for an input note.
+func (m *quantMidi) noteOff(note, vel uint8) {
+	if m.qnote[note] >= 0 {
+		m.refs.off(m, m.ch, uint8(m.qnote[note]), vel)
+		m.qnote[note] = -1
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func quantMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*quantMidi)
+	me := e.GetEventMIDIChannel(m.ch)
+	if me != nil {
+		note := me.GetNote()
+		switch me.GetType() {
+		case core.EventMIDINoteOn:
+			m.noteOff(note, 0)
+			if me.GetVelocityInt() != 0 {
+				q := m.key.Quantize(note)
+				m.qnote[note] = int(q)
+				m.refs.on(m, m.ch, q, me.GetVelocityInt())
+			}
+			return
+		case core.EventMIDINoteOff:
+			m.noteOff(note, me.GetVelocityInt())
+			return
+		}
+	}
+	// pass through everything else
+	core.EventOut(m, "midi", e)
+}
+
+func quantPortRoot(cm core.Module, e *core.Event) {
+	m := cm.(*quantMidi)
+	m.root = core.ClampInt(e.GetEventInt().Val, 0, 11)
+	m.setKey()
+}
+
+func quantPortMode(cm core.Module, e *core.Event) {
+	m := cm.(*quantMidi)
+	mode := e.GetEventInt().Val
+	if !core.InEnum(mode, len(Modes)) {
+		log.Info.Printf("bad mode value %d", mode)
+		return
+	}
+	m.mode = mode
+	m.setKey()
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *quantMidi) Process(buf ...*core.Buf) bool {
+	return false
+}
+
+//-----------------------------------------------------------------------------
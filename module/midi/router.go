@@ -0,0 +1,227 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Router Module
+
+Route MIDI events to a set of outputs using keyboard split/layer rules.
+
+Each rule matches events by input channel, note range and velocity range.
+Matching notes are transposed and sent to the rule output (midi0, midi1, ...)
+on the rule output channel. A note may match several rules (layering).
+
+Note off events go to the same rules as the note on, so a split or layer
+doesn't leave hanging notes. Other channel events (CC, pitch bend, etc.) go
+once to each output with a rule for the channel. System events go to all
+outputs.
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"fmt"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var routerMidiInfo = core.ModuleInfo{
+	Name: "routerMidi",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, routerMidiIn},
+	},
+	// output ports are built from the rules
+}
+
+// Info returns the module information.
+func (m *routerMidi) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// AnyChannel matches events on any MIDI channel.
+const AnyChannel = -1
+
+// maxRouteRules is the maximum number of rules for a router.
+const maxRouteRules = 64
+
+// RouteRule is a MIDI routing rule.
+type RouteRule struct {
+	Out       int   // output port index (midiN)
+	Ch        int   // input MIDI channel (AnyChannel matches all channels)
+	NoteLo    uint8 // lowest note (inclusive)
+	NoteHi    uint8 // highest note (inclusive)
+	VelLo     uint8 // lowest note on velocity (inclusive)
+	VelHi     uint8 // highest note on velocity (inclusive)
+	Transpose int   // transpose (semitones)
+	OutCh     int   // output MIDI channel (AnyChannel keeps the input channel)
+}
+
+// matchChannel returns true if the rule matches the MIDI channel.
+func (r *RouteRule) matchChannel(ch uint8) bool {
+	return r.Ch == AnyChannel || r.Ch == int(ch)
+}
+
+// matchNote returns true if the rule matches the note and velocity.
+func (r *RouteRule) matchNote(note, vel uint8) bool {
+	return note >= r.NoteLo && note <= r.NoteHi && vel >= r.VelLo && vel <= r.VelHi
+}
+
+// channel returns the output channel for an input channel.
+func (r *RouteRule) channel(ch uint8) uint8 {
+	if r.OutCh == AnyChannel {
+		return ch
+	}
+	return uint8(r.OutCh)
+}
+
+//-----------------------------------------------------------------------------
+
+type routerMidi struct {
+	info   core.ModuleInfo // module info
+	rule   []RouteRule     // routing rules
+	port   []string        // output port names
+	active [16][128]uint64 // bitmap of the rules used by each note on
+}
+
+// NewRouter returns a MIDI split/layer routing module.
+func NewRouter(s *core.Synth, rule []RouteRule) core.Module {
+	log.Info.Printf("")
+	if len(rule) > maxRouteRules {
+		panic(fmt.Sprintf("router can have at most %d rules", maxRouteRules))
+	}
+	// build the output ports
+	n := 0
+	for i := range rule {
+		r := &rule[i]
+		if r.Out < 0 {
+			panic(fmt.Sprintf("rule %d: bad output index %d", i, r.Out))
+		}
+		if r.Ch != AnyChannel && !core.InEnum(r.Ch, 16) {
+			panic(fmt.Sprintf("rule %d: bad input channel %d", i, r.Ch))
+		}
+		if r.OutCh != AnyChannel && !core.InEnum(r.OutCh, 16) {
+			panic(fmt.Sprintf("rule %d: bad output channel %d", i, r.OutCh))
+		}
+		if r.Out >= n {
+			n = r.Out + 1
+		}
+	}
+	info := routerMidiInfo
+	info.Out = make([]core.PortInfo, n)
+	port := make([]string, n)
+	for i := range port {
+		port[i] = fmt.Sprintf("midi%d", i)
+		info.Out[i] = core.PortInfo{port[i], fmt.Sprintf("midi output %d", i), core.PortTypeMIDI, nil}
+	}
+	m := &routerMidi{
+		info: info,
+		rule: append([]RouteRule(nil), rule...),
+		port: port,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *routerMidi) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *routerMidi) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Events
+
+// noteOn routes a note on event to all matching rules.
+func (m *routerMidi) noteOn(me *core.EventMIDI) {
+	ch := me.GetChannel()
+	note := me.GetNote()
+	vel := me.GetVelocityInt()
+	// finish any active instance of this note
+	m.noteOff(me.GetType(), ch, note, 0)
+	var active uint64
+	for i := range m.rule {
+		r := &m.rule[i]
+		if r.matchChannel(ch) && r.matchNote(note, vel) {
+			if m.send(r, core.EventMIDINoteOn, ch, note, vel) {
+				active |= 1 << uint(i)
+			}
+		}
+	}
+	m.active[ch][note] = active
+}
+
+// noteOff sends a note event to the rules used by the note on.
+func (m *routerMidi) noteOff(etype core.EventTypeMIDI, ch, note, vel uint8) {
+	active := m.active[ch][note]
+	for i := range m.rule {
+		if active&(1<<uint(i)) != 0 {
+			m.send(&m.rule[i], etype, ch, note, vel)
+		}
+	}
+	if etype != core.EventMIDIPolyphonicAftertouch {
+		m.active[ch][note] = 0
+	}
+}
+
+// send sends a transposed note event to a rule output.
+// Returns false if the transposed note is out of range.
+func (m *routerMidi) send(r *RouteRule, etype core.EventTypeMIDI, ch, note, vel uint8) bool {
+	n := int(note) + r.Transpose
+	if !core.InEnum(n, 128) {
+		return false
+	}
+	core.EventOut(m, m.port[r.Out], core.NewEventMIDIChannel(etype, r.channel(ch), uint8(n), vel))
+	return true
+}
+
+func routerMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*routerMidi)
+	me := e.GetEventMIDI()
+	if me == nil {
+		// system events go to all outputs
+		if e.GetEventSysex() != nil {
+			for _, name := range m.port {
+				core.EventOut(m, name, e)
+			}
+		}
+		return
+	}
+	ch := me.GetChannel()
+	switch me.GetType() {
+	case core.EventMIDINoteOn:
+		if me.GetVelocityInt() != 0 {
+			m.noteOn(me)
+		} else {
+			// note on with vel=0 is a note off
+			m.noteOff(core.EventMIDINoteOn, ch, me.GetNote(), 0)
+		}
+	case core.EventMIDINoteOff, core.EventMIDIPolyphonicAftertouch:
+		m.noteOff(me.GetType(), ch, me.GetNote(), me.GetVelocityInt())
+	default:
+		// other channel events go once to each output with a channel match
+		sent := make([]bool, len(m.port))
+		for i := range m.rule {
+			r := &m.rule[i]
+			if r.matchChannel(ch) && !sent[r.Out] {
+				sent[r.Out] = true
+				core.EventOut(m, m.port[r.Out], core.NewEventMIDIChannel(me.GetType(), r.channel(ch), me.GetNote(), me.GetVelocityInt()))
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *routerMidi) Process(buf ...*core.Buf) bool {
+	return false
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,114 @@
+//-----------------------------------------------------------------------------
+/*
+
+MIDI Router Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// midiSink records the MIDI events sent to its port.
+type midiSink struct {
+	info core.ModuleInfo
+	me   []*core.EventMIDI
+}
+
+func (m *midiSink) Info() *core.ModuleInfo        { return &m.info }
+func (m *midiSink) Child() []core.Module          { return nil }
+func (m *midiSink) Stop()                         {}
+func (m *midiSink) Process(buf ...*core.Buf) bool { return false }
+
+func midiSinkIn(cm core.Module, e *core.Event) {
+	m := cm.(*midiSink)
+	m.me = append(m.me, e.GetEventMIDI())
+}
+
+func newMidiSink(s *core.Synth) *midiSink {
+	m := &midiSink{
+		info: core.ModuleInfo{
+			Name: "midiSink",
+			In:   []core.PortInfo{{"midi", "midi input", core.PortTypeMIDI, midiSinkIn}},
+		},
+	}
+	s.Register(m)
+	return m
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Router(t *testing.T) {
+	s := core.NewSynth()
+	rule := []RouteRule{
+		// upper split, layered on a soft and a hard velocity
+		{0, AnyChannel, 60, 127, 0, 127, 0, AnyChannel},
+		{1, AnyChannel, 60, 127, 100, 127, 12, 3},
+		// lower split, down an octave
+		{2, 0, 0, 59, 0, 127, -12, AnyChannel},
+	}
+	m := NewRouter(s, rule)
+	sink := make([]*midiSink, 3)
+	for i := range sink {
+		sink[i] = newMidiSink(s)
+		core.Connect(m, []string{"midi0", "midi1", "midi2"}[i], sink[i], "midi")
+	}
+
+	type note struct {
+		etype    core.EventTypeMIDI
+		ch, n, v uint8
+	}
+	in := func(etype core.EventTypeMIDI, ch, n, v uint8) {
+		core.EventIn(m, "midi", core.NewEventMIDIChannel(etype, ch, n, v))
+	}
+	check := func(name string, expect [3][]note) {
+		for i := range sink {
+			if len(sink[i].me) != len(expect[i]) {
+				t.Errorf("%s: output %d: expected %v, got %v", name, i, expect[i], sink[i].me)
+			} else {
+				for j, me := range sink[i].me {
+					x := note{me.GetType(), me.GetChannel(), me.GetNote(), me.GetVelocityInt()}
+					if x != expect[i][j] {
+						t.Errorf("%s: output %d: expected %v, got %v", name, i, expect[i][j], x)
+					}
+				}
+			}
+			sink[i].me = nil
+		}
+	}
+
+	on := core.EventTypeMIDI(core.EventMIDINoteOn)
+	off := core.EventTypeMIDI(core.EventMIDINoteOff)
+	cc := core.EventTypeMIDI(core.EventMIDIControlChange)
+
+	in(on, 0, 64, 50)
+	check("soft upper", [3][]note{{{on, 0, 64, 50}}, nil, nil})
+	in(on, 0, 65, 110)
+	check("hard upper", [3][]note{{{on, 0, 65, 110}}, {{on, 3, 77, 110}}, nil})
+	// the note off goes to the layer even with a low release velocity
+	in(off, 0, 65, 10)
+	check("hard upper off", [3][]note{{{off, 0, 65, 10}}, {{off, 3, 77, 10}}, nil})
+	in(on, 0, 40, 80)
+	check("lower", [3][]note{nil, nil, {{on, 0, 28, 80}}})
+	// note on with vel=0 is a note off
+	in(on, 0, 40, 0)
+	check("lower off", [3][]note{nil, nil, {{on, 0, 28, 0}}})
+	// lower split is channel 0 only
+	in(on, 1, 40, 80)
+	check("channel 1", [3][]note{nil, nil, nil})
+	// control changes go once to each output with a channel match
+	in(cc, 1, 7, 99)
+	check("cc", [3][]note{{{cc, 1, 7, 99}}, {{cc, 3, 7, 99}}, nil})
+	// out of range transpose
+	in(on, 0, 5, 80)
+	check("range", [3][]note{nil, nil, nil})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,188 @@
+//-----------------------------------------------------------------------------
+/*
+
+Musical Keys
+
+A key is the set of MIDI notes for a root note and a mode, or for a root
+note and a Scala scale. Keys are used by the scale quantizer and the chord
+generator.
+
+Scala scale degrees are rounded to the nearest 12-TET note. Use the same
+scale for the synth tuning to hear the exact scale pitches.
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// Mode is a musical mode.
+type Mode struct {
+	Name  string // mode name
+	Steps []int  // semitones above the root
+}
+
+// Modes is the list of known modes.
+var Modes = []Mode{
+	{"major", []int{0, 2, 4, 5, 7, 9, 11}},
+	{"minor", []int{0, 2, 3, 5, 7, 8, 10}},
+	{"dorian", []int{0, 2, 3, 5, 7, 9, 10}},
+	{"phrygian", []int{0, 1, 3, 5, 7, 8, 10}},
+	{"lydian", []int{0, 2, 4, 6, 7, 9, 11}},
+	{"mixolydian", []int{0, 2, 4, 5, 7, 9, 10}},
+	{"locrian", []int{0, 1, 3, 5, 6, 8, 10}},
+	{"harmonic minor", []int{0, 2, 3, 5, 7, 8, 11}},
+	{"melodic minor", []int{0, 2, 3, 5, 7, 9, 11}},
+	{"major pentatonic", []int{0, 2, 4, 7, 9}},
+	{"minor pentatonic", []int{0, 3, 5, 7, 10}},
+	{"blues", []int{0, 3, 5, 6, 7, 10}},
+	{"whole tone", []int{0, 2, 4, 6, 8, 10}},
+	{"chromatic", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+}
+
+// modeScale returns the mode as a scala scale.
+func modeScale(mode int) *core.Scale {
+	m := &Modes[mode]
+	s := &core.Scale{Description: m.Name}
+	for _, x := range m.Steps[1:] {
+		s.Cents = append(s.Cents, 100*float64(x))
+	}
+	s.Cents = append(s.Cents, 1200)
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+// Key is the set of MIDI notes in a musical key.
+type Key struct {
+	name  string    // key name
+	notes []uint8   // notes in the key (ascending)
+	in    [128]bool // is the note in the key?
+}
+
+// NewKey returns the key for a root pitch class (0..11, C = 0) and a mode (index into Modes).
+func NewKey(root, mode int) (*Key, error) {
+	if !core.InEnum(mode, len(Modes)) {
+		return nil, fmt.Errorf("bad mode %d", mode)
+	}
+	return NewScaleKey(root, modeScale(mode)), nil
+}
+
+// NewScaleKey returns the key for a root pitch class (0..11, C = 0) and a scala scale.
+// Scale degree 0 is the root note in MIDI octave 5 (e.g. C5 = 60).
+func NewScaleKey(root int, s *core.Scale) *Key {
+	root = ((root % 12) + 12) % 12
+	k := &Key{
+		name: fmt.Sprintf("%s %s", core.MidiNote(root).NoteName(), s.Description),
+	}
+	base := 60 + root
+	n := len(s.Cents)
+	period := s.Cents[n-1]
+	// degrees for the range of MIDI notes
+	lo := int(math.Floor(-float64(base)*100/period)) - 1
+	hi := int(math.Ceil(float64(127-base)*100/period)) + 1
+	for octave := lo; octave <= hi; octave++ {
+		for i := 0; i < n; i++ {
+			cents := float64(octave) * period
+			if i != 0 {
+				cents += s.Cents[i-1]
+			}
+			note := base + int(math.Floor(cents/100+0.5))
+			if core.InEnum(note, 128) {
+				k.in[note] = true
+			}
+		}
+	}
+	for i := range k.in {
+		if k.in[i] {
+			k.notes = append(k.notes, uint8(i))
+		}
+	}
+	return k
+}
+
+func (k *Key) String() string {
+	return k.name
+}
+
+// Contains returns true if the note is in the key.
+func (k *Key) Contains(note uint8) bool {
+	return k.in[note&0x7f]
+}
+
+// Degree returns the index of the note in the key (the nearest lower note for notes not in the key).
+func (k *Key) Degree(note uint8) int {
+	i := sort.Search(len(k.notes), func(i int) bool { return k.notes[i] > note })
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+// Note returns the note for an index in the key.
+// Returns false if the index is out of range.
+func (k *Key) Note(degree int) (uint8, bool) {
+	if !core.InEnum(degree, len(k.notes)) {
+		return 0, false
+	}
+	return k.notes[degree], true
+}
+
+// Quantize returns the nearest note in the key.
+// A note half way between two key notes is quantized down.
+func (k *Key) Quantize(note uint8) uint8 {
+	if len(k.notes) == 0 || k.Contains(note) {
+		return note
+	}
+	i := k.Degree(note)
+	lo := k.notes[i]
+	if lo > note {
+		// below the lowest note
+		return lo
+	}
+	if i+1 == len(k.notes) {
+		// above the highest note
+		return lo
+	}
+	hi := k.notes[i+1]
+	if hi-note < note-lo {
+		return hi
+	}
+	return lo
+}
+
+//-----------------------------------------------------------------------------
+
+// noteRefs counts the note ons for output notes so that overlapping notes
+// from different inputs don't turn each other off.
+type noteRefs struct {
+	count [128]int
+}
+
+// on sends a note on and counts it.
+func (r *noteRefs) on(m core.Module, ch, note, vel uint8) {
+	r.count[note]++
+	core.EventOut(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, ch, note, vel))
+}
+
+// off sends a note off when the last note on for the note is released.
+func (r *noteRefs) off(m core.Module, ch, note, vel uint8) {
+	if r.count[note] == 0 {
+		return
+	}
+	r.count[note]--
+	if r.count[note] == 0 {
+		core.EventOut(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, ch, note, vel))
+	}
+}
+
+//-----------------------------------------------------------------------------
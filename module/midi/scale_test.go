@@ -0,0 +1,225 @@
+//-----------------------------------------------------------------------------
+/*
+
+Scale Quantizer and Chord Generator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package midi
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Key(t *testing.T) {
+	// D dorian
+	k, err := NewKey(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.String() != "D dorian" {
+		t.Errorf("bad key name %s", k)
+	}
+	tests := []struct {
+		in, out uint8
+	}{
+		{60, 60}, // C
+		{61, 60}, // C# -> C (tie goes down)
+		{62, 62}, // D
+		{66, 65}, // F# -> F (tie goes down)
+		{68, 67}, // G# -> G
+		{0, 0},
+		{1, 0},
+		{127, 127}, // G
+	}
+	for _, v := range tests {
+		if q := k.Quantize(v.in); q != v.out {
+			t.Errorf("quantize %d: expected %d, got %d", v.in, v.out, q)
+		}
+	}
+
+	// scala scale: 5 note equal temperament (240 cents per step)
+	s, err := core.ParseScale([]byte("5-TET\n5\n240.0\n480.0\n720.0\n960.0\n2/1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k = NewScaleKey(0, s)
+	expect := []uint8{60, 62, 65, 67, 70, 72}
+	for _, n := range expect {
+		if !k.Contains(n) {
+			t.Errorf("5-TET: expected %d in key", n)
+		}
+	}
+	if k.Quantize(64) != 65 || k.Quantize(63) != 62 {
+		t.Errorf("5-TET: bad quantize")
+	}
+
+	if _, err := NewKey(0, len(Modes)); err == nil {
+		t.Errorf("expected error for bad mode")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// noteEvent is a note event sent to a midi sink.
+type noteEvent struct {
+	on   bool
+	note uint8
+}
+
+// noteEvents returns the note events sent to the sink.
+func noteEvents(sink *midiSink) []noteEvent {
+	var x []noteEvent
+	for _, me := range sink.me {
+		if me == nil {
+			continue
+		}
+		switch me.GetType() {
+		case core.EventMIDINoteOn:
+			x = append(x, noteEvent{me.GetVelocityInt() != 0, me.GetNote()})
+		case core.EventMIDINoteOff:
+			x = append(x, noteEvent{false, me.GetNote()})
+		}
+	}
+	sink.me = nil
+	return x
+}
+
+func noteEventsEqual(a, b []noteEvent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_Quantizer(t *testing.T) {
+	s := core.NewSynth()
+	m := NewQuantizer(s, 0, nil)
+	sink := newMidiSink(s)
+	core.Connect(m, "midi", sink, "midi")
+
+	in := func(etype core.EventTypeMIDI, note uint8) {
+		core.EventIn(m, "midi", core.NewEventMIDIChannel(etype, 0, note, 100))
+	}
+	on := core.EventTypeMIDI(core.EventMIDINoteOn)
+	off := core.EventTypeMIDI(core.EventMIDINoteOff)
+
+	tests := []struct {
+		etype  core.EventTypeMIDI
+		note   uint8
+		result []noteEvent
+	}{
+		{on, 61, []noteEvent{{true, 60}}},   // C# -> C
+		{on, 60, []noteEvent{{true, 60}}},   // C (retrigger)
+		{off, 61, nil},                      // C is still held
+		{off, 60, []noteEvent{{false, 60}}}, // C released
+		{on, 66, []noteEvent{{true, 65}}},   // F# -> F
+	}
+	for i, v := range tests {
+		in(v.etype, v.note)
+		if x := noteEvents(sink); !noteEventsEqual(x, v.result) {
+			t.Errorf("test %d: expected %v, got %v", i, v.result, x)
+		}
+	}
+
+	// change the key while the note is held, E major
+	core.EventInInt(m, "root", 4)
+	in(off, 66)
+	in(on, 66)
+	expect := []noteEvent{{false, 65}, {true, 66}}
+	if x := noteEvents(sink); !noteEventsEqual(x, expect) {
+		t.Errorf("key change: expected %v, got %v", expect, x)
+	}
+
+	// a bad mode is ignored, C major
+	in(off, 66)
+	core.EventInInt(m, "mode", len(Modes))
+	core.EventInInt(m, "root", 0)
+	in(on, 66)
+	expect = []noteEvent{{false, 66}, {true, 65}}
+	if x := noteEvents(sink); !noteEventsEqual(x, expect) {
+		t.Errorf("bad mode: expected %v, got %v", expect, x)
+	}
+}
+
+func Test_Chord(t *testing.T) {
+	s := core.NewSynth()
+	m := NewChord(s, 0, nil)
+	sink := newMidiSink(s)
+	core.Connect(m, "midi", sink, "midi")
+
+	chord := func(note uint8) []uint8 {
+		core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, note, 100))
+		var notes []uint8
+		for _, x := range noteEvents(sink) {
+			notes = append(notes, x.note)
+		}
+		core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, note, 0))
+		sink.me = nil
+		return notes
+	}
+
+	tests := []struct {
+		mode      int // -1 for no key
+		chord     int
+		inversion int
+		voicing   int
+		note      uint8
+		result    []uint8
+	}{
+		{-1, 0, 0, VoicingClose, 60, []uint8{60, 64, 67}},     // C major
+		{-1, 1, 0, VoicingClose, 62, []uint8{62, 65, 69}},     // D minor
+		{-1, 0, 1, VoicingClose, 60, []uint8{64, 67, 72}},     // C major, 1st inversion
+		{-1, 0, 2, VoicingClose, 60, []uint8{67, 72, 76}},     // C major, 2nd inversion
+		{-1, 4, 0, VoicingDrop2, 60, []uint8{55, 60, 64, 70}}, // C7, drop 2
+		{-1, 0, 0, VoicingOpen, 60, []uint8{60, 67, 76}},      // C major, open
+		{0, 0, 0, VoicingClose, 62, []uint8{62, 65, 69}},      // C major key: ii = D minor
+		{0, 0, 0, VoicingClose, 71, []uint8{71, 74, 77}},      // C major key: vii = B diminished
+		{0, 4, 0, VoicingClose, 67, []uint8{67, 71, 74, 77}},  // C major key: V7 = G7
+		{0, 0, 0, VoicingClose, 63, []uint8{62, 65, 69}},      // D# is quantized to D
+	}
+	for i, v := range tests {
+		core.EventInInt(m, "mode", v.mode)
+		core.EventInInt(m, "chord", v.chord)
+		core.EventInInt(m, "inversion", v.inversion)
+		core.EventInInt(m, "voicing", v.voicing)
+		x := chord(v.note)
+		if !notesEqual(x, v.result) {
+			t.Errorf("test %d: expected %v, got %v", i, v.result, x)
+		}
+	}
+
+	// overlapping chords don't turn off shared notes
+	core.EventInInt(m, "mode", -1)
+	core.EventInInt(m, "chord", 0)
+	core.EventInInt(m, "inversion", 0)
+	core.EventInInt(m, "voicing", 0)
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 100)) // C E G
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 64, 100)) // E G# B
+	sink.me = nil
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, 60, 0))
+	expect := []noteEvent{{false, 60}, {false, 67}}
+	if x := noteEvents(sink); !noteEventsEqual(x, expect) {
+		t.Errorf("overlap: expected %v, got %v", expect, x)
+	}
+
+	// a bad mode is ignored
+	for _, mode := range []int{-2, len(Modes)} {
+		core.EventInInt(m, "mode", mode)
+		if m.(*chordMidi).mode != -1 {
+			t.Errorf("bad mode %d was set", mode)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,300 @@
+//-----------------------------------------------------------------------------
+/*
+
+Additive Oscillator Module
+
+The output is the sum of up to 128 sine partials.
+
+The partial amplitudes are a base spectrum (a sawtooth by default) modified by:
+
+* tilt: a gain slope across the partials (dB/octave)
+* balance: the mix of odd (0) and even (1) partials
+* stretch: inharmonicity, partial k has frequency k * f * sqrt((1 + B*k*k)/(1 + B))
+* decay: the decay time of the fundamental, partial k decays k times faster
+
+Partials at or above the nyquist frequency are culled.
+
+A base spectrum can be imported from the FFT of a WAV file snapshot.
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var additiveOscInfo = core.ModuleInfo{
+	Name: "additiveOsc",
+	In: []core.PortInfo{
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, additivePortFrequency},
+		{"gate", "partial decay gate, restart(>0)", core.PortTypeFloat, additivePortGate},
+		{"tilt", "amplitude tilt (dB/octave)", core.PortTypeFloat, additivePortTilt},
+		{"balance", "odd(0)/even(1) partial balance", core.PortTypeFloat, additivePortBalance},
+		{"stretch", "inharmonicity coefficient (0..1)", core.PortTypeFloat, additivePortStretch},
+		{"decay", "fundamental decay time (secs), 0 = no decay", core.PortTypeFloat, additivePortDecay},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *additiveOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// AdditivePartials is the maximum number of partials.
+const AdditivePartials = 128
+
+// sawPartials returns the partial amplitudes of a sawtooth.
+func sawPartials() []float32 {
+	amp := make([]float32, AdditivePartials)
+	for i := range amp {
+		amp[i] = 1 / float32(i+1)
+	}
+	return amp
+}
+
+// PartialsFromWave returns the partial amplitudes (fundamental = 1) of a WAV file snapshot.
+// The fundamental frequency of the snapshot is f (Hz).
+func PartialsFromWave(w *core.Wave, f float32) ([]float32, error) {
+	x := w.Mono()
+	// use the largest power of 2 snapshot
+	n := 1 << 16
+	for n > len(x) {
+		n >>= 1
+	}
+	if n < 4 {
+		return nil, errors.New("snapshot is too short")
+	}
+	if f <= 0 || f >= float32(w.Rate)/2 {
+		return nil, fmt.Errorf("bad fundamental frequency %f", f)
+	}
+	win := core.BlackmanWindow(n)
+	in := make([]complex128, n)
+	for i := range in {
+		in[i] = complex(float64(x[i])*win[i], 0)
+	}
+	spec := core.FFT(in)
+	// bins per harmonic
+	bph := float64(f) * float64(n) / float64(w.Rate)
+	span := int(math.Max(1, bph/2))
+	var amp []float32
+	for k := 1; k <= AdditivePartials; k++ {
+		c := int(math.Floor(float64(k)*bph + 0.5))
+		if c+span >= n/2 {
+			break
+		}
+		// peak magnitude near the harmonic
+		var peak float64
+		for i := core.Max(1, c-span); i <= c+span; i++ {
+			peak = math.Max(peak, cmplx.Abs(spec[i]))
+		}
+		amp = append(amp, float32(peak))
+	}
+	if len(amp) == 0 || amp[0] == 0 {
+		return nil, errors.New("no fundamental")
+	}
+	k := 1 / amp[0]
+	for i := range amp {
+		amp[i] *= k
+	}
+	return amp, nil
+}
+
+// LoadPartials returns the partial amplitudes of a WAV file snapshot.
+func LoadPartials(path string, f float32) ([]float32, error) {
+	w, err := core.LoadWave(path)
+	if err != nil {
+		return nil, err
+	}
+	amp, err := PartialsFromWave(w, f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return amp, nil
+}
+
+//-----------------------------------------------------------------------------
+
+type additiveOsc struct {
+	info    core.ModuleInfo // module info
+	amp     []float32       // base partial amplitudes
+	freq    float32         // base frequency
+	tilt    float32         // amplitude tilt (dB/octave)
+	balance float32         // odd/even balance
+	stretch float32         // inharmonicity coefficient
+	decay   float32         // fundamental decay time
+	level   []float32       // partial levels (0 = culled)
+	env     []float32       // partial decay envelopes
+	gain    []float32       // current partial gains
+	x       []uint32        // partial phase
+	xstep   []uint32        // partial phase step
+}
+
+// NewAdditive returns an additive oscillator module.
+// The partials are the base partial amplitudes (nil for a sawtooth).
+func NewAdditive(s *core.Synth, partials []float32) core.Module {
+	log.Info.Printf("")
+	if partials == nil {
+		partials = sawPartials()
+	}
+	n := core.Min(len(partials), AdditivePartials)
+	m := &additiveOsc{
+		info:    additiveOscInfo,
+		amp:     partials[:n],
+		balance: 0.5,
+		level:   make([]float32, n),
+		env:     make([]float32, n),
+		gain:    make([]float32, n),
+		x:       make([]uint32, n),
+		xstep:   make([]uint32, n),
+	}
+	for i := range m.x {
+		m.env[i] = 1
+		// start with sin(0)
+		m.x[i] = 3 << 30
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *additiveOsc) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *additiveOsc) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+// update sets the partial frequencies and levels.
+func (m *additiveOsc) update() {
+	b := float64(m.stretch)
+	// tilt exponent, k^e is tilt dB/octave
+	e := float64(m.tilt) / (20 * math.Log10(2))
+	odd := core.Clamp(2*(1-m.balance), 0, 1)
+	even := core.Clamp(2*m.balance, 0, 1)
+	for i := range m.level {
+		k := float64(i + 1)
+		f := k * float64(m.freq) * math.Sqrt((1+b*k*k)/(1+b))
+		if f >= 0.5*core.AudioSampleFrequency {
+			// cull the partial
+			m.level[i] = 0
+			m.xstep[i] = 0
+			continue
+		}
+		m.xstep[i] = uint32(float32(f) * core.FrequencyScale)
+		level := m.amp[i] * float32(math.Pow(k, e))
+		if i&1 == 0 {
+			level *= odd
+		} else {
+			level *= even
+		}
+		m.level[i] = level
+	}
+}
+
+func additivePortFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.freq = frequency
+	m.update()
+}
+
+func additivePortGate(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	gate := e.GetEventFloat().Val
+	log.Info.Printf("gate %f", gate)
+	if gate > 0 {
+		// restart the partial decays
+		for i := range m.env {
+			m.env[i] = 1
+		}
+	}
+}
+
+func additivePortTilt(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	tilt := core.Clamp(e.GetEventFloat().Val, -24, 24)
+	log.Info.Printf("set tilt %f dB/octave", tilt)
+	m.tilt = tilt
+	m.update()
+}
+
+func additivePortBalance(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	balance := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set balance %f", balance)
+	m.balance = balance
+	m.update()
+}
+
+func additivePortStretch(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	stretch := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set stretch %f", stretch)
+	m.stretch = stretch
+	m.update()
+}
+
+func additivePortDecay(cm core.Module, e *core.Event) {
+	m := cm.(*additiveOsc)
+	decay := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set decay %f secs", decay)
+	m.decay = decay
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *additiveOsc) Process(buf ...*core.Buf) bool {
+	out := buf[0]
+	out.Zero()
+	// per buffer decay of the fundamental
+	var k float64
+	if m.decay > 0 {
+		k = core.AudioBufferSize / (float64(m.decay) * core.AudioSampleFrequency)
+	}
+	for i := range m.level {
+		g0 := m.gain[i]
+		if m.decay > 0 {
+			m.env[i] *= float32(math.Exp(-k * float64(i+1)))
+		}
+		g1 := m.level[i] * m.env[i]
+		m.gain[i] = g1
+		if g0 == 0 && g1 == 0 {
+			// culled or silent, just step the phase
+			m.x[i] += m.xstep[i] * core.AudioBufferSize
+			continue
+		}
+		// ramp the gain over the buffer
+		dg := (g1 - g0) * (1.0 / core.AudioBufferSize)
+		g := g0
+		x, xstep := m.x[i], m.xstep[i]
+		for j := range out {
+			g += dg
+			out[j] += g * core.CosLookup(x)
+			x += xstep
+		}
+		m.x[i] = x
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
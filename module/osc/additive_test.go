@@ -0,0 +1,165 @@
+//-----------------------------------------------------------------------------
+/*
+
+Additive Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// 375 Hz is an exact FFT bin (and phase step)
+const testFreq = 375
+const testBin = fftSize * testFreq / core.AudioSampleFrequency
+
+// harmonics returns the amplitudes of the first n harmonics of the oscillator output.
+func harmonics(m core.Module, n int) []float64 {
+	// skip the gain ramp
+	render(m, core.AudioBufferSize)
+	x := render(m, fftSize)
+	in := make([]complex128, len(x))
+	for i := range x {
+		in[i] = complex(x[i], 0)
+	}
+	out := core.FFT(in)
+	amp := make([]float64, n)
+	for i := range amp {
+		amp[i] = 2 * cmplx.Abs(out[(i+1)*testBin]) / fftSize
+	}
+	return amp
+}
+
+func checkHarmonics(t *testing.T, name string, amp, expected []float64) {
+	for i := range amp {
+		if math.Abs(amp[i]-expected[i]) > 1e-3 {
+			t.Errorf("%s: harmonic %d is %f, expected %f", name, i+1, amp[i], expected[i])
+		}
+	}
+}
+
+func Test_Additive(t *testing.T) {
+	s := core.NewSynth()
+
+	m := NewAdditive(s, nil)
+	core.EventInFloat(m, "frequency", testFreq)
+	checkHarmonics(t, "sawtooth", harmonics(m, 6), []float64{1, 1.0 / 2, 1.0 / 3, 1.0 / 4, 1.0 / 5, 1.0 / 6})
+
+	// odd partials
+	core.EventInFloat(m, "balance", 0)
+	checkHarmonics(t, "odd", harmonics(m, 6), []float64{1, 0, 1.0 / 3, 0, 1.0 / 5, 0})
+
+	// even partials
+	core.EventInFloat(m, "balance", 1)
+	checkHarmonics(t, "even", harmonics(m, 6), []float64{0, 1.0 / 2, 0, 1.0 / 4, 0, 1.0 / 6})
+
+	// -6.02 dB/octave tilt
+	core.EventInFloat(m, "balance", 0.5)
+	core.EventInFloat(m, "tilt", float32(-20*math.Log10(2)))
+	checkHarmonics(t, "tilt", harmonics(m, 6), []float64{1, 1.0 / 4, 1.0 / 9, 1.0 / 16, 1.0 / 25, 1.0 / 36})
+}
+
+func Test_AdditiveCulling(t *testing.T) {
+	s := core.NewSynth()
+	m := NewAdditive(s, nil)
+	// partials 1..4 are below the nyquist frequency
+	core.EventInFloat(m, "frequency", testFreq*13)
+	render(m, core.AudioBufferSize)
+	x := render(m, fftSize)
+	// the output power is the power of the partials below the nyquist frequency
+	var power float64
+	for _, v := range x {
+		power += v * v
+	}
+	power /= float64(len(x))
+	var expected float64
+	for k := 1; k <= 4; k++ {
+		expected += 0.5 / float64(k*k)
+	}
+	if math.Abs(power-expected) > 1e-3 {
+		t.Errorf("output power %f, expected %f", power, expected)
+	}
+}
+
+func Test_AdditiveStretch(t *testing.T) {
+	s := core.NewSynth()
+	m := NewAdditive(s, nil)
+	core.EventInFloat(m, "frequency", 100)
+	core.EventInFloat(m, "stretch", 0.01)
+	a := m.(*additiveOsc)
+	for i, xstep := range a.xstep[:8] {
+		k := float64(i + 1)
+		f := 100 * k * math.Sqrt((1+0.01*k*k)/1.01)
+		if math.Abs(float64(xstep)/float64(core.FrequencyScale)-f) > 1e-3 {
+			t.Errorf("partial %d: frequency %f, expected %f", i+1, float64(xstep)/float64(core.FrequencyScale), f)
+		}
+	}
+}
+
+func Test_AdditiveDecay(t *testing.T) {
+	s := core.NewSynth()
+	m := NewAdditive(s, nil)
+	core.EventInFloat(m, "frequency", testFreq)
+	core.EventInFloat(m, "decay", 0.5)
+	core.EventInFloat(m, "gate", 1)
+	// 0.5 secs
+	render(m, core.AudioSampleFrequency/2)
+	a := m.(*additiveOsc)
+	for i := 0; i < 4; i++ {
+		x := math.Exp(-float64(i + 1))
+		if math.Abs(float64(a.env[i])-x) > 1e-2 {
+			t.Errorf("partial %d: decay %f, expected %f", i+1, a.env[i], x)
+		}
+	}
+	// restart
+	core.EventInFloat(m, "gate", 1)
+	if a.env[3] != 1 {
+		t.Errorf("decay was not restarted")
+	}
+}
+
+func Test_PartialsFromWave(t *testing.T) {
+	amp := []float64{1, 0.5, 0, 0.25, 0.1}
+	w := &core.Wave{
+		Rate: 44100,
+		Data: [][]float32{make([]float32, 1<<15)},
+	}
+	for i := range w.Data[0] {
+		var x float64
+		for k, a := range amp {
+			x += a * math.Sin(2*math.Pi*441*float64((k+1)*i)/44100)
+		}
+		w.Data[0][i] = float32(0.5 * x)
+	}
+	partials, err := PartialsFromWave(w, 441)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// partials below the nyquist frequency
+	if len(partials) != 49 {
+		t.Errorf("%d partials, expected 49", len(partials))
+	}
+	for i := range partials {
+		var x float64
+		if i < len(amp) {
+			x = amp[i]
+		}
+		if math.Abs(float64(partials[i])-x) > 1e-2 {
+			t.Errorf("partial %d is %f, expected %f", i+1, partials[i], x)
+		}
+	}
+	if _, err := PartialsFromWave(w, 0); err == nil {
+		t.Errorf("expected an error for a bad frequency")
+	}
+}
+
+//-----------------------------------------------------------------------------
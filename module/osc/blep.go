@@ -0,0 +1,75 @@
+//-----------------------------------------------------------------------------
+/*
+
+MinBLEP Discontinuity Correction
+
+A naive waveform has steps that alias. Each step is corrected by adding the
+difference between a minimum phase bandwidth limited step (minBLEP) and an
+ideal step. The corrections are accumulated in a short residual buffer that
+is added to the naive waveform.
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"sync"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+const blepZeroCrossings = 16
+const blepOverSampling = 32
+
+// blepLength is the length of a step correction in samples.
+const blepLength = 2 * blepZeroCrossings
+
+var blepOnce sync.Once
+var blepTable []float32
+
+// blepInit creates the minBLEP table (once).
+func blepInit() {
+	blepOnce.Do(func() {
+		x := core.GenerateMinBLEP(blepZeroCrossings, blepOverSampling)
+		blepTable = make([]float32, len(x))
+		for i := range x {
+			blepTable[i] = float32(x[i])
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
+
+// blep is a residual buffer of step corrections.
+type blep struct {
+	buf [blepLength]float32 // correction residuals
+	idx int                 // current sample index
+}
+
+// add adds a step of height h that happened d samples (0..1) before the current sample.
+func (b *blep) add(h, d float32) {
+	d = core.Clamp(d, 0, 0.999)
+	for i := 0; i < blepLength; i++ {
+		f := (float32(i) + d) * blepOverSampling
+		j := int(f)
+		frac := f - float32(j)
+		step := blepTable[j] + frac*(blepTable[j+1]-blepTable[j])
+		b.buf[(b.idx+i)%blepLength] += h * (step - 1)
+	}
+}
+
+// next returns the correction for the current sample and moves to the next sample.
+func (b *blep) next() float32 {
+	x := b.buf[b.idx]
+	b.buf[b.idx] = 0
+	b.idx++
+	if b.idx == blepLength {
+		b.idx = 0
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,122 @@
+//-----------------------------------------------------------------------------
+/*
+
+MinBLEP Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+const fftSize = 8192
+
+// render returns the output of an oscillator.
+func render(m core.Module, n int) []float64 {
+	var x []float64
+	// no audio inputs, then the output
+	args := make([]*core.Buf, core.NumAudioIn(m)+1)
+	for len(x) < n {
+		var buf core.Buf
+		args[len(args)-1] = &buf
+		m.Process(args...)
+		for _, v := range buf {
+			x = append(x, float64(v))
+		}
+	}
+	return x[:n]
+}
+
+// aliasRatio returns the ratio of the non-harmonic (aliased) energy to the total energy.
+func aliasRatio(x []float64, freq float32) float64 {
+	w := core.BlackmanWindow(len(x))
+	in := make([]complex128, len(x))
+	for i := range x {
+		in[i] = complex(x[i]*w[i], 0)
+	}
+	out := core.FFT(in)
+	// bin spacing in Hz
+	df := float64(core.AudioSampleFrequency) / float64(len(x))
+	var total, alias float64
+	for i := 1; i < len(x)/2; i++ {
+		e := cmplx.Abs(out[i])
+		e *= e
+		total += e
+		// distance to the nearest harmonic (in bins)
+		f := float64(i) * df
+		h := math.Floor(f/float64(freq) + 0.5)
+		if math.Abs(f-h*float64(freq)) > 4*df {
+			alias += e
+		}
+	}
+	return alias / total
+}
+
+func checkAliasing(t *testing.T, name string, basic, blep core.Module) {
+	for _, freq := range []float32{1234.5, 3456.7, 5678.9} {
+		core.EventInFloat(basic, "frequency", freq)
+		core.EventInFloat(blep, "frequency", freq)
+		// skip the start up
+		render(basic, core.AudioBufferSize)
+		render(blep, core.AudioBufferSize)
+		a0 := aliasRatio(render(basic, fftSize), freq)
+		a1 := aliasRatio(render(blep, fftSize), freq)
+		t.Logf("%s %.1f Hz: basic %.1f dB, blep %.1f dB", name, freq, 10*math.Log10(a0), 10*math.Log10(a1))
+		if a1*10 > a0 {
+			t.Errorf("%s %.1f Hz: aliasing is not reduced by 10 dB (basic %g, blep %g)", name, freq, a0, a1)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SawtoothBLEP(t *testing.T) {
+	s := core.NewSynth()
+	checkAliasing(t, "sawtooth", NewSawtoothBasic(s), NewSawtoothBLEP(s))
+}
+
+func Test_SquareBLEP(t *testing.T) {
+	s := core.NewSynth()
+	for _, duty := range []float32{0, 0.3, 1} {
+		basic := NewSquareBasic(s)
+		blep := NewSquareBLEP(s)
+		core.EventInFloat(basic, "duty", duty)
+		core.EventInFloat(blep, "duty", duty)
+		checkAliasing(t, "square", basic, blep)
+	}
+}
+
+func Test_SquareDuty(t *testing.T) {
+	s := core.NewSynth()
+	m := NewSquareBLEP(s)
+	core.EventInFloat(m, "frequency", 440)
+	// sweep the duty cycle every buffer
+	for i := 0; i < 200; i++ {
+		core.EventInFloat(m, "duty", float32(i%17)/16)
+		for _, x := range render(m, core.AudioBufferSize) {
+			if math.IsNaN(x) || math.Abs(x) > 2 {
+				t.Fatalf("bad sample value %f", x)
+			}
+		}
+	}
+	// no steps at zero frequency
+	core.EventInFloat(m, "frequency", 0)
+	render(m, core.AudioBufferSize)
+	core.EventInFloat(m, "duty", 0)
+	for _, x := range render(m, 4*core.AudioBufferSize)[2*core.AudioBufferSize:] {
+		if x != -1 && x != 1 {
+			t.Fatalf("output is not constant at zero frequency (%f)", x)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,211 @@
+//-----------------------------------------------------------------------------
+/*
+
+Phase Distortion Oscillator
+
+This is the Casio CZ phase distortion oscillator. A cosine is read with a
+distorted phase. The DCW (digitally controlled wave) amount sets the distortion.
+At 0 the waveforms are a cosine (the resonance waveforms are a windowed
+cosine). At 1 they are the full CZ waveform.
+
+The waveforms are:
+
+* saw: a fast then slow phase
+* square: a fast phase and a flat phase in each half cycle
+* pulse: a fast phase then a flat phase
+* double sine: each half cycle reads a cosine cycle
+* saw-pulse: a saw in the first half cycle then a flat phase
+* resonance 1, 2, 3: a cosine at 1..16 times the frequency, reset each cycle
+  and windowed by a saw, triangle or trapezoid.
+
+The dcw_mod audio input is added to the DCW amount.
+
+See:
+https://en.wikipedia.org/wiki/Phase_distortion_synthesis
+Casio CZ-101 Operation Manual
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var czOscInfo = core.ModuleInfo{
+	Name: "czOsc",
+	In: []core.PortInfo{
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, czOscFrequency},
+		{"wave", "waveform (0..7)", core.PortTypeInt, czOscWave},
+		{"dcw", "phase distortion amount (0..1)", core.PortTypeFloat, czOscDcw},
+		{"dcw_mod", "phase distortion modulation", core.PortTypeAudio, nil},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *czOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// CzWave is a phase distortion waveform.
+type CzWave int
+
+// phase distortion waveforms
+const (
+	CzSaw        CzWave = iota // sawtooth
+	CzSquare                   // square
+	CzPulse                    // pulse
+	CzDoubleSine               // double sine
+	CzSawPulse                 // saw-pulse
+	CzResonance1               // resonance (saw window)
+	CzResonance2               // resonance (triangle window)
+	CzResonance3               // resonance (trapezoid window)
+	czMaxWave
+)
+
+func (w CzWave) String() string {
+	return []string{"saw", "square", "pulse", "double sine", "saw-pulse", "resonance 1", "resonance 2", "resonance 3"}[w]
+}
+
+type czOsc struct {
+	info  core.ModuleInfo // module info
+	wave  CzWave          // waveform
+	dcw   float32         // phase distortion amount
+	x     uint32          // phase position
+	xstep uint32          // phase step per sample
+}
+
+// NewCZ returns a phase distortion oscillator module.
+func NewCZ(s *core.Synth) core.Module {
+	log.Info.Printf("")
+	m := &czOsc{
+		info: czOscInfo,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *czOsc) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *czOsc) Stop() {
+}
+
+// SetCZFrequency sets the frequency of a CZ oscillator without logging.
+// It's for a voice that changes the pitch every buffer.
+func SetCZFrequency(cm core.Module, frequency float32) {
+	cm.(*czOsc).setFrequency(core.ClampLo(frequency, 0))
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func (m *czOsc) setFrequency(frequency float32) {
+	m.xstep = uint32(frequency * core.FrequencyScale)
+}
+
+func czOscFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*czOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.setFrequency(frequency)
+}
+
+func czOscWave(cm core.Module, e *core.Event) {
+	m := cm.(*czOsc)
+	wave := e.GetEventInt().Val
+	if !core.InEnum(wave, int(czMaxWave)) {
+		log.Info.Printf("bad waveform %d", wave)
+		return
+	}
+	m.wave = CzWave(wave)
+	log.Info.Printf("set waveform %s", m.wave)
+}
+
+func czOscDcw(cm core.Module, e *core.Event) {
+	m := cm.(*czOsc)
+	dcw := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set dcw %f", dcw)
+	m.dcw = dcw
+}
+
+//-----------------------------------------------------------------------------
+
+// czCos returns the cosine of a phase (cycles).
+func czCos(phase float32) float32 {
+	return core.CosLookup(uint32(int64(phase * core.FullCycle)))
+}
+
+// czBend returns a phase that reaches 0.5 at x = d, and 1 at x = 1.
+func czBend(x, d float32) float32 {
+	if x < d {
+		return 0.5 * x / d
+	}
+	return 0.5 + 0.5*(x-d)/(1-d)
+}
+
+// czSample returns the waveform value at phase x (0..1) for a phase distortion amount.
+func czSample(wave CzWave, x, dcw float32) float32 {
+	switch wave {
+	case CzSaw:
+		return czCos(czBend(x, 0.5-0.49*dcw))
+	case CzSquare:
+		d := 1 - 0.98*dcw
+		if x < 0.5 {
+			return czCos(0.5 * core.Clamp(2*x/d, 0, 1))
+		}
+		return czCos(0.5 + 0.5*core.Clamp((2*x-1)/d, 0, 1))
+	case CzPulse:
+		return czCos(core.Clamp(x/(1-0.98*dcw), 0, 1))
+	case CzDoubleSine:
+		if x < 0.5 {
+			return czCos(x * (1 + dcw))
+		}
+		return czCos(1 - (1-x)*(1+dcw))
+	case CzSawPulse:
+		e := 1 - 0.5*dcw
+		if x < e {
+			return czCos(czBend(x/e, 0.5-0.49*dcw))
+		}
+		return 1
+	}
+	// resonance
+	var w float32
+	switch wave {
+	case CzResonance1:
+		w = 1 - x
+	case CzResonance2:
+		w = 1 - core.Abs(2*x-1)
+	case CzResonance3:
+		w = core.Clamp(2*(1-x), 0, 1)
+	}
+	return 1 - w*(1-czCos(x*(1+15*dcw)))
+}
+
+// Process runs the module DSP.
+func (m *czOsc) Process(buf ...*core.Buf) bool {
+	mod := buf[0]
+	out := buf[1]
+	dcw := m.dcw
+	for i := range out {
+		if mod != nil {
+			dcw = core.Clamp(m.dcw+mod[i], 0, 1)
+		}
+		out[i] = czSample(m.wave, float32(m.x)*(1.0/core.FullCycle), dcw)
+		m.x += m.xstep
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
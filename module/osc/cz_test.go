@@ -0,0 +1,104 @@
+//-----------------------------------------------------------------------------
+/*
+
+Phase Distortion Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// 128 samples per cycle
+const czFreq = core.AudioSampleFrequency / 128
+
+// newCZ returns a phase distortion oscillator.
+func newCZ(wave CzWave, dcw float32) core.Module {
+	s := core.NewSynth()
+	m := NewCZ(s)
+	core.EventInFloat(m, "frequency", czFreq)
+	core.EventInInt(m, "wave", int(wave))
+	core.EventInFloat(m, "dcw", dcw)
+	return m
+}
+
+// centroid returns the spectral centroid (harmonic number) of the first 32 harmonics.
+func centroid(x []float64) float64 {
+	var sum, wsum float64
+	for h := 1; h <= 32; h++ {
+		a := harmonic(x, float64(h*czFreq))
+		sum += a
+		wsum += float64(h) * a
+	}
+	return wsum / sum
+}
+
+func Test_CzCosine(t *testing.T) {
+	for wave := CzSaw; wave <= CzSawPulse; wave++ {
+		x := render(newCZ(wave, 0), 1024)
+		for i := range x {
+			y := math.Cos(2 * math.Pi * float64(i) / 128)
+			if math.Abs(x[i]-y) > 1e-3 {
+				t.Errorf("%s: sample %d is %f, expected %f", wave, i, x[i], y)
+				break
+			}
+		}
+	}
+}
+
+func Test_CzWaves(t *testing.T) {
+	// saw has all harmonics
+	x := render(newCZ(CzSaw, 1), 12800)
+	if harmonic(x, 2*czFreq) < 0.3*harmonic(x, czFreq) {
+		t.Errorf("saw: weak 2nd harmonic")
+	}
+	// square has odd harmonics
+	x = render(newCZ(CzSquare, 1), 12800)
+	if harmonic(x, 2*czFreq) > 0.01*harmonic(x, czFreq) || harmonic(x, 3*czFreq) < 0.2*harmonic(x, czFreq) {
+		t.Errorf("square: bad harmonics")
+	}
+	// resonance peaks at 16 times the frequency
+	for _, wave := range []CzWave{CzResonance1, CzResonance2, CzResonance3} {
+		x = render(newCZ(wave, 1), 12800)
+		if harmonic(x, 16*czFreq) < 2*harmonic(x, 4*czFreq) {
+			t.Errorf("%s: no resonant peak", wave)
+		}
+	}
+	// more dcw, brighter
+	for wave := CzSaw; wave <= CzResonance3; wave++ {
+		c0 := centroid(render(newCZ(wave, 0.25), 12800))
+		c1 := centroid(render(newCZ(wave, 0.75), 12800))
+		if c1 <= c0 {
+			t.Errorf("%s: spectral centroid %f at dcw 0.75, %f at dcw 0.25", wave, c1, c0)
+		}
+	}
+}
+
+func Test_CzModulation(t *testing.T) {
+	m0 := newCZ(CzPulse, 0.8)
+	m1 := newCZ(CzPulse, 0.3)
+	var mod core.Buf
+	for i := range mod {
+		mod[i] = 0.5
+	}
+	for j := 0; j < 10; j++ {
+		var out0, out1 core.Buf
+		m0.Process(nil, &out0)
+		m1.Process(&mod, &out1)
+		for i := range out0 {
+			if math.Abs(float64(out0[i]-out1[i])) > 1e-6 {
+				t.Fatalf("modulated dcw is different")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -37,9 +37,11 @@ var goomOscInfo = core.ModuleInfo{
 		{"duty", "duty cycle (0..1)", core.PortTypeFloat, goomOscDuty},
 		{"slope", "slope (0..1)", core.PortTypeFloat, goomOscSlope},
 		{"mode", "oscillator mode", core.PortTypeInt, goomOscMode},
+		{"sync", "sync input", core.PortTypeAudio, nil},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
+		{"sync", "sync output", core.PortTypeAudio, nil},
 	},
 }
 
@@ -90,6 +92,11 @@ func (m *goomOsc) Child() []core.Module {
 func (m *goomOsc) Stop() {
 }
 
+// setPhase sets the oscillator phase.
+func (m *goomOsc) setPhase(x uint32) {
+	m.x = x
+}
+
 //-----------------------------------------------------------------------------
 // Events
 
@@ -167,27 +174,29 @@ func (m *goomOsc) Process(buf ...*core.Buf) bool {
 
 	switch m.mode {
 	case GoomModeBasic: // no feedback, no modulation
-		out := buf[0]
+		syncIn, out, syncOut := syncBufs(buf, 0)
 		for i := 0; i < len(out); i++ {
 			out[i] = m.sample()
 			// step the phase
-			m.x += m.xstep
+			setSync(syncOut, i, syncStep(&m.x, m.xstep, getSync(syncIn, i)))
 		}
 	case GoomModeFM: // frequency modulation input
 		fm := buf[0]
-		out := buf[1]
+		syncIn, out, syncOut := syncBufs(buf, 1)
 		for i := 0; i < len(out); i++ {
 			out[i] = m.sample()
 			// step the phase
-			m.x += uint32((m.freq + fm[i]) * core.FrequencyScale)
+			xstep := uint32((m.freq + fm[i]) * core.FrequencyScale)
+			setSync(syncOut, i, syncStep(&m.x, xstep, getSync(syncIn, i)))
 		}
 	case GoomModePM: // phase modulation input
 		pm := buf[0]
-		out := buf[1]
+		syncIn, out, syncOut := syncBufs(buf, 1)
 		for i := 0; i < len(out); i++ {
 			out[i] = m.sample()
 			// step the phase
-			m.x += uint32(float32(m.xstep) + (pm[i] * core.PhaseScale))
+			xstep := uint32(float32(m.xstep) + (pm[i] * core.PhaseScale))
+			setSync(syncOut, i, syncStep(&m.x, xstep, getSync(syncIn, i)))
 		}
 	default:
 		panic(fmt.Sprintf("bad mode %d", m.mode))
@@ -3,14 +3,25 @@
 
 Karplus Strong Oscillator Module
 
-KS generally has a delay line buffer size that determines the fundamental frequency
-of the sound. That has some practical problems. The delay line buffer is too
-large for low frequencies and it makes it hard to provide fine resolution
-control over the frequency. This implementation uses a fixed buffer size and
-steps through it with a 32 bit phase value. The step size determines the
-frequency of the sound. When the step position falls between samples we do
-linear interpolation to get the output value. When we move beyond a sample
-we do the low pass filtering on it (in this case simple averaging).
+This is the extended Karplus Strong (Jaffe/Smith) plucked string.
+
+The string loop has:
+
+* a variable length delay line (the integer part of the period)
+* a two point average lowpass with a loss (attenuation)
+* first order allpasses for string stiffness (dispersion)
+* a first order allpass tuned to the fractional part of the period
+
+A gate plucks the string with a noise burst that is lowpass filtered for the
+pick direction and comb filtered for the pick position. The gate value sets
+the dynamic level. Softer plucks are quieter and have fewer high harmonics.
+
+Audio on the excitation input (a nil buffer for none) is pick filtered and
+added to the string.
+
+See:
+Jaffe, D. A., Smith, J. O., "Extensions of the Karplus-Strong Plucked-String Algorithm", 1983
+https://ccrma.stanford.edu/~jos/pasp/Extended_Karplus_Strong_Algorithm.html
 
 */
 //-----------------------------------------------------------------------------
@@ -18,6 +29,8 @@ we do the low pass filtering on it (in this case simple averaging).
 package osc
 
 import (
+	"math"
+
 	"github.com/deadsy/babi/core"
 	"github.com/deadsy/babi/utils/log"
 )
@@ -30,6 +43,10 @@ var ksOscInfo = core.ModuleInfo{
 		{"gate", "oscillator gate, attack(>0) or mute(=0)", core.PortTypeFloat, ksPortGate},
 		{"frequency", "frequency (Hz)", core.PortTypeFloat, ksPortFrequency},
 		{"attenuation", "attenuation (0..1)", core.PortTypeFloat, ksPortAttenuation},
+		{"pick_position", "pick position (0..1), 0 is off", core.PortTypeFloat, ksPortPickPosition},
+		{"pick_direction", "pick direction (0..1), 0 is up, 1 is down", core.PortTypeFloat, ksPortPickDirection},
+		{"stiffness", "string stiffness (0..1)", core.PortTypeFloat, ksPortStiffness},
+		{"in", "excitation input", core.PortTypeAudio, nil},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
@@ -43,30 +60,62 @@ func (m *ksOsc) Info() *core.ModuleInfo {
 
 //-----------------------------------------------------------------------------
 
-const ksDelayBits = 5
-const ksDelaySize = 1 << ksDelayBits
-
+const ksDelayBits = 12
+const ksDelaySize = 1 << ksDelayBits // delay line size (lowest frequency ~12 Hz)
 const ksDelayMask = ksDelaySize - 1
-const ksFracBits = 32 - ksDelayBits
-const ksFracMask = (1 << ksFracBits) - 1
-const ksFracScale = 1 / (1 << ksFracBits)
+
+const ksStiffSections = 4 // number of stiffness allpasses
+
+// ksAllpass is a first order allpass filter: H(z) = (c + z^-1)/(1 + c.z^-1)
+type ksAllpass struct {
+	x1, y1 float32
+}
+
+func (a *ksAllpass) filter(x, c float32) float32 {
+	y := c*x + a.x1 - c*a.y1
+	a.x1 = x
+	a.y1 = y
+	return y
+}
+
+// allpassDelay returns the phase delay (samples) of a first order allpass at w (radians/sample).
+func allpassDelay(c, w float64) float64 {
+	s, k := math.Sin(w), math.Cos(w)
+	phase := math.Atan2(-s, c+k) - math.Atan2(-c*s, 1+c*k)
+	return -phase / w
+}
 
 type ksOsc struct {
-	info  core.ModuleInfo // module info
-	rand  *core.Rand32
-	delay [ksDelaySize]float32 // delay line
-	k     float32              // attenuation and averaging constant 0 to 0.5
-	freq  float32              // base frequency
-	x     uint32               // phase position
-	xstep uint32               // phase step per sample
+	info      core.ModuleInfo // module info
+	rand      *core.Rand32
+	delay     [ksDelaySize]float32 // delay line
+	pick      [ksDelaySize]float32 // pick direction filtered excitation (for the pick position comb)
+	wr        int                  // delay line write index
+	n         int                  // delay line length
+	k         float32              // attenuation and averaging constant 0 to 0.5
+	freq      float32              // base frequency
+	position  float32              // pick position
+	direction float32              // pick direction lowpass coefficient
+	stiffness float32              // stiffness
+	burst     []float32            // pluck excitation
+	level     float32              // dynamic level
+	d1        float32              // averaging filter state
+	sc        float32              // stiffness allpass coefficient
+	stiff     [ksStiffSections]ksAllpass
+	tc        float32   // tuning allpass coefficient
+	tune      ksAllpass // tuning allpass
+	e1        float32   // pick direction filter state
+	lb, la    float32   // dynamic level lowpass coefficients
+	lx1, ly1  float32   // dynamic level lowpass state
 }
 
 // NewKarplusStrong returns a Karplus Strong oscillator module.
 func NewKarplusStrong(s *core.Synth) core.Module {
 	log.Info.Printf("new osc")
 	m := &ksOsc{
-		info: ksOscInfo,
-		rand: core.NewRand32(0),
+		info:  ksOscInfo,
+		rand:  core.NewRand32(0),
+		level: 1,
 	}
 	return s.Register(m)
 }
@@ -80,6 +129,74 @@ func (m *ksOsc) Child() []core.Module {
 func (m *ksOsc) Stop() {
 }
 
+//-----------------------------------------------------------------------------
+
+// update sets the delay line length and the loop filters for the frequency.
+func (m *ksOsc) update() {
+	if m.freq <= 0 {
+		return
+	}
+	// period (samples)
+	p := math.Min(math.Max(core.AudioSampleFrequency/float64(m.freq), 4), ksDelaySize-2)
+	w := 2 * math.Pi / p
+	// The stiffness allpasses delay the fundamental. Reduce the stiffness
+	// if we need more delay than the period.
+	c := -0.7 * float64(m.stiffness)
+	var ds float64
+	for c != 0 {
+		ds = ksStiffSections * allpassDelay(c, w)
+		if p-0.5-ds >= 2.1 {
+			break
+		}
+		ds = 0
+		c *= 0.5
+		if c > -1e-3 {
+			c = 0
+		}
+	}
+	// the averaging filter delay is 0.5 samples
+	d := p - 0.5 - ds
+	// keep the tuning allpass delay in 0.1..1.1 (c > -1)
+	n := int(d - 0.1)
+	eta := d - float64(n)
+	m.n = n
+	m.sc = float32(c)
+	// allpass coefficient for a phase delay of eta at the fundamental
+	m.tc = float32(math.Sin((1-eta)*w/2) / math.Sin((1+eta)*w/2))
+	// dynamic level lowpass at the fundamental
+	t := math.Tan(math.Pi * float64(m.freq) / core.AudioSampleFrequency)
+	m.lb = float32(t / (1 + t))
+	m.la = float32((1 - t) / (1 + t))
+}
+
+// pluck starts a noise burst excitation with a period length.
+func (m *ksOsc) pluck() {
+	n := core.Max(m.n, 1)
+	m.burst = make([]float32, n)
+	var sum float32
+	for i := range m.burst {
+		m.burst[i] = m.rand.Float32()
+		sum += m.burst[i]
+	}
+	// remove any DC
+	sum /= float32(n)
+	for i := range m.burst {
+		m.burst[i] -= sum
+	}
+}
+
+// mute stops the string.
+func (m *ksOsc) mute() {
+	for i := range m.delay {
+		m.delay[i] = 0
+		m.pick[i] = 0
+	}
+	m.burst = nil
+	m.d1, m.e1, m.lx1, m.ly1 = 0, 0, 0, 0
+	m.tune = ksAllpass{}
+	m.stiff = [ksStiffSections]ksAllpass{}
+}
+
 //-----------------------------------------------------------------------------
 // Port Events
 
@@ -88,24 +205,10 @@ func ksPortGate(cm core.Module, e *core.Event) {
 	gate := e.GetEventFloat().Val
 	log.Info.Printf("gate %f", gate)
 	if gate > 0 {
-		// Initialise the delay buffer with random samples between -1 and 1.
-		// The values should sum to zero so that multiple rounds of filtering
-		// will make all values fall to zero.
-		var sum float32
-		for i := 0; i < ksDelaySize-1; i++ {
-			val := m.rand.Float32()
-			x := sum + val
-			if x > 1 || x < -1 {
-				val = -val
-			}
-			sum += val
-			m.delay[i] = val
-		}
-		m.delay[ksDelaySize-1] = -sum
+		m.level = core.Clamp(gate, 0, 1)
+		m.pluck()
 	} else {
-		for i := 0; i < ksDelaySize; i++ {
-			m.delay[i] = 0
-		}
+		m.mute()
 	}
 }
 
@@ -121,28 +224,79 @@ func ksPortFrequency(cm core.Module, e *core.Event) {
 	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
 	log.Info.Printf("set frequency %f Hz", frequency)
 	m.freq = frequency
-	m.xstep = uint32(frequency * core.FrequencyScale)
+	m.update()
+}
+
+func ksPortPickPosition(cm core.Module, e *core.Event) {
+	m := cm.(*ksOsc)
+	position := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set pick position %f", position)
+	m.position = position
+}
+
+func ksPortPickDirection(cm core.Module, e *core.Event) {
+	m := cm.(*ksOsc)
+	direction := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set pick direction %f", direction)
+	m.direction = 0.9 * direction
+}
+
+func ksPortStiffness(cm core.Module, e *core.Event) {
+	m := cm.(*ksOsc)
+	stiffness := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set stiffness %f", stiffness)
+	m.stiffness = stiffness
+	m.update()
 }
 
 //-----------------------------------------------------------------------------
 
 // Process runs the module DSP.
 func (m *ksOsc) Process(buf ...*core.Buf) bool {
-	out := buf[0]
-	for i := 0; i < len(out); i++ {
-		x0 := m.x >> ksFracBits
-		x1 := (x0 + 1) & ksDelayMask
-		y0 := m.delay[x0]
-		y1 := m.delay[x1]
-		// interpolate
-		out[i] = y0 + (y1-y0)*ksFracScale*float32(m.x&ksFracMask)
-		// step the x position
-		m.x += m.xstep
-		// filter - once we have moved beyond the delay line index we
-		// will average it's amplitude with the next value.
-		if x0 != (m.x >> ksFracBits) {
-			m.delay[x0] = m.k * (y0 + y1)
+	in := buf[0]
+	out := buf[1]
+	if m.n == 0 {
+		// no frequency
+		out.Zero()
+		return true
+	}
+	// pick position comb delay
+	pd := int(m.position*float32(m.n) + 0.5)
+	for i := range out {
+		// excitation
+		var x float32
+		if len(m.burst) != 0 {
+			x = m.burst[0]
+			m.burst = m.burst[1:]
+		}
+		if in != nil {
+			x += in[i]
+		}
+		// pick direction lowpass
+		m.e1 = (1-m.direction)*x + m.direction*m.e1
+		m.pick[m.wr] = m.e1
+		// pick position comb
+		x = m.e1
+		if pd != 0 {
+			x -= m.pick[(m.wr-pd)&ksDelayMask]
+		}
+		// string loop
+		d := m.delay[(m.wr-m.n)&ksDelayMask]
+		y := m.k * (d + m.d1)
+		m.d1 = d
+		if m.sc != 0 {
+			for j := range m.stiff {
+				y = m.stiff[j].filter(y, m.sc)
+			}
 		}
+		y = m.tune.filter(y, m.tc) + x
+		m.delay[m.wr] = y
+		m.wr = (m.wr + 1) & ksDelayMask
+		// dynamic level lowpass
+		lp := m.lb*(y+m.lx1) + m.la*m.ly1
+		m.lx1 = y
+		m.ly1 = lp
+		out[i] = m.level * (m.level*y + (1-m.level)*lp)
 	}
 	return true
 }
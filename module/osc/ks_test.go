@@ -0,0 +1,217 @@
+//-----------------------------------------------------------------------------
+/*
+
+Karplus Strong Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// period returns the period (samples) of a signal near an expected period.
+func period(x []float64, p float64) float64 {
+	n := len(x) / 2
+	var mean float64
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	r := func(lag int) float64 {
+		var sum float64
+		for i := 0; i < n; i++ {
+			sum += (x[i] - mean) * (x[i+lag] - mean)
+		}
+		return sum
+	}
+	best := 0
+	for lag := int(0.9 * p); lag <= int(1.1*p)+1; lag++ {
+		if best == 0 || r(lag) > r(best) {
+			best = lag
+		}
+	}
+	// parabolic interpolation
+	y0, y1, y2 := r(best-1), r(best), r(best+1)
+	return float64(best) + 0.5*(y0-y2)/(y0-2*y1+y2)
+}
+
+// harmonic returns the amplitude of frequency f in a signal.
+func harmonic(x []float64, f float64) float64 {
+	var re, im float64
+	for i := range x {
+		w := 2 * math.Pi * f * float64(i) / core.AudioSampleFrequency
+		re += x[i] * math.Cos(w)
+		im -= x[i] * math.Sin(w)
+	}
+	return 2 * math.Hypot(re, im) / float64(len(x))
+}
+
+// partial returns the offset (cents) of the partial nearest to frequency f.
+func partial(x []float64, f float64) float64 {
+	w := core.BlackmanWindow(len(x))
+	y := make([]float64, len(x))
+	for i := range x {
+		y[i] = x[i] * w[i]
+	}
+	best := 0.0
+	amp := 0.0
+	for c := -50.0; c <= 50; c += 0.25 {
+		if a := harmonic(y, f*math.Pow(2, c/1200)); a > amp {
+			best, amp = c, a
+		}
+	}
+	return best
+}
+
+func Test_KarplusStrongPitch(t *testing.T) {
+	s := core.NewSynth()
+	for _, stiffness := range []float32{0, 1} {
+		for _, freq := range []float32{41.2, 110, 440, 1234.5, 3520} {
+			m := NewKarplusStrong(s)
+			core.EventInFloat(m, "attenuation", 1)
+			core.EventInFloat(m, "frequency", freq)
+			core.EventInFloat(m, "stiffness", stiffness)
+			core.EventInFloat(m, "gate", 1)
+			x := render(m, 16384)
+			if cents := partial(x[4096:], float64(freq)); math.Abs(cents) > 2 {
+				t.Errorf("stiffness %f: %f Hz is %f cents", stiffness, freq, cents)
+			}
+		}
+	}
+}
+
+func Test_KarplusStrongStiffness(t *testing.T) {
+	const freq = 220
+	s := core.NewSynth()
+	// a stiff string has sharp upper partials
+	for _, stiffness := range []float32{0, 1} {
+		m := NewKarplusStrong(s)
+		core.EventInFloat(m, "attenuation", 1)
+		core.EventInFloat(m, "frequency", freq)
+		core.EventInFloat(m, "stiffness", stiffness)
+		core.EventInFloat(m, "gate", 1)
+		x := render(m, 16384)
+		cents := partial(x[4096:], 8*freq)
+		if stiffness == 0 && math.Abs(cents) > 2 {
+			t.Errorf("stiffness 0: 8th partial is %f cents", cents)
+		}
+		if stiffness == 1 && cents < 10 {
+			t.Errorf("stiffness 1: 8th partial is %f cents", cents)
+		}
+	}
+}
+
+func Test_KarplusStrongPick(t *testing.T) {
+	const freq = 200
+	s := core.NewSynth()
+	m0 := NewKarplusStrong(s)
+	core.EventInFloat(m0, "attenuation", 1)
+	core.EventInFloat(m0, "frequency", freq)
+	core.EventInFloat(m0, "gate", 1)
+	x0 := render(m0, 9600)
+	// plucked at the middle of the string, there are no even harmonics
+	m1 := NewKarplusStrong(s)
+	core.EventInFloat(m1, "attenuation", 1)
+	core.EventInFloat(m1, "frequency", freq)
+	core.EventInFloat(m1, "pick_position", 0.5)
+	core.EventInFloat(m1, "gate", 1)
+	x1 := render(m1, 9600)
+	h0 := harmonic(x0, 2*freq) / harmonic(x0, freq)
+	h1 := harmonic(x1, 2*freq) / harmonic(x1, freq)
+	if h1 > 0.1*h0 {
+		t.Errorf("2nd harmonic ratio %f, expected < %f", h1, 0.1*h0)
+	}
+	// picking down has fewer high harmonics
+	m2 := NewKarplusStrong(s)
+	core.EventInFloat(m2, "attenuation", 1)
+	core.EventInFloat(m2, "frequency", freq)
+	core.EventInFloat(m2, "pick_direction", 1)
+	core.EventInFloat(m2, "gate", 1)
+	x1 = render(m2, 9600)
+	h0 = harmonic(x0, 20*freq)
+	h1 = harmonic(x1, 20*freq)
+	if h1 > 0.5*h0 {
+		t.Errorf("20th harmonic %f, expected < %f", h1, 0.5*h0)
+	}
+}
+
+func Test_KarplusStrongLevel(t *testing.T) {
+	const freq = 200
+	s := core.NewSynth()
+	m0 := NewKarplusStrong(s)
+	core.EventInFloat(m0, "attenuation", 1)
+	core.EventInFloat(m0, "frequency", freq)
+	core.EventInFloat(m0, "gate", 1)
+	x0 := render(m0, 9600)
+	m1 := NewKarplusStrong(s)
+	core.EventInFloat(m1, "attenuation", 1)
+	core.EventInFloat(m1, "frequency", freq)
+	core.EventInFloat(m1, "gate", 0.5)
+	x1 := render(m1, 9600)
+	// quieter
+	if harmonic(x1, freq) > 0.6*harmonic(x0, freq) {
+		t.Errorf("soft pluck is too loud")
+	}
+	// darker
+	h0 := harmonic(x0, 10*freq) / harmonic(x0, freq)
+	h1 := harmonic(x1, 10*freq) / harmonic(x1, freq)
+	if h1 > 0.75*h0 {
+		t.Errorf("soft pluck 10th harmonic ratio %f, expected < %f", h1, 0.75*h0)
+	}
+}
+
+func Test_KarplusStrongMute(t *testing.T) {
+	s := core.NewSynth()
+	m := NewKarplusStrong(s)
+	core.EventInFloat(m, "attenuation", 1)
+	core.EventInFloat(m, "frequency", 200)
+	core.EventInFloat(m, "gate", 1)
+	render(m, 1000)
+	core.EventInFloat(m, "gate", 0)
+	x := render(m, 1000)
+	for i := range x {
+		if x[i] != 0 {
+			t.Fatalf("output after mute")
+		}
+	}
+}
+
+func Test_KarplusStrongInput(t *testing.T) {
+	s := core.NewSynth()
+	m := NewKarplusStrong(s)
+	core.EventInFloat(m, "attenuation", 1)
+	core.EventInFloat(m, "frequency", 200)
+	// no excitation, no output
+	var in, out core.Buf
+	m.Process(&in, &out)
+	for i := range out {
+		if out[i] != 0 {
+			t.Fatalf("output without excitation")
+		}
+	}
+	// impulse excitation, the string rings
+	in[0] = 1
+	m.Process(&in, &out)
+	in[0] = 0
+	var x []float64
+	for i := 0; i < 100; i++ {
+		m.Process(&in, &out)
+		for _, v := range out {
+			x = append(x, float64(v))
+		}
+	}
+	p := period(x, core.AudioSampleFrequency/200)
+	if math.Abs(p-240) > 0.1 {
+		t.Errorf("period %f, expected 240", p)
+	}
+}
+
+//-----------------------------------------------------------------------------
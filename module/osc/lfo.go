@@ -3,12 +3,38 @@
 
 Low Frequency Oscillator
 
+The rate is set in Hz, or in tempo mode as a note division of the synth tempo
+(set by the sequencer bpm).
+
+The phase offset shifts the waveform. A sync resets the phase and restarts
+the fade-in delay. With a delay the output is zero for the delay time, then
+fades in over the delay time.
+
+The custom shape is a list of breakpoints (x = 0..1, y = -1..1) with linear
+interpolation between them. It wraps from the last point to the first.
+
+The sample and hold output can be slewed to smooth the steps.
+
+Optional output buffers follow the bipolar output in the Process() arguments:
+
+* inverted bipolar
+* unipolar (0..depth)
+* inverted unipolar
+
 */
 //-----------------------------------------------------------------------------
 
 package osc
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/deadsy/babi/core"
 	"github.com/deadsy/babi/utils/log"
 )
@@ -20,11 +46,19 @@ var lfoOscInfo = core.ModuleInfo{
 	In: []core.PortInfo{
 		{"rate", "rate (Hz)", core.PortTypeFloat, lfoOscRate},
 		{"depth", "depth (>= 0)", core.PortTypeFloat, lfoOscDepth},
-		{"shape", "wave shape (0..5)", core.PortTypeInt, lfoOscShape},
+		{"shape", "wave shape (0..6)", core.PortTypeInt, lfoOscShape},
 		{"sync", "reset the lfo phase", core.PortTypeBool, lfoOscSync},
+		{"tempo", "tempo mode, rate from the synth tempo and division", core.PortTypeBool, lfoOscTempo},
+		{"division", "note division (index into LfoDivisions)", core.PortTypeInt, lfoOscDivision},
+		{"phase", "phase offset (0..1)", core.PortTypeFloat, lfoOscPhase},
+		{"delay", "fade-in delay (secs)", core.PortTypeFloat, lfoOscDelay},
+		{"slew", "sample and hold slew time (secs)", core.PortTypeFloat, lfoOscSlew},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
+		{"inv", "inverted output", core.PortTypeAudio, nil},
+		{"uni", "unipolar output", core.PortTypeAudio, nil},
+		{"uni_inv", "inverted unipolar output", core.PortTypeAudio, nil},
 	},
 }
 
@@ -46,6 +80,7 @@ const (
 	LfoSquare                            // square
 	LfoSine                              // sine
 	LfoSampleAndHold                     // random sample and hold
+	LfoCustom                            // custom breakpoint shape
 )
 
 var lfoWaveShapeToString = map[LfoWaveShape]string{
@@ -55,18 +90,136 @@ var lfoWaveShapeToString = map[LfoWaveShape]string{
 	LfoSquare:        "sqr",
 	LfoSine:          "sin",
 	LfoSampleAndHold: "s&h",
+	LfoCustom:        "custom",
 }
 
 func (s LfoWaveShape) String() string {
 	return lfoWaveShapeToString[s]
 }
 
+//-----------------------------------------------------------------------------
+// Tempo Divisions
+
+// LfoDivision is a note division for the tempo mode.
+type LfoDivision struct {
+	Name  string  // note division name
+	Beats float32 // beats per lfo cycle
+}
+
+// LfoDivisions are the tempo mode note divisions (T is triplet, . is dotted).
+var LfoDivisions = []LfoDivision{
+	{"4/1", 16},
+	{"2/1", 8},
+	{"1/1", 4},
+	{"1/2.", 3},
+	{"1/2", 2},
+	{"1/2T", 4.0 / 3},
+	{"1/4.", 1.5},
+	{"1/4", 1},
+	{"1/4T", 2.0 / 3},
+	{"1/8.", 0.75},
+	{"1/8", 0.5},
+	{"1/8T", 1.0 / 3},
+	{"1/16", 0.25},
+	{"1/16T", 1.0 / 6},
+	{"1/32", 0.125},
+}
+
+// lfoDefaultDivision is a quarter note.
+const lfoDefaultDivision = 7
+
+//-----------------------------------------------------------------------------
+// Custom Shapes
+
+// LfoPoint is a breakpoint of a custom LFO shape.
+type LfoPoint struct {
+	X float32 // phase (0..1)
+	Y float32 // value (-1..1)
+}
+
+// ParseLfoShape parses a breakpoint list.
+// Each line has an x and y value. Lines starting with # are comments.
+func ParseLfoShape(buf []byte) ([]LfoPoint, error) {
+	var shape []LfoPoint
+	for i, l := range strings.Split(string(buf), "\n") {
+		f := strings.Fields(l)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: expected x and y values", i+1)
+		}
+		x, err := strconv.ParseFloat(f[0], 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		y, err := strconv.ParseFloat(f[1], 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if x < 0 || x > 1 {
+			return nil, fmt.Errorf("line %d: x value %g is not 0..1", i+1, x)
+		}
+		shape = append(shape, LfoPoint{float32(x), core.Clamp(float32(y), -1, 1)})
+	}
+	if len(shape) == 0 {
+		return nil, errors.New("no breakpoints")
+	}
+	return shape, nil
+}
+
+// LoadLfoShape returns a custom LFO shape from a breakpoint list file.
+func LoadLfoShape(path string) ([]LfoPoint, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	shape, err := ParseLfoShape(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return shape, nil
+}
+
+// lfoCustomSample returns the custom shape value at phase x (0..1).
+func lfoCustomSample(shape []LfoPoint, x float32) float32 {
+	n := len(shape)
+	if n == 0 {
+		return 0
+	}
+	// the first point after x
+	i := sort.Search(n, func(i int) bool { return shape[i].X > x })
+	p0 := shape[(i+n-1)%n]
+	p1 := shape[i%n]
+	x0, x1 := p0.X, p1.X
+	if i == 0 {
+		x0--
+	}
+	if i == n {
+		x1++
+	}
+	if x1 <= x0 {
+		return p1.Y
+	}
+	return p0.Y + (p1.Y-p0.Y)*(x-x0)/(x1-x0)
+}
+
 //-----------------------------------------------------------------------------
 
 type lfoOsc struct {
 	info      core.ModuleInfo // module info
 	shape     LfoWaveShape    // wave shape
+	custom    []LfoPoint      // custom shape breakpoints
 	depth     float32         // wave amplitude
+	rate      float32         // rate (Hz)
+	tempo     bool            // tempo mode
+	bpm       float32         // synth tempo for the tempo mode rate
+	division  int             // note division
+	phase     uint32          // phase offset
+	delay     int             // fade-in delay (samples)
+	age       int             // samples since the sync
+	slew      float32         // sample and hold slew coefficient
+	sh        float32         // slewed sample and hold value
 	x         uint32          // current x-value
 	xstep     uint32          // current x-step
 	randState uint32          // random state for s&h
@@ -76,11 +229,23 @@ type lfoOsc struct {
 func NewLFO(s *core.Synth) core.Module {
 	log.Info.Printf("")
 	m := &lfoOsc{
-		info: lfoOscInfo,
+		info:     lfoOscInfo,
+		division: lfoDefaultDivision,
+		slew:     1,
 	}
 	return s.Register(m)
 }
 
+// NewLFOCustom returns a low frequency oscillator module with a custom shape.
+func NewLFOCustom(s *core.Synth, shape []LfoPoint) core.Module {
+	m := NewLFO(s).(*lfoOsc)
+	m.custom = make([]LfoPoint, len(shape))
+	copy(m.custom, shape)
+	sort.SliceStable(m.custom, func(i, j int) bool { return m.custom[i].X < m.custom[j].X })
+	m.shape = LfoCustom
+	return m
+}
+
 // Child returns the child modules of this module.
 func (m *lfoOsc) Child() []core.Module {
 	return nil
@@ -90,6 +255,16 @@ func (m *lfoOsc) Child() []core.Module {
 func (m *lfoOsc) Stop() {
 }
 
+// update sets the phase step for the rate or tempo.
+func (m *lfoOsc) update() {
+	rate := m.rate
+	if m.tempo {
+		m.bpm = m.info.Synth.Tempo()
+		rate = m.bpm / (core.SecsPerMin * LfoDivisions[m.division].Beats)
+	}
+	m.xstep = uint32(rate * core.FrequencyScale)
+}
+
 //-----------------------------------------------------------------------------
 // Port Events
 
@@ -97,12 +272,13 @@ func lfoOscRate(cm core.Module, e *core.Event) {
 	m := cm.(*lfoOsc)
 	rate := core.ClampLo(e.GetEventFloat().Val, 0)
 	log.Info.Printf("set rate %f Hz", rate)
-	m.xstep = uint32(rate * core.FrequencyScale)
+	m.rate = rate
+	m.update()
 }
 
 func lfoOscShape(cm core.Module, e *core.Event) {
 	m := cm.(*lfoOsc)
-	shape := core.ClampInt(e.GetEventInt().Val, 0, 5)
+	shape := core.ClampInt(e.GetEventInt().Val, 0, int(LfoCustom))
 	log.Info.Printf("set wave shape %d", shape)
 	m.shape = LfoWaveShape(shape)
 }
@@ -119,50 +295,131 @@ func lfoOscSync(cm core.Module, e *core.Event) {
 	if e.GetEventBool().Val {
 		log.Info.Printf("lfo sync")
 		m.x = 0
+		m.age = 0
+	}
+}
+
+func lfoOscTempo(cm core.Module, e *core.Event) {
+	m := cm.(*lfoOsc)
+	m.tempo = e.GetEventBool().Val
+	log.Info.Printf("set tempo mode %t", m.tempo)
+	m.update()
+}
+
+func lfoOscDivision(cm core.Module, e *core.Event) {
+	m := cm.(*lfoOsc)
+	m.division = core.ClampInt(e.GetEventInt().Val, 0, len(LfoDivisions)-1)
+	log.Info.Printf("set division %s", LfoDivisions[m.division].Name)
+	m.update()
+}
+
+func lfoOscPhase(cm core.Module, e *core.Event) {
+	m := cm.(*lfoOsc)
+	phase := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set phase offset %f", phase)
+	m.phase = uint32(int64(phase * core.FullCycle))
+}
+
+func lfoOscDelay(cm core.Module, e *core.Event) {
+	m := cm.(*lfoOsc)
+	delay := core.Clamp(e.GetEventFloat().Val, 0, 30)
+	log.Info.Printf("set delay %f secs", delay)
+	m.delay = int(delay * core.AudioSampleFrequency)
+}
+
+func lfoOscSlew(cm core.Module, e *core.Event) {
+	m := cm.(*lfoOsc)
+	slew := core.Clamp(e.GetEventFloat().Val, 0, 10)
+	log.Info.Printf("set slew %f secs", slew)
+	m.slew = 1
+	if slew > 0 {
+		m.slew = float32(1 - math.Exp(-1/(float64(slew)*core.AudioSampleFrequency)))
 	}
 }
 
 //-----------------------------------------------------------------------------
 
 // Each waveform ranges from -1.0 to 1.0
-// Each waveform is 0 at m.x == 0
-func (m *lfoOsc) sample() float32 {
+// Each waveform is 0 at x == 0
+func (m *lfoOsc) sample(x uint32) float32 {
 	// calculate samples as q8.24
 	var sample int32
 	switch m.shape {
 	case LfoTriangle:
-		x := m.x + (1 << 30)
+		x += (1 << 30)
 		sample = int32(x >> 6)
 		sample ^= -int32(x >> 31)
 		sample &= (1 << 25) - 1
 		sample -= (1 << 24)
 	case LfoSawDown:
-		sample = -int32(m.x) >> 7
+		sample = -int32(x) >> 7
 	case LfoSawUp:
-		sample = int32(m.x) >> 7
+		sample = int32(x) >> 7
 	case LfoSquare:
-		sample = int32(m.x & (1 << 31))
+		sample = int32(x & (1 << 31))
 		sample = (sample >> 6) | (1 << 24)
 	case LfoSine:
-		x := m.x - (1 << 30)
-		return core.CosLookup(x)
+		return core.CosLookup(x - (1 << 30))
 	case LfoSampleAndHold:
-		if m.x < m.xstep {
+		if x < m.xstep {
 			// 0..253, cycle length = 128, 64 values with bit 7 = 1
 			m.randState = ((m.randState * 179) + 17) & 0xff
 		}
-		sample = int32(m.randState<<24) >> 7
+		y := float32(int32(m.randState<<24)>>7) / float32(1<<24)
+		m.sh += m.slew * (y - m.sh)
+		return m.sh
+	case LfoCustom:
+		return lfoCustomSample(m.custom, float32(x)*(1.0/core.FullCycle))
 	}
 	// convert q8.24 to float
 	return float32(sample) / float32(1<<24)
 }
 
+// fade returns the fade-in delay gain.
+func (m *lfoOsc) fade() float32 {
+	if m.delay == 0 {
+		return 1
+	}
+	if m.age < 2*m.delay {
+		m.age++
+	}
+	if m.age <= m.delay {
+		return 0
+	}
+	return float32(m.age-m.delay) / float32(m.delay)
+}
+
 // Process runs the module DSP.
 func (m *lfoOsc) Process(buf ...*core.Buf) bool {
+	// follow the synth tempo
+	if m.tempo && m.bpm != m.info.Synth.Tempo() {
+		m.update()
+	}
 	out := buf[0]
+	var inv, uni, uniInv *core.Buf
+	if len(buf) > 1 {
+		inv = buf[1]
+	}
+	if len(buf) > 2 {
+		uni = buf[2]
+	}
+	if len(buf) > 3 {
+		uniInv = buf[3]
+	}
 	for i := 0; i < len(out); i++ {
 		m.x += m.xstep
-		out[i] = m.depth * m.sample()
+		a := m.depth * m.fade()
+		s := m.sample(m.x + m.phase)
+		out[i] = a * s
+		if inv != nil {
+			inv[i] = -a * s
+		}
+		if uni != nil {
+			uni[i] = 0.5 * a * (1 + s)
+		}
+		if uniInv != nil {
+			uniInv[i] = 0.5 * a * (1 - s)
+		}
 	}
 	return true
 }
@@ -0,0 +1,168 @@
+//-----------------------------------------------------------------------------
+/*
+
+Low Frequency Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// 128 samples per cycle
+const lfoRate = core.AudioSampleFrequency / 128
+
+func Test_LfoTempo(t *testing.T) {
+	s := core.NewSynth()
+	m := NewLFO(s).(*lfoOsc)
+	core.EventInFloat(m, "rate", lfoRate)
+	rate := func(f float32) bool {
+		return math.Abs(float64(m.xstep)-float64(f*core.FrequencyScale)) < 2
+	}
+	s.SetTempo(90)
+	core.EventInBool(m, "tempo", true)
+	// 90 bpm quarter notes, 1.5 Hz
+	if !rate(1.5) {
+		t.Errorf("bad quarter note rate")
+	}
+	// follow a tempo change, 120 bpm quarter notes, 2 Hz
+	s.SetTempo(120)
+	var out core.Buf
+	m.Process(&out)
+	if !rate(2) {
+		t.Errorf("bad tempo change rate")
+	}
+	s.SetTempo(90)
+	core.EventInInt(m, "division", 5)
+	// 90 bpm half note triplets, 1.125 Hz
+	if !rate(1.125) {
+		t.Errorf("bad half note triplet rate")
+	}
+	core.EventInBool(m, "tempo", false)
+	if !rate(lfoRate) {
+		t.Errorf("bad rate")
+	}
+}
+
+func Test_LfoPhase(t *testing.T) {
+	s := core.NewSynth()
+	for _, shape := range []LfoWaveShape{LfoTriangle, LfoSawUp, LfoSquare, LfoSine} {
+		m0 := NewLFO(s)
+		core.EventInInt(m0, "shape", int(shape))
+		core.EventInFloat(m0, "depth", 1)
+		core.EventInFloat(m0, "rate", lfoRate)
+		x0 := render(m0, 1024)
+		m1 := NewLFO(s)
+		core.EventInInt(m1, "shape", int(shape))
+		core.EventInFloat(m1, "depth", 1)
+		core.EventInFloat(m1, "rate", lfoRate)
+		core.EventInFloat(m1, "phase", 0.25)
+		x1 := render(m1, 1024)
+		// a quarter cycle is 32 samples
+		for i := 0; i < 512; i++ {
+			if math.Abs(x1[i]-x0[i+32]) > 1e-6 {
+				t.Errorf("%s: sample %d is %f, expected %f", shape, i, x1[i], x0[i+32])
+				break
+			}
+		}
+	}
+}
+
+func Test_LfoDelay(t *testing.T) {
+	s := core.NewSynth()
+	m := NewLFO(s)
+	core.EventInInt(m, "shape", int(LfoSquare))
+	core.EventInFloat(m, "depth", 1)
+	core.EventInFloat(m, "rate", lfoRate)
+	core.EventInFloat(m, "delay", 0.01)
+	check := func() {
+		x := render(m, 1024)
+		// silent for 480 samples, then a fade in over 480 samples
+		if x[479] != 0 || math.Abs(x[719])-0.5 > 1e-3 || math.Abs(x[1000]) != 1 {
+			t.Errorf("bad delay %f %f %f", x[479], x[719], x[1000])
+		}
+	}
+	check()
+	// sync restarts the delay
+	core.EventInBool(m, "sync", true)
+	check()
+}
+
+func Test_LfoOutputs(t *testing.T) {
+	s := core.NewSynth()
+	m := NewLFO(s)
+	core.EventInInt(m, "shape", int(LfoTriangle))
+	core.EventInFloat(m, "depth", 2)
+	core.EventInFloat(m, "rate", lfoRate)
+	var out, inv, uni, uniInv core.Buf
+	m.Process(&out, &inv, &uni, &uniInv)
+	for i := range out {
+		if inv[i] != -out[i] || uni[i] < 0 || uni[i] > 2 || math.Abs(float64(uni[i]-(1+0.5*out[i]))) > 1e-6 || math.Abs(float64(uni[i]+uniInv[i]-2)) > 1e-6 {
+			t.Fatalf("bad outputs %f %f %f %f", out[i], inv[i], uni[i], uniInv[i])
+		}
+	}
+}
+
+func Test_LfoCustom(t *testing.T) {
+	shape, err := ParseLfoShape([]byte("# a triangle\n0.5 1\n\n0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := core.NewSynth()
+	m := NewLFOCustom(s, shape)
+	core.EventInFloat(m, "depth", 1)
+	core.EventInFloat(m, "rate", lfoRate)
+	x := render(m, 128)
+	// the output at phase 1/128 .. 1
+	for i, v := range []float64{0, 0.5, 1, 0.5, 0} {
+		k := 32*i - 1
+		if k < 0 {
+			k = 127
+		}
+		if math.Abs(x[k]-v) > 1e-3 {
+			t.Errorf("sample %d is %f, expected %f", k, x[k], v)
+		}
+	}
+	// errors
+	for _, s := range []string{"", "# nothing\n", "0.5\n", "1.5 0\n", "0 x\n"} {
+		if _, err := ParseLfoShape([]byte(s)); err == nil {
+			t.Errorf("expected an error for \"%s\"", s)
+		}
+	}
+}
+
+func Test_LfoSlew(t *testing.T) {
+	// maximum step between samples
+	step := func(x []float64) float64 {
+		var max float64
+		for i := 1; i < len(x); i++ {
+			max = math.Max(max, math.Abs(x[i]-x[i-1]))
+		}
+		return max
+	}
+	s := core.NewSynth()
+	m0 := NewLFO(s)
+	core.EventInInt(m0, "shape", int(LfoSampleAndHold))
+	core.EventInFloat(m0, "depth", 1)
+	core.EventInFloat(m0, "rate", lfoRate)
+	x0 := render(m0, 4096)
+	m1 := NewLFO(s)
+	core.EventInInt(m1, "shape", int(LfoSampleAndHold))
+	core.EventInFloat(m1, "depth", 1)
+	core.EventInFloat(m1, "rate", lfoRate)
+	core.EventInFloat(m1, "slew", 0.001)
+	x1 := render(m1, 4096)
+	if step(x0) < 0.1 || step(x1) > 0.1*step(x0) {
+		t.Errorf("bad slew, steps %f %f", step(x0), step(x1))
+	}
+}
+
+//-----------------------------------------------------------------------------
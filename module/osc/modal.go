@@ -0,0 +1,283 @@
+//-----------------------------------------------------------------------------
+/*
+
+Modal Resonator Module
+
+A modal resonator models a struck object as a bank of decaying resonant modes.
+Each mode is a two pole resonator. The mode tables give the frequency, decay
+time and gain of each mode relative to the fundamental.
+
+A gate strikes the resonator with a decaying noise burst from a noise module.
+The gate value sets the strike level. A zero gate damps the modes by the
+damping factor (0 lets them ring, 1 mutes them).
+
+Audio on the excitation input is added to the noise burst.
+
+See:
+https://ccrma.stanford.edu/~jos/pasp/Modal_Representation.html
+Fletcher, N. H., Rossing, T. D., "The Physics of Musical Instruments", 1998
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var modalOscInfo = core.ModuleInfo{
+	Name: "modalOsc",
+	In: []core.PortInfo{
+		{"gate", "strike level (0..1), 0 is damp", core.PortTypeFloat, modalPortGate},
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, modalPortFrequency},
+		{"decay", "fundamental decay time (secs)", core.PortTypeFloat, modalPortDecay},
+		{"damping", "damping on gate off (0..1)", core.PortTypeFloat, modalPortDamping},
+		{"burst", "noise burst length (secs)", core.PortTypeFloat, modalPortBurst},
+		{"in", "excitation input", core.PortTypeAudio, nil},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *modalOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+// Mode Tables
+
+// Mode is a resonant mode with frequency, decay time and gain relative to the fundamental.
+type Mode struct {
+	Freq  float32 // frequency ratio
+	Decay float32 // decay time ratio
+	Gain  float32 // gain
+}
+
+// ModalBar is a uniform bar with free ends (e.g. glockenspiel).
+var ModalBar = []Mode{
+	{1, 1, 1},
+	{2.756, 0.7, 0.6},
+	{5.404, 0.5, 0.4},
+	{8.933, 0.35, 0.3},
+	{13.345, 0.25, 0.2},
+	{18.638, 0.18, 0.15},
+}
+
+// ModalPlate is a square plate with supported edges.
+var ModalPlate = []Mode{
+	{1, 1, 1},
+	{2.5, 0.8, 1.4},
+	{4, 0.65, 0.6},
+	{5, 0.55, 1.1},
+	{6.5, 0.45, 0.9},
+	{8.5, 0.35, 0.7},
+	{9, 0.33, 0.3},
+	{10, 0.3, 0.5},
+	{12.5, 0.25, 0.4},
+}
+
+// ModalMembrane is an ideal circular membrane (e.g. a drum head).
+var ModalMembrane = []Mode{
+	{1, 1, 1},
+	{1.594, 0.8, 0.8},
+	{2.136, 0.65, 0.65},
+	{2.296, 0.6, 0.5},
+	{2.653, 0.5, 0.45},
+	{2.918, 0.45, 0.35},
+	{3.156, 0.4, 0.3},
+	{3.501, 0.35, 0.25},
+	{3.600, 0.33, 0.2},
+	{3.652, 0.32, 0.2},
+}
+
+//-----------------------------------------------------------------------------
+// Noise Burst Excitation
+
+// t60 is the decay (log(1000)) for a 60dB drop.
+const t60 = 6.907755
+
+// noiseBurst is a linearly decaying noise burst.
+type noiseBurst struct {
+	noise  core.Module // noise source
+	length float32     // burst length (secs)
+	n      int         // samples remaining
+	total  int         // burst length (samples)
+	level  float32     // burst level
+}
+
+// start starts a noise burst.
+func (b *noiseBurst) start(level float32) {
+	b.total = core.Max(int(b.length*core.AudioSampleFrequency), 1)
+	b.n = b.total
+	// normalise the burst energy
+	b.level = level / float32(math.Sqrt(float64(b.total)))
+}
+
+// process writes the excitation (noise burst plus input) to a buffer.
+func (b *noiseBurst) process(x, in *core.Buf) {
+	if b.n > 0 {
+		b.noise.Process(x)
+		for i := range x {
+			x[i] *= b.level * float32(b.n) / float32(b.total)
+			if b.n > 0 {
+				b.n--
+			}
+		}
+	} else {
+		x.Zero()
+	}
+	if in != nil {
+		x.Add(in)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// modalResonator is a two pole resonator: H(z) = b/(1 - a1.z^-1 + a2.z^-2)
+type modalResonator struct {
+	b, a1, a2 float32 // coefficients
+	y1, y2    float32 // state
+}
+
+type modalOsc struct {
+	info    core.ModuleInfo  // module info
+	modes   []Mode           // mode table
+	res     []modalResonator // mode resonators
+	burst   noiseBurst       // noise burst excitation
+	freq    float32          // fundamental frequency
+	decay   float32          // fundamental decay time
+	damping float32          // damping on gate off
+	damped  bool             // the modes are damped
+}
+
+// NewModal returns a modal resonator module for a mode table.
+func NewModal(s *core.Synth, modes []Mode) core.Module {
+	log.Info.Printf("")
+	m := &modalOsc{
+		info:  modalOscInfo,
+		modes: modes,
+		res:   make([]modalResonator, len(modes)),
+		burst: noiseBurst{
+			noise:  NewNoiseWhite(s),
+			length: 0.002,
+		},
+		decay: 1,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *modalOsc) Child() []core.Module {
+	return []core.Module{m.burst.noise}
+}
+
+// Stop performs any cleanup of a module.
+func (m *modalOsc) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// update sets the resonator coefficients for the frequency and decay.
+func (m *modalOsc) update() {
+	decay := float64(m.decay)
+	if m.damped {
+		decay *= math.Max(float64(1-m.damping), 1e-3)
+	}
+	for i := range m.res {
+		r := &m.res[i]
+		f := float64(m.freq * m.modes[i].Freq)
+		if f <= 0 || f >= 0.45*core.AudioSampleFrequency {
+			// the mode is off
+			r.b, r.a1, r.a2 = 0, 0, 0
+			r.y1, r.y2 = 0, 0
+			continue
+		}
+		w := 2 * math.Pi * f / core.AudioSampleFrequency
+		k := math.Exp(-t60 / (decay * float64(m.modes[i].Decay) * core.AudioSampleFrequency))
+		// unit impulse has the mode gain
+		r.b = float32(float64(m.modes[i].Gain) * math.Sin(w))
+		r.a1 = float32(2 * k * math.Cos(w))
+		r.a2 = float32(k * k)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func modalPortGate(cm core.Module, e *core.Event) {
+	m := cm.(*modalOsc)
+	gate := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("gate %f", gate)
+	m.damped = gate == 0
+	m.update()
+	if gate > 0 {
+		m.burst.start(gate)
+	}
+}
+
+func modalPortFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*modalOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.freq = frequency
+	m.update()
+}
+
+func modalPortDecay(cm core.Module, e *core.Event) {
+	m := cm.(*modalOsc)
+	decay := core.Clamp(e.GetEventFloat().Val, 0.01, 30)
+	log.Info.Printf("set decay %f secs", decay)
+	m.decay = decay
+	m.update()
+}
+
+func modalPortDamping(cm core.Module, e *core.Event) {
+	m := cm.(*modalOsc)
+	damping := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set damping %f", damping)
+	m.damping = damping
+	m.update()
+}
+
+func modalPortBurst(cm core.Module, e *core.Event) {
+	m := cm.(*modalOsc)
+	length := core.Clamp(e.GetEventFloat().Val, 0, 0.1)
+	log.Info.Printf("set burst length %f secs", length)
+	m.burst.length = length
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *modalOsc) Process(buf ...*core.Buf) bool {
+	in := buf[0]
+	out := buf[1]
+	var x core.Buf
+	m.burst.process(&x, in)
+	out.Zero()
+	for j := range m.res {
+		r := &m.res[j]
+		if r.b == 0 {
+			continue
+		}
+		y1, y2 := r.y1, r.y2
+		for i := range out {
+			y := r.b*x[i] + r.a1*y1 - r.a2*y2
+			y2 = y1
+			y1 = y
+			out[i] += y
+		}
+		r.y1, r.y2 = y1, y2
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
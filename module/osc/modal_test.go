@@ -0,0 +1,138 @@
+//-----------------------------------------------------------------------------
+/*
+
+Modal Resonator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// rms returns the root mean square of a signal.
+func rms(x []float64) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(x)))
+}
+
+// testPercussionPitch checks the mode frequencies of a percussion oscillator.
+func testPercussionPitch(t *testing.T, osc func(s *core.Synth, modes []Mode) core.Module, modes []Mode) {
+	s := core.NewSynth()
+	for _, freq := range []float32{55, 220, 880} {
+		m := osc(s, modes)
+		core.EventInFloat(m, "frequency", freq)
+		core.EventInFloat(m, "decay", 5)
+		core.EventInFloat(m, "gate", 1)
+		x := render(m, 16384)
+		for i := 0; i < 2; i++ {
+			f := float64(freq * modes[i].Freq)
+			if cents := partial(x, f); math.Abs(cents) > 1 {
+				t.Errorf("%f Hz mode %d is %f cents", freq, i, cents)
+			}
+		}
+	}
+}
+
+// testPercussionDecay checks the decay time of a single mode.
+func testPercussionDecay(t *testing.T, osc func(s *core.Synth, modes []Mode) core.Module) {
+	const decay = 0.5
+	const n = core.AudioSampleFrequency / 20
+	s := core.NewSynth()
+	m := osc(s, []Mode{{1, 1, 1}})
+	core.EventInFloat(m, "frequency", 400)
+	core.EventInFloat(m, "decay", decay)
+	core.EventInFloat(m, "gate", 1)
+	x := render(m, core.AudioSampleFrequency/2)
+	// 60dB decay in 0.5 secs, 24dB in 0.2 secs
+	db := 20 * math.Log10(rms(x[2*n:3*n])/rms(x[6*n:7*n]))
+	if math.Abs(db-24) > 0.5 {
+		t.Errorf("decay of %f dB, expected 24 dB", db)
+	}
+	// damped
+	core.EventInFloat(m, "damping", 1)
+	core.EventInFloat(m, "gate", 0)
+	render(m, n)
+	if level := rms(render(m, n)); level > 1e-6 {
+		t.Errorf("output %f after damping", level)
+	}
+}
+
+// testPercussionInput checks excitation by the audio input.
+func testPercussionInput(t *testing.T, osc func(s *core.Synth, modes []Mode) core.Module) {
+	s := core.NewSynth()
+	m := osc(s, ModalMembrane)
+	core.EventInFloat(m, "frequency", 200)
+	// no excitation, no output
+	var in, out core.Buf
+	m.Process(&in, &out)
+	for i := range out {
+		if out[i] != 0 {
+			t.Fatalf("output without excitation")
+		}
+	}
+	// impulse excitation, the modes ring
+	in[0] = 1
+	m.Process(&in, &out)
+	in[0] = 0
+	var x []float64
+	for i := 0; i < 100; i++ {
+		m.Process(&in, &out)
+		for _, v := range out {
+			x = append(x, float64(v))
+		}
+	}
+	if cents := partial(x, 200*1.594); math.Abs(cents) > 1 {
+		t.Errorf("input excited mode is %f cents", cents)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ModalPitch(t *testing.T) {
+	testPercussionPitch(t, NewModal, ModalBar)
+	testPercussionPitch(t, NewModal, ModalPlate)
+}
+
+func Test_ModalDecay(t *testing.T) {
+	testPercussionDecay(t, NewModal)
+}
+
+func Test_ModalInput(t *testing.T) {
+	testPercussionInput(t, NewModal)
+}
+
+func Test_ModalLevel(t *testing.T) {
+	s := core.NewSynth()
+	m0 := NewModal(s, ModalBar)
+	core.EventInFloat(m0, "frequency", 440)
+	core.EventInFloat(m0, "gate", 1)
+	x0 := render(m0, 4800)
+	m1 := NewModal(s, ModalBar)
+	core.EventInFloat(m1, "frequency", 440)
+	core.EventInFloat(m1, "gate", 0.5)
+	x1 := render(m1, 4800)
+	if r := rms(x1) / rms(x0); r < 0.4 || r > 0.6 {
+		t.Errorf("half strike level ratio %f", r)
+	}
+	// modes above nyquist are off
+	m2 := NewModal(s, ModalBar)
+	core.EventInFloat(m2, "frequency", 5000)
+	core.EventInFloat(m2, "gate", 1)
+	x := render(m2, 4800)
+	if level := rms(x); level == 0 || math.IsNaN(level) {
+		t.Errorf("bad high note level %f", level)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -21,9 +21,11 @@ var sawOscInfo = core.ModuleInfo{
 	Name: "sawOsc",
 	In: []core.PortInfo{
 		{"frequency", "frequency (Hz)", core.PortTypeFloat, sawPortFrequency},
+		{"sync", "sync input", core.PortTypeAudio, nil},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
+		{"sync", "sync output", core.PortTypeAudio, nil},
 	},
 }
 
@@ -48,6 +50,7 @@ type sawOsc struct {
 	freq  float32         // base frequency
 	x     uint32          // phase position
 	xstep uint32          // phase step per sample
+	blep  blep            // step corrections
 }
 
 func newSawtooth(s *core.Synth, stype sawType) core.Module {
@@ -55,6 +58,9 @@ func newSawtooth(s *core.Synth, stype sawType) core.Module {
 		info:  sawOscInfo,
 		stype: stype,
 	}
+	if stype == sawTypeBLEP {
+		blepInit()
+	}
 	return s.Register(m)
 }
 
@@ -79,6 +85,11 @@ func (m *sawOsc) Child() []core.Module {
 func (m *sawOsc) Stop() {
 }
 
+// setPhase sets the oscillator phase.
+func (m *sawOsc) setPhase(x uint32) {
+	m.x = x
+}
+
 //-----------------------------------------------------------------------------
 // Port Events
 
@@ -92,26 +103,61 @@ func sawPortFrequency(cm core.Module, e *core.Event) {
 
 //-----------------------------------------------------------------------------
 
-func (m *sawOsc) generateBasic(out *core.Buf) {
+// naiveSaw returns the non bandwidth limited sawtooth value for a phase.
+func naiveSaw(x uint32) float32 {
+	return (2.0/float32(core.FullCycle))*float32(x) - 1.0
+}
+
+func (m *sawOsc) generateBasic(out, syncIn, syncOut *core.Buf) {
 	for i := 0; i < len(out); i++ {
-		out[i] = (2.0/float32(core.FullCycle))*float32(m.x) - 1.0
+		out[i] = naiveSaw(m.x)
 		// step the phase
-		m.x += m.xstep
+		setSync(syncOut, i, syncStep(&m.x, m.xstep, getSync(syncIn, i)))
 	}
 }
 
-func (m *sawOsc) generateBLEP(out *core.Buf) {
-	// TODO
+// wrap adds the step for a phase wrap in the phase span ending at x,
+// where x is d samples before the next sample. It returns the sync output value.
+func (m *sawOsc) wrap(x, span uint32, d float32) float32 {
+	if x < span {
+		// the phase wrapped: step down from 1 to -1
+		d += float32(x) / float32(m.xstep)
+		m.blep.add(-2, d)
+		return 1 - d
+	}
+	return 0
+}
+
+func (m *sawOsc) generateBLEP(out, syncIn, syncOut *core.Buf) {
+	for i := 0; i < len(out); i++ {
+		out[i] = naiveSaw(m.x) + m.blep.next()
+		// step the phase
+		var so float32
+		if s := getSync(syncIn, i); s > 0 {
+			// phase at the sync point
+			span := uint32(s * float32(m.xstep))
+			x := m.x + span
+			m.wrap(x, span, 1-s)
+			// reset the phase: step down to -1
+			m.blep.add(-1-naiveSaw(x), 1-s)
+			m.x = uint32((1 - s) * float32(m.xstep))
+			so = s
+		} else {
+			m.x += m.xstep
+			so = m.wrap(m.x, m.xstep, 0)
+		}
+		setSync(syncOut, i, so)
+	}
 }
 
 // Process runs the module DSP.
 func (m *sawOsc) Process(buf ...*core.Buf) bool {
-	out := buf[0]
+	syncIn, out, syncOut := syncBufs(buf, 0)
 	switch m.stype {
 	case sawTypeBasic:
-		m.generateBasic(out)
+		m.generateBasic(out, syncIn, syncOut)
 	case sawTypeBLEP:
-		m.generateBLEP(out)
+		m.generateBLEP(out, syncIn, syncOut)
 	default:
 		panic(fmt.Sprintf("bad sawtooth type %d", m.stype))
 	}
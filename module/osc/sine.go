@@ -19,9 +19,11 @@ var sineOscInfo = core.ModuleInfo{
 	Name: "sineOsc",
 	In: []core.PortInfo{
 		{"frequency", "frequency (Hz)", core.PortTypeFloat, sinePortFrequency},
+		{"sync", "sync input", core.PortTypeAudio, nil},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
+		{"sync", "sync output", core.PortTypeAudio, nil},
 	},
 }
 
@@ -57,6 +59,11 @@ func (m *sineOsc) Child() []core.Module {
 func (m *sineOsc) Stop() {
 }
 
+// setPhase sets the oscillator phase.
+func (m *sineOsc) setPhase(x uint32) {
+	m.x = x
+}
+
 //-----------------------------------------------------------------------------
 // Events
 
@@ -72,10 +79,10 @@ func sinePortFrequency(cm core.Module, e *core.Event) {
 
 // Process runs the module DSP.
 func (m *sineOsc) Process(buf ...*core.Buf) bool {
-	out := buf[0]
+	syncIn, out, syncOut := syncBufs(buf, 0)
 	for i := 0; i < len(out); i++ {
 		out[i] = core.CosLookup(m.x)
-		m.x += m.xstep
+		setSync(syncOut, i, syncStep(&m.x, m.xstep, getSync(syncIn, i)))
 	}
 	return true
 }
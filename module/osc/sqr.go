@@ -22,9 +22,11 @@ var sqrOscInfo = core.ModuleInfo{
 	In: []core.PortInfo{
 		{"frequency", "frequency (Hz)", core.PortTypeFloat, sqrPortFrequency},
 		{"duty", "duty cycle (0..1)", core.PortTypeFloat, sqrPortDuty},
+		{"sync", "sync input", core.PortTypeAudio, nil},
 	},
 	Out: []core.PortInfo{
 		{"out", "output", core.PortTypeAudio, nil},
+		{"sync", "sync output", core.PortTypeAudio, nil},
 	},
 }
 
@@ -50,12 +52,18 @@ type sqrOsc struct {
 	freq  float32         // base frequency
 	x     uint32          // phase position
 	xstep uint32          // phase step per sample
+	high  bool            // output state (BLEP)
+	blep  blep            // step corrections
 }
 
 func newSquare(s *core.Synth, stype sqrType) core.Module {
 	m := &sqrOsc{
 		info:  sqrOscInfo,
 		stype: stype,
+		high:  true,
+	}
+	if stype == sqrTypeBLEP {
+		blepInit()
 	}
 	return s.Register(m)
 }
@@ -81,6 +89,12 @@ func (m *sqrOsc) Child() []core.Module {
 func (m *sqrOsc) Stop() {
 }
 
+// setPhase sets the oscillator phase.
+func (m *sqrOsc) setPhase(x uint32) {
+	m.x = x
+	m.high = x < m.tp
+}
+
 //-----------------------------------------------------------------------------
 // Port Events
 
@@ -101,7 +115,7 @@ func sqrPortDuty(cm core.Module, e *core.Event) {
 
 //-----------------------------------------------------------------------------
 
-func (m *sqrOsc) generateBasic(out *core.Buf) {
+func (m *sqrOsc) generateBasic(out, syncIn, syncOut *core.Buf) {
 	for i := 0; i < len(out); i++ {
 		// what portion of the cycle are we in?
 		if m.x < m.tp {
@@ -110,22 +124,77 @@ func (m *sqrOsc) generateBasic(out *core.Buf) {
 			out[i] = -1
 		}
 		// step the phase
-		m.x += m.xstep
+		setSync(syncOut, i, syncStep(&m.x, m.xstep, getSync(syncIn, i)))
+	}
+}
+
+// edges adds the steps for the phase span ending at x,
+// where x is d samples before the next sample. It returns the sync output value.
+func (m *sqrOsc) edges(x, span uint32, d float32) float32 {
+	var so float32
+	if x < span {
+		// the phase wrapped: step up from -1 to 1
+		dx := d + float32(x)/float32(m.xstep)
+		if !m.high {
+			m.blep.add(2, dx)
+			m.high = true
+		}
+		so = 1 - dx
+	}
+	if m.high && x >= m.tp {
+		// step down from 1 to -1
+		// the step is at x if a duty cycle change moved the transition point behind the phase
+		dx := d
+		if x-m.tp < span {
+			dx += float32(x-m.tp) / float32(m.xstep)
+		}
+		m.blep.add(-2, dx)
+		m.high = false
 	}
+	return so
 }
 
-func (m *sqrOsc) generateBLEP(out *core.Buf) {
-	// TODO
+// generateBLEP generates a bandwidth limited square wave.
+// The output state only changes at the transition point, when the phase wraps
+// and on a sync reset, so a duty cycle change takes effect without adding extra steps.
+func (m *sqrOsc) generateBLEP(out, syncIn, syncOut *core.Buf) {
+	for i := 0; i < len(out); i++ {
+		if m.high {
+			out[i] = 1
+		} else {
+			out[i] = -1
+		}
+		out[i] += m.blep.next()
+		// step the phase
+		var so float32
+		if s := getSync(syncIn, i); s > 0 {
+			// phase at the sync point
+			span := uint32(s * float32(m.xstep))
+			m.edges(m.x+span, span, 1-s)
+			// reset the phase: step up to 1
+			if !m.high {
+				m.blep.add(2, 1-s)
+				m.high = true
+			}
+			m.x = uint32((1 - s) * float32(m.xstep))
+			m.edges(m.x, m.x, 0)
+			so = s
+		} else {
+			m.x += m.xstep
+			so = m.edges(m.x, m.xstep, 0)
+		}
+		setSync(syncOut, i, so)
+	}
 }
 
 // Process runs the module DSP.
 func (m *sqrOsc) Process(buf ...*core.Buf) bool {
-	out := buf[0]
+	syncIn, out, syncOut := syncBufs(buf, 0)
 	switch m.stype {
 	case sqrTypeBasic:
-		m.generateBasic(out)
+		m.generateBasic(out, syncIn, syncOut)
 	case sqrTypeBLEP:
-		m.generateBLEP(out)
+		m.generateBLEP(out, syncIn, syncOut)
 	default:
 		panic(fmt.Sprintf("bad square type %d", m.stype))
 	}
@@ -0,0 +1,66 @@
+//-----------------------------------------------------------------------------
+/*
+
+Oscillator Hard Sync
+
+The phase accumulator oscillators have a sync input and an optional sync output.
+The Process() buffers are in port order: sync input, output, sync output.
+A nil sync input buffer is no sync.
+
+A sync sample is 0 for no sync. A non-zero value s (0..1] marks the start of a
+cycle at time s between this sample and the next sample. The sync output of a
+master oscillator is connected to the sync input of a slave oscillator, and the
+slave resets its phase at the start of each master cycle.
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import "github.com/deadsy/babi/core"
+
+//-----------------------------------------------------------------------------
+
+// syncBufs returns the sync input, output and sync output buffers starting at buf[i].
+// The sync input and sync output buffers may be nil.
+func syncBufs(buf []*core.Buf, i int) (*core.Buf, *core.Buf, *core.Buf) {
+	var sync *core.Buf
+	if len(buf) > i+2 {
+		sync = buf[i+2]
+	}
+	return buf[i], buf[i+1], sync
+}
+
+// getSync returns the sync input value for sample i.
+func getSync(in *core.Buf, i int) float32 {
+	if in == nil {
+		return 0
+	}
+	return core.Clamp(in[i], 0, 1)
+}
+
+// setSync sets the sync output value for sample i.
+func setSync(out *core.Buf, i int, s float32) {
+	if out != nil {
+		out[i] = s
+	}
+}
+
+// syncStep steps the phase to the next sample.
+// The phase is reset if the sync input value is non-zero.
+// It returns the sync output value.
+func syncStep(x *uint32, xstep uint32, s float32) float32 {
+	if s > 0 {
+		*x = uint32((1 - s) * float32(xstep))
+		return s
+	}
+	x0 := *x
+	*x += xstep
+	if *x < x0 {
+		// the phase wrapped
+		return 1 - float32(*x)/float32(xstep)
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
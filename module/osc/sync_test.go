@@ -0,0 +1,105 @@
+//-----------------------------------------------------------------------------
+/*
+
+Oscillator Hard Sync Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// renderSync returns the output of a slave oscillator synced to a master oscillator.
+func renderSync(master, slave core.Module, n int) []float64 {
+	var x []float64
+	for len(x) < n {
+		var mout, msync, sout, ssync core.Buf
+		master.Process(nil, &mout, &msync)
+		slave.Process(&msync, &sout, &ssync)
+		for _, v := range sout {
+			x = append(x, float64(v))
+		}
+	}
+	return x[:n]
+}
+
+func Test_SyncOut(t *testing.T) {
+	s := core.NewSynth()
+	for _, m := range []core.Module{NewSine(s), NewSawtoothBasic(s), NewSawtoothBLEP(s), NewSquareBasic(s), NewSquareBLEP(s), NewGoom(s)} {
+		core.EventInFloat(m, "frequency", 1000)
+		n := 0
+		for i := 0; i < core.AudioSampleFrequency/core.AudioBufferSize; i++ {
+			var out, sync core.Buf
+			m.Process(nil, &out, &sync)
+			for _, x := range sync {
+				if x < 0 || x > 1 {
+					t.Fatalf("%s: bad sync value %f", m.Info().Name, x)
+				}
+				if x != 0 {
+					n++
+				}
+			}
+		}
+		// 1000 Hz for 1 second
+		if n < 999 || n > 1000 {
+			t.Errorf("%s: %d sync outputs, expected 1000", m.Info().Name, n)
+		}
+	}
+}
+
+func Test_SyncReset(t *testing.T) {
+	s := core.NewSynth()
+	master := NewSawtoothBasic(s)
+	core.EventInFloat(master, "frequency", 220)
+	for _, slave := range []core.Module{NewSine(s), NewSawtoothBasic(s), NewSawtoothBLEP(s), NewSquareBasic(s), NewSquareBLEP(s), NewGoom(s)} {
+		core.EventInFloat(slave, "frequency", 567)
+		for i := 0; i < 100; i++ {
+			var mout, msync, sout, ssync core.Buf
+			master.Process(nil, &mout, &msync)
+			slave.Process(&msync, &sout, &ssync)
+			// the slave starts a cycle at the start of each master cycle
+			for j := range msync {
+				if msync[j] != 0 && ssync[j] != msync[j] {
+					t.Fatalf("%s: sync output %f, expected %f", slave.Info().Name, ssync[j], msync[j])
+				}
+			}
+		}
+	}
+}
+
+func Test_SyncBLEP(t *testing.T) {
+	s := core.NewSynth()
+	for _, freq := range []float32{440, 1234.5} {
+		for _, duty := range []float32{0, 0.5} {
+			m0, m1 := NewSawtoothBasic(s), NewSawtoothBasic(s)
+			core.EventInFloat(m0, "frequency", freq)
+			core.EventInFloat(m1, "frequency", freq)
+			for _, slave := range [][2]core.Module{
+				{NewSawtoothBasic(s), NewSawtoothBLEP(s)},
+				{NewSquareBasic(s), NewSquareBLEP(s)},
+			} {
+				for _, m := range slave {
+					core.EventInFloat(m, "frequency", freq*2.37)
+					core.EventInFloat(m, "duty", duty)
+				}
+				a0 := aliasRatio(renderSync(m0, slave[0], fftSize), freq)
+				a1 := aliasRatio(renderSync(m1, slave[1], fftSize), freq)
+				name := slave[1].Info().Name
+				t.Logf("%s %.1f Hz: basic %.1f dB, blep %.1f dB", name, freq, 10*math.Log10(a0), 10*math.Log10(a1))
+				if a1*10 > a0 {
+					t.Errorf("%s %.1f Hz: aliasing is not reduced by 10 dB (basic %g, blep %g)", name, freq, a0, a1)
+				}
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,242 @@
+//-----------------------------------------------------------------------------
+/*
+
+Unison (Supersaw) Oscillator Module
+
+N detuned oscillators are mixed and spread across the left/right outputs.
+The detune and mix curves are from the Roland JP-8000 supersaw.
+
+See:
+https://www.adamszabo.com/internet/adam_szabo_how_to_emulate_the_super_saw.pdf
+
+The oscillators are created with an oscillator function, so any oscillator
+shape can be used. The phase accumulator oscillators start with random phases.
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var unisonOscInfo = core.ModuleInfo{
+	Name: "unisonOsc",
+	In: []core.PortInfo{
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, unisonPortFrequency},
+		{"detune", "detune amount (0..1)", core.PortTypeFloat, unisonPortDetune},
+		{"mix", "side oscillator mix (0..1)", core.PortTypeFloat, unisonPortMix},
+		{"width", "stereo width (0..1)", core.PortTypeFloat, unisonPortWidth},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *unisonOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// phaseOsc is an oscillator with a settable phase.
+type phaseOsc interface {
+	setPhase(x uint32)
+}
+
+// unisonRand is shared so each unison module starts with different phases.
+var unisonRand = core.NewRand32(0)
+
+// supersawOffset is the relative frequency offset of the 7 supersaw oscillators.
+var supersawOffset = []float32{
+	-0.11002313, -0.06288439, -0.01952356, 0, 0.01991221, 0.06216538, 0.10745242,
+}
+
+// unisonOffset returns the frequency offset for oscillator i of n.
+// The supersaw offsets are interpolated for n != 7.
+func unisonOffset(i, n int) float32 {
+	if n == 1 {
+		return 0
+	}
+	x := float32(i) * float32(len(supersawOffset)-1) / float32(n-1)
+	j := core.Min(int(x), len(supersawOffset)-2)
+	k := x - float32(j)
+	return supersawOffset[j] + k*(supersawOffset[j+1]-supersawOffset[j])
+}
+
+// detuneCurve maps the detune control (0..1) to the supersaw detune amount (0..1).
+func detuneCurve(x float32) float32 {
+	k := []float64{
+		10028.7312891634, -50818.8652045924, 111363.4808729368, -138150.6761080548,
+		106649.6679158292, -53046.9642751875, 17019.9518580080, -3425.0836591318,
+		404.2703938388, -24.1878824391, 0.6717417634, 0.0030115596,
+	}
+	var y float64
+	for _, c := range k {
+		y = y*float64(x) + c
+	}
+	return float32(y)
+}
+
+// centerGain returns the gain of the center oscillator for the mix control (0..1).
+func centerGain(x float32) float32 {
+	return -0.55366*x + 0.99785
+}
+
+// sideGain returns the gain of the side oscillators for the mix control (0..1).
+func sideGain(x float32) float32 {
+	return -0.73764*x*x + 1.2841*x + 0.044372
+}
+
+//-----------------------------------------------------------------------------
+
+type unisonOsc struct {
+	info   core.ModuleInfo // module info
+	osc    []core.Module   // oscillators
+	obuf   []*core.Buf     // oscillator buffers (unused audio inputs are nil)
+	freq   float32         // base frequency
+	detune float32         // detune control
+	mix    float32         // mix control
+	width  float32         // stereo width
+	volL   []float32       // left channel volume per oscillator
+	volR   []float32       // right channel volume per oscillator
+}
+
+// NewUnison returns an oscillator module with n detuned copies of an oscillator.
+func NewUnison(s *core.Synth, osc func(s *core.Synth) core.Module, n int) core.Module {
+	log.Info.Printf("")
+	n = core.ClampInt(n, 1, 16)
+	m := &unisonOsc{
+		info:   unisonOscInfo,
+		osc:    make([]core.Module, n),
+		detune: 0.5,
+		mix:    0.5,
+		width:  0.5,
+		volL:   make([]float32, n),
+		volR:   make([]float32, n),
+	}
+	for i := range m.osc {
+		m.osc[i] = osc(s)
+		if p, ok := m.osc[i].(phaseOsc); ok {
+			p.setPhase(unisonRand.Uint32())
+		}
+	}
+	m.obuf = make([]*core.Buf, core.NumAudioIn(m.osc[0])+1)
+	m.setMix()
+	return s.Register(m)
+}
+
+// NewSupersaw returns a JP-8000 style supersaw oscillator module.
+func NewSupersaw(s *core.Synth) core.Module {
+	return NewUnison(s, NewSawtoothBLEP, len(supersawOffset))
+}
+
+// Child returns the child modules of this module.
+func (m *unisonOsc) Child() []core.Module {
+	return m.osc
+}
+
+// Stop performs any cleanup of a module.
+func (m *unisonOsc) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+// setFrequency sets the oscillator frequencies.
+func (m *unisonOsc) setFrequency() {
+	d := detuneCurve(m.detune)
+	for i, osc := range m.osc {
+		f := m.freq * (1 + d*unisonOffset(i, len(m.osc)))
+		core.EventInFloat(osc, "frequency", f)
+	}
+}
+
+// setMix sets the left/right oscillator volumes.
+func (m *unisonOsc) setMix() {
+	n := len(m.osc)
+	vol := make([]float32, n)
+	var power float32
+	for i := range vol {
+		if n&1 == 1 && i == n/2 {
+			vol[i] = centerGain(m.mix)
+		} else {
+			vol[i] = sideGain(m.mix)
+		}
+		power += vol[i] * vol[i]
+	}
+	// normalise the power of the (uncorrelated) oscillators
+	k := float32(1 / math.Sqrt(float64(power)))
+	for i := range vol {
+		// pan 0 == left, 1 == right
+		pan := float32(0.5)
+		if n > 1 {
+			pan += m.width * (float32(i)/float32(n-1) - 0.5)
+		}
+		// Use sin/cos so that l*l + r*r = K (constant power)
+		m.volL[i] = k * vol[i] * core.Cos(pan*0.5*core.Pi)
+		m.volR[i] = k * vol[i] * core.Sin(pan*0.5*core.Pi)
+	}
+}
+
+func unisonPortFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*unisonOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.freq = frequency
+	m.setFrequency()
+}
+
+func unisonPortDetune(cm core.Module, e *core.Event) {
+	m := cm.(*unisonOsc)
+	detune := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set detune %f", detune)
+	m.detune = detune
+	m.setFrequency()
+}
+
+func unisonPortMix(cm core.Module, e *core.Event) {
+	m := cm.(*unisonOsc)
+	mix := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set mix %f", mix)
+	m.mix = mix
+	m.setMix()
+}
+
+func unisonPortWidth(cm core.Module, e *core.Event) {
+	m := cm.(*unisonOsc)
+	width := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set width %f", width)
+	m.width = width
+	m.setMix()
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *unisonOsc) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	out0.Zero()
+	out1.Zero()
+	var x core.Buf
+	m.obuf[len(m.obuf)-1] = &x
+	for i, osc := range m.osc {
+		osc.Process(m.obuf...)
+		for j := range x {
+			out0[j] += m.volL[i] * x[j]
+			out1[j] += m.volR[i] * x[j]
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,108 @@
+//-----------------------------------------------------------------------------
+/*
+
+Unison Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_UnisonCurves(t *testing.T) {
+	for i, x := range supersawOffset {
+		if unisonOffset(i, len(supersawOffset)) != x {
+			t.Errorf("oscillator %d: offset %f, expected %f", i, unisonOffset(i, len(supersawOffset)), x)
+		}
+	}
+	if unisonOffset(0, 1) != 0 {
+		t.Errorf("single oscillator is detuned")
+	}
+	if unisonOffset(0, 3) != supersawOffset[0] || unisonOffset(1, 3) != 0 || unisonOffset(2, 3) != supersawOffset[6] {
+		t.Errorf("bad 3 oscillator offsets")
+	}
+	if math.Abs(float64(detuneCurve(0))-0.003) > 1e-3 || math.Abs(float64(detuneCurve(1))-1) > 1e-2 {
+		t.Errorf("bad detune curve %f..%f", detuneCurve(0), detuneCurve(1))
+	}
+	// the polynomial fit has small ripples
+	for x := float32(0); x < 1; x += 0.01 {
+		if detuneCurve(x+0.01) < detuneCurve(x)-1e-3 {
+			t.Errorf("detune curve is not monotonic at %f", x)
+		}
+	}
+}
+
+// renderStereo returns the left/right outputs of a module.
+func renderStereo(m core.Module, n int) ([]float64, []float64) {
+	var l, r []float64
+	for len(l) < n {
+		var out0, out1 core.Buf
+		m.Process(&out0, &out1)
+		for i := range out0 {
+			l = append(l, float64(out0[i]))
+			r = append(r, float64(out1[i]))
+		}
+	}
+	return l[:n], r[:n]
+}
+
+func Test_Supersaw(t *testing.T) {
+	s := core.NewSynth()
+	m0 := NewSupersaw(s)
+	m1 := NewSupersaw(s)
+	for _, m := range []core.Module{m0, m1} {
+		core.EventInFloat(m, "frequency", 220)
+		core.EventInFloat(m, "width", 0)
+	}
+	l0, r0 := renderStereo(m0, fftSize)
+	l1, _ := renderStereo(m1, fftSize)
+	var peak, diff float64
+	for i := range l0 {
+		if l0[i] != r0[i] {
+			t.Fatalf("sample %d: left/right differ with zero width", i)
+		}
+		peak = math.Max(peak, math.Abs(l0[i]))
+		diff = math.Max(diff, math.Abs(l0[i]-l1[i]))
+	}
+	if peak < 0.1 || peak > 2 {
+		t.Errorf("bad peak output %f", peak)
+	}
+	if diff == 0 {
+		t.Errorf("oscillators don't have random phases")
+	}
+	// full width
+	core.EventInFloat(m0, "width", 1)
+	l0, r0 = renderStereo(m0, fftSize)
+	var d float64
+	for i := range l0 {
+		d = math.Max(d, math.Abs(l0[i]-r0[i]))
+	}
+	if d < 0.1 {
+		t.Errorf("left/right are the same with full width")
+	}
+}
+
+func Test_UnisonDetune(t *testing.T) {
+	s := core.NewSynth()
+	m := NewUnison(s, NewSine, 3)
+	core.EventInFloat(m, "frequency", 1000)
+	core.EventInFloat(m, "detune", 1)
+	// the oscillators are at the detuned frequencies
+	for i, osc := range m.Child() {
+		f := osc.(*sineOsc).freq
+		x := 1000 * (1 + detuneCurve(1)*unisonOffset(i, 3))
+		if f != x {
+			t.Errorf("oscillator %d: frequency %f, expected %f", i, f, x)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,259 @@
+//-----------------------------------------------------------------------------
+/*
+
+Banded Waveguide Drum Module
+
+A banded waveguide models a struck object as a set of bands. Each band is a
+delay line loop with the period of a mode. A narrow bandpass filter in the
+loop selects the mode frequency. The loop gain sets the mode decay.
+
+The bands use the same mode tables as the modal resonator. A first order
+allpass in each loop tunes the fractional part of the period.
+
+A gate strikes the drum with a decaying noise burst from a noise module.
+The gate value sets the strike level. A zero gate damps the bands by the
+damping factor (0 lets them ring, 1 mutes them).
+
+The excitation input audio is mixed into the strike.
+
+See:
+Essl, G., Cook, P. R., "Banded Waveguides: Towards Physical Modeling of Bowed Bar Percussion Instruments", 1999
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var bwgOscInfo = core.ModuleInfo{
+	Name: "bwgOsc",
+	In: []core.PortInfo{
+		{"gate", "strike level (0..1), 0 is damp", core.PortTypeFloat, bwgPortGate},
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, bwgPortFrequency},
+		{"decay", "fundamental decay time (secs)", core.PortTypeFloat, bwgPortDecay},
+		{"damping", "damping on gate off (0..1)", core.PortTypeFloat, bwgPortDamping},
+		{"burst", "noise burst length (secs)", core.PortTypeFloat, bwgPortBurst},
+		{"in", "excitation input", core.PortTypeAudio, nil},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *bwgOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+const bwgDelayBits = 12
+const bwgDelaySize = 1 << bwgDelayBits // delay line size (lowest frequency ~12 Hz)
+const bwgDelayMask = bwgDelaySize - 1
+
+const bwgQ = 30 // bandpass filter Q
+
+// bwgBand is a delay line loop with a bandpass filter.
+type bwgBand struct {
+	delay  [bwgDelaySize]float32 // delay line
+	n      int                   // delay line length (0 is off)
+	g      float32               // loop gain
+	b0     float32               // bandpass: H(z) = b0.(1 - z^-2)/(1 - a1.z^-1 + a2.z^-2)
+	a1, a2 float32               // bandpass coefficients
+	x1, x2 float32               // bandpass state
+	y1, y2 float32               // bandpass state
+	tc     float32               // tuning allpass coefficient
+	tune   ksAllpass             // tuning allpass
+	gain   float32               // output gain
+}
+
+type bwgOsc struct {
+	info    core.ModuleInfo // module info
+	modes   []Mode          // mode table
+	band    []bwgBand       // waveguide bands
+	burst   noiseBurst      // noise burst excitation
+	wr      int             // delay line write index
+	freq    float32         // fundamental frequency
+	decay   float32         // fundamental decay time
+	damping float32         // damping on gate off
+	damped  bool            // the bands are damped
+}
+
+// NewBandedWaveguide returns a banded waveguide drum module for a mode table.
+func NewBandedWaveguide(s *core.Synth, modes []Mode) core.Module {
+	log.Info.Printf("")
+	m := &bwgOsc{
+		info:  bwgOscInfo,
+		modes: modes,
+		band:  make([]bwgBand, len(modes)),
+		burst: noiseBurst{
+			noise:  NewNoiseWhite(s),
+			length: 0.002,
+		},
+		decay: 1,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *bwgOsc) Child() []core.Module {
+	return []core.Module{m.burst.noise}
+}
+
+// Stop performs any cleanup of a module.
+func (m *bwgOsc) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// update sets the band delays and filters for the frequency and decay.
+func (m *bwgOsc) update() {
+	decay := float64(m.decay)
+	if m.damped {
+		decay *= math.Max(float64(1-m.damping), 1e-3)
+	}
+	for i := range m.band {
+		b := &m.band[i]
+		f := float64(m.freq * m.modes[i].Freq)
+		// period (samples)
+		p := core.AudioSampleFrequency / f
+		if f <= 0 || p < 4 || p > bwgDelaySize-2 {
+			// the band is off
+			*b = bwgBand{}
+			continue
+		}
+		w := 2 * math.Pi / p
+		// pole radius for the decay time
+		t := decay * float64(m.modes[i].Decay)
+		r := math.Exp(-t60 / (t * core.AudioSampleFrequency))
+		// bandpass filter, it should ring for less time than the mode
+		k := math.Min(math.Exp(-math.Pi*f/(bwgQ*core.AudioSampleFrequency)), math.Pow(r, 4))
+		b0 := (1 - k*k) / 2
+		a1 := 2 * k * math.Cos(w)
+		a2 := k * k
+		bp := func(z complex128) complex128 {
+			return complex(b0, 0) * (1 - z*z) / (1 - complex(a1, 0)*z + complex(a2, 0)*z*z)
+		}
+		h := bp(cmplx.Rect(1, -w))
+		// the bandpass phase delay at the mode frequency
+		d := p + cmplx.Phase(h)/w
+		// keep the tuning allpass delay in 0.1..1.1 (c > -1)
+		n := int(d - 0.1)
+		eta := d - float64(n)
+		tc := math.Sin((1-eta)*w/2) / math.Sin((1+eta)*w/2)
+		b.n = n
+		b.tc = float32(tc)
+		b.b0 = float32(b0)
+		b.a1 = float32(a1)
+		b.a2 = float32(a2)
+		// The loop gain puts a pole at the decay radius. The loop phase is
+		// zero at the mode frequency on the unit circle, so search near it.
+		loop := func(theta float64) complex128 {
+			z := cmplx.Rect(1/r, -theta) // z^-1
+			return bp(z) * (complex(tc, 0) + z) / (1 + complex(tc, 0)*z) * cmplx.Pow(z, complex(float64(n), 0))
+		}
+		const dw = 1e-7
+		theta := w
+		for j := 0; j < 8; j++ {
+			phase := cmplx.Phase(loop(theta))
+			slope := cmplx.Phase(loop(theta+dw)/loop(theta-dw)) / (2 * dw)
+			theta -= phase / slope
+		}
+		g := 1 / cmplx.Abs(loop(theta))
+		b.g = float32(g)
+		// The output gain makes the impulse response amplitude the mode gain.
+		// Near the pole the band response is 1/(g.L'(z).(z - z0)).
+		dl := cmplx.Abs(loop(theta+dw)-loop(theta-dw)) / (2 * dw)
+		b.gain = float32(float64(m.modes[i].Gain) * g * dl / (2 * r))
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func bwgPortGate(cm core.Module, e *core.Event) {
+	m := cm.(*bwgOsc)
+	gate := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("gate %f", gate)
+	m.damped = gate == 0
+	m.update()
+	if gate > 0 {
+		m.burst.start(gate)
+	}
+}
+
+func bwgPortFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*bwgOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.freq = frequency
+	m.update()
+}
+
+func bwgPortDecay(cm core.Module, e *core.Event) {
+	m := cm.(*bwgOsc)
+	decay := core.Clamp(e.GetEventFloat().Val, 0.01, 30)
+	log.Info.Printf("set decay %f secs", decay)
+	m.decay = decay
+	m.update()
+}
+
+func bwgPortDamping(cm core.Module, e *core.Event) {
+	m := cm.(*bwgOsc)
+	damping := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set damping %f", damping)
+	m.damping = damping
+	m.update()
+}
+
+func bwgPortBurst(cm core.Module, e *core.Event) {
+	m := cm.(*bwgOsc)
+	length := core.Clamp(e.GetEventFloat().Val, 0, 0.1)
+	log.Info.Printf("set burst length %f secs", length)
+	m.burst.length = length
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *bwgOsc) Process(buf ...*core.Buf) bool {
+	in := buf[0]
+	out := buf[1]
+	var x core.Buf
+	m.burst.process(&x, in)
+	out.Zero()
+	for j := range m.band {
+		b := &m.band[j]
+		if b.n == 0 {
+			continue
+		}
+		wr := m.wr
+		for i := range out {
+			// bandpass the delay line output
+			v := b.delay[(wr-b.n)&bwgDelayMask]
+			y := b.b0*(v-b.x2) + b.a1*b.y1 - b.a2*b.y2
+			b.x2 = b.x1
+			b.x1 = v
+			b.y2 = b.y1
+			b.y1 = y
+			// tune and attenuate
+			y = b.g * b.tune.filter(y, b.tc)
+			b.delay[wr] = y + x[i]
+			wr = (wr + 1) & bwgDelayMask
+			out[i] += b.gain * y
+		}
+	}
+	m.wr = (m.wr + len(out)) & bwgDelayMask
+	return true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,30 @@
+//-----------------------------------------------------------------------------
+/*
+
+Banded Waveguide Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"testing"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_BandedWaveguidePitch(t *testing.T) {
+	testPercussionPitch(t, NewBandedWaveguide, ModalMembrane)
+	testPercussionPitch(t, NewBandedWaveguide, ModalBar)
+}
+
+func Test_BandedWaveguideDecay(t *testing.T) {
+	testPercussionDecay(t, NewBandedWaveguide)
+}
+
+func Test_BandedWaveguideInput(t *testing.T) {
+	testPercussionInput(t, NewBandedWaveguide)
+}
+
+//-----------------------------------------------------------------------------
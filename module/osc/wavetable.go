@@ -0,0 +1,287 @@
+//-----------------------------------------------------------------------------
+/*
+
+Wavetable Oscillator Module
+
+A wavetable is a set of single cycle frames. The position input morphs
+between adjacent frames with linear interpolation.
+
+Each frame is resampled to 2048 samples and stored as a set of bandwidth
+limited mipmaps (one per octave). The oscillator frequency selects the
+mipmap with the most harmonics that doesn't alias.
+
+Wavetables are loaded from WAV files. Serum style files (2048 sample frames)
+have multiple frames, any other file is a single frame.
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var wavetableOscInfo = core.ModuleInfo{
+	Name: "wavetableOsc",
+	In: []core.PortInfo{
+		{"frequency", "frequency (Hz)", core.PortTypeFloat, wavetablePortFrequency},
+		{"position", "frame position (0..1)", core.PortTypeFloat, wavetablePortPosition},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *wavetableOsc) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+const wtBits = 11
+const wtSize = 1 << wtBits // samples per mipmap
+const wtLevels = wtBits    // number of mipmaps (1024 to 1 harmonics)
+const wtFracBits = 32 - wtBits
+const wtFrameSize = 2048 // default frame size for multi-frame WAV files
+
+// wtHarmonics returns the maximum harmonic for a mipmap level.
+func wtHarmonics(level int) int {
+	if level == 0 {
+		// don't use the nyquist frequency
+		return wtSize/2 - 1
+	}
+	return (wtSize / 2) >> uint(level)
+}
+
+// Wavetable is a set of bandwidth limited single cycle frames.
+type Wavetable struct {
+	frame [][wtLevels][]float32 // mipmaps for each frame
+}
+
+// spectrum returns the frequency domain representation of a frame.
+func spectrum(x []float32) []complex128 {
+	in := make([]complex128, len(x))
+	for i := range x {
+		in[i] = complex(float64(x[i]), 0)
+	}
+	n := len(x)
+	if n >= 4 && n&(n-1) == 0 {
+		return core.FFT(in)
+	}
+	return core.DFT(in)
+}
+
+// mipmaps returns the mipmaps for a frame.
+func mipmaps(x []float32) [wtLevels][]float32 {
+	var mm [wtLevels][]float32
+	spec := spectrum(x)
+	// harmonics in the frame
+	nh := (len(x) - 1) / 2
+	// scale the amplitude for the resampling
+	k := complex(float64(wtSize)/float64(len(x)), 0)
+	for level := range mm {
+		h := core.Min(nh, wtHarmonics(level))
+		if level > 0 && h == core.Min(nh, wtHarmonics(level-1)) {
+			// same harmonics as the previous level
+			mm[level] = mm[level-1]
+			continue
+		}
+		// bandwidth limit (no dc)
+		y := make([]complex128, wtSize)
+		for i := 1; i <= h; i++ {
+			y[i] = spec[i] * k
+			y[wtSize-i] = cmplx.Conj(y[i])
+		}
+		y = core.InverseFFT(y)
+		// the extra sample is for interpolation
+		t := make([]float32, wtSize+1)
+		for i := 0; i < wtSize; i++ {
+			t[i] = float32(real(y[i]))
+		}
+		t[wtSize] = t[0]
+		mm[level] = t
+	}
+	return mm
+}
+
+// NewWavetable returns a wavetable for a set of single cycle frames.
+func NewWavetable(frames [][]float32) (*Wavetable, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("wavetable has no frames")
+	}
+	wt := &Wavetable{
+		frame: make([][wtLevels][]float32, len(frames)),
+	}
+	for i, x := range frames {
+		if len(x) < 2 {
+			return nil, fmt.Errorf("frame %d is too short", i)
+		}
+		wt.frame[i] = mipmaps(x)
+	}
+	return wt, nil
+}
+
+// frameSize returns the frame size from a Serum "clm " chunk (e.g. "<!>2048 ...").
+func frameSize(clm []byte) int {
+	s := string(clm)
+	if !strings.HasPrefix(s, "<!>") {
+		return 0
+	}
+	s = s[3:]
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i >= 0 {
+		s = s[:i]
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// ParseWavetable returns a wavetable from WAV file audio data.
+func ParseWavetable(w *core.Wave) (*Wavetable, error) {
+	x := w.Mono()
+	if len(x) < 2 {
+		return nil, errors.New("wavetable data is too short")
+	}
+	n := frameSize(w.Chunk["clm "])
+	if n <= 0 || n > len(x) {
+		n = len(x)
+		if n > wtFrameSize && n%wtFrameSize == 0 {
+			n = wtFrameSize
+		}
+	}
+	var frames [][]float32
+	for i := 0; i+n <= len(x); i += n {
+		frames = append(frames, x[i:i+n])
+	}
+	return NewWavetable(frames)
+}
+
+// LoadWavetable returns a wavetable from a WAV file.
+func LoadWavetable(path string) (*Wavetable, error) {
+	w, err := core.LoadWave(path)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := ParseWavetable(w)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return wt, nil
+}
+
+// Frames returns the number of frames in the wavetable.
+func (wt *Wavetable) Frames() int {
+	return len(wt.frame)
+}
+
+//-----------------------------------------------------------------------------
+
+type wavetableOsc struct {
+	info   core.ModuleInfo // module info
+	wt     *Wavetable      // wavetable
+	level  int             // mipmap level
+	pos    float32         // current frame position
+	target float32         // target frame position
+	freq   float32         // base frequency
+	x      uint32          // phase position
+	xstep  uint32          // phase step per sample
+}
+
+// NewWavetableOsc returns a wavetable oscillator module.
+func NewWavetableOsc(s *core.Synth, wt *Wavetable) core.Module {
+	log.Info.Printf("")
+	m := &wavetableOsc{
+		info: wavetableOscInfo,
+		wt:   wt,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *wavetableOsc) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *wavetableOsc) Stop() {
+}
+
+// setPhase sets the oscillator phase.
+func (m *wavetableOsc) setPhase(x uint32) {
+	m.x = x
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func (m *wavetableOsc) setFrequency(frequency float32) {
+	m.freq = frequency
+	m.xstep = uint32(frequency * core.FrequencyScale)
+	// use the mipmap with the most harmonics below the nyquist frequency
+	m.level = wtLevels - 1
+	for level := 0; level < wtLevels; level++ {
+		if float32(wtHarmonics(level))*frequency <= 0.5*core.AudioSampleFrequency {
+			m.level = level
+			break
+		}
+	}
+}
+
+func wavetablePortFrequency(cm core.Module, e *core.Event) {
+	m := cm.(*wavetableOsc)
+	frequency := core.ClampLo(e.GetEventFloat().Val, 0)
+	log.Info.Printf("set frequency %f Hz", frequency)
+	m.setFrequency(frequency)
+}
+
+func wavetablePortPosition(cm core.Module, e *core.Event) {
+	m := cm.(*wavetableOsc)
+	position := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set position %f", position)
+	m.target = position
+}
+
+//-----------------------------------------------------------------------------
+
+// lookup returns the interpolated mipmap value for the current phase.
+func (m *wavetableOsc) lookup(t []float32) float32 {
+	i := m.x >> wtFracBits
+	frac := float32(m.x&(1<<wtFracBits-1)) * (1.0 / (1 << wtFracBits))
+	return t[i] + frac*(t[i+1]-t[i])
+}
+
+// Process runs the module DSP.
+func (m *wavetableOsc) Process(buf ...*core.Buf) bool {
+	out := buf[0]
+	n := len(m.wt.frame) - 1
+	// ramp the position over the buffer
+	dpos := (m.target - m.pos) * (1.0 / float32(len(out)))
+	for i := 0; i < len(out); i++ {
+		m.pos += dpos
+		// frames either side of the position
+		p := core.Clamp(m.pos, 0, 1) * float32(n)
+		f0 := core.Min(int(p), n)
+		f1 := core.Min(f0+1, n)
+		k := p - float32(f0)
+		y0 := m.lookup(m.wt.frame[f0][m.level])
+		y1 := m.lookup(m.wt.frame[f1][m.level])
+		out[i] = y0 + k*(y1-y0)
+		// step the phase
+		m.x += m.xstep
+	}
+	m.pos = m.target
+	return true
+}
+
+//-----------------------------------------------------------------------------
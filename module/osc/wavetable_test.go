@@ -0,0 +1,158 @@
+//-----------------------------------------------------------------------------
+/*
+
+Wavetable Oscillator Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package osc
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// testFrames returns a sine frame and a (naive) sawtooth frame.
+func testFrames(n int) [][]float32 {
+	sine := make([]float32, n)
+	saw := make([]float32, n)
+	for i := 0; i < n; i++ {
+		sine[i] = float32(math.Sin(2 * math.Pi * float64(i) / float64(n)))
+		saw[i] = 2*float32(i)/float32(n) - 1
+	}
+	return [][]float32{sine, saw}
+}
+
+func Test_WavetableParse(t *testing.T) {
+	frames := testFrames(wtFrameSize)
+	data := append(append([]float32{}, frames[0]...), frames[1]...)
+	tests := []struct {
+		w      *core.Wave
+		frames int
+	}{
+		// serum wavetable
+		{&core.Wave{Rate: 48000, Data: [][]float32{data}, Chunk: map[string][]byte{"clm ": []byte("<!>2048 10000000 wavetable")}}, 2},
+		// 2048 sample frames, no clm chunk
+		{&core.Wave{Rate: 48000, Data: [][]float32{data}}, 2},
+		// single cycle
+		{&core.Wave{Rate: 44100, Data: [][]float32{testFrames(600)[1]}}, 1},
+		// 256 sample frames
+		{&core.Wave{Rate: 48000, Data: [][]float32{data}, Chunk: map[string][]byte{"clm ": []byte("<!>256")}}, 16},
+	}
+	for i, v := range tests {
+		w, err := core.ParseWave(core.EncodeWave(v.w))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wt, err := ParseWavetable(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wt.Frames() != v.frames {
+			t.Errorf("test %d: %d frames, expected %d", i, wt.Frames(), v.frames)
+		}
+	}
+	if _, err := NewWavetable(nil); err == nil {
+		t.Errorf("expected an error for no frames")
+	}
+	// empty data chunk
+	w, err := core.ParseWave(core.EncodeWave(&core.Wave{Rate: 48000, Data: [][]float32{{}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWavetable(w); err == nil {
+		t.Errorf("expected an error for an empty data chunk")
+	}
+}
+
+func Test_WavetableMipmaps(t *testing.T) {
+	wt, err := NewWavetable(testFrames(600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for level := 0; level < wtLevels; level++ {
+		// the resampled sine frame is unchanged
+		x := wt.frame[0][level]
+		for i := 0; i < wtSize; i++ {
+			y := math.Sin(2 * math.Pi * float64(i) / wtSize)
+			if math.Abs(float64(x[i])-y) > 1e-4 {
+				t.Fatalf("level %d: sample %d is %f, expected %f", level, i, x[i], y)
+			}
+		}
+		if x[wtSize] != x[0] {
+			t.Errorf("level %d: bad interpolation sample", level)
+		}
+		// each level of the sawtooth has the expected harmonics
+		spec := spectrum(wt.frame[1][level][:wtSize])
+		h := core.Min(wtHarmonics(level), 299)
+		for i := 1; i < wtSize/2; i++ {
+			a := cmplx.Abs(spec[i]) / cmplx.Abs(spec[1])
+			if i <= h && a < 1e-4 {
+				t.Fatalf("level %d: harmonic %d is missing", level, i)
+			}
+			if i > h && a > 1e-6 {
+				t.Fatalf("level %d: harmonic %d is present", level, i)
+			}
+		}
+	}
+}
+
+func Test_WavetableAliasing(t *testing.T) {
+	s := core.NewSynth()
+	wt, err := NewWavetable(testFrames(wtFrameSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, freq := range []float32{1234.5, 3456.7, 5678.9} {
+		basic := NewSawtoothBasic(s)
+		m := NewWavetableOsc(s, wt)
+		core.EventInFloat(basic, "frequency", freq)
+		core.EventInFloat(m, "frequency", freq)
+		core.EventInFloat(m, "position", 1)
+		render(m, core.AudioBufferSize)
+		a0 := aliasRatio(render(basic, fftSize), freq)
+		a1 := aliasRatio(render(m, fftSize), freq)
+		t.Logf("%.1f Hz: basic %.1f dB, wavetable %.1f dB", freq, 10*math.Log10(a0), 10*math.Log10(a1))
+		if a1*100 > a0 {
+			t.Errorf("%.1f Hz: aliasing is not reduced by 20 dB (basic %g, wavetable %g)", freq, a0, a1)
+		}
+	}
+}
+
+func Test_WavetablePosition(t *testing.T) {
+	s := core.NewSynth()
+	wt, err := NewWavetable(testFrames(wtFrameSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m [3]core.Module
+	for i := range m {
+		m[i] = NewWavetableOsc(s, wt)
+		core.EventInFloat(m[i], "frequency", 375)
+		core.EventInFloat(m[i], "position", float32(i)*0.5)
+		// the position ramps over the first buffer
+		render(m[i], core.AudioBufferSize)
+	}
+	y0 := render(m[0], fftSize)
+	y1 := render(m[1], fftSize)
+	y2 := render(m[2], fftSize)
+	for i := range y0 {
+		// position 0 is the sine frame
+		x := math.Sin(2 * math.Pi * float64(i+core.AudioBufferSize) * 375 / core.AudioSampleFrequency)
+		if math.Abs(y0[i]-x) > 1e-3 {
+			t.Fatalf("sample %d is %f, expected %f", i, y0[i], x)
+		}
+		// position 0.5 is half way between the frames
+		if math.Abs(y1[i]-0.5*(y0[i]+y2[i])) > 1e-5 {
+			t.Fatalf("sample %d is %f, expected %f", i, y1[i], 0.5*(y0[i]+y2[i]))
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -3,6 +3,9 @@
 
 Poly Patch
 
+An optional chain of MIDI modules (e.g. an arpeggiator) can process the MIDI
+input before the polyphony. Each chain module has a "midi" input and output.
+
 */
 //-----------------------------------------------------------------------------
 
@@ -36,14 +39,15 @@ func (m *polyPatch) Info() *core.ModuleInfo {
 //-----------------------------------------------------------------------------
 
 type polyPatch struct {
-	info core.ModuleInfo // module info
-	ch   uint8           // MIDI channel
-	poly core.Module     // polyphony
-	pan  core.Module     // pan left/right
+	info  core.ModuleInfo // module info
+	ch    uint8           // MIDI channel
+	poly  core.Module     // polyphony
+	pan   core.Module     // pan left/right
+	chain []core.Module   // MIDI processing modules
 }
 
 // NewPoly returns a polyPatch module.
-func NewPoly(s *core.Synth, ch uint8, sm func(s *core.Synth) core.Module) core.Module {
+func NewPoly(s *core.Synth, ch uint8, sm func(s *core.Synth) core.Module, chain ...core.Module) core.Module {
 	log.Info.Printf("")
 
 	const midiCtrl = 7
@@ -52,19 +56,28 @@ func NewPoly(s *core.Synth, ch uint8, sm func(s *core.Synth) core.Module) core.M
 	poly := midi.NewPoly(s, ch, sm, 16)
 	// pan the output to left/right channels
 	pan := mix.NewPan(s, ch, midiCtrl)
+	// connect the MIDI processing chain to the polyphony
+	for i := range chain {
+		dst := poly
+		if i < len(chain)-1 {
+			dst = chain[i+1]
+		}
+		core.Connect(chain[i], "midi", dst, "midi")
+	}
 
 	m := &polyPatch{
-		info: polyPatchInfo,
-		ch:   ch,
-		poly: poly,
-		pan:  pan,
+		info:  polyPatchInfo,
+		ch:    ch,
+		poly:  poly,
+		pan:   pan,
+		chain: chain,
 	}
 	return s.Register(m)
 }
 
 // Child returns the child modules of this module.
 func (m *polyPatch) Child() []core.Module {
-	return []core.Module{m.poly, m.pan}
+	return append([]core.Module{m.poly, m.pan}, m.chain...)
 }
 
 // Stop performs any cleanup of a module.
@@ -76,9 +89,15 @@ func (m *polyPatch) Stop() {
 
 func polyPatchMidiIn(cm core.Module, e *core.Event) {
 	m := cm.(*polyPatch)
+	if len(m.chain) != 0 {
+		// the chain gets all MIDI events (e.g. MIDI clock)
+		core.EventIn(m.chain[0], "midi", e)
+	}
 	me := e.GetEventMIDIChannel(m.ch)
 	if me != nil {
-		core.EventIn(m.poly, "midi", e)
+		if len(m.chain) == 0 {
+			core.EventIn(m.poly, "midi", e)
+		}
 		core.EventIn(m.pan, "midi", e)
 	}
 }
@@ -89,6 +108,10 @@ func polyPatchMidiIn(cm core.Module, e *core.Event) {
 func (m *polyPatch) Process(buf ...*core.Buf) bool {
 	out0 := buf[0]
 	out1 := buf[1]
+	// MIDI processing
+	for _, c := range m.chain {
+		c.Process()
+	}
 	// polyphony
 	var out core.Buf
 	m.poly.Process(&out)
@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+Split Patch
+
+Keyboard split/layer patch. A MIDI router sends notes to a set of polyphonic
+voices. Rule output N drives the voice sub-module N.
+
+*/
+//-----------------------------------------------------------------------------
+
+package patch
+
+import (
+	"fmt"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
+	"github.com/deadsy/babi/module/mix"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var splitPatchInfo = core.ModuleInfo{
+	Name: "splitPatch",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, splitPatchMidiIn},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the general module information.
+func (m *splitPatch) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type splitPatch struct {
+	info   core.ModuleInfo // module info
+	ch     uint8           // MIDI channel
+	router core.Module     // split/layer router
+	poly   []core.Module   // polyphony for each router output
+	pan    core.Module     // pan left/right
+}
+
+// NewSplit returns a splitPatch module.
+// The router output channels are set to ch, the channel of the poly modules.
+func NewSplit(s *core.Synth, ch uint8, rule []midi.RouteRule, sm []func(s *core.Synth) core.Module) core.Module {
+	log.Info.Printf("")
+
+	const midiCtrl = 7
+
+	// route all rules to the poly channel
+	rule = append([]midi.RouteRule(nil), rule...)
+	for i := range rule {
+		if !core.InEnum(rule[i].Out, len(sm)) {
+			panic(fmt.Sprintf("rule %d: no voice for output %d", i, rule[i].Out))
+		}
+		rule[i].OutCh = int(ch)
+	}
+	router := midi.NewRouter(s, rule)
+
+	// polyphony for each router output
+	poly := make([]core.Module, len(sm))
+	for i := range poly {
+		poly[i] = midi.NewPoly(s, ch, sm[i], 16)
+		if i < len(router.Info().Out) {
+			core.Connect(router, fmt.Sprintf("midi%d", i), poly[i], "midi")
+		}
+	}
+
+	// pan the output to left/right channels
+	pan := mix.NewPan(s, ch, midiCtrl)
+
+	m := &splitPatch{
+		info:   splitPatchInfo,
+		ch:     ch,
+		router: router,
+		poly:   poly,
+		pan:    pan,
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *splitPatch) Child() []core.Module {
+	return append([]core.Module{m.router, m.pan}, m.poly...)
+}
+
+// Stop performs any cleanup of a module.
+func (m *splitPatch) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func splitPatchMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*splitPatch)
+	core.EventIn(m.router, "midi", e)
+	if e.GetEventMIDIChannel(m.ch) != nil {
+		core.EventIn(m.pan, "midi", e)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *splitPatch) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	// polyphony (each poly module accumulates into the buffer)
+	var out core.Buf
+	for _, p := range m.poly {
+		p.Process(&out)
+	}
+	// pan left/right
+	m.pan.Process(&out, out0, out1)
+	return true
+}
+
+//-----------------------------------------------------------------------------
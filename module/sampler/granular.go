@@ -0,0 +1,289 @@
+//-----------------------------------------------------------------------------
+/*
+
+Granular Synthesis Module
+
+Plays short windowed grains of a sample, or of the live audio input.
+
+Grain onsets are randomly spaced about the mean spacing set by the density.
+The position sets where grains start in the sample (0..1). For live input
+it sets how far back in the input buffer grains start. Each grain has a
+random position and pitch offset within the jitter ranges, and a random
+stereo pan within the spread.
+
+The grain window is a Tukey window: shape 0 is rectangular, 1 is Hann.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var granularInfo = core.ModuleInfo{
+	Name: "granular",
+	In: []core.PortInfo{
+		{"in", "live input", core.PortTypeAudio, nil},
+		{"size", "grain size (secs)", core.PortTypeFloat, granularPortSize},
+		{"density", "grains per second", core.PortTypeFloat, granularPortDensity},
+		{"position", "grain position (0..1)", core.PortTypeFloat, granularPortPosition},
+		{"position_jitter", "grain position jitter (0..1)", core.PortTypeFloat, granularPortPositionJitter},
+		{"pitch", "grain pitch (semitones)", core.PortTypeFloat, granularPortPitch},
+		{"pitch_jitter", "grain pitch jitter (semitones)", core.PortTypeFloat, granularPortPitchJitter},
+		{"window", "grain window shape (0..1)", core.PortTypeFloat, granularPortWindow},
+		{"spread", "grain stereo spread (0..1)", core.PortTypeFloat, granularPortSpread},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *granular) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+const maxGrains = 64 // maximum number of concurrent grains
+
+const liveBits = 18
+const liveSize = 1 << liveBits // live input buffer (~5.5 secs)
+const liveMask = liveSize - 1
+
+// tukey returns the tukey window value at t (0..1).
+func tukey(t, alpha float32) float32 {
+	if alpha <= 0 {
+		return 1
+	}
+	if t > 0.5 {
+		t = 1 - t
+	}
+	if t < alpha/2 {
+		return 0.5 * (1 - core.Cos(2*core.Pi*t/alpha))
+	}
+	return 1
+}
+
+type grain struct {
+	pos  float64 // source position (samples)
+	step float64 // source step per output sample
+	age  int     // output samples since the grain started
+	n    int     // grain length (output samples)
+	volL float32 // left channel volume
+	volR float32 // right channel volume
+}
+
+type granular struct {
+	info        core.ModuleInfo // module info
+	rand        *core.Rand32    // grain randomisation
+	src         []float32       // source samples
+	live        bool            // the source is the live input buffer
+	rate        float64         // source sample rate / output sample rate
+	wr          int             // live buffer write index
+	grain       []grain         // active grains
+	next        int             // output samples until the next grain
+	size        float32         // grain size (secs)
+	density     float32         // grains per second
+	position    float32         // grain position (0..1)
+	posJitter   float32         // grain position jitter (0..1)
+	pitch       float32         // grain pitch (semitones)
+	pitchJitter float32         // grain pitch jitter (semitones)
+	window      float32         // window shape (0..1)
+	spread      float32         // stereo spread (0..1)
+}
+
+// NewGranular returns a granular synthesis module for a sample, or for the live input if the sample is nil.
+func NewGranular(s *core.Synth, smp *Sample) core.Module {
+	log.Info.Printf("")
+	m := &granular{
+		info:    granularInfo,
+		rand:    core.NewRand32(0),
+		grain:   make([]grain, 0, maxGrains),
+		size:    0.05,
+		density: 20,
+		window:  1,
+		spread:  0.5,
+	}
+	if smp != nil {
+		m.src = smp.Data
+		m.rate = float64(smp.Rate) / core.AudioSampleFrequency
+	} else {
+		m.src = make([]float32, liveSize)
+		m.live = true
+		m.rate = 1
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *granular) Child() []core.Module {
+	return nil
+}
+
+// Stop performs any cleanup of a module.
+func (m *granular) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func granularPortSize(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	size := core.Clamp(e.GetEventFloat().Val, 0.001, 1)
+	log.Info.Printf("set grain size %f secs", size)
+	m.size = size
+}
+
+func granularPortDensity(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	density := core.Clamp(e.GetEventFloat().Val, 0.1, 1000)
+	log.Info.Printf("set density %f grains/sec", density)
+	m.density = density
+}
+
+func granularPortPosition(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	position := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set position %f", position)
+	m.position = position
+}
+
+func granularPortPositionJitter(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	jitter := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set position jitter %f", jitter)
+	m.posJitter = jitter
+}
+
+func granularPortPitch(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	pitch := core.Clamp(e.GetEventFloat().Val, -48, 48)
+	log.Info.Printf("set pitch %f semitones", pitch)
+	m.pitch = pitch
+}
+
+func granularPortPitchJitter(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	jitter := core.Clamp(e.GetEventFloat().Val, 0, 24)
+	log.Info.Printf("set pitch jitter %f semitones", jitter)
+	m.pitchJitter = jitter
+}
+
+func granularPortWindow(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	window := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set window shape %f", window)
+	m.window = window
+}
+
+func granularPortSpread(cm core.Module, e *core.Event) {
+	m := cm.(*granular)
+	spread := core.Clamp(e.GetEventFloat().Val, 0, 1)
+	log.Info.Printf("set spread %f", spread)
+	m.spread = spread
+}
+
+//-----------------------------------------------------------------------------
+
+// start starts a new grain.
+func (m *granular) start() {
+	if len(m.grain) == maxGrains {
+		return
+	}
+	n := int(m.size * core.AudioSampleFrequency)
+	semitones := m.pitch + m.pitchJitter*m.rand.Float32()
+	step := m.rate * math.Pow(2, float64(semitones)/12)
+	position := float64(m.position + m.posJitter*m.rand.Float32())
+	var pos float64
+	if m.live {
+		// the grain must not overtake the write index
+		delay := math.Max(math.Abs(position)*liveSize, float64(n)*step+2)
+		if delay >= liveSize {
+			return
+		}
+		pos = float64(m.wr) - delay
+	} else {
+		// wrap the position
+		pos = (position - math.Floor(position)) * float64(len(m.src))
+	}
+	// constant power pan
+	pan := 0.5 + 0.5*m.spread*m.rand.Float32()
+	m.grain = append(m.grain, grain{
+		pos:  pos,
+		step: step,
+		n:    n,
+		volL: core.Cos(pan * core.Pi / 2),
+		volR: core.Sin(pan * core.Pi / 2),
+	})
+}
+
+// sample returns the interpolated source value at position x.
+func (m *granular) sample(x float64) float32 {
+	n := len(m.src)
+	i := int(math.Floor(x))
+	t := float32(x - float64(i))
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	j := i + 1
+	if j == n {
+		j = 0
+	}
+	return m.src[i] + t*(m.src[j]-m.src[i])
+}
+
+// Process runs the module DSP.
+func (m *granular) Process(buf ...*core.Buf) bool {
+	in := buf[0]
+	out0 := buf[1]
+	out1 := buf[2]
+	// normalise the overlapping grains
+	k := 1 / float32(math.Sqrt(math.Max(1, float64(m.size*m.density))))
+	period := core.AudioSampleFrequency / m.density
+	for i := range out0 {
+		if m.live && in != nil {
+			m.src[m.wr] = in[i]
+			m.wr = (m.wr + 1) & liveMask
+		}
+		// schedule grains
+		if m.next <= 0 {
+			m.start()
+			m.next = int(period * (1 + 0.5*m.rand.Float32()))
+		}
+		m.next--
+		// run the grains
+		var l, r float32
+		for j := range m.grain {
+			g := &m.grain[j]
+			x := tukey((float32(g.age)+0.5)/float32(g.n), m.window) * m.sample(g.pos)
+			l += g.volL * x
+			r += g.volR * x
+			g.pos += g.step
+			g.age++
+		}
+		out0[i] = k * l
+		out1[i] = k * r
+		// remove finished grains
+		j := 0
+		for _, g := range m.grain {
+			if g.age < g.n {
+				m.grain[j] = g
+				j++
+			}
+		}
+		m.grain = m.grain[:j]
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
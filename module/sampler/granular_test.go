@@ -0,0 +1,127 @@
+//-----------------------------------------------------------------------------
+/*
+
+Granular Synthesis Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Tukey(t *testing.T) {
+	tests := []struct {
+		t, alpha, y float32
+	}{
+		{0, 0, 1},
+		{0.5, 1, 1},
+		{0, 1, 0},
+		{0.25, 1, 0.5},
+		{0.75, 1, 0.5},
+		{0.125, 0.5, 0.5},
+		{0.3, 0.5, 1},
+	}
+	for _, v := range tests {
+		y := tukey(v.t, v.alpha)
+		if math.Abs(float64(y-v.y)) > 1e-3 {
+			t.Errorf("tukey(%f, %f) is %f, expected %f", v.t, v.alpha, y, v.y)
+		}
+	}
+}
+
+// renderGranular returns the stereo output of a granular module with an input.
+func renderGranular(m core.Module, in float32, n int) ([]float64, []float64) {
+	var l, r []float64
+	for len(l) < n {
+		var b, b0, b1 core.Buf
+		for i := range b {
+			b[i] = in
+		}
+		m.Process(&b, &b0, &b1)
+		for i := range b0 {
+			l = append(l, float64(b0[i]))
+			r = append(r, float64(b1[i]))
+		}
+	}
+	return l[:n], r[:n]
+}
+
+func Test_GranularPitch(t *testing.T) {
+	s := core.NewSynth()
+	smp := parseSample(t, sineWave(48000, 480, 48000, nil))
+	// a single rectangular grain, an octave up
+	m := NewGranular(s, smp)
+	core.EventInFloat(m, "size", 0.1)
+	core.EventInFloat(m, "density", 0.1)
+	core.EventInFloat(m, "window", 0)
+	core.EventInFloat(m, "spread", 0)
+	core.EventInFloat(m, "pitch", 12)
+	l, r := renderGranular(m, 0, core.AudioSampleFrequency/5)
+	if n := zeroCrossings(l[:4800]); n < 95 || n > 96 {
+		t.Errorf("%d cycles, expected 96", n)
+	}
+	for i := range l {
+		if math.Abs(l[i]-r[i]) > 1e-6 {
+			t.Fatalf("left and right are different")
+		}
+	}
+	if power(l[4800:]) != 0 {
+		t.Errorf("output after the grain")
+	}
+}
+
+func Test_GranularRepeat(t *testing.T) {
+	smp := parseSample(t, sineWave(48000, 480, 48000, nil))
+	run := func() ([]float64, []float64) {
+		s := core.NewSynth()
+		m := NewGranular(s, smp)
+		core.EventInFloat(m, "density", 200)
+		core.EventInFloat(m, "position_jitter", 0.5)
+		core.EventInFloat(m, "pitch_jitter", 3)
+		core.EventInFloat(m, "spread", 1)
+		return renderGranular(m, 0, core.AudioSampleFrequency)
+	}
+	l0, r0 := run()
+	l1, r1 := run()
+	for i := range l0 {
+		if l0[i] != l1[i] || r0[i] != r1[i] {
+			t.Fatalf("outputs are different")
+		}
+	}
+	// overlapping grains are normalised
+	if p := power(l0) + power(r0); p < 0.1 || p > 1 {
+		t.Errorf("output power %f", p)
+	}
+	// spread grains are in both channels, but not the same
+	if power(l0) == 0 || power(r0) == 0 || math.Abs(l0[10000]-r0[10000]) < 1e-6 {
+		t.Errorf("bad stereo spread")
+	}
+}
+
+func Test_GranularLive(t *testing.T) {
+	s := core.NewSynth()
+	m := NewGranular(s, nil)
+	core.EventInFloat(m, "density", 100)
+	core.EventInFloat(m, "window", 0)
+	core.EventInFloat(m, "spread", 0)
+	core.EventInFloat(m, "position", 0.1)
+	// the grains start 0.55 secs back in the input
+	l, _ := renderGranular(m, 1, core.AudioSampleFrequency/2)
+	if power(l) != 0 {
+		t.Errorf("output before the delay")
+	}
+	l, _ = renderGranular(m, 1, core.AudioSampleFrequency/2)
+	if power(l[core.AudioSampleFrequency/4:]) == 0 {
+		t.Errorf("no output after the delay")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,215 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sampler Instrument Module
+
+A polyphonic MIDI sampler for an instrument (E.g. loaded from an SFZ file).
+
+A note on plays every zone matching the note and velocity, each with its
+own voice. A note off releases these voices and plays any zones triggered
+by the note release. Voices are panned to stereo outputs.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var samplerInfo = core.ModuleInfo{
+	Name: "sampler",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, samplerMidiIn},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *sampler) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+type samplerSlot struct {
+	module core.Module // voice module
+	note   uint8       // MIDI note
+	held   bool        // waiting for a note off
+	volL   float32     // left channel volume
+	volR   float32     // right channel volume
+}
+
+type sampler struct {
+	info  core.ModuleInfo // module info
+	ch    uint8           // MIDI channel
+	inst  *Instrument     // sample zones
+	voice []samplerSlot   // voices
+	idx   int             // round-robin index for voice stealing
+	bend  float32         // pitch bending value (for all voices)
+	vel   [128]float32    // note on velocity (for release triggers)
+}
+
+// NewSampler returns a polyphonic MIDI sampler module for an instrument.
+func NewSampler(s *core.Synth, ch uint8, inst *Instrument, maxvoices uint) core.Module {
+	log.Info.Printf("")
+	m := &sampler{
+		info:  samplerInfo,
+		ch:    ch,
+		inst:  inst,
+		voice: make([]samplerSlot, maxvoices),
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *sampler) Child() []core.Module {
+	var children []core.Module
+	for i := range m.voice {
+		if m.voice[i].module != nil {
+			children = append(children, m.voice[i].module)
+		}
+	}
+	return children
+}
+
+// Stop performs any cleanup of a module.
+func (m *sampler) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Events
+
+// voiceAlloc returns a free voice, or steals one.
+func (m *sampler) voiceAlloc() *samplerSlot {
+	for i := range m.voice {
+		if m.voice[i].module == nil {
+			return &m.voice[i]
+		}
+	}
+	// round robin stealing
+	v := &m.voice[m.idx]
+	m.idx++
+	if m.idx == len(m.voice) {
+		m.idx = 0
+	}
+	v.module.Stop()
+	return v
+}
+
+// play starts a voice for a zone.
+func (m *sampler) play(z *Zone, note uint8, vel float32) {
+	log.Info.Printf("note %d", note)
+	v := m.voiceAlloc()
+	v.module = NewVoice(m.info.Synth, []*Zone{z})
+	v.note = note
+	v.held = !z.OnRelease
+	// velocity gain and constant power pan
+	k := 1 - z.VelTrack*(1-vel*vel)
+	v.volL = k * core.Cos(z.Pan*core.Pi/2)
+	v.volR = k * core.Sin(z.Pan*core.Pi/2)
+	core.EventInFloat(v.module, "note", float32(note)+m.bend)
+	core.EventInFloat(v.module, "gate", vel)
+}
+
+// release releases the voices for a note.
+func (m *sampler) release(note uint8) {
+	for i := range m.voice {
+		v := &m.voice[i]
+		if v.module != nil && v.held && v.note == note {
+			core.EventInFloat(v.module, "gate", 0)
+			v.held = false
+		}
+	}
+}
+
+// noteOff releases a note and plays the zones triggered by the release.
+func (m *sampler) noteOff(note uint8) {
+	m.release(note)
+	if m.vel[note] != 0 {
+		m.trigger(note, m.vel[note], true)
+		m.vel[note] = 0
+	}
+}
+
+// trigger plays the zones for a note on (or a note release).
+func (m *sampler) trigger(note uint8, vel float32, release bool) {
+	if m.inst == nil {
+		return
+	}
+	k := int(vel*127 + 0.5)
+	for _, z := range m.inst.Zones {
+		if z.OnRelease == release && z.match(int(note), k) {
+			m.play(z, note, vel)
+		}
+	}
+}
+
+func samplerMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*sampler)
+	me := e.GetEventMIDIChannel(m.ch)
+	if me == nil {
+		return
+	}
+	switch me.GetType() {
+	case core.EventMIDINoteOn:
+		note := me.GetNote()
+		vel := me.GetVelocityFloat()
+		if vel == 0 {
+			// note on with vel=0 is a note off
+			m.noteOff(note)
+			return
+		}
+		// a repeated note releases the previous voices
+		m.release(note)
+		m.vel[note] = vel
+		m.trigger(note, vel, false)
+	case core.EventMIDINoteOff:
+		m.noteOff(me.GetNote())
+	case core.EventMIDIPitchWheel:
+		m.bend = core.MIDIPitchBend(me.GetPitchWheel())
+		for i := range m.voice {
+			v := &m.voice[i]
+			if v.module != nil {
+				core.EventInFloat(v.module, "note", float32(v.note)+m.bend)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *sampler) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	out0.Zero()
+	out1.Zero()
+	var vout core.Buf
+	for i := range m.voice {
+		v := &m.voice[i]
+		if v.module == nil {
+			continue
+		}
+		if !v.module.Process(&vout) {
+			// the voice has finished
+			v.module.Stop()
+			v.module = nil
+			continue
+		}
+		for j := range vout {
+			out0[j] += v.volL * vout[j]
+			out1[j] += v.volR * vout[j]
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
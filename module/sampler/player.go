@@ -0,0 +1,164 @@
+//-----------------------------------------------------------------------------
+/*
+
+SoundFont 2 Player Module
+
+A multitimbral MIDI sampler for an SF2 file (E.g. a General MIDI sound bank).
+Each MIDI channel has a sampler for its current preset. A program change
+selects the preset for the bank set by the last bank select (CC 0).
+
+Channel 10 (percussion) always uses bank 128, and ignores bank select.
+Missing presets fall back to the same program in bank 0 (or program 0 in
+bank 128 for percussion).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var sf2PlayerInfo = core.ModuleInfo{
+	Name: "sf2Player",
+	In: []core.PortInfo{
+		{"midi", "midi input", core.PortTypeMIDI, sf2PlayerMidiIn},
+	},
+	Out: []core.PortInfo{
+		{"out0", "left channel output", core.PortTypeAudio, nil},
+		{"out1", "right channel output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *sf2Player) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+const (
+	numChannels       = 16  // number of MIDI channels
+	percussionChannel = 9   // General MIDI percussion channel (channel 10)
+	percussionBank    = 128 // SF2 bank for percussion presets
+	ccBankSelect      = 0   // MIDI CC number for bank select (MSB)
+)
+
+type sf2Player struct {
+	info core.ModuleInfo            // module info
+	sf2  *SF2                       // sound bank
+	ch   [numChannels]*sampler      // channel samplers
+	bank [numChannels]int           // bank for the next program change
+	inst map[*SF2Preset]*Instrument // instruments for the presets in use
+}
+
+// NewPlayer returns a multitimbral MIDI player for an SF2 sound bank.
+func NewPlayer(s *core.Synth, f *SF2, maxvoices uint) core.Module {
+	log.Info.Printf("")
+	m := &sf2Player{
+		info: sf2PlayerInfo,
+		sf2:  f,
+		inst: make(map[*SF2Preset]*Instrument),
+	}
+	for i := range m.ch {
+		m.ch[i] = NewSampler(s, uint8(i), nil, maxvoices).(*sampler)
+		if i == percussionChannel {
+			m.bank[i] = percussionBank
+		}
+		m.setProgram(i, 0)
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *sf2Player) Child() []core.Module {
+	children := make([]core.Module, len(m.ch))
+	for i := range m.ch {
+		children[i] = m.ch[i]
+	}
+	return children
+}
+
+// Stop performs any cleanup of a module.
+func (m *sf2Player) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// preset returns the preset for a bank and program (with General MIDI fallbacks).
+func (m *sf2Player) preset(bank, program int) *SF2Preset {
+	if p := m.sf2.Preset(bank, program); p != nil {
+		return p
+	}
+	if bank == percussionBank {
+		return m.sf2.Preset(percussionBank, 0)
+	}
+	return m.sf2.Preset(0, program)
+}
+
+// setProgram sets the instrument for new notes on a channel.
+func (m *sf2Player) setProgram(ch, program int) {
+	p := m.preset(m.bank[ch], program)
+	if p == nil {
+		log.Info.Printf("channel %d: no preset for bank %d program %d", ch, m.bank[ch], program)
+		m.ch[ch].inst = nil
+		return
+	}
+	inst, ok := m.inst[p]
+	if !ok {
+		var err error
+		inst, err = m.sf2.Instrument(p)
+		if err != nil {
+			log.Info.Printf("%s", err)
+		}
+		m.inst[p] = inst
+	}
+	log.Info.Printf("channel %d: bank %d program %d: %s", ch, p.Bank, p.Preset, p.Name)
+	m.ch[ch].inst = inst
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func sf2PlayerMidiIn(cm core.Module, e *core.Event) {
+	m := cm.(*sf2Player)
+	me := e.GetEventMIDI()
+	if me == nil {
+		return
+	}
+	ch := int(me.GetChannel())
+	switch me.GetType() {
+	case core.EventMIDIProgramChange:
+		m.setProgram(ch, int(me.GetProgram()))
+	case core.EventMIDIControlChange:
+		// the percussion channel stays on the percussion bank (GM resets select bank 0)
+		if me.GetCcNum() == ccBankSelect && ch != percussionChannel {
+			m.bank[ch] = int(me.GetCcInt())
+		}
+	default:
+		core.EventIn(m.ch[ch], "midi", e)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *sf2Player) Process(buf ...*core.Buf) bool {
+	out0 := buf[0]
+	out1 := buf[1]
+	out0.Zero()
+	out1.Zero()
+	var l, r core.Buf
+	for _, s := range m.ch {
+		s.Process(&l, &r)
+		out0.Add(&l)
+		out1.Add(&r)
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
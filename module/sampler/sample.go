@@ -0,0 +1,97 @@
+//-----------------------------------------------------------------------------
+/*
+
+Samples
+
+A sample is mono audio data loaded from a WAV file.
+The root note and loop points are read from the WAV "smpl" chunk.
+
+See:
+https://www.recordingblogs.com/wiki/sample-chunk-of-a-wave-file
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// defaultRoot is the root note for samples without a "smpl" chunk (middle C).
+const defaultRoot = 60
+
+// Sample is mono audio data with loop points.
+type Sample struct {
+	Rate      int       // sample rate (Hz)
+	Data      []float32 // samples
+	Root      int       // MIDI root note
+	Tune      float32   // root note tuning (cents)
+	LoopStart int       // loop start (first sample of the loop)
+	LoopEnd   int       // loop end (one past the last sample of the loop), 0 = no loop
+}
+
+// parseSmpl sets the sample root note and loop points from a "smpl" chunk.
+func (s *Sample) parseSmpl(buf []byte) error {
+	if len(buf) < 36 {
+		return errors.New("smpl chunk is too short")
+	}
+	s.Root = core.ClampInt(int(binary.LittleEndian.Uint32(buf[12:])), 0, 127)
+	// the pitch fraction is a fraction of a semitone
+	s.Tune = float32(binary.LittleEndian.Uint32(buf[16:])) * (100.0 / (1 << 32))
+	nloops := int(binary.LittleEndian.Uint32(buf[28:]))
+	if nloops == 0 {
+		return nil
+	}
+	if len(buf) < 36+24 {
+		return errors.New("smpl chunk is too short")
+	}
+	// use the first loop
+	start := int(binary.LittleEndian.Uint32(buf[36+8:]))
+	end := int(binary.LittleEndian.Uint32(buf[36+12:])) + 1
+	if start >= end || end > len(s.Data) {
+		return fmt.Errorf("bad loop points %d..%d", start, end)
+	}
+	s.LoopStart = start
+	s.LoopEnd = end
+	return nil
+}
+
+// NewSample returns a sample for WAV file audio data.
+func NewSample(w *core.Wave) (*Sample, error) {
+	s := &Sample{
+		Rate: w.Rate,
+		Data: w.Mono(),
+		Root: defaultRoot,
+	}
+	if len(s.Data) == 0 {
+		return nil, errors.New("no sample data")
+	}
+	if buf, ok := w.Chunk["smpl"]; ok {
+		if err := s.parseSmpl(buf); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// LoadSample returns a sample from a WAV file.
+func LoadSample(path string) (*Sample, error) {
+	w, err := core.LoadWave(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSample(w)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
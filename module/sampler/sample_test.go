@@ -0,0 +1,87 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sample Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// smplChunk returns a "smpl" chunk with a root note and a loop (end is inclusive).
+func smplChunk(root, fraction uint32, loop bool, start, end uint32) []byte {
+	var buf bytes.Buffer
+	nloops := uint32(0)
+	if loop {
+		nloops = 1
+	}
+	hdr := []uint32{0, 0, 0, root, fraction, 0, 0, nloops, 0}
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	if loop {
+		binary.Write(&buf, binary.LittleEndian, []uint32{0, 0, start, end, 0, 0})
+	}
+	return buf.Bytes()
+}
+
+// sineWave returns a WAV file with a sine wave.
+func sineWave(rate int, freq float64, n int, smpl []byte) []byte {
+	w := &core.Wave{
+		Rate:  rate,
+		Data:  [][]float32{make([]float32, n)},
+		Chunk: make(map[string][]byte),
+	}
+	for i := range w.Data[0] {
+		w.Data[0][i] = float32(math.Sin(2 * math.Pi * freq * float64(i) / float64(rate)))
+	}
+	if smpl != nil {
+		w.Chunk["smpl"] = smpl
+	}
+	return core.EncodeWave(w)
+}
+
+func parseSample(t *testing.T, buf []byte) *Sample {
+	w, err := core.ParseWave(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSample(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_Sample(t *testing.T) {
+	// no smpl chunk
+	s := parseSample(t, sineWave(44100, 441, 1000, nil))
+	if s.Rate != 44100 || len(s.Data) != 1000 || s.Root != defaultRoot || s.LoopEnd != 0 {
+		t.Errorf("bad sample %d Hz, %d samples, root %d, loop end %d", s.Rate, len(s.Data), s.Root, s.LoopEnd)
+	}
+	// root note, 50 cents, loop
+	s = parseSample(t, sineWave(44100, 441, 1000, smplChunk(69, 1<<31, true, 100, 899)))
+	if s.Root != 69 || s.Tune != 50 || s.LoopStart != 100 || s.LoopEnd != 900 {
+		t.Errorf("bad smpl chunk: root %d, tune %f, loop %d..%d", s.Root, s.Tune, s.LoopStart, s.LoopEnd)
+	}
+	z := NewZone(s)
+	if z.Loop != LoopSustain || z.Root != 69 || z.Tune != -50 {
+		t.Errorf("bad zone: loop %s, root %d, tune %f", z.Loop, z.Root, z.Tune)
+	}
+	// bad loop
+	w, _ := core.ParseWave(sineWave(44100, 441, 1000, smplChunk(69, 0, true, 100, 2000)))
+	if _, err := NewSample(w); err == nil {
+		t.Errorf("expected an error for bad loop points")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,565 @@
+//-----------------------------------------------------------------------------
+/*
+
+SoundFont 2 Files
+
+An SF2 file is a RIFF file with sample data and a hierarchy of presets,
+instruments and samples. Preset and instrument zones are sets of generators
+(synthesis parameters) and modulators (real-time controls of generators).
+
+A preset is converted to a sampler instrument with a zone for each sample
+in each instrument zone of each preset zone. Preset generators are added to
+instrument generators. The following generators are used:
+
+* key and velocity ranges
+* sample addresses and loop modes
+* root key, coarse and fine tuning
+* attenuation and pan
+* volume envelope attack, decay, sustain and release
+
+Modulators are parsed but not applied. The SF2 default modulators are
+approximated by velocity gain tracking.
+
+See:
+http://www.synthfont.com/sfspec24.pdf
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// SF2 generator operators
+const (
+	sf2StartAddrsOffset           = 0
+	sf2EndAddrsOffset             = 1
+	sf2StartloopAddrsOffset       = 2
+	sf2EndloopAddrsOffset         = 3
+	sf2StartAddrsCoarseOffset     = 4
+	sf2EndAddrsCoarseOffset       = 12
+	sf2Pan                        = 17
+	sf2DelayVolEnv                = 33
+	sf2AttackVolEnv               = 34
+	sf2HoldVolEnv                 = 35
+	sf2DecayVolEnv                = 36
+	sf2SustainVolEnv              = 37
+	sf2ReleaseVolEnv              = 38
+	sf2Instrument                 = 41
+	sf2KeyRange                   = 43
+	sf2VelRange                   = 44
+	sf2StartloopAddrsCoarseOffset = 45
+	sf2Keynum                     = 46
+	sf2Velocity                   = 47
+	sf2InitialAttenuation         = 48
+	sf2EndloopAddrsCoarseOffset   = 50
+	sf2CoarseTune                 = 51
+	sf2FineTune                   = 52
+	sf2SampleID                   = 53
+	sf2SampleModes                = 54
+	sf2OverridingRootKey          = 58
+)
+
+// sf2Defaults are the default values of the instrument generators.
+var sf2Defaults = sf2Gens{
+	sf2DelayVolEnv:       -12000,
+	sf2AttackVolEnv:      -12000,
+	sf2HoldVolEnv:        -12000,
+	sf2DecayVolEnv:       -12000,
+	sf2ReleaseVolEnv:     -12000,
+	sf2KeyRange:          127 << 8,
+	sf2VelRange:          127 << 8,
+	sf2Keynum:            -1,
+	sf2Velocity:          -1,
+	sf2OverridingRootKey: -1,
+}
+
+// SF2 sample types
+const (
+	sf2SampleROM = 0x8000 // the sample data is in ROM
+)
+
+//-----------------------------------------------------------------------------
+
+// SF2Generator sets a synthesis parameter.
+type SF2Generator struct {
+	Oper   uint16 // generator operator
+	Amount int16  // generator value
+}
+
+// SF2Modulator controls a generator with a modulation source.
+type SF2Modulator struct {
+	Src    uint16 // modulation source
+	Dest   uint16 // destination generator
+	Amount int16  // modulation amount
+	AmtSrc uint16 // modulation amount source
+	Trans  uint16 // modulation transform
+}
+
+// SF2Zone is a set of generators and modulators.
+type SF2Zone struct {
+	Gen []SF2Generator // generators
+	Mod []SF2Modulator // modulators
+}
+
+// SF2Preset is a set of instrument zones selected by a MIDI bank and program.
+type SF2Preset struct {
+	Name   string     // preset name
+	Preset int        // MIDI program
+	Bank   int        // MIDI bank (128 for percussion)
+	Zones  []*SF2Zone // zones
+}
+
+// SF2Instrument is a set of sample zones.
+type SF2Instrument struct {
+	Name  string     // instrument name
+	Zones []*SF2Zone // zones
+}
+
+// SF2Sample is a sample header.
+type SF2Sample struct {
+	Name       string // sample name
+	Start      int    // first sample
+	End        int    // one past the last sample
+	LoopStart  int    // first sample of the loop
+	LoopEnd    int    // one past the last sample of the loop
+	Rate       int    // sample rate (Hz)
+	Pitch      int    // MIDI note of the recorded pitch
+	Correction int    // pitch correction (cents)
+	Link       int    // linked sample (stereo pairs)
+	Type       int    // sample type
+}
+
+// SF2 is a SoundFont 2 file.
+type SF2 struct {
+	Name        string           // bank name
+	Presets     []*SF2Preset     // presets
+	Instruments []*SF2Instrument // instruments
+	Samples     []*SF2Sample     // sample headers
+	Data        []float32        // sample data
+	cache       map[sf2SampleKey]*Sample
+}
+
+//-----------------------------------------------------------------------------
+// parsing
+
+// sf2Chunks returns the RIFF chunks of a buffer. The contents of LIST chunks are included.
+func sf2Chunks(buf []byte, chunks map[string][]byte) {
+	core.RIFFChunks(buf, func(id string, chunk []byte) error {
+		if id == "LIST" && len(chunk) >= 4 {
+			sf2Chunks(chunk[4:], chunks)
+		} else {
+			chunks[id] = chunk
+		}
+		return nil
+	})
+}
+
+// sf2Name returns a string from a fixed length name field.
+func sf2Name(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// sf2Records returns the records of a hydra chunk, excluding the terminal record.
+func sf2Records(chunks map[string][]byte, id string, size int) ([][]byte, error) {
+	buf, ok := chunks[id]
+	if !ok {
+		return nil, fmt.Errorf("no %s chunk", id)
+	}
+	if len(buf)%size != 0 || len(buf) < size {
+		return nil, fmt.Errorf("bad %s chunk length %d", id, len(buf))
+	}
+	n := len(buf)/size - 1
+	r := make([][]byte, n)
+	for i := range r {
+		r[i] = buf[i*size : (i+1)*size]
+	}
+	return r, nil
+}
+
+type sf2Bag struct {
+	gen int // first generator
+	mod int // first modulator
+}
+
+// sf2Hydra has the records for a preset or instrument zone hierarchy.
+type sf2Hydra struct {
+	bag []sf2Bag
+	gen []SF2Generator
+	mod []SF2Modulator
+}
+
+// parseHydra parses the bag, modulator and generator chunks (E.g. "pbag", "pmod", "pgen").
+func parseHydra(chunks map[string][]byte, bagID, modID, genID string) (*sf2Hydra, error) {
+	h := &sf2Hydra{}
+	// the terminal bag is needed for the last zone
+	buf, ok := chunks[bagID]
+	if !ok || len(buf)%4 != 0 || len(buf) < 4 {
+		return nil, fmt.Errorf("bad %s chunk", bagID)
+	}
+	for i := 0; i < len(buf); i += 4 {
+		h.bag = append(h.bag, sf2Bag{
+			gen: int(binary.LittleEndian.Uint16(buf[i:])),
+			mod: int(binary.LittleEndian.Uint16(buf[i+2:])),
+		})
+	}
+	r, err := sf2Records(chunks, modID, 10)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range r {
+		h.mod = append(h.mod, SF2Modulator{
+			Src:    binary.LittleEndian.Uint16(b[0:]),
+			Dest:   binary.LittleEndian.Uint16(b[2:]),
+			Amount: int16(binary.LittleEndian.Uint16(b[4:])),
+			AmtSrc: binary.LittleEndian.Uint16(b[6:]),
+			Trans:  binary.LittleEndian.Uint16(b[8:]),
+		})
+	}
+	r, err = sf2Records(chunks, genID, 4)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range r {
+		h.gen = append(h.gen, SF2Generator{
+			Oper:   binary.LittleEndian.Uint16(b[0:]),
+			Amount: int16(binary.LittleEndian.Uint16(b[2:])),
+		})
+	}
+	return h, nil
+}
+
+// zones returns the zones for the bags b0..b1-1.
+func (h *sf2Hydra) zones(b0, b1 int) ([]*SF2Zone, error) {
+	if b0 > b1 || b1 >= len(h.bag) {
+		return nil, fmt.Errorf("bad bag index %d..%d", b0, b1)
+	}
+	var zones []*SF2Zone
+	for i := b0; i < b1; i++ {
+		g0, g1 := h.bag[i].gen, h.bag[i+1].gen
+		m0, m1 := h.bag[i].mod, h.bag[i+1].mod
+		if g0 > g1 || g1 > len(h.gen) || m0 > m1 || m1 > len(h.mod) {
+			return nil, fmt.Errorf("bad bag %d", i)
+		}
+		zones = append(zones, &SF2Zone{
+			Gen: h.gen[g0:g1],
+			Mod: h.mod[m0:m1],
+		})
+	}
+	return zones, nil
+}
+
+// ParseSF2 returns the SoundFont 2 data from the contents of an SF2 file.
+func ParseSF2(buf []byte) (*SF2, error) {
+	if len(buf) < 12 || string(buf[0:4]) != "RIFF" || string(buf[8:12]) != "sfbk" {
+		return nil, errors.New("sf2: not a RIFF/sfbk file")
+	}
+	chunks := make(map[string][]byte)
+	sf2Chunks(buf[12:], chunks)
+	f := &SF2{
+		Name:  sf2Name(chunks["INAM"]),
+		cache: make(map[sf2SampleKey]*Sample),
+	}
+
+	// sample data (16 bit)
+	smpl, ok := chunks["smpl"]
+	if !ok {
+		return nil, errors.New("sf2: no smpl chunk")
+	}
+	f.Data = make([]float32, len(smpl)/2)
+	for i := range f.Data {
+		f.Data[i] = float32(int16(binary.LittleEndian.Uint16(smpl[2*i:]))) * (1.0 / (1 << 15))
+	}
+
+	// sample headers
+	r, err := sf2Records(chunks, "shdr", 46)
+	if err != nil {
+		return nil, fmt.Errorf("sf2: %s", err)
+	}
+	for _, b := range r {
+		f.Samples = append(f.Samples, &SF2Sample{
+			Name:       sf2Name(b[0:20]),
+			Start:      int(binary.LittleEndian.Uint32(b[20:])),
+			End:        int(binary.LittleEndian.Uint32(b[24:])),
+			LoopStart:  int(binary.LittleEndian.Uint32(b[28:])),
+			LoopEnd:    int(binary.LittleEndian.Uint32(b[32:])),
+			Rate:       int(binary.LittleEndian.Uint32(b[36:])),
+			Pitch:      int(b[40]),
+			Correction: int(int8(b[41])),
+			Link:       int(binary.LittleEndian.Uint16(b[42:])),
+			Type:       int(binary.LittleEndian.Uint16(b[44:])),
+		})
+	}
+
+	// instruments
+	h, err := parseHydra(chunks, "ibag", "imod", "igen")
+	if err != nil {
+		return nil, fmt.Errorf("sf2: %s", err)
+	}
+	r, err = sf2Records(chunks, "inst", 22)
+	if err != nil {
+		return nil, fmt.Errorf("sf2: %s", err)
+	}
+	// the terminal record has the last bag index
+	inst := chunks["inst"]
+	for i, b := range r {
+		b0 := int(binary.LittleEndian.Uint16(b[20:]))
+		b1 := int(binary.LittleEndian.Uint16(inst[(i+1)*22+20:]))
+		zones, err := h.zones(b0, b1)
+		if err != nil {
+			return nil, fmt.Errorf("sf2: instrument %d: %s", i, err)
+		}
+		f.Instruments = append(f.Instruments, &SF2Instrument{
+			Name:  sf2Name(b[0:20]),
+			Zones: zones,
+		})
+	}
+
+	// presets
+	h, err = parseHydra(chunks, "pbag", "pmod", "pgen")
+	if err != nil {
+		return nil, fmt.Errorf("sf2: %s", err)
+	}
+	r, err = sf2Records(chunks, "phdr", 38)
+	if err != nil {
+		return nil, fmt.Errorf("sf2: %s", err)
+	}
+	phdr := chunks["phdr"]
+	for i, b := range r {
+		b0 := int(binary.LittleEndian.Uint16(b[24:]))
+		b1 := int(binary.LittleEndian.Uint16(phdr[(i+1)*38+24:]))
+		zones, err := h.zones(b0, b1)
+		if err != nil {
+			return nil, fmt.Errorf("sf2: preset %d: %s", i, err)
+		}
+		f.Presets = append(f.Presets, &SF2Preset{
+			Name:   sf2Name(b[0:20]),
+			Preset: int(binary.LittleEndian.Uint16(b[20:])),
+			Bank:   int(binary.LittleEndian.Uint16(b[22:])),
+			Zones:  zones,
+		})
+	}
+
+	return f, nil
+}
+
+// LoadSF2 returns the SoundFont 2 data from an SF2 file.
+func LoadSF2(path string) (*SF2, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseSF2(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return f, nil
+}
+
+//-----------------------------------------------------------------------------
+// generators
+
+// sf2Gens maps generator operators to values.
+type sf2Gens map[uint16]int16
+
+// mergeGens returns the union of a set of generators, later values override earlier ones.
+func mergeGens(gens ...sf2Gens) sf2Gens {
+	x := make(sf2Gens)
+	for _, g := range gens {
+		for k, v := range g {
+			x[k] = v
+		}
+	}
+	return x
+}
+
+// splitZones returns the global generators and the generators for each local zone.
+// Local zones end with the terminal generator (instrument or sample).
+func splitZones(zones []*SF2Zone, terminal uint16) (sf2Gens, []sf2Gens) {
+	global := make(sf2Gens)
+	var local []sf2Gens
+	for i, z := range zones {
+		g := make(sf2Gens)
+		for _, gen := range z.Gen {
+			g[gen.Oper] = gen.Amount
+		}
+		n := len(z.Gen)
+		if n != 0 && z.Gen[n-1].Oper == terminal {
+			local = append(local, g)
+		} else if i == 0 {
+			global = g
+		}
+	}
+	return global, local
+}
+
+// keyRange returns the low and high values of a range generator.
+func (g sf2Gens) keyRange(oper uint16) (int, int) {
+	x := uint16(g[oper])
+	return int(x & 0xff), int(x >> 8)
+}
+
+// timecents returns the time (secs) for a generator in timecents.
+func timecents(x int) float32 {
+	return float32(math.Pow(2, float64(x)/1200))
+}
+
+// centibels returns the gain for an attenuation in centibels.
+func centibels(x int) float32 {
+	return float32(math.Pow(10, -float64(core.ClampLo(float32(x), 0))/200))
+}
+
+//-----------------------------------------------------------------------------
+// instruments
+
+type sf2SampleKey struct {
+	start, end, rate int
+}
+
+// sample returns the sampler sample for a range of the sample data.
+func (f *SF2) sample(start, end, rate int) *Sample {
+	k := sf2SampleKey{start, end, rate}
+	if s, ok := f.cache[k]; ok {
+		return s
+	}
+	s := &Sample{
+		Rate: rate,
+		Data: f.Data[start:end],
+		Root: defaultRoot,
+	}
+	f.cache[k] = s
+	return s
+}
+
+// zone returns the sampler zone for the preset and instrument generators (or nil).
+func (f *SF2) zone(p, i sf2Gens) (*Zone, error) {
+	// key and velocity ranges are the intersection of the preset and instrument ranges
+	loKey, hiKey := i.keyRange(sf2KeyRange)
+	loVel, hiVel := i.keyRange(sf2VelRange)
+	if _, ok := p[sf2KeyRange]; ok {
+		lo, hi := p.keyRange(sf2KeyRange)
+		loKey, hiKey = core.Max(loKey, lo), core.Min(hiKey, hi)
+	}
+	if _, ok := p[sf2VelRange]; ok {
+		lo, hi := p.keyRange(sf2VelRange)
+		loVel, hiVel = core.Max(loVel, lo), core.Min(hiVel, hi)
+	}
+	if loKey > hiKey || loVel > hiVel {
+		return nil, nil
+	}
+
+	idx := int(uint16(i[sf2SampleID]))
+	if idx >= len(f.Samples) {
+		return nil, fmt.Errorf("bad sample index %d", idx)
+	}
+	sh := f.Samples[idx]
+	if sh.Type&sf2SampleROM != 0 {
+		// no sample data
+		return nil, nil
+	}
+
+	// preset generators are added to the instrument generators
+	val := func(oper uint16) int {
+		return int(i[oper]) + int(p[oper])
+	}
+	// sample addresses are only set by instruments
+	addr := func(fine, coarse uint16) int {
+		return int(i[fine]) + 32768*int(i[coarse])
+	}
+
+	start := core.ClampInt(sh.Start+addr(sf2StartAddrsOffset, sf2StartAddrsCoarseOffset), 0, len(f.Data))
+	end := core.ClampInt(sh.End+addr(sf2EndAddrsOffset, sf2EndAddrsCoarseOffset), start, len(f.Data))
+	if start == end {
+		return nil, fmt.Errorf("sample %d has no data", idx)
+	}
+	s := f.sample(start, end, sh.Rate)
+
+	root := int(i[sf2OverridingRootKey])
+	if root < 0 {
+		root = sh.Pitch
+		if root > 127 {
+			root = defaultRoot
+		}
+	}
+
+	z := &Zone{
+		Sample:    s,
+		LoKey:     loKey,
+		HiKey:     hiKey,
+		LoVel:     loVel,
+		HiVel:     hiVel,
+		Root:      root,
+		Tune:      float32(100*val(sf2CoarseTune) + val(sf2FineTune) + sh.Correction),
+		Gain:      centibels(val(sf2InitialAttenuation)),
+		Pan:       core.Clamp(float32(val(sf2Pan)+500)/1000, 0, 1),
+		VelTrack:  1,
+		LoopStart: sh.LoopStart + addr(sf2StartloopAddrsOffset, sf2StartloopAddrsCoarseOffset) - start,
+		LoopEnd:   sh.LoopEnd + addr(sf2EndloopAddrsOffset, sf2EndloopAddrsCoarseOffset) - start,
+		Attack:    timecents(val(sf2AttackVolEnv)),
+		Decay:     timecents(val(sf2DecayVolEnv)),
+		Sustain:   centibels(val(sf2SustainVolEnv)),
+		Release:   timecents(val(sf2ReleaseVolEnv)),
+	}
+	switch i[sf2SampleModes] & 3 {
+	case 1:
+		z.Loop = LoopContinuous
+	case 3:
+		z.Loop = LoopSustain
+	}
+	if z.Loop != LoopNone && !z.looped() {
+		// ignore bad loops
+		z.Loop = LoopNone
+	}
+	return z, nil
+}
+
+// Preset returns the preset for a MIDI bank and program (or nil).
+func (f *SF2) Preset(bank, program int) *SF2Preset {
+	for _, p := range f.Presets {
+		if p.Bank == bank && p.Preset == program {
+			return p
+		}
+	}
+	return nil
+}
+
+// Instrument returns the sampler instrument for a preset.
+func (f *SF2) Instrument(p *SF2Preset) (*Instrument, error) {
+	inst := &Instrument{}
+	pglobal, plocal := splitZones(p.Zones, sf2Instrument)
+	for _, pg := range plocal {
+		pg = mergeGens(pglobal, pg)
+		idx := int(uint16(pg[sf2Instrument]))
+		if idx >= len(f.Instruments) {
+			return nil, fmt.Errorf("sf2: %s: bad instrument index %d", p.Name, idx)
+		}
+		iglobal, ilocal := splitZones(f.Instruments[idx].Zones, sf2SampleID)
+		for _, ig := range ilocal {
+			z, err := f.zone(pg, mergeGens(sf2Defaults, iglobal, ig))
+			if err != nil {
+				return nil, fmt.Errorf("sf2: %s: %s", f.Instruments[idx].Name, err)
+			}
+			if z != nil {
+				inst.Zones = append(inst.Zones, z)
+			}
+		}
+	}
+	return inst, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,269 @@
+//-----------------------------------------------------------------------------
+/*
+
+SoundFont 2 Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+// riffChunk returns a RIFF chunk.
+func riffChunk(id string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)&1 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// riffList returns a RIFF chunk containing a list of chunks.
+func riffList(id, typ string, chunks ...[]byte) []byte {
+	data := []byte(typ)
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return riffChunk(id, data)
+}
+
+// records returns the little endian encoding of a slice of records.
+func records(x interface{}) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, x)
+	return buf.Bytes()
+}
+
+func name20(s string) [20]byte {
+	var x [20]byte
+	copy(x[:], s)
+	return x
+}
+
+type testPhdr struct {
+	Name                  [20]byte
+	Preset, Bank, Bag     uint16
+	Library, Genre, Morph uint32
+}
+
+type testInst struct {
+	Name [20]byte
+	Bag  uint16
+}
+
+type testShdr struct {
+	Name                                 [20]byte
+	Start, End, LoopStart, LoopEnd, Rate uint32
+	Pitch                                uint8
+	Correction                           int8
+	Link, Type                           uint16
+}
+
+type testBag struct {
+	Gen, Mod uint16
+}
+
+// testSF2 returns an SF2 file with piano and drum presets.
+func testSF2() []byte {
+	// 480 Hz sine and a decaying 100 Hz sine
+	var smpl []int16
+	for i := 0; i < 4800; i++ {
+		smpl = append(smpl, int16(32767*math.Sin(2*math.Pi*float64(i)/100)))
+	}
+	for i := 0; i < 4800; i++ {
+		smpl = append(smpl, int16(32767*math.Exp(-float64(i)/1000)*math.Sin(2*math.Pi*float64(i)/480)))
+	}
+	shdr := []testShdr{
+		{name20("sine"), 0, 4800, 1000, 2000, 48000, 60, 0, 0, 1},
+		{name20("drum"), 4800, 9600, 0, 0, 48000, 60, -10, 0, 1},
+		{name20("EOS"), 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	// instrument zones
+	igen := []SF2Generator{
+		// piano global zone
+		{sf2AttackVolEnv, -1200},
+		{sf2ReleaseVolEnv, 0},
+		// piano low
+		{sf2KeyRange, 63 << 8},
+		{sf2SampleModes, 1},
+		{sf2SampleID, 0},
+		// piano high
+		{sf2KeyRange, 127<<8 | 64},
+		{sf2OverridingRootKey, 72},
+		{sf2Pan, -500},
+		{sf2SampleID, 0},
+		// drum
+		{sf2SampleID, 1},
+		{0, 0},
+	}
+	ibag := []testBag{{0, 0}, {2, 0}, {5, 0}, {9, 0}, {10, 0}}
+	inst := []testInst{{name20("piano"), 0}, {name20("drum"), 3}, {name20("EOI"), 4}}
+	// preset zones
+	pgen := []SF2Generator{
+		// piano global zone
+		{sf2InitialAttenuation, 60},
+		// piano
+		{sf2Instrument, 0},
+		// drums
+		{sf2KeyRange, 81<<8 | 35},
+		{sf2Instrument, 1},
+		// piano 2
+		{sf2CoarseTune, 12},
+		{sf2Instrument, 0},
+		{0, 0},
+	}
+	pbag := []testBag{{0, 0}, {1, 0}, {2, 0}, {4, 0}, {6, 0}}
+	phdr := []testPhdr{
+		{Name: name20("Piano"), Preset: 0, Bank: 0, Bag: 0},
+		{Name: name20("Drums"), Preset: 0, Bank: 128, Bag: 2},
+		{Name: name20("Piano 2"), Preset: 5, Bank: 1, Bag: 3},
+		{Name: name20("EOP"), Bag: 4},
+	}
+	mod := make([]byte, 10)
+	sfbk := riffList("RIFF", "sfbk",
+		riffList("LIST", "INFO", riffChunk("INAM", []byte("Test Bank\x00"))),
+		riffList("LIST", "sdta", riffChunk("smpl", records(smpl))),
+		riffList("LIST", "pdta",
+			riffChunk("phdr", records(phdr)),
+			riffChunk("pbag", records(pbag)),
+			riffChunk("pmod", mod),
+			riffChunk("pgen", records(pgen)),
+			riffChunk("inst", records(inst)),
+			riffChunk("ibag", records(ibag)),
+			riffChunk("imod", mod),
+			riffChunk("igen", records(igen)),
+			riffChunk("shdr", records(shdr)),
+		),
+	)
+	return sfbk
+}
+
+func Test_SF2(t *testing.T) {
+	f, err := ParseSF2(testSF2())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Test Bank" || len(f.Presets) != 3 || len(f.Instruments) != 2 || len(f.Samples) != 2 || len(f.Data) != 9600 {
+		t.Fatalf("bad sf2 \"%s\": %d presets, %d instruments, %d samples, %d sample data",
+			f.Name, len(f.Presets), len(f.Instruments), len(f.Samples), len(f.Data))
+	}
+	if f.Samples[1].Name != "drum" || f.Samples[1].Correction != -10 || len(f.Instruments[0].Zones) != 3 {
+		t.Errorf("bad sample or instrument")
+	}
+
+	// piano
+	p := f.Preset(0, 0)
+	if p == nil || p.Name != "Piano" {
+		t.Fatalf("no piano preset")
+	}
+	inst, err := f.Instrument(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inst.Zones) != 2 {
+		t.Fatalf("%d piano zones, expected 2", len(inst.Zones))
+	}
+	z := inst.Zones[0]
+	if z.LoKey != 0 || z.HiKey != 63 || z.Root != 60 || z.Loop != LoopContinuous || z.LoopStart != 1000 || z.LoopEnd != 2000 {
+		t.Errorf("bad low zone keys %d..%d root %d loop %s %d..%d", z.LoKey, z.HiKey, z.Root, z.Loop, z.LoopStart, z.LoopEnd)
+	}
+	if math.Abs(float64(z.Gain)-0.501) > 1e-3 || math.Abs(float64(z.Attack)-0.5) > 1e-6 || z.Release != 1 || z.Sustain != 1 || z.Pan != 0.5 {
+		t.Errorf("bad low zone gain %f attack %f release %f sustain %f pan %f", z.Gain, z.Attack, z.Release, z.Sustain, z.Pan)
+	}
+	z = inst.Zones[1]
+	if z.LoKey != 64 || z.HiKey != 127 || z.Root != 72 || z.Loop != LoopNone || z.Pan != 0 {
+		t.Errorf("bad high zone keys %d..%d root %d loop %s pan %f", z.LoKey, z.HiKey, z.Root, z.Loop, z.Pan)
+	}
+	if inst.Zones[0].Sample != inst.Zones[1].Sample {
+		t.Errorf("samples are not shared")
+	}
+
+	// drums
+	inst, err = f.Instrument(f.Preset(128, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z = inst.Zones[0]
+	if z.LoKey != 35 || z.HiKey != 81 || z.Tune != -10 || len(z.Sample.Data) != 4800 || z.Sample.Data[0] != f.Data[4800] {
+		t.Errorf("bad drum zone keys %d..%d tune %f", z.LoKey, z.HiKey, z.Tune)
+	}
+
+	// errors
+	if _, err := ParseSF2([]byte("RIFF\x00\x00\x00\x00WAVE")); err == nil {
+		t.Errorf("expected an error for a non-sf2 file")
+	}
+	if _, err := ParseSF2(testSF2()[:5000]); err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+}
+
+func Test_Player(t *testing.T) {
+	f, err := ParseSF2(testSF2())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := core.NewSynth()
+	m := NewPlayer(s, f, 8).(*sf2Player)
+	// default presets
+	if m.ch[0].inst == nil || m.ch[0].inst.Zones[0].Tune != 0 || m.ch[9].inst == nil || m.ch[9].inst.Zones[0].LoKey != 35 {
+		t.Fatalf("bad default presets")
+	}
+	// bank select and program change
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIControlChange, 1, ccBankSelect, 1))
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 1, 5, 0))
+	if m.ch[1].inst == nil || m.ch[1].inst.Zones[0].Tune != 1200 {
+		t.Errorf("bad bank 1 program 5")
+	}
+	// fallback to bank 0
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 1, 0, 0))
+	if m.ch[1].inst != m.ch[0].inst {
+		t.Errorf("bad bank 1 program 0")
+	}
+	// no preset
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 2, 7, 0))
+	if m.ch[2].inst != nil {
+		t.Errorf("bad bank 0 program 7")
+	}
+	// bank select on the percussion channel
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIControlChange, 9, ccBankSelect, 0))
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDIProgramChange, 9, 0, 0))
+	if m.ch[9].inst == nil || m.ch[9].inst.Zones[0].LoKey != 35 {
+		t.Errorf("percussion channel is not on the percussion bank")
+	}
+
+	n := core.AudioSampleFrequency / 20
+	// notes on channels 0 (piano, center) and 9 (drums, center), 2 (no preset)
+	for _, ch := range []uint8{0, 2, 9} {
+		core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, ch, 60, 127))
+	}
+	l, r := renderStereo(m, n)
+	if power(l) == 0 || math.Abs(power(l)-power(r)) > 1e-6 {
+		t.Errorf("bad note output: left power %f right power %f", power(l), power(r))
+	}
+	if len(m.ch[0].Child()) != 1 || len(m.ch[2].Child()) != 0 || len(m.ch[9].Child()) != 1 {
+		t.Errorf("bad voices")
+	}
+	// high piano notes are panned left
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, 60, 0))
+	renderStereo(m, 2*core.AudioSampleFrequency)
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 3, 72, 127))
+	l, r = renderStereo(m, n)
+	if power(l) == 0 || power(r) > 1e-6*power(l) {
+		t.Errorf("bad panned output: left power %f right power %f", power(l), power(r))
+	}
+}
+
+//-----------------------------------------------------------------------------
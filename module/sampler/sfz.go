@@ -0,0 +1,355 @@
+//-----------------------------------------------------------------------------
+/*
+
+SFZ Instruments
+
+An SFZ file is a text file describing how a set of WAV samples is mapped
+to notes and velocities. Opcodes set under <global>, <master> and <group>
+headers are inherited by the <region> headers that follow them.
+
+Supported opcodes:
+sample, default_path, lokey, hikey, key, lovel, hivel, pitch_keycenter,
+tune, transpose, volume, pan, amp_veltrack, loop_mode, loop_start, loop_end,
+ampeg_attack, ampeg_decay, ampeg_sustain, ampeg_release, trigger
+
+Other opcodes are ignored.
+
+See:
+https://sfzformat.com/
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+// Instrument is a set of sample zones.
+type Instrument struct {
+	Zones []*Zone // sample zones
+}
+
+//-----------------------------------------------------------------------------
+// note names
+
+var noteOffset = map[byte]int{'c': 0, 'd': 2, 'e': 4, 'f': 5, 'g': 7, 'a': 9, 'b': 11}
+
+// parseNote returns the MIDI note for a note number or name (c4 == 60).
+func parseNote(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 127 {
+			return 0, fmt.Errorf("note %d out of range", n)
+		}
+		return n, nil
+	}
+	s = strings.ToLower(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("bad note \"%s\"", s)
+	}
+	note, ok := noteOffset[s[0]]
+	if !ok {
+		return 0, fmt.Errorf("bad note \"%s\"", s)
+	}
+	i := 1
+	switch s[1] {
+	case '#':
+		note++
+		i++
+	case 'b':
+		note--
+		i++
+	}
+	octave, err := strconv.Atoi(s[i:])
+	if err != nil {
+		return 0, fmt.Errorf("bad note \"%s\"", s)
+	}
+	note += 12 * (octave + 1)
+	if note < 0 || note > 127 {
+		return 0, fmt.Errorf("note \"%s\" out of range", s)
+	}
+	return note, nil
+}
+
+//-----------------------------------------------------------------------------
+// parsing
+
+// sfzOpcodes are the opcode values for a header.
+type sfzOpcodes map[string]string
+
+// copyOpcodes returns the union of a set of opcodes, later values override earlier ones.
+func copyOpcodes(ops ...sfzOpcodes) sfzOpcodes {
+	x := make(sfzOpcodes)
+	for _, op := range ops {
+		for k, v := range op {
+			x[k] = v
+		}
+	}
+	return x
+}
+
+var sfzComment = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+var sfzToken = regexp.MustCompile(`<(\w+)>|(\w+)=`)
+
+// parseSFZ returns the control opcodes and the opcodes for each region.
+func parseSFZ(text string) (sfzOpcodes, []sfzOpcodes) {
+	text = sfzComment.ReplaceAllString(text, " ")
+	control := make(sfzOpcodes)
+	global := make(sfzOpcodes)
+	master := make(sfzOpcodes)
+	group := make(sfzOpcodes)
+	var regions []sfzOpcodes
+	// opcodes outside of a supported header are discarded
+	cur := make(sfzOpcodes)
+	idx := sfzToken.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range idx {
+		if m[2] >= 0 {
+			// header
+			switch text[m[2]:m[3]] {
+			case "control":
+				cur = control
+			case "global":
+				global = make(sfzOpcodes)
+				master = make(sfzOpcodes)
+				group = make(sfzOpcodes)
+				cur = global
+			case "master":
+				master = make(sfzOpcodes)
+				group = make(sfzOpcodes)
+				cur = master
+			case "group":
+				group = make(sfzOpcodes)
+				cur = group
+			case "region":
+				cur = copyOpcodes(global, master, group)
+				regions = append(regions, cur)
+			default:
+				log.Info.Printf("unsupported header <%s>", text[m[2]:m[3]])
+				cur = make(sfzOpcodes)
+			}
+			continue
+		}
+		// opcode, the value (which may contain spaces) runs to the next token
+		end := len(text)
+		if i+1 < len(idx) {
+			end = idx[i+1][0]
+		}
+		cur[text[m[4]:m[5]]] = strings.TrimSpace(text[m[1]:end])
+	}
+	return control, regions
+}
+
+//-----------------------------------------------------------------------------
+// zones
+
+type sfzLoader struct {
+	dir     string             // sample directory
+	samples map[string]*Sample // loaded samples
+}
+
+// sample returns the sample for a path (relative to the sample directory).
+func (l *sfzLoader) sample(name string) (*Sample, error) {
+	path := filepath.Join(l.dir, filepath.FromSlash(strings.Replace(name, "\\", "/", -1)))
+	if s, ok := l.samples[path]; ok {
+		return s, nil
+	}
+	s, err := LoadSample(path)
+	if err != nil {
+		return nil, err
+	}
+	l.samples[path] = s
+	return s, nil
+}
+
+// zone returns the sample zone for the opcodes of a region.
+func (l *sfzLoader) zone(op sfzOpcodes) (*Zone, error) {
+	name, ok := op["sample"]
+	if !ok {
+		return nil, errors.New("no sample")
+	}
+	s, err := l.sample(name)
+	if err != nil {
+		return nil, err
+	}
+	// SFZ defaults
+	z := NewZone(s)
+	z.Root = 60
+	z.Tune = 0
+	z.Release = 0.001
+	z.VelTrack = 1
+
+	num := func(k string) (float32, error) {
+		x, err := strconv.ParseFloat(op[k], 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad %s value \"%s\"", k, op[k])
+		}
+		return float32(x), nil
+	}
+
+	// key sets the key range and the root note
+	if _, ok := op["key"]; ok {
+		n, err := parseNote(op["key"])
+		if err != nil {
+			return nil, err
+		}
+		z.LoKey, z.HiKey, z.Root = n, n, n
+	}
+
+	for k, v := range op {
+		var x float32
+		var n int
+		var err error
+		switch k {
+		case "sample", "key":
+			// done
+		case "lokey":
+			z.LoKey, err = parseNote(v)
+		case "hikey":
+			z.HiKey, err = parseNote(v)
+		case "pitch_keycenter":
+			z.Root, err = parseNote(v)
+		case "lovel", "hivel", "loop_start", "loop_end":
+			n, err = strconv.Atoi(v)
+			if err != nil {
+				err = fmt.Errorf("bad %s value \"%s\"", k, v)
+				break
+			}
+			switch k {
+			case "lovel":
+				z.LoVel = core.ClampInt(n, 0, 127)
+			case "hivel":
+				z.HiVel = core.ClampInt(n, 0, 127)
+			case "loop_start":
+				z.LoopStart = n
+			case "loop_end":
+				// the sfz loop end is inclusive
+				z.LoopEnd = n + 1
+			}
+		case "tune", "transpose", "volume", "pan", "amp_veltrack", "ampeg_attack", "ampeg_decay", "ampeg_sustain", "ampeg_release":
+			x, err = num(k)
+			if err != nil {
+				break
+			}
+			switch k {
+			case "tune":
+				// cents
+				z.Tune += x
+			case "transpose":
+				// semitones
+				z.Tune += 100 * x
+			case "volume":
+				// dB
+				z.Gain = float32(math.Pow(10, float64(x)/20))
+			case "pan":
+				// -100 (left) .. 100 (right)
+				z.Pan = core.Clamp((x+100)/200, 0, 1)
+			case "amp_veltrack":
+				// percent
+				z.VelTrack = core.Clamp(x/100, 0, 1)
+			case "ampeg_attack":
+				z.Attack = x
+			case "ampeg_decay":
+				z.Decay = x
+			case "ampeg_sustain":
+				// percent
+				z.Sustain = core.Clamp(x/100, 0, 1)
+			case "ampeg_release":
+				z.Release = x
+			}
+		case "loop_mode":
+			z.Loop = -1
+			for i, name := range loopModeName {
+				if v == name {
+					z.Loop = LoopMode(i)
+				}
+			}
+			if z.Loop < 0 {
+				err = fmt.Errorf("bad loop_mode \"%s\"", v)
+			}
+		case "trigger":
+			switch v {
+			case "attack":
+				z.OnRelease = false
+			case "release":
+				z.OnRelease = true
+			default:
+				log.Info.Printf("unsupported trigger \"%s\"", v)
+			}
+		default:
+			log.Info.Printf("unsupported opcode %s", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := op["loop_mode"]; !ok && z.LoopEnd != 0 {
+		// loop if there are loop points
+		z.Loop = LoopContinuous
+	}
+	if z.Loop == LoopContinuous || z.Loop == LoopSustain {
+		if z.LoopEnd == 0 {
+			// no loop points, loop the whole sample
+			z.LoopStart, z.LoopEnd = 0, len(s.Data)
+		}
+		if !z.looped() {
+			return nil, fmt.Errorf("bad loop points %d..%d", z.LoopStart, z.LoopEnd)
+		}
+	}
+	if z.OnRelease {
+		// there is no note off for a release triggered zone
+		z.Loop = LoopOneShot
+	}
+	return z, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ParseSFZ returns an instrument from SFZ text. Sample paths are relative to dir.
+func ParseSFZ(text, dir string) (*Instrument, error) {
+	control, regions := parseSFZ(text)
+	l := &sfzLoader{
+		dir:     filepath.Join(dir, filepath.FromSlash(strings.Replace(control["default_path"], "\\", "/", -1))),
+		samples: make(map[string]*Sample),
+	}
+	inst := &Instrument{}
+	for i, op := range regions {
+		z, err := l.zone(op)
+		if err != nil {
+			return nil, fmt.Errorf("sfz: region %d: %s", i, err)
+		}
+		inst.Zones = append(inst.Zones, z)
+	}
+	if len(inst.Zones) == 0 {
+		return nil, errors.New("sfz: no regions")
+	}
+	return inst, nil
+}
+
+// LoadSFZ returns an instrument from an SFZ file.
+func LoadSFZ(path string) (*Instrument, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := ParseSFZ(string(buf), filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return inst, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,237 @@
+//-----------------------------------------------------------------------------
+/*
+
+SFZ Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_ParseNote(t *testing.T) {
+	tests := []struct {
+		s    string
+		note int
+	}{
+		{"60", 60},
+		{"c4", 60},
+		{"C4", 60},
+		{"c#4", 61},
+		{"db4", 61},
+		{"a4", 69},
+		{"c-1", 0},
+		{"g9", 127},
+	}
+	for _, v := range tests {
+		note, err := parseNote(v.s)
+		if err != nil {
+			t.Errorf("%s: %s", v.s, err)
+		} else if note != v.note {
+			t.Errorf("%s: note %d, expected %d", v.s, note, v.note)
+		}
+	}
+	for _, s := range []string{"128", "h4", "c", "g#9", "cx"} {
+		if _, err := parseNote(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+const testSFZ = `
+// test instrument
+<control> default_path=samples/
+<global> ampeg_release=0.5
+/* piano
+   zones */
+<group> lovel=1 hivel=63 volume=-6
+<region> sample=soft piano.wav lokey=c3 hikey=b3 pitch_keycenter=c4
+<region> sample=soft piano.wav lokey=c4 hikey=b4 pitch_keycenter=c4 pan=-100
+<group> lovel=64
+<region> sample=loud.wav key=60 tune=-10 transpose=1 loop_mode=one_shot
+<region> sample=loud.wav key=61 ampeg_sustain=50 trigger=release
+<group>
+<region> sample=loop.wav loop_start=100 loop_end=199
+<region> sample=loop.wav loop_mode=loop_sustain
+<curve> v000=0 v127=1
+`
+
+// writeSamples writes the test samples, and returns the directory.
+func writeSamples(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sfz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "samples"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"soft piano.wav": sineWave(48000, 480, 4800, nil),
+		"loud.wav":       sineWave(48000, 480, 4800, nil),
+		"loop.wav":       sineWave(48000, 480, 4800, nil),
+	}
+	for name, buf := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "samples", name), buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func Test_SFZ(t *testing.T) {
+	dir := writeSamples(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.sfz")
+	if err := ioutil.WriteFile(path, []byte(testSFZ), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := LoadSFZ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inst.Zones) != 6 {
+		t.Fatalf("%d zones, expected 6", len(inst.Zones))
+	}
+	z := inst.Zones
+	// shared samples
+	if z[0].Sample != z[1].Sample || z[0].Sample == z[2].Sample {
+		t.Errorf("samples are not shared")
+	}
+	// group and global opcodes
+	if z[1].LoKey != 60 || z[1].HiKey != 71 || z[1].LoVel != 1 || z[1].HiVel != 63 || z[1].Root != 60 {
+		t.Errorf("bad zone 1 keys %d..%d velocity %d..%d root %d", z[1].LoKey, z[1].HiKey, z[1].LoVel, z[1].HiVel, z[1].Root)
+	}
+	if math.Abs(float64(z[1].Gain)-0.501) > 1e-3 || z[1].Pan != 0 || z[1].Release != 0.5 {
+		t.Errorf("bad zone 1 gain %f pan %f release %f", z[1].Gain, z[1].Pan, z[1].Release)
+	}
+	// key, tuning, velocity
+	if z[2].LoKey != 60 || z[2].HiKey != 60 || z[2].Root != 60 || z[2].Tune != 90 || z[2].LoVel != 64 || z[2].HiVel != 127 {
+		t.Errorf("bad zone 2 keys %d..%d root %d tune %f velocity %d..%d", z[2].LoKey, z[2].HiKey, z[2].Root, z[2].Tune, z[2].LoVel, z[2].HiVel)
+	}
+	if z[2].Loop != LoopOneShot || z[2].Gain != 1 || z[2].Pan != 0.5 {
+		t.Errorf("bad zone 2 loop %s gain %f pan %f", z[2].Loop, z[2].Gain, z[2].Pan)
+	}
+	// release trigger
+	if !z[3].OnRelease || z[3].Loop != LoopOneShot || z[3].Sustain != 0.5 {
+		t.Errorf("bad zone 3 trigger %v loop %s sustain %f", z[3].OnRelease, z[3].Loop, z[3].Sustain)
+	}
+	// loops
+	if z[4].Loop != LoopContinuous || z[4].LoopStart != 100 || z[4].LoopEnd != 200 || z[4].LoVel != 0 {
+		t.Errorf("bad zone 4 loop %s %d..%d", z[4].Loop, z[4].LoopStart, z[4].LoopEnd)
+	}
+	if z[5].Loop != LoopSustain || z[5].LoopStart != 0 || z[5].LoopEnd != 4800 {
+		t.Errorf("bad zone 5 loop %s %d..%d", z[5].Loop, z[5].LoopStart, z[5].LoopEnd)
+	}
+	// errors
+	for _, text := range []string{
+		"",
+		"<region> lokey=60",
+		"<region> sample=missing.wav",
+		"<region> sample=samples/loud.wav lokey=x",
+		"<region> sample=samples/loud.wav loop_mode=forever",
+		"<region> sample=samples/loud.wav loop_start=0 loop_end=5000",
+	} {
+		if _, err := ParseSFZ(text, dir); err == nil {
+			t.Errorf("\"%s\": expected an error", text)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// renderStereo returns the left and right channel output of a module.
+func renderStereo(m core.Module, n int) ([]float64, []float64) {
+	var l, r []float64
+	for len(l) < n {
+		var b0, b1 core.Buf
+		m.Process(&b0, &b1)
+		for i := range b0 {
+			l = append(l, float64(b0[i]))
+			r = append(r, float64(b1[i]))
+		}
+	}
+	return l[:n], r[:n]
+}
+
+// power returns the mean square of a signal.
+func power(x []float64) float64 {
+	var p float64
+	for _, v := range x {
+		p += v * v
+	}
+	return p / float64(len(x))
+}
+
+func Test_Sampler(t *testing.T) {
+	dir := writeSamples(t)
+	defer os.RemoveAll(dir)
+	inst, err := ParseSFZ(`
+<region> sample=samples/loud.wav key=60 pan=-100 loop_mode=loop_continuous ampeg_release=0.01
+<region> sample=samples/soft piano.wav key=60 trigger=release pan=100
+`, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := core.NewSynth()
+	m := NewSampler(s, 0, inst, 8)
+	n := core.AudioSampleFrequency / 20
+	// no output
+	l, r := renderStereo(m, n)
+	if power(l) != 0 || power(r) != 0 {
+		t.Errorf("output without a note")
+	}
+	// note on, left channel
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 127))
+	l, r = renderStereo(m, n)
+	if math.Abs(power(l)-0.5) > 1e-2 || power(r) > 1e-6 {
+		t.Errorf("note on: left power %f right power %f", power(l), power(r))
+	}
+	// note off, release triggered on the right channel
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, 60, 0))
+	l, r = renderStereo(m, n)
+	if math.Abs(power(r[n/2:])-0.5) > 1e-2 || power(l[n/2:]) > 1e-6 {
+		t.Errorf("note off: left power %f right power %f", power(l[n/2:]), power(r[n/2:]))
+	}
+	// the release sample plays to the end (0.1 secs)
+	renderStereo(m, n)
+	l, r = renderStereo(m, n)
+	if power(l) != 0 || power(r) != 0 {
+		t.Errorf("output after the release")
+	}
+	if len(m.Child()) != 0 {
+		t.Errorf("%d active voices, expected 0", len(m.Child()))
+	}
+	// no release trigger without a note on
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOff, 0, 60, 0))
+	l, r = renderStereo(m, n)
+	if power(l) != 0 || power(r) != 0 {
+		t.Errorf("output for a note off without a note on")
+	}
+	// velocity tracking, gain is velocity squared
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 64))
+	l, _ = renderStereo(m, n)
+	k := math.Pow(64.0/127.0, 4)
+	if math.Abs(power(l)-0.5*k) > 1e-2*k {
+		t.Errorf("velocity 64: left power %f, expected %f", power(l), 0.5*k)
+	}
+	// no instrument
+	m = NewSampler(s, 0, nil, 8)
+	core.EventIn(m, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, 60, 127))
+	l, r = renderStereo(m, n)
+	if power(l) != 0 || power(r) != 0 {
+		t.Errorf("output without an instrument")
+	}
+}
+
+//-----------------------------------------------------------------------------
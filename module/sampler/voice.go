@@ -0,0 +1,211 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sampler Voice
+
+Plays the sample zone for the note and velocity with an ADSR envelope.
+The sample is pitch shifted from the zone root note with cubic (hermite)
+interpolation.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/env"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var samplerVoiceInfo = core.ModuleInfo{
+	Name: "samplerVoice",
+	In: []core.PortInfo{
+		{"note", "note value", core.PortTypeFloat, samplerVoiceNote},
+		{"gate", "voice gate, attack(>0) or release(=0)", core.PortTypeFloat, samplerVoiceGate},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *samplerVoice) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// hermite returns the 4-point, 3rd-order hermite interpolation of x1..x2.
+func hermite(x0, x1, x2, x3, t float32) float32 {
+	c1 := 0.5 * (x2 - x0)
+	c2 := x0 - 2.5*x1 + 2*x2 - 0.5*x3
+	c3 := 0.5*(x3-x0) + 1.5*(x1-x2)
+	return ((c3*t+c2)*t+c1)*t + x1
+}
+
+//-----------------------------------------------------------------------------
+
+type samplerVoice struct {
+	info   core.ModuleInfo // module info
+	zones  []*Zone         // sample zones
+	zone   *Zone           // current zone
+	adsr   core.Module     // amplitude envelope
+	note   float32         // current note
+	pos    float64         // sample position
+	step   float64         // sample position step per output sample
+	loop   bool            // currently looping
+	active bool            // the voice is playing
+}
+
+// NewVoice returns a sampler voice for a set of sample zones.
+func NewVoice(s *core.Synth, zones []*Zone) core.Module {
+	log.Info.Printf("")
+	m := &samplerVoice{
+		info:  samplerVoiceInfo,
+		zones: zones,
+		adsr:  env.NewADSR(s),
+	}
+	return s.Register(m)
+}
+
+// Child returns the child modules of this module.
+func (m *samplerVoice) Child() []core.Module {
+	return []core.Module{m.adsr}
+}
+
+// Stop performs any cleanup of a module.
+func (m *samplerVoice) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+
+// lookup returns the zone for a note and velocity.
+func (m *samplerVoice) lookup(note, vel int) *Zone {
+	for _, z := range m.zones {
+		if z.match(note, vel) {
+			return z
+		}
+	}
+	return nil
+}
+
+// setPitch sets the sample step for the current note.
+func (m *samplerVoice) setPitch() {
+	z := m.zone
+	if z == nil {
+		return
+	}
+	s := m.info.Synth
+	// frequency ratio from the root note (using the synth tuning)
+	k := float64(s.NoteToFrequency(m.note)) / float64(s.NoteToFrequency(float32(z.Root)))
+	k *= math.Pow(2, float64(z.Tune)/1200)
+	m.step = k * float64(z.Sample.Rate) / core.AudioSampleFrequency
+}
+
+// noteOn starts the voice with a velocity (0..127).
+func (m *samplerVoice) noteOn(vel int) {
+	note := int(math.Floor(float64(m.note) + 0.5))
+	z := m.lookup(note, vel)
+	if z == nil {
+		log.Info.Printf("no zone for note %d velocity %d", note, vel)
+		m.active = false
+		return
+	}
+	m.zone = z
+	m.setPitch()
+	m.pos = 0
+	m.loop = z.looped() && (z.Loop == LoopContinuous || z.Loop == LoopSustain)
+	m.active = true
+	// start the envelope
+	core.EventInFloat(m.adsr, "attack", z.Attack)
+	core.EventInFloat(m.adsr, "decay", z.Decay)
+	core.EventInFloat(m.adsr, "sustain", z.Sustain)
+	core.EventInFloat(m.adsr, "release", z.Release)
+	core.EventInFloat(m.adsr, "gate", 1)
+}
+
+// noteOff releases the voice.
+func (m *samplerVoice) noteOff() {
+	if !m.active || m.zone.Loop == LoopOneShot {
+		return
+	}
+	if m.zone.Loop == LoopSustain {
+		// play on to the end of the sample
+		m.loop = false
+	}
+	core.EventInFloat(m.adsr, "gate", 0)
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func samplerVoiceNote(cm core.Module, e *core.Event) {
+	m := cm.(*samplerVoice)
+	m.note = e.GetEventFloat().Val
+	m.setPitch()
+}
+
+func samplerVoiceGate(cm core.Module, e *core.Event) {
+	m := cm.(*samplerVoice)
+	gate := e.GetEventFloat().Val
+	log.Info.Printf("gate %f", gate)
+	if gate != 0 {
+		m.noteOn(int(gate*127 + 0.5))
+	} else {
+		m.noteOff()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// sample returns the sample value at index i (with looping).
+func (m *samplerVoice) sample(i int) float32 {
+	z := m.zone
+	if m.loop && i >= z.LoopEnd {
+		i = z.LoopStart + (i-z.LoopStart)%(z.LoopEnd-z.LoopStart)
+	}
+	if i < 0 || i >= len(z.Sample.Data) {
+		return 0
+	}
+	return z.Sample.Data[i]
+}
+
+// Process runs the module DSP.
+func (m *samplerVoice) Process(buf ...*core.Buf) bool {
+	if !m.active {
+		return false
+	}
+	var env core.Buf
+	if !m.adsr.Process(&env) {
+		m.active = false
+		return false
+	}
+	z := m.zone
+	out := buf[0]
+	for i := range out {
+		if m.loop && m.pos >= float64(z.LoopEnd) {
+			m.pos -= float64(z.LoopEnd - z.LoopStart)
+		}
+		j := int(m.pos)
+		if j >= len(z.Sample.Data) {
+			// end of the sample
+			m.active = false
+			for ; i < len(out); i++ {
+				out[i] = 0
+			}
+			break
+		}
+		t := float32(m.pos - float64(j))
+		x := hermite(m.sample(j-1), m.sample(j), m.sample(j+1), m.sample(j+2), t)
+		out[i] = z.Gain * env[i] * x
+		m.pos += m.step
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,145 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sampler Voice Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/midi"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Hermite(t *testing.T) {
+	// passes through the sample points
+	if y := hermite(3, -1, 2, 5, 0); y != -1 {
+		t.Errorf("hermite(0) is %f, expected -1", y)
+	}
+	if y := hermite(3, -1, 2, 5, 1); y != 2 {
+		t.Errorf("hermite(1) is %f, expected 2", y)
+	}
+	for _, x := range []float32{0.25, 0.5, 0.75} {
+		// exact for a line
+		y := hermite(-1, 0, 1, 2, x)
+		if math.Abs(float64(y-x)) > 1e-6 {
+			t.Errorf("hermite(%f) is %f, expected %f", x, y, x)
+		}
+	}
+}
+
+// render returns the output of a module, and true if it was active for all buffers.
+func render(m core.Module, n int) ([]float64, bool) {
+	var x []float64
+	active := true
+	for len(x) < n {
+		var buf core.Buf
+		if !m.Process(&buf) {
+			active = false
+		}
+		for _, v := range buf {
+			x = append(x, float64(v))
+		}
+	}
+	return x[:n], active
+}
+
+// zeroCrossings returns the number of rising zero crossings.
+func zeroCrossings(x []float64) int {
+	n := 0
+	for i := 1; i < len(x); i++ {
+		if x[i-1] < 0 && x[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func Test_VoicePitch(t *testing.T) {
+	// 100 sample cycles at 44100 Hz, continuous loop over the whole sample
+	smp := parseSample(t, sineWave(44100, 441, 10000, smplChunk(69, 0, true, 0, 9999)))
+	z := NewZone(smp)
+	z.Loop = LoopContinuous
+	for _, note := range []uint8{57, 69, 81} {
+		s := core.NewSynth()
+		p := midi.NewPoly(s, 0, func(s *core.Synth) core.Module { return NewVoice(s, []*Zone{z}) }, 4)
+		core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, note, 100))
+		// 1 second
+		x, _ := render(p, core.AudioSampleFrequency)
+		f := 441 * math.Pow(2, float64(int(note)-69)/12)
+		n := zeroCrossings(x)
+		if math.Abs(float64(n)-f) > 2 {
+			t.Errorf("note %d: %d cycles, expected %f", note, n, f)
+		}
+	}
+}
+
+func Test_VoiceLoop(t *testing.T) {
+	// 0.5 seconds at 48000 Hz
+	smp := parseSample(t, sineWave(48000, 480, 24000, smplChunk(60, 0, true, 4000, 4999)))
+	s := core.NewSynth()
+	for _, mode := range []LoopMode{LoopNone, LoopOneShot, LoopContinuous, LoopSustain} {
+		z := NewZone(smp)
+		z.Loop = mode
+		z.Release = 0.2
+		v := NewVoice(s, []*Zone{z})
+		core.EventInFloat(v, "note", 60)
+		core.EventInFloat(v, "gate", 1)
+		// held for 1 second
+		_, held := render(v, core.AudioSampleFrequency)
+		// released for 1 second
+		core.EventInFloat(v, "gate", 0)
+		_, released := render(v, core.AudioSampleFrequency)
+		expected := mode == LoopContinuous || mode == LoopSustain
+		if held != expected {
+			t.Errorf("%s: active for the whole note is %v, expected %v", mode, held, expected)
+		}
+		if released {
+			t.Errorf("%s: still active after the release", mode)
+		}
+	}
+}
+
+func Test_VoiceZones(t *testing.T) {
+	smp := parseSample(t, sineWave(48000, 480, 48000, nil))
+	soft := NewZone(smp)
+	soft.HiVel = 63
+	soft.Gain = 0.25
+	loud := NewZone(smp)
+	loud.LoVel = 64
+	high := NewZone(smp)
+	high.LoKey = 72
+	high.Gain = 0.5
+	zones := []*Zone{high, soft, loud}
+	s := core.NewSynth()
+	tests := []struct {
+		note uint8
+		vel  uint8
+		peak float64
+	}{
+		{60, 20, 0.25},
+		{60, 100, 1},
+		{72, 100, 0.5},
+	}
+	for _, v := range tests {
+		p := midi.NewPoly(s, 0, func(s *core.Synth) core.Module { return NewVoice(s, zones) }, 4)
+		core.EventIn(p, "midi", core.NewEventMIDIChannel(core.EventMIDINoteOn, 0, v.note, v.vel))
+		x, _ := render(p, core.AudioSampleFrequency/10)
+		var peak float64
+		for i := range x {
+			peak = math.Max(peak, math.Abs(x[i]))
+		}
+		if math.Abs(peak-v.peak) > 1e-2 {
+			t.Errorf("note %d velocity %d: peak %f, expected %f", v.note, v.vel, peak, v.peak)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
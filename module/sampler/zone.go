@@ -0,0 +1,94 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sample Zones
+
+A zone maps a sample to a key range and a velocity range, and sets how the
+sample is played.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sampler
+
+import "fmt"
+
+//-----------------------------------------------------------------------------
+
+// LoopMode is the sample loop mode.
+type LoopMode int
+
+// sample loop modes
+const (
+	LoopNone       LoopMode = iota // play the sample once, stop on release
+	LoopOneShot                    // play the whole sample, ignore the release
+	LoopContinuous                 // loop until the end of the release
+	LoopSustain                    // loop until the release, then play to the end
+)
+
+var loopModeName = []string{"no_loop", "one_shot", "loop_continuous", "loop_sustain"}
+
+func (m LoopMode) String() string {
+	if int(m) < len(loopModeName) {
+		return loopModeName[m]
+	}
+	return fmt.Sprintf("LoopMode(%d)", int(m))
+}
+
+//-----------------------------------------------------------------------------
+
+// Zone is a sample mapped to a key and velocity range.
+type Zone struct {
+	Sample    *Sample  // sample data
+	LoKey     int      // lowest MIDI note
+	HiKey     int      // highest MIDI note
+	LoVel     int      // lowest velocity
+	HiVel     int      // highest velocity
+	Root      int      // MIDI note that plays the sample at the recorded pitch
+	Tune      float32  // tuning (cents)
+	Gain      float32  // linear gain
+	Pan       float32  // left/right pan (0 == left, 1 == right)
+	VelTrack  float32  // velocity to gain tracking (0 == none, 1 == gain is velocity squared)
+	Loop      LoopMode // loop mode
+	LoopStart int      // loop start
+	LoopEnd   int      // loop end (one past the last sample of the loop)
+	Attack    float32  // attack time (secs)
+	Decay     float32  // decay time (secs)
+	Sustain   float32  // sustain level 0..1
+	Release   float32  // release time (secs)
+	OnRelease bool     // the zone is played on the note release
+}
+
+// NewZone returns a zone for a sample covering all notes and velocities.
+// Samples with loop points have a sustain loop.
+func NewZone(s *Sample) *Zone {
+	z := &Zone{
+		Sample:    s,
+		HiKey:     127,
+		HiVel:     127,
+		Root:      s.Root,
+		Tune:      -s.Tune,
+		Gain:      1,
+		Pan:       0.5,
+		LoopStart: s.LoopStart,
+		LoopEnd:   s.LoopEnd,
+		Sustain:   1,
+		Release:   0.1,
+	}
+	if s.LoopEnd != 0 {
+		z.Loop = LoopSustain
+	}
+	return z
+}
+
+// match returns true if the zone is used for a note and velocity.
+func (z *Zone) match(note, vel int) bool {
+	return note >= z.LoKey && note <= z.HiKey && vel >= z.LoVel && vel <= z.HiVel
+}
+
+// looped returns true if the zone has usable loop points.
+func (z *Zone) looped() bool {
+	return z.LoopEnd > z.LoopStart && z.LoopStart >= 0 && z.LoopEnd <= len(z.Sample.Data)
+}
+
+//-----------------------------------------------------------------------------
@@ -3,6 +3,9 @@
 
 Basic Sequencer
 
+The bpm port sets the synth tempo. The sequencer ticks at the synth tempo,
+so tempo synced modules (e.g. arpeggiators, LFOs) stay in time with it.
+
 */
 //-----------------------------------------------------------------------------
 
@@ -135,11 +138,10 @@ type seqStateMachine struct {
 }
 
 type basicSeq struct {
-	info        core.ModuleInfo  // module info
-	secsPerTick float32          // seconds per tick
-	tickError   float32          // current tick error
-	ticks       uint             // full ticks
-	sm          *seqStateMachine // state machine
+	info      core.ModuleInfo  // module info
+	tickError float32          // current tick error
+	ticks     uint             // full ticks
+	sm        *seqStateMachine // state machine
 }
 
 // NewSequencer returns a basic sequencer module.
@@ -175,7 +177,7 @@ func seqPortBpm(cm core.Module, e *core.Event) {
 	m := cm.(*basicSeq)
 	bpm := core.Clamp(e.GetEventFloat().Val, core.MinBeatsPerMin, core.MaxBeatsPerMin)
 	log.Info.Printf("set bpm %f", bpm)
-	m.secsPerTick = core.SecsPerMin / (bpm * ticksPerBeat)
+	m.info.Synth.SetTempo(bpm)
 }
 
 func seqPortCtrl(cm core.Module, e *core.Event) {
@@ -208,9 +210,10 @@ func (m *basicSeq) Process(buf ...*core.Buf) bool {
 	// The desired BPM will generally not correspond to an integral number
 	// of audio blocks, so accumulate an error and tick when needed.
 	// ie- Bresenham style.
+	secsPerTick := core.SecsPerMin / (m.info.Synth.Tempo() * ticksPerBeat)
 	m.tickError += core.SecsPerAudioBuffer
-	if m.tickError > m.secsPerTick {
-		m.tickError -= m.secsPerTick
+	if m.tickError > secsPerTick {
+		m.tickError -= secsPerTick
 		m.ticks++
 		// tick the state machine
 		m.tick(m.sm)
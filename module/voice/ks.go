@@ -75,7 +75,7 @@ func ksVoiceGate(cm core.Module, e *core.Event) {
 
 func ksVoiceNote(cm core.Module, e *core.Event) {
 	m := cm.(*ksVoice)
-	f := core.MIDIToFrequency(e.GetEventFloat().Val)
+	f := m.info.Synth.NoteToFrequency(e.GetEventFloat().Val)
 	core.EventInFloat(m.ks, "frequency", f)
 }
 
@@ -84,7 +84,7 @@ func ksVoiceNote(cm core.Module, e *core.Event) {
 // Process runs the module DSP.
 func (m *ksVoice) Process(buf ...*core.Buf) bool {
 	out := buf[0]
-	m.ks.Process(out)
+	m.ks.Process(nil, out)
 	return true
 }
 
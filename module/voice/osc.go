@@ -40,6 +40,7 @@ type oscVoice struct {
 	info core.ModuleInfo // module info
 	adsr core.Module     // adsr envelope
 	osc  core.Module     // oscillator
+	obuf []*core.Buf     // oscillator buffers (unused audio inputs are nil)
 }
 
 // NewOsc returns an oscillator voice module.
@@ -62,6 +63,7 @@ func NewOsc(s *core.Synth, osc core.Module) core.Module {
 		info: oscVoiceInfo,
 		adsr: adsr,
 		osc:  osc,
+		obuf: make([]*core.Buf, core.NumAudioIn(osc)+1),
 	}
 	return s.Register(m)
 }
@@ -85,7 +87,7 @@ func oscVoiceGate(cm core.Module, e *core.Event) {
 
 func oscVoiceNote(cm core.Module, e *core.Event) {
 	m := cm.(*oscVoice)
-	f := core.MIDIToFrequency(e.GetEventFloat().Val)
+	f := m.info.Synth.NoteToFrequency(e.GetEventFloat().Val)
 	core.EventInFloat(m.osc, "frequency", f)
 }
 
@@ -101,7 +103,8 @@ func (m *oscVoice) Process(buf ...*core.Buf) bool {
 	}
 	out := buf[0]
 	// generate wave
-	m.osc.Process(out)
+	m.obuf[len(m.obuf)-1] = out
+	m.osc.Process(m.obuf...)
 	// apply envelope
 	out.Mul(&env)
 	return true
@@ -0,0 +1,131 @@
+//-----------------------------------------------------------------------------
+/*
+
+Percussion Voice
+
+This provides some controls and defaults for the modal resonator and banded
+waveguide percussion oscillators. The voice is inactive once the strike has
+decayed to silence.
+
+A banded waveguide is silent until the strike has gone around its delay lines,
+so the voice tracks a decaying peak level rather than the level of a single
+buffer. A strike sets the peak to 1, and it falls to silence in percHold
+seconds unless the output holds it up.
+
+*/
+//-----------------------------------------------------------------------------
+
+package voice
+
+import (
+	"math"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/osc"
+	"github.com/deadsy/babi/utils/log"
+)
+
+//-----------------------------------------------------------------------------
+
+var percVoiceInfo = core.ModuleInfo{
+	Name: "percVoice",
+	In: []core.PortInfo{
+		{"gate", "strike level (0..1), 0 is damp", core.PortTypeFloat, percVoiceGate},
+		{"note", "midi note value", core.PortTypeFloat, percVoiceNote},
+	},
+	Out: []core.PortInfo{
+		{"out", "output", core.PortTypeAudio, nil},
+	},
+}
+
+// Info returns the module information.
+func (m *percVoice) Info() *core.ModuleInfo {
+	return &m.info
+}
+
+//-----------------------------------------------------------------------------
+
+// percSilence is the output level below which the voice is inactive (-80dB).
+const percSilence = 1e-4
+
+// percHold is the time (secs) for the peak level to fall from 1 to silence.
+const percHold = 0.25
+
+type percVoice struct {
+	info core.ModuleInfo // module info
+	osc  core.Module     // percussion oscillator
+	peak float32         // decaying peak output level
+	k    float32         // peak decay per buffer
+}
+
+// newPerc returns a percussion voice module for a percussion oscillator.
+func newPerc(s *core.Synth, perc core.Module) core.Module {
+	// oscillator defaults
+	core.EventInFloat(perc, "decay", 1.5)
+	core.EventInFloat(perc, "damping", 0.5)
+	m := &percVoice{
+		info: percVoiceInfo,
+		osc:  perc,
+		k:    float32(math.Pow(percSilence, core.AudioBufferSize/(percHold*core.AudioSampleFrequency))),
+	}
+	return s.Register(m)
+}
+
+// NewModal returns a modal resonator percussion voice module.
+func NewModal(s *core.Synth, modes []osc.Mode) core.Module {
+	log.Info.Printf("new voice")
+	return newPerc(s, osc.NewModal(s, modes))
+}
+
+// NewBandedWaveguide returns a banded waveguide percussion voice module.
+func NewBandedWaveguide(s *core.Synth, modes []osc.Mode) core.Module {
+	log.Info.Printf("new voice")
+	return newPerc(s, osc.NewBandedWaveguide(s, modes))
+}
+
+// Child returns the child modules of this module.
+func (m *percVoice) Child() []core.Module {
+	return []core.Module{m.osc}
+}
+
+// Stop performs any cleanup of a module.
+func (m *percVoice) Stop() {
+}
+
+//-----------------------------------------------------------------------------
+// Port Events
+
+func percVoiceGate(cm core.Module, e *core.Event) {
+	m := cm.(*percVoice)
+	if e.GetEventFloat().Val > 0 {
+		m.peak = 1
+	}
+	core.EventIn(m.osc, "gate", e)
+}
+
+func percVoiceNote(cm core.Module, e *core.Event) {
+	m := cm.(*percVoice)
+	f := m.info.Synth.NoteToFrequency(e.GetEventFloat().Val)
+	core.EventInFloat(m.osc, "frequency", f)
+}
+
+//-----------------------------------------------------------------------------
+
+// Process runs the module DSP.
+func (m *percVoice) Process(buf ...*core.Buf) bool {
+	if m.peak < percSilence {
+		return false
+	}
+	out := buf[0]
+	m.osc.Process(nil, out)
+	// track the decaying peak level
+	m.peak *= m.k
+	for _, x := range out {
+		if x := core.Abs(x); x > m.peak {
+			m.peak = x
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,59 @@
+//-----------------------------------------------------------------------------
+/*
+
+Percussion Voice Testing
+
+*/
+//-----------------------------------------------------------------------------
+
+package voice
+
+import (
+	"testing"
+
+	"github.com/deadsy/babi/core"
+	"github.com/deadsy/babi/module/osc"
+)
+
+//-----------------------------------------------------------------------------
+
+// strike returns the peak output level of a struck percussion voice,
+// and the number of buffers until it is inactive.
+func strike(m core.Module, note float32) (float32, int) {
+	core.EventInFloat(m, "note", note)
+	core.EventInFloat(m, "gate", 1)
+	var peak float32
+	n := 0
+	for ; n < 10*core.AudioSampleFrequency/core.AudioBufferSize; n++ {
+		var out core.Buf
+		if !m.Process(&out) {
+			break
+		}
+		for _, x := range out {
+			if x := core.Abs(x); x > peak {
+				peak = x
+			}
+		}
+	}
+	return peak, n
+}
+
+func Test_PercActive(t *testing.T) {
+	s := core.NewSynth()
+	for _, note := range []float32{24, 36, 60, 96} {
+		for i, m := range []core.Module{
+			NewModal(s, osc.ModalMembrane),
+			NewBandedWaveguide(s, osc.ModalMembrane),
+		} {
+			peak, n := strike(m, note)
+			if peak < 0.01 {
+				t.Errorf("voice %d note %f: peak level %f", i, note, peak)
+			}
+			if n == 10*core.AudioSampleFrequency/core.AudioBufferSize {
+				t.Errorf("voice %d note %f: still active", i, note)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------